@@ -0,0 +1,128 @@
+package hang
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// AccessLogFormat is the format of the access log lines
+type AccessLogFormat int
+
+const (
+	// StructuredAccessLog logs through the handler Logger with fields (default)
+	StructuredAccessLog AccessLogFormat = iota
+	// CombinedAccessLog writes Apache combined log format lines
+	CombinedAccessLog
+	// JSONAccessLog writes one JSON object per line
+	JSONAccessLog
+)
+
+// AccessLogOptions configures the access log middleware
+type AccessLogOptions struct {
+	Format AccessLogFormat
+	// Destination of the combined and JSON lines, the handler Logger (at
+	// info level) if nil
+	Output io.Writer
+}
+
+// AccessLogEntry contains the data logged for every request
+type AccessLogEntry struct {
+	Time       time.Time `json:"time"`
+	Method     string    `json:"method"`
+	Path       string    `json:"path"`
+	Route      string    `json:"route"`
+	Proto      string    `json:"proto"`
+	Status     int       `json:"status"`
+	Bytes      int64     `json:"bytes"`
+	LatencyMs  float64   `json:"latency_ms"`
+	RemoteAddr string    `json:"remote_addr"`
+	UserAgent  string    `json:"user_agent"`
+	Referer    string    `json:"referer"`
+	RequestID  string    `json:"request_id"`
+}
+
+// AccessLog returns a middleware logging one line per request
+func (h *Handler) AccessLog(opts AccessLogOptions) Middleware {
+	var mu sync.Mutex
+	return func(next HandleFunc) HandleFunc {
+		return func(resp http.ResponseWriter, req *http.Request) error {
+			start := time.Now()
+			rr := NewResponseRecorder(resp)
+			err := next(rr, req)
+			id := GetRequestID(req)
+			if id == "" {
+				// Set by the RequestID middleware, if inside this one
+				id = rr.Header().Get(RequestIDHeader)
+			}
+			e := AccessLogEntry{
+				Time:       start,
+				Method:     req.Method,
+				Path:       req.URL.RequestURI(),
+				Route:      RouteFrom(req),
+				Proto:      req.Proto,
+				Status:     rr.Status,
+				Bytes:      rr.Bytes,
+				LatencyMs:  float64(time.Since(start).Microseconds()) / 1000,
+				RemoteAddr: RealIP(req),
+				UserAgent:  req.UserAgent(),
+				Referer:    req.Referer(),
+				RequestID:  id,
+			}
+			if opts.Format == StructuredAccessLog {
+				h.Log.WithFields(e.Fields()).Info("request")
+				return err
+			}
+			var line string
+			if opts.Format == CombinedAccessLog {
+				line = e.Combined()
+			} else {
+				b, _ := json.Marshal(e)
+				line = string(b)
+			}
+			if opts.Output == nil {
+				h.Log.Info(line)
+				return err
+			}
+			mu.Lock()
+			io.WriteString(opts.Output, line+"\n")
+			mu.Unlock()
+			return err
+		}
+	}
+}
+
+// Fields returns the entry as log fields
+func (e AccessLogEntry) Fields() Fields {
+	return Fields{
+		"method":     e.Method,
+		"path":       e.Path,
+		"route":      e.Route,
+		"status":     e.Status,
+		"bytes":      e.Bytes,
+		"latency_ms": e.LatencyMs,
+		"origin":     e.RemoteAddr,
+		"user_agent": e.UserAgent,
+		"request_id": e.RequestID,
+	}
+}
+
+// Combined returns the entry in Apache combined log format
+func (e AccessLogEntry) Combined() string {
+	return fmt.Sprintf("%s - - [%s] \"%s %s %s\" %d %d %q %q",
+		e.RemoteAddr,
+		e.Time.Format("02/Jan/2006:15:04:05 -0700"),
+		e.Method, e.Path, e.Proto,
+		e.Status, e.Bytes,
+		dash(e.Referer), dash(e.UserAgent))
+}
+
+func dash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
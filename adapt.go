@@ -0,0 +1,77 @@
+package hang
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+// mwErrKey carries the error of the next HandleFunc through a standard
+// library middleware
+type mwErrKey struct{}
+
+// FromHTTPHandler wraps a standard library handler into a HandleFunc
+func FromHTTPHandler(handler http.Handler) HandleFunc {
+	return func(resp http.ResponseWriter, req *http.Request) error {
+		handler.ServeHTTP(resp, req)
+		return nil
+	}
+}
+
+// Mount serves handler under prefix, e.g. a file server, a gorilla router
+// or another Handler, removing prefix from the path it sees. The original
+// path is still available in req.RequestURI.
+func (h *Handler) Mount(prefix string, handler http.Handler) error {
+	prefix = strings.Trim(prefix, "/")
+	route := "*"
+	if prefix != "" {
+		route = prefix + "/*"
+	}
+	return h.AddRoute(route, func(resp http.ResponseWriter, req *http.Request) error {
+		r := req.Clone(req.Context())
+		r.URL.Path = "/" + RouteSuffix(req)
+		r.URL.RawPath = ""
+		handler.ServeHTTP(resp, r)
+		return nil
+	})
+}
+
+// FromHTTPMiddleware adapts a standard library middleware, as used by
+// gorilla/handlers, rs/cors and most of the ecosystem, to a Middleware.
+// The error returned by the wrapped HandleFunc goes through it.
+func FromHTTPMiddleware(mw func(http.Handler) http.Handler) Middleware {
+	return func(next HandleFunc) HandleFunc {
+		handler := mw(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+			err := next(resp, req)
+			if p, ok := req.Context().Value(mwErrKey{}).(*error); ok {
+				*p = err
+			}
+		}))
+		return func(resp http.ResponseWriter, req *http.Request) error {
+			var err error
+			handler.ServeHTTP(resp, req.WithContext(context.WithValue(req.Context(), mwErrKey{}, &err)))
+			return err
+		}
+	}
+}
+
+// FromNegroniMiddleware adapts a negroni style middleware, calling next to
+// continue the chain, to a Middleware
+func FromNegroniMiddleware(mw func(resp http.ResponseWriter, req *http.Request, next http.HandlerFunc)) Middleware {
+	return FromHTTPMiddleware(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+			mw(resp, req, next.ServeHTTP)
+		})
+	})
+}
+
+// ToHTTPMiddleware adapts a Middleware to a standard library one, for
+// routers other than Handler; errors are dropped
+func ToHTTPMiddleware(mw Middleware) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		handleFunc := mw(FromHTTPHandler(next))
+		return http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+			handleFunc(resp, req)
+		})
+	}
+}
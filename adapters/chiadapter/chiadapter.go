@@ -0,0 +1,59 @@
+// Package chiadapter registers the routes of a hang.Handler on a chi
+// router, to migrate between the two without rewriting the handlers
+package chiadapter
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/brunetto/hang"
+	"github.com/go-chi/chi/v5"
+	"github.com/pkg/errors"
+)
+
+// Register adds to r the routes of h, served by h itself so that
+// middleware, params and logging behave as on the Handler. Routes chi
+// can't express (regex, host bound) and the paths matching no route reach
+// h through NotFound, which answers with its default route, as the methods
+// not allowed.
+func Register(r chi.Router, h *hang.Handler) (err error) {
+	done := map[string]bool{}
+	// chi panics on invalid patterns
+	defer func() {
+		if p := recover(); p != nil {
+			err = errors.New(fmt.Sprint("can't register routes on chi: ", p))
+		}
+	}()
+	for _, spec := range h.RouteSpecs() {
+		if spec.Regex || spec.Host != "" {
+			continue
+		}
+		segs := strings.Split(spec.Path, "/")
+		for i, seg := range segs {
+			if strings.HasPrefix(seg, ":") {
+				segs[i] = "{" + seg[1:] + "}"
+			}
+		}
+		paths := []string{"/" + strings.Join(segs, "/")}
+		if spec.Wildcard {
+			prefix := "/" + strings.TrimSuffix(strings.TrimSuffix(spec.Path, "*"), "/")
+			paths = []string{prefix, strings.TrimSuffix(prefix, "/") + "/*"}
+		}
+		for _, p := range paths {
+			if done[p] {
+				continue
+			}
+			done[p] = true
+			if spec.Methods == nil {
+				r.Handle(p, h)
+				continue
+			}
+			for _, m := range spec.Methods {
+				r.Method(m, p, h)
+			}
+		}
+	}
+	r.NotFound(h.ServeHTTP)
+	r.MethodNotAllowed(h.ServeHTTP)
+	return nil
+}
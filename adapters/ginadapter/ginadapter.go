@@ -0,0 +1,60 @@
+// Package ginadapter registers the routes of a hang.Handler on a gin
+// engine, to migrate between the two without rewriting the handlers
+package ginadapter
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/brunetto/hang"
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+)
+
+// Register adds to r the routes of h, served by h itself so that
+// middleware, params and logging behave as on the Handler. Routes gin can't
+// express (regex, host bound, root wildcard) and the paths matching no
+// route reach h through NoRoute, which answers with its default route, as
+// the methods not allowed unless HandleMethodNotAllowed is set on r.
+func Register(r *gin.Engine, h *hang.Handler) (err error) {
+	var (
+		handler = gin.WrapH(h)
+		done    = map[string]bool{}
+	)
+	// gin panics on conflicting routes
+	defer func() {
+		if p := recover(); p != nil {
+			err = errors.New(fmt.Sprint("can't register routes on gin: ", p))
+		}
+	}()
+	for _, spec := range h.RouteSpecs() {
+		if spec.Regex || spec.Host != "" || spec.Path == "*" {
+			continue
+		}
+		paths := []string{"/" + spec.Path}
+		if spec.Wildcard {
+			prefix := "/" + strings.TrimSuffix(strings.TrimSuffix(spec.Path, "*"), "/")
+			paths = []string{prefix, prefix + "/*suffix"}
+		}
+		for _, p := range paths {
+			if done[p] {
+				continue
+			}
+			done[p] = true
+			if spec.Methods == nil {
+				r.Any(p, handler)
+				continue
+			}
+			for _, m := range spec.Methods {
+				r.Handle(m, p, handler)
+			}
+		}
+	}
+	r.NoRoute(func(c *gin.Context) {
+		// gin presets a 404 for NoRoute
+		c.Status(http.StatusOK)
+		h.ServeHTTP(c.Writer, c.Request)
+	})
+	return nil
+}
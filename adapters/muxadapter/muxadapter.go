@@ -0,0 +1,47 @@
+// Package muxadapter registers the routes of a hang.Handler on a gorilla
+// mux router, to migrate between the two without rewriting the handlers
+package muxadapter
+
+import (
+	"strings"
+
+	"github.com/brunetto/hang"
+	"github.com/gorilla/mux"
+)
+
+// Register adds to r the routes of h, served by h itself so that
+// middleware, params and logging behave as on the Handler. Regex routes
+// and the paths matching no route reach h through the NotFoundHandler,
+// which answers with its default route, as the methods not allowed.
+func Register(r *mux.Router, h *hang.Handler) error {
+	for _, spec := range h.RouteSpecs() {
+		if spec.Regex {
+			continue
+		}
+		route := r.NewRoute()
+		if spec.Host != "" {
+			route = route.Host(strings.Replace(spec.Host, "*", "{subdomain}", 1))
+		}
+		if spec.Wildcard {
+			route = route.PathPrefix("/" + strings.TrimSuffix(spec.Path, "*"))
+		} else {
+			segs := strings.Split(spec.Path, "/")
+			for i, seg := range segs {
+				if strings.HasPrefix(seg, ":") {
+					segs[i] = "{" + seg[1:] + "}"
+				}
+			}
+			route = route.Path("/" + strings.Join(segs, "/"))
+		}
+		if spec.Methods != nil {
+			route = route.Methods(spec.Methods...)
+		}
+		route.Handler(h)
+		if err := route.GetError(); err != nil {
+			return err
+		}
+	}
+	r.NotFoundHandler = h
+	r.MethodNotAllowedHandler = h
+	return nil
+}
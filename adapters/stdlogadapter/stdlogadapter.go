@@ -0,0 +1,26 @@
+// Package stdlogadapter adapts a standard library log.Logger to the hang.Logger interface
+package stdlogadapter
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/brunetto/hang"
+)
+
+// New returns a hang.Logger writing to lg lines like
+// "level=info msg=started key=value"; entries below minLevel are discarded
+func New(lg *log.Logger, minLevel hang.Level) hang.Logger {
+	return hang.NewFuncLogger(func(level hang.Level, msg string, fields hang.Fields) {
+		if level > minLevel {
+			return
+		}
+		var b strings.Builder
+		b.WriteString("level=" + level.String() + " msg=" + fmt.Sprintf("%q", msg))
+		for _, k := range fields.SortedKeys() {
+			b.WriteString(fmt.Sprintf(" %v=%v", k, fields[k]))
+		}
+		lg.Output(4, b.String())
+	})
+}
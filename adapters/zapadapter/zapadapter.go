@@ -0,0 +1,38 @@
+// Package zapadapter adapts a zap logger to the hang.Logger interface
+package zapadapter
+
+import (
+	"github.com/brunetto/hang"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// New returns a hang.Logger writing to lg
+func New(lg *zap.Logger) hang.Logger {
+	// Skip the adapter frames when reporting the caller
+	lg = lg.WithOptions(zap.AddCallerSkip(3))
+	return hang.NewFuncLogger(func(level hang.Level, msg string, fields hang.Fields) {
+		zf := make([]zap.Field, 0, len(fields))
+		for _, k := range fields.SortedKeys() {
+			zf = append(zf, zap.Any(k, fields[k]))
+		}
+		if ce := lg.Check(zapLevel(level), msg); ce != nil {
+			ce.Write(zf...)
+		}
+	})
+}
+
+// zapLevel maps hang levels on zap levels. Fatal and panic are logged at
+// error level because hang.NewFuncLogger takes care of exiting or panicking.
+func zapLevel(level hang.Level) zapcore.Level {
+	switch level {
+	case hang.DebugLevel:
+		return zapcore.DebugLevel
+	case hang.InfoLevel:
+		return zapcore.InfoLevel
+	case hang.WarnLevel:
+		return zapcore.WarnLevel
+	default:
+		return zapcore.ErrorLevel
+	}
+}
@@ -0,0 +1,37 @@
+// Package zerologadapter adapts a zerolog logger to the hang.Logger interface
+package zerologadapter
+
+import (
+	"github.com/brunetto/hang"
+	"github.com/rs/zerolog"
+)
+
+// New returns a hang.Logger writing to lg
+func New(lg zerolog.Logger) hang.Logger {
+	return hang.NewFuncLogger(func(level hang.Level, msg string, fields hang.Fields) {
+		ev := lg.WithLevel(zerologLevel(level))
+		if ev == nil {
+			return
+		}
+		ev.Fields(map[string]interface{}(fields)).Msg(msg)
+	})
+}
+
+// zerologLevel maps hang levels on zerolog levels. Fatal and panic are
+// logged without exiting because hang.NewFuncLogger takes care of it.
+func zerologLevel(level hang.Level) zerolog.Level {
+	switch level {
+	case hang.DebugLevel:
+		return zerolog.DebugLevel
+	case hang.InfoLevel:
+		return zerolog.InfoLevel
+	case hang.WarnLevel:
+		return zerolog.WarnLevel
+	case hang.ErrorLevel:
+		return zerolog.ErrorLevel
+	case hang.FatalLevel:
+		return zerolog.FatalLevel
+	default:
+		return zerolog.PanicLevel
+	}
+}
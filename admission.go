@@ -0,0 +1,178 @@
+package hang
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// PriorityHeader carries the priority class of a request, interactive or batch
+const PriorityHeader = "X-Request-Priority"
+
+// Priority is the admission class of a request
+type Priority int
+
+// Priority classes, from the highest
+const (
+	PriorityInteractive Priority = iota
+	PriorityBatch
+	numPriorities
+)
+
+func (p Priority) String() string {
+	if p == PriorityBatch {
+		return "batch"
+	}
+	return "interactive"
+}
+
+// ParsePriority returns the priority named s
+func ParsePriority(s string) (Priority, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "interactive":
+		return PriorityInteractive, nil
+	case "batch":
+		return PriorityBatch, nil
+	}
+	return PriorityInteractive, errors.New("unknown priority " + s)
+}
+
+// AdmissionOptions configures the admission queue
+type AdmissionOptions struct {
+	// Requests served at the same time, the others wait in their lane
+	MaxConcurrent int
+	// Requests waiting in each lane before shedding, 100 if zero
+	MaxQueue int
+	// How long a request waits to be admitted, 5s if zero
+	QueueTimeout time.Duration
+	// Priority by route; requests to other routes use the PriorityHeader,
+	// or Default if missing or invalid
+	RoutePriority map[string]Priority
+	Default       Priority
+	// Routes never queued, livecheck and readycheck if nil
+	Bypass []string
+}
+
+// admissionQueue admits the waiting requests highest priority first
+type admissionQueue struct {
+	opts    AdmissionOptions
+	mu      sync.Mutex
+	running int
+	lanes   [numPriorities][]chan struct{}
+}
+
+// AdmissionQueue returns a middleware serving at most MaxConcurrent
+// requests at once and queueing the others in priority lanes, so that
+// interactive traffic is admitted before long-running batch calls. Requests
+// not admitted in time, or finding their lane full, get a 503.
+func AdmissionQueue(opts AdmissionOptions) Middleware {
+	if opts.MaxConcurrent <= 0 {
+		opts.MaxConcurrent = 1
+	}
+	if opts.MaxQueue <= 0 {
+		opts.MaxQueue = 100
+	}
+	if opts.QueueTimeout <= 0 {
+		opts.QueueTimeout = 5 * time.Second
+	}
+	if opts.Bypass == nil {
+		opts.Bypass = []string{"livecheck", "readycheck"}
+	}
+	q := &admissionQueue{opts: opts}
+	return func(next HandleFunc) HandleFunc {
+		return func(resp http.ResponseWriter, req *http.Request) error {
+			route := RouteFrom(req)
+			if containsString(opts.Bypass, route) {
+				return next(resp, req)
+			}
+			if err := q.admit(req, q.priority(req, route)); err != nil {
+				resp.Header().Set("Retry-After", strconv.Itoa(int(opts.QueueTimeout.Seconds()+0.5)))
+				WriteError(resp, req, http.StatusServiceUnavailable, errors.New("server busy"))
+				return err
+			}
+			defer q.release()
+			return next(resp, req)
+		}
+	}
+}
+
+// priority returns the class of the request
+func (q *admissionQueue) priority(req *http.Request, route string) Priority {
+	if p, ok := q.opts.RoutePriority[route]; ok {
+		return p
+	}
+	if v := req.Header.Get(PriorityHeader); v != "" {
+		if p, err := ParsePriority(v); err == nil {
+			return p
+		}
+	}
+	return q.opts.Default
+}
+
+// admit returns when the request can be served or with an error if it
+// can't be admitted in time
+func (q *admissionQueue) admit(req *http.Request, p Priority) error {
+	if p < 0 || p >= numPriorities {
+		p = PriorityInteractive
+	}
+	q.mu.Lock()
+	if q.running < q.opts.MaxConcurrent {
+		q.running++
+		q.mu.Unlock()
+		return nil
+	}
+	if len(q.lanes[p]) >= q.opts.MaxQueue {
+		q.mu.Unlock()
+		return errors.Errorf("%v queue full", p)
+	}
+	ready := make(chan struct{})
+	q.lanes[p] = append(q.lanes[p], ready)
+	q.mu.Unlock()
+
+	timer := time.NewTimer(q.opts.QueueTimeout)
+	defer timer.Stop()
+	var err error
+	select {
+	case <-ready:
+		return nil
+	case <-timer.C:
+		err = errors.Errorf("%v request not admitted in %v", p, q.opts.QueueTimeout)
+	case <-req.Context().Done():
+		err = errors.Wrap(req.Context().Err(), "request cancelled waiting for admission")
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for i, c := range q.lanes[p] {
+		if c == ready {
+			q.lanes[p] = append(q.lanes[p][:i], q.lanes[p][i+1:]...)
+			return err
+		}
+	}
+	// Admitted meanwhile: give the slot to the next one
+	q.next()
+	return err
+}
+
+// release frees the slot of a served request
+func (q *admissionQueue) release() {
+	q.mu.Lock()
+	q.next()
+	q.mu.Unlock()
+}
+
+// next hands the slot to the first waiting request of the highest lane,
+// to be called with the lock held
+func (q *admissionQueue) next() {
+	for p := range q.lanes {
+		if len(q.lanes[p]) > 0 {
+			close(q.lanes[p][0])
+			q.lanes[p] = q.lanes[p][1:]
+			return
+		}
+	}
+	q.running--
+}
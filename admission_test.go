@@ -0,0 +1,82 @@
+package hang
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestAdmissionQueuePriority(t *testing.T) {
+	q := &admissionQueue{opts: AdmissionOptions{MaxConcurrent: 1, MaxQueue: 10, QueueTimeout: time.Second}}
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	if err := q.admit(req, PriorityBatch); err != nil {
+		t.Fatal(err)
+	}
+
+	admitted := make(chan Priority, 3)
+	wait := func(p Priority) {
+		go func() {
+			if err := q.admit(req, p); err != nil {
+				t.Error(err)
+				return
+			}
+			admitted <- p
+			q.release()
+		}()
+		// Wait for the request to be queued
+		for {
+			q.mu.Lock()
+			n := len(q.lanes[p])
+			q.mu.Unlock()
+			if n > 0 {
+				return
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+	wait(PriorityBatch)
+	wait(PriorityInteractive)
+	q.release()
+
+	if first, second := <-admitted, <-admitted; first != PriorityInteractive || second != PriorityBatch {
+		t.Errorf("got %v admitted before %v, want interactive first", first, second)
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.running != 0 {
+		t.Errorf("got %d running after all the releases, want 0", q.running)
+	}
+}
+
+func TestAdmissionQueueShedding(t *testing.T) {
+	h := testHandler(t)
+	h.Use(AdmissionQueue(AdmissionOptions{MaxConcurrent: 1, MaxQueue: 1, QueueTimeout: 50 * time.Millisecond}))
+	var (
+		started = make(chan struct{})
+		release = make(chan struct{})
+	)
+	h.AddRoute("slow", func(resp http.ResponseWriter, req *http.Request) error {
+		close(started)
+		<-release
+		return nil
+	})
+	h.AddRoute("fast", func(resp http.ResponseWriter, req *http.Request) error { return nil })
+
+	done := make(chan int)
+	go func() { done <- serve(h, http.MethodGet, "/slow", nil).Code }()
+	<-started
+	if rec := serve(h, http.MethodGet, "/fast", nil); rec.Code != http.StatusServiceUnavailable || rec.Header().Get("Retry-After") == "" {
+		t.Errorf("not admitted in time: got status %d and Retry-After %q, want %d", rec.Code, rec.Header().Get("Retry-After"), http.StatusServiceUnavailable)
+	}
+	if rec := serve(h, http.MethodGet, "/livecheck", nil); rec.Code != http.StatusOK {
+		t.Errorf("bypassed route: got status %d, want %d", rec.Code, http.StatusOK)
+	}
+	close(release)
+	if code := <-done; code != http.StatusOK {
+		t.Errorf("admitted request: got status %d, want %d", code, http.StatusOK)
+	}
+	if rec := serve(h, http.MethodGet, "/fast", nil); rec.Code != http.StatusOK {
+		t.Errorf("after release: got status %d, want %d", rec.Code, http.StatusOK)
+	}
+}
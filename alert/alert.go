@@ -0,0 +1,190 @@
+// Package alert fires alerts through notifiers (Slack, generic webhooks,
+// email) when the logger writes a fatal or panic entry, see
+// Alerter.Logger, or when the 5xx rate of a route exceeds a threshold, see
+// Alerter.ErrorRate.
+package alert
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/brunetto/hang"
+	"github.com/pkg/errors"
+)
+
+// Alert is a notification
+type Alert struct {
+	Title   string      `json:"title"`
+	Text    string      `json:"text"`
+	Service string      `json:"service"`
+	Fields  hang.Fields `json:"fields,omitempty"`
+	Time    time.Time   `json:"time"`
+}
+
+// Notifier delivers the alerts
+type Notifier interface {
+	Notify(ctx context.Context, a Alert) error
+}
+
+// Alerter sends the alerts to all its notifiers, at most one per title
+// every Cooldown
+type Alerter struct {
+	Log hang.Logger
+	// Name of the service, set in the alerts
+	Service   string
+	Notifiers []Notifier
+	// Minimum time between two alerts with the same title
+	Cooldown time.Duration
+	// Timeout of the delivery of an alert
+	Timeout time.Duration
+
+	mu   sync.Mutex
+	last map[string]time.Time
+}
+
+// New returns an Alerter logging the delivery errors on lg, with a 5m
+// cooldown and a 10s timeout
+func New(lg hang.Logger, service string, notifiers ...Notifier) *Alerter {
+	return &Alerter{
+		Log:       lg,
+		Service:   service,
+		Notifiers: notifiers,
+		Cooldown:  5 * time.Minute,
+		Timeout:   10 * time.Second,
+		last:      map[string]time.Time{},
+	}
+}
+
+// Fire sends the alert to the notifiers and waits for the delivery, unless
+// an alert with the same title was sent less than Cooldown ago
+func (a *Alerter) Fire(title, text string, fields hang.Fields) {
+	now := time.Now()
+	a.mu.Lock()
+	if last, ok := a.last[title]; ok && now.Sub(last) < a.Cooldown {
+		a.mu.Unlock()
+		return
+	}
+	a.last[title] = now
+	a.mu.Unlock()
+
+	alert := Alert{Title: title, Text: text, Service: a.Service, Fields: fields, Time: now}
+	ctx, cancel := context.WithTimeout(context.Background(), a.Timeout)
+	defer cancel()
+	var wg sync.WaitGroup
+	for _, n := range a.Notifiers {
+		wg.Add(1)
+		go func(n Notifier) {
+			defer wg.Done()
+			if err := n.Notify(ctx, alert); err != nil {
+				// Not through the alerting logger, not to loop
+				a.Log.WithFields(hang.Fields{"alert": title}).Error(errors.Wrap(err, "can't send alert"))
+			}
+		}(n)
+	}
+	wg.Wait()
+}
+
+// Logger returns a logger writing to lg and firing an alert, before the
+// process stops, for every fatal or panic entry
+func (a *Alerter) Logger(lg hang.Logger) hang.Logger {
+	return hang.HookLogger(lg, hang.FatalLevel, func(level hang.Level, msg string, fields hang.Fields) {
+		a.Fire(a.Service+": "+level.String(), msg, fields)
+	})
+}
+
+// RateOptions configures ErrorRate
+type RateOptions struct {
+	// Window the rate is computed on, 1m if zero
+	Window time.Duration
+	// Fraction of the requests answered with a 5xx firing the alert, 0.1 if zero
+	Threshold float64
+	// Minimum number of requests in the window for the rate to count, 20 if zero
+	MinRequests int
+}
+
+// ErrorRate returns a middleware firing an alert when the 5xx responses of
+// a route exceed opts.Threshold of its requests within opts.Window. The
+// errors returned without writing a response count as 500.
+func (a *Alerter) ErrorRate(opts RateOptions) hang.Middleware {
+	if opts.Window <= 0 {
+		opts.Window = time.Minute
+	}
+	if opts.Threshold <= 0 {
+		opts.Threshold = 0.1
+	}
+	if opts.MinRequests <= 0 {
+		opts.MinRequests = 20
+	}
+	var (
+		mu      sync.Mutex
+		windows = map[string]*window{}
+	)
+	return func(next hang.HandleFunc) hang.HandleFunc {
+		return func(resp http.ResponseWriter, req *http.Request) error {
+			rr, ok := resp.(*hang.ResponseRecorder)
+			if !ok {
+				rr = hang.NewResponseRecorder(resp)
+			}
+			err := next(rr, req)
+			status := rr.Status
+			if !rr.WroteHeader && err != nil {
+				status = http.StatusInternalServerError
+			}
+			route := hang.RouteFrom(req)
+			mu.Lock()
+			w, ok := windows[route]
+			if !ok {
+				w = newWindow(opts.Window)
+				windows[route] = w
+			}
+			total, failed := w.add(time.Now(), status >= 500)
+			mu.Unlock()
+			if total >= opts.MinRequests && float64(failed)/float64(total) > opts.Threshold {
+				title := fmt.Sprintf("%v: high 5xx rate on %v", a.Service, route)
+				text := fmt.Sprintf("%d of the last %d requests to %v failed in %v", failed, total, route, opts.Window)
+				go a.Fire(title, text, hang.Fields{"route": route, "requests": total, "errors": failed})
+			}
+			return err
+		}
+	}
+}
+
+// windowBuckets is the resolution of the windows
+const windowBuckets = 10
+
+// window counts the requests and the failures in a sliding time window
+type window struct {
+	width  time.Duration
+	start  [windowBuckets]time.Time
+	total  [windowBuckets]int
+	failed [windowBuckets]int
+}
+
+func newWindow(d time.Duration) *window {
+	return &window{width: d / windowBuckets}
+}
+
+// add counts a request at now and returns the totals of the window
+func (w *window) add(now time.Time, failed bool) (int, int) {
+	slot := now.Truncate(w.width)
+	i := int(slot.UnixNano()/int64(w.width)) % windowBuckets
+	if !w.start[i].Equal(slot) {
+		w.start[i], w.total[i], w.failed[i] = slot, 0, 0
+	}
+	w.total[i]++
+	if failed {
+		w.failed[i]++
+	}
+	var total, failures int
+	oldest := slot.Add(-w.width * (windowBuckets - 1))
+	for j := range w.start {
+		if !w.start[j].Before(oldest) {
+			total += w.total[j]
+			failures += w.failed[j]
+		}
+	}
+	return total, failures
+}
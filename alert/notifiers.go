@@ -0,0 +1,115 @@
+package alert
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/smtp"
+	"strings"
+
+	"github.com/brunetto/hang"
+	"github.com/pkg/errors"
+)
+
+// Webhook posts the alerts as JSON to URL
+type Webhook struct {
+	URL string
+	// Headers added to the requests, e.g. for authentication
+	Header http.Header
+	// Client for the requests, http.DefaultClient if nil
+	Client *http.Client
+}
+
+// Notify implements Notifier
+func (w Webhook) Notify(ctx context.Context, a Alert) error {
+	return postJSON(ctx, w.Client, w.URL, w.Header, a)
+}
+
+// Slack posts the alerts to a Slack incoming webhook
+type Slack struct {
+	WebhookURL string
+	// Client for the requests, http.DefaultClient if nil
+	Client *http.Client
+}
+
+// Notify implements Notifier
+func (s Slack) Notify(ctx context.Context, a Alert) error {
+	text := "*" + a.Title + "*\n" + a.Text
+	for _, k := range a.Fields.SortedKeys() {
+		text += fmt.Sprintf("\n• %v: %v", k, a.Fields[k])
+	}
+	return postJSON(ctx, s.Client, s.WebhookURL, nil, map[string]string{"text": text})
+}
+
+// postJSON posts v to url
+func postJSON(ctx context.Context, client *http.Client, url string, header http.Header, v interface{}) error {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return errors.Wrap(err, "can't encode alert")
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(b))
+	if err != nil {
+		return errors.Wrap(err, "can't create alert request")
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", hang.MIMEJSON)
+	resp, err := client.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "can't post alert")
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return errors.New("alert rejected with status " + resp.Status)
+	}
+	return nil
+}
+
+// Email sends the alerts by mail through an SMTP server
+type Email struct {
+	// Server host:port
+	Addr string
+	// Credentials for PLAIN authentication, none if Username is empty
+	Username string
+	Password string
+	From     string
+	To       []string
+}
+
+// Notify implements Notifier
+func (e Email) Notify(ctx context.Context, a Alert) error {
+	var (
+		auth smtp.Auth
+		body strings.Builder
+	)
+	if e.Username != "" {
+		host, _, _ := net.SplitHostPort(e.Addr)
+		auth = smtp.PlainAuth("", e.Username, e.Password, host)
+	}
+	fmt.Fprintf(&body, "From: %v\r\nTo: %v\r\nSubject: %v\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n%v\r\n",
+		e.From, strings.Join(e.To, ", "), oneLine(a.Title), a.Text)
+	for _, k := range a.Fields.SortedKeys() {
+		fmt.Fprintf(&body, "\r\n%v: %v", k, a.Fields[k])
+	}
+	// net/smtp does not take a context
+	errc := make(chan error, 1)
+	go func() { errc <- smtp.SendMail(e.Addr, auth, e.From, e.To, []byte(body.String())) }()
+	select {
+	case err := <-errc:
+		return errors.Wrap(err, "can't send alert email")
+	case <-ctx.Done():
+		return errors.Wrap(ctx.Err(), "can't send alert email")
+	}
+}
+
+// oneLine removes the line breaks, not to inject headers
+func oneLine(s string) string {
+	return strings.NewReplacer("\r", " ", "\n", " ").Replace(s)
+}
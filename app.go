@@ -0,0 +1,130 @@
+package hang
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+	"gitlab.com/brunetto/swaggo"
+)
+
+// AppOptions configures the App created by NewApp
+type AppOptions struct {
+	// Logger of the app; if nil one is created with LoggerOptions
+	Logger Logger
+	// Options of the logger created if Logger is nil, a daily rotated JSON
+	// file storage/logs/<name>.log teed to stderr at debug level if nil
+	LoggerOptions *LoggerOptions
+	// Serve a gin engine created with these options, mounted on the
+	// Handler below its own routes; no engine if nil
+	Gin *GinOptions
+	// Configuration of the app, e.g. loaded with the config subpackage
+	Config interface{}
+	// Maximum time to drain the requests and run the shutdown hooks, 30s if zero
+	ShutdownTimeout time.Duration
+}
+
+// App bundles what a service needs: the Handler serving the requests (and,
+// optionally, a gin engine), the swaggo docs, the logger, the configuration
+// and the lifecycle running the servers and the background components, so
+// that main can be reduced to NewApp, route registration and Run.
+type App struct {
+	Name      string
+	Log       Logger
+	Handler   *Handler
+	Engine    *gin.Engine
+	Docs      *swaggo.Swaggo
+	Config    interface{}
+	Lifecycle *Lifecycle
+
+	mu     sync.Mutex
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewApp creates an App named name
+func NewApp(name string, opts AppOptions) (*App, error) {
+	var err error
+	a := &App{Name: name, Log: opts.Logger, Config: opts.Config}
+	if a.Log == nil {
+		lo := LoggerOptions{Path: "storage/logs/" + name + ".log", Rotation: DailyRotation, TeeToStderr: true}
+		if opts.LoggerOptions != nil {
+			lo = *opts.LoggerOptions
+		}
+		a.Log, err = NewLogger(lo)
+		if err != nil {
+			return nil, errors.Wrap(err, "can't create logger")
+		}
+	}
+	a.Handler = NewHandler(a.Log, name)
+	if opts.Gin != nil {
+		gopts := *opts.Gin
+		gopts.Logger = a.Log
+		// The lifecycle logs start and stop
+		gopts.DisableStartStopLog = true
+		a.Engine, a.Docs, _, err = GinOnTheRocksWithOptions(name, gopts)
+		if err != nil {
+			return nil, err
+		}
+		err = a.Handler.Mount("", a.Engine)
+		if err != nil {
+			return nil, errors.Wrap(err, "can't mount gin engine")
+		}
+	} else {
+		a.Docs, err = swaggo.NewSwaggo()
+		if err != nil {
+			return nil, errors.Wrap(err, "can't create new swaggo")
+		}
+	}
+	a.Lifecycle = NewLifecycle(name, a.Log)
+	if opts.ShutdownTimeout > 0 {
+		a.Lifecycle.ShutdownTimeout = opts.ShutdownTimeout
+	}
+	return a, nil
+}
+
+// Run serves the app on addr, together with the runners added to the
+// lifecycle, until a stop signal, a runner failure or Shutdown
+func (a *App) Run(addr string) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	a.mu.Lock()
+	if a.done != nil {
+		a.mu.Unlock()
+		cancel()
+		return errors.New("app " + a.Name + " already running")
+	}
+	a.cancel, a.done = cancel, make(chan struct{})
+	a.mu.Unlock()
+	defer close(a.done)
+	defer cancel()
+
+	a.Lifecycle.AddHandler(a.Handler, addr)
+	return a.Lifecycle.Run(ctx)
+}
+
+// Shutdown stops the app started by Run, waiting for it to stop until ctx
+// is done
+func (a *App) Shutdown(ctx context.Context) error {
+	a.mu.Lock()
+	cancel, done := a.cancel, a.done
+	a.mu.Unlock()
+	if done == nil {
+		return errors.New("app " + a.Name + " not running")
+	}
+	cancel()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return errors.Wrap(ctx.Err(), "app "+a.Name+" not stopped")
+	}
+}
+
+// AddRoute registers fn for method on route of the Handler, documenting it
+// both in the Handler spec (see SwaggerSpec) and in the swaggo docs, so that
+// the docs can't drift from the routes
+func (a *App) AddRoute(method, route string, fn HandleFunc, doc RouteDoc) error {
+	return a.Handler.AddSwaggoRoute(a.Docs, method, route, fn, doc)
+}
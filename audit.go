@@ -0,0 +1,169 @@
+package hang
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Audit results
+const (
+	AuditSuccess = "success"
+	AuditDenied  = "denied"
+	AuditFailure = "failure"
+)
+
+// AuditRecord is an entry of the audit trail: who did what, when, with
+// which result
+type AuditRecord struct {
+	Time time.Time `json:"time"`
+	// Authenticated principal, "" if anonymous
+	Principal string `json:"principal"`
+	Method    string `json:"method"`
+	Route     string `json:"route"`
+	Path      string `json:"path"`
+	// Identifiers of the resources, from the route params
+	Resources map[string]string `json:"resources,omitempty"`
+	Status    int               `json:"status"`
+	// AuditSuccess, AuditDenied (401 and 403) or AuditFailure
+	Result    string `json:"result"`
+	Error     string `json:"error,omitempty"`
+	RequestID string `json:"request_id,omitempty"`
+	Origin    string `json:"origin"`
+}
+
+// AuditSink stores the audit records
+type AuditSink interface {
+	WriteAudit(r AuditRecord) error
+}
+
+// AuditSinkFunc is a function implementing AuditSink
+type AuditSinkFunc func(r AuditRecord) error
+
+// WriteAudit implements AuditSink
+func (f AuditSinkFunc) WriteAudit(r AuditRecord) error {
+	return f(r)
+}
+
+// NewAuditWriter returns a sink writing the records to w, one JSON object
+// per line
+func NewAuditWriter(w io.Writer) AuditSink {
+	return &auditWriter{w: w}
+}
+
+// NewAuditFile returns a sink appending the records to the file at path,
+// one JSON object per line, with the given rotation policy. The file is
+// never truncated.
+func NewAuditFile(path string, rotation Rotation) (AuditSink, error) {
+	w, err := openLogFile(path, rotation)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't open audit log")
+	}
+	return NewAuditWriter(w), nil
+}
+
+type auditWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (a *auditWriter) WriteAudit(r AuditRecord) error {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return errors.Wrap(err, "can't encode audit record")
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	_, err = a.w.Write(append(b, '\n'))
+	return errors.Wrap(err, "can't write audit record")
+}
+
+// AuditOptions configures the Audit middleware
+type AuditOptions struct {
+	Sink AuditSink
+	// Returns the principal of the request, DefaultAuditPrincipal if nil.
+	// Authentication middleware inside Audit can set it with
+	// SetAuditPrincipal instead.
+	Principal func(req *http.Request) string
+	// Methods audited, all if empty, e.g. only the mutating ones
+	Methods []string
+}
+
+// DefaultAuditPrincipal returns the common name of the verified client
+// certificate or the basic auth user of the request, "" if none
+func DefaultAuditPrincipal(req *http.Request) string {
+	if id, ok := ClientIdentity(req); ok {
+		return id.CommonName
+	}
+	user, _, _ := req.BasicAuth()
+	return user
+}
+
+// SetAuditPrincipal sets the principal recorded by the Audit middleware
+// wrapping the request, for authentication middleware and handlers running
+// inside it
+func SetAuditPrincipal(req *http.Request, principal string) {
+	if p, ok := req.Context().Value(auditKey).(*string); ok {
+		*p = principal
+	}
+}
+
+// Audit returns a middleware recording every request in the audit trail,
+// separate from the application log, after the handler ran. Records which
+// can't be stored are logged as errors.
+func (h *Handler) Audit(opts AuditOptions) Middleware {
+	if opts.Principal == nil {
+		opts.Principal = DefaultAuditPrincipal
+	}
+	methods := map[string]bool{}
+	for _, m := range opts.Methods {
+		methods[m] = true
+	}
+	return func(next HandleFunc) HandleFunc {
+		return func(resp http.ResponseWriter, req *http.Request) error {
+			if len(methods) > 0 && !methods[req.Method] {
+				return next(resp, req)
+			}
+			var (
+				start     = time.Now()
+				principal = opts.Principal(req)
+				rr        = NewResponseRecorder(resp)
+			)
+			err := next(rr, req.WithContext(context.WithValue(req.Context(), auditKey, &principal)))
+			r := AuditRecord{
+				Time:      start,
+				Principal: principal,
+				Method:    req.Method,
+				Route:     RouteFrom(req),
+				Path:      req.URL.Path,
+				Resources: Params(req),
+				Status:    rr.Status,
+				Result:    AuditSuccess,
+				RequestID: GetRequestID(req),
+				Origin:    RealIP(req),
+			}
+			if !rr.WroteHeader && err != nil {
+				r.Status = http.StatusInternalServerError
+			}
+			switch {
+			case r.Status == http.StatusUnauthorized || r.Status == http.StatusForbidden:
+				r.Result = AuditDenied
+			case r.Status >= 400:
+				r.Result = AuditFailure
+			}
+			if err != nil {
+				r.Result = AuditFailure
+				r.Error = err.Error()
+			}
+			if e := opts.Sink.WriteAudit(r); e != nil {
+				h.Log.WithFields(Fields{"route": r.Route, "principal": principal, "request_id": r.RequestID}).Error(e)
+			}
+			return err
+		}
+	}
+}
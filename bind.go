@@ -0,0 +1,111 @@
+package hang
+
+import (
+	"mime"
+	"net/http"
+
+	"github.com/pkg/errors"
+	"github.com/vmihailenco/msgpack/v5"
+	"google.golang.org/protobuf/proto"
+)
+
+// Media types of the supported body encodings
+const (
+	MIMEJSON     = "application/json"
+	MIMEXML      = "application/xml"
+	MIMEMsgpack  = "application/msgpack"
+	MIMEProtobuf = "application/x-protobuf"
+)
+
+// GetReqMsgpackData reads the request body and decodes it as MessagePack into
+// data, responding on failure
+func GetReqMsgpackData(resp http.ResponseWriter, req *http.Request, data interface{}) error {
+	body, err := GetReqData(resp, req)
+	if err != nil {
+		return err
+	}
+	err = msgpack.Unmarshal(body, data)
+	if err != nil {
+		err = errors.Wrap(err, "can't decode input MessagePack")
+		// Respond
+		WriteError(resp, req, http.StatusBadRequest, err)
+		return err
+	}
+	return nil
+}
+
+// WriteMsgpack serializes data as MessagePack and writes it with the given status
+func WriteMsgpack(resp http.ResponseWriter, status int, data interface{}) error {
+	b, err := msgpack.Marshal(data)
+	if err != nil {
+		err = errors.Wrap(err, "can't encode output MessagePack")
+		resp.WriteHeader(http.StatusInternalServerError)
+		return err
+	}
+	resp.Header().Set("Content-Type", MIMEMsgpack)
+	resp.WriteHeader(status)
+	_, err = resp.Write(b)
+	return err
+}
+
+// GetReqProtoData reads the request body and decodes it as Protobuf into
+// msg, responding on failure
+func GetReqProtoData(resp http.ResponseWriter, req *http.Request, msg proto.Message) error {
+	body, err := GetReqData(resp, req)
+	if err != nil {
+		return err
+	}
+	err = proto.Unmarshal(body, msg)
+	if err != nil {
+		err = errors.Wrap(err, "can't decode input Protobuf")
+		// Respond
+		WriteError(resp, req, http.StatusBadRequest, err)
+		return err
+	}
+	return nil
+}
+
+// WriteProto serializes msg as Protobuf and writes it with the given status
+func WriteProto(resp http.ResponseWriter, status int, msg proto.Message) error {
+	b, err := proto.Marshal(msg)
+	if err != nil {
+		err = errors.Wrap(err, "can't encode output Protobuf")
+		resp.WriteHeader(http.StatusInternalServerError)
+		return err
+	}
+	resp.Header().Set("Content-Type", MIMEProtobuf)
+	resp.WriteHeader(status)
+	_, err = resp.Write(b)
+	return err
+}
+
+// Bind decodes the request body into v choosing the decoder from the
+// Content-Type: JSON (the default when missing), XML, MessagePack or Protobuf
+// (v must then be a proto.Message). It responds 415 for other types.
+func Bind(resp http.ResponseWriter, req *http.Request, v interface{}) error {
+	var mediaType string
+	if ct := req.Header.Get("Content-Type"); ct != "" {
+		mediaType, _, _ = mime.ParseMediaType(ct)
+	}
+	switch mediaType {
+	case "", MIMEJSON:
+		return GetReqJSONData(resp, req, v)
+	case MIMEXML, "text/xml":
+		return GetReqXMLData(resp, req, v)
+	case MIMEMsgpack, "application/x-msgpack":
+		return GetReqMsgpackData(resp, req, v)
+	case MIMEProtobuf, "application/protobuf":
+		msg, ok := v.(proto.Message)
+		if !ok {
+			err := errors.Errorf("%T is not a proto.Message", v)
+			// Respond
+			WriteError(resp, req, http.StatusUnsupportedMediaType, err)
+			return err
+		}
+		return GetReqProtoData(resp, req, msg)
+	}
+	err := errors.New("unsupported content type " + mediaType)
+	// Respond
+	WriteError(resp, req, http.StatusUnsupportedMediaType, err)
+	return err
+}
@@ -0,0 +1,188 @@
+package hang
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ErrCircuitOpen is returned when a request is refused by an open breaker
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// BreakerState is the state of a circuit breaker
+type BreakerState int
+
+const (
+	// BreakerClosed lets all the requests through
+	BreakerClosed BreakerState = iota
+	// BreakerOpen refuses all the requests
+	BreakerOpen
+	// BreakerHalfOpen lets a limited number of trial requests through
+	BreakerHalfOpen
+)
+
+// String returns the name of the state
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	}
+	return "closed"
+}
+
+// BreakerOptions configures a circuit breaker
+type BreakerOptions struct {
+	// Consecutive failures opening the breaker, 5 if zero
+	FailureThreshold int
+	// Time the breaker stays open before letting trial requests, 30s if zero
+	OpenTimeout time.Duration
+	// Trial requests in half-open state, all must succeed to close the
+	// breaker, 1 if zero
+	HalfOpenRequests int
+}
+
+// CircuitBreaker stops calling a failing dependency for a while
+type CircuitBreaker struct {
+	opts      BreakerOptions
+	mu        sync.Mutex
+	state     BreakerState
+	failures  int
+	openedAt  time.Time
+	trials    int
+	successes int
+}
+
+// NewCircuitBreaker creates a closed breaker
+func NewCircuitBreaker(opts BreakerOptions) *CircuitBreaker {
+	if opts.FailureThreshold <= 0 {
+		opts.FailureThreshold = 5
+	}
+	if opts.OpenTimeout <= 0 {
+		opts.OpenTimeout = 30 * time.Second
+	}
+	if opts.HalfOpenRequests <= 0 {
+		opts.HalfOpenRequests = 1
+	}
+	return &CircuitBreaker{opts: opts}
+}
+
+// State returns the current state
+func (b *CircuitBreaker) State() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refresh()
+	return b.state
+}
+
+// refresh moves an open breaker to half-open after the timeout
+func (b *CircuitBreaker) refresh() {
+	if b.state == BreakerOpen && time.Since(b.openedAt) >= b.opts.OpenTimeout {
+		b.state = BreakerHalfOpen
+		b.trials = 0
+		b.successes = 0
+	}
+}
+
+// Allow returns ErrCircuitOpen if the request must not be sent
+func (b *CircuitBreaker) Allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refresh()
+	switch b.state {
+	case BreakerOpen:
+		return ErrCircuitOpen
+	case BreakerHalfOpen:
+		if b.trials >= b.opts.HalfOpenRequests {
+			return ErrCircuitOpen
+		}
+		b.trials++
+	}
+	return nil
+}
+
+// Success records a successful request
+func (b *CircuitBreaker) Success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case BreakerClosed:
+		b.failures = 0
+	case BreakerHalfOpen:
+		b.successes++
+		if b.successes >= b.opts.HalfOpenRequests {
+			b.state = BreakerClosed
+			b.failures = 0
+		}
+	}
+}
+
+// Failure records a failed request
+func (b *CircuitBreaker) Failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case BreakerClosed:
+		b.failures++
+		if b.failures >= b.opts.FailureThreshold {
+			b.open()
+		}
+	case BreakerHalfOpen:
+		b.open()
+	}
+}
+
+func (b *CircuitBreaker) open() {
+	b.state = BreakerOpen
+	b.openedAt = time.Now()
+}
+
+// breaker returns the breaker of host, nil if breakers are disabled
+func (c *Client) breaker(host string) *CircuitBreaker {
+	if c.opts.Breaker == nil {
+		return nil
+	}
+	c.breakersMu.Lock()
+	defer c.breakersMu.Unlock()
+	if c.breakers == nil {
+		c.breakers = map[string]*CircuitBreaker{}
+	}
+	b, ok := c.breakers[host]
+	if !ok {
+		b = NewCircuitBreaker(*c.opts.Breaker)
+		c.breakers[host] = b
+	}
+	return b
+}
+
+// BreakerStates returns the state of the breaker of every host contacted
+func (c *Client) BreakerStates() map[string]BreakerState {
+	c.breakersMu.Lock()
+	defer c.breakersMu.Unlock()
+	states := make(map[string]BreakerState, len(c.breakers))
+	for host, b := range c.breakers {
+		states[host] = b.State()
+	}
+	return states
+}
+
+// BreakerCheck is a CheckFunc failing when the breaker of any host is
+// open, to be registered with AddReadinessCheck
+func (c *Client) BreakerCheck(ctx context.Context) error {
+	open := []string{}
+	for host, state := range c.BreakerStates() {
+		if state == BreakerOpen {
+			open = append(open, host)
+		}
+	}
+	if len(open) == 0 {
+		return nil
+	}
+	sort.Strings(open)
+	return errors.New("circuit open for " + strings.Join(open, ", "))
+}
@@ -0,0 +1,77 @@
+package hang
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	b := NewCircuitBreaker(BreakerOptions{FailureThreshold: 2, OpenTimeout: 20 * time.Millisecond, HalfOpenRequests: 2})
+	expect := func(step string, state BreakerState, allowed bool) {
+		t.Helper()
+		if got := b.State(); got != state {
+			t.Errorf("%s: got state %v, want %v", step, got, state)
+		}
+		if err := b.Allow(); (err == nil) != allowed {
+			t.Errorf("%s: got Allow %v, want allowed %v", step, err, allowed)
+		}
+	}
+
+	b.Failure()
+	b.Success()
+	b.Failure()
+	expect("failures reset by a success", BreakerClosed, true)
+	b.Failure()
+	expect("threshold reached", BreakerOpen, false)
+
+	time.Sleep(30 * time.Millisecond)
+	expect("open timeout elapsed", BreakerHalfOpen, true)
+	b.Failure()
+	expect("trial failed", BreakerOpen, false)
+
+	time.Sleep(30 * time.Millisecond)
+	expect("second half-open", BreakerHalfOpen, true)
+	expect("second trial", BreakerHalfOpen, true)
+	if err := b.Allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("trials exhausted: got %v, want ErrCircuitOpen", err)
+	}
+	b.Success()
+	if got := b.State(); got != BreakerHalfOpen {
+		t.Errorf("one trial succeeded: got state %v, want %v", got, BreakerHalfOpen)
+	}
+	b.Success()
+	expect("all trials succeeded", BreakerClosed, true)
+}
+
+func TestClientBreaker(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		resp.WriteHeader(http.StatusBadGateway)
+	}))
+	defer srv.Close()
+	c := NewClient(testHandler(t).Log, ClientOptions{Breaker: &BreakerOptions{FailureThreshold: 2, OpenTimeout: time.Minute}})
+
+	for i := 0; i < 2; i++ {
+		resp, err := c.Get(context.Background(), srv.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+	if err := c.BreakerCheck(context.Background()); err == nil {
+		t.Error("readiness check passing with an open breaker")
+	}
+	if _, err := c.Get(context.Background(), srv.URL); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("got %v, want ErrCircuitOpen", err)
+	}
+	if n := atomic.LoadInt32(&calls); n != 2 {
+		t.Errorf("server called %d times, want 2", n)
+	}
+}
@@ -0,0 +1,221 @@
+package hang
+
+import (
+	"container/list"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CacheStatusHeader reports whether a response comes from the ResponseCache
+const CacheStatusHeader = "X-Cache"
+
+// SetCacheControl sets Cache-Control, with max-age and the given directives
+// (e.g. "public"), and Expires. A maxAge of zero or less disables caching.
+func SetCacheControl(resp http.ResponseWriter, maxAge time.Duration, directives ...string) {
+	if maxAge <= 0 {
+		resp.Header().Set("Cache-Control", "no-store")
+		resp.Header().Set("Expires", "0")
+		return
+	}
+	cc := append([]string{"max-age=" + strconv.Itoa(int(maxAge.Seconds()))}, directives...)
+	resp.Header().Set("Cache-Control", strings.Join(cc, ", "))
+	resp.Header().Set("Expires", time.Now().Add(maxAge).UTC().Format(http.TimeFormat))
+}
+
+// CacheControl returns a middleware setting the cache headers with
+// SetCacheControl, to be used per route with UseForRoute. Handlers can still
+// override them.
+func CacheControl(maxAge time.Duration, directives ...string) Middleware {
+	return func(next HandleFunc) HandleFunc {
+		return func(resp http.ResponseWriter, req *http.Request) error {
+			SetCacheControl(resp, maxAge, directives...)
+			return next(resp, req)
+		}
+	}
+}
+
+// ResponseCacheOptions configures the ResponseCache middleware
+type ResponseCacheOptions struct {
+	// Lifetime of the cached responses, 1m if zero
+	TTL time.Duration
+	// Maximum number of cached responses, the least recently used being
+	// evicted, 1000 if zero
+	MaxEntries int
+}
+
+// ResponseCache returns a middleware caching in memory the 200 responses to
+// GET requests, keyed by path, query and the request headers listed in the
+// Vary of the response, replaying them for TTL. Responses with Set-Cookie,
+// Vary * or Cache-Control no-store/private are not cached, requests with
+// Cache-Control no-cache skip the cache. Requests with Authorization or
+// Cookie are served and stored only the responses marked public.
+func ResponseCache(opts ResponseCacheOptions) Middleware {
+	if opts.TTL <= 0 {
+		opts.TTL = time.Minute
+	}
+	if opts.MaxEntries <= 0 {
+		opts.MaxEntries = 1000
+	}
+	c := &responseCache{opts: opts, entries: map[string]*list.Element{}, lru: list.New(), vary: map[string][]string{}}
+	return func(next HandleFunc) HandleFunc {
+		return func(resp http.ResponseWriter, req *http.Request) error {
+			if req.Method != http.MethodGet {
+				return next(resp, req)
+			}
+			var (
+				base = req.URL.Path + "?" + req.URL.Query().Encode()
+				// Responses to one user must not be replayed to the others
+				private = req.Header.Get("Authorization") != "" || req.Header.Get("Cookie") != ""
+			)
+			if !strings.Contains(req.Header.Get("Cache-Control"), "no-cache") {
+				if cached := c.get(c.key(base, req)); cached != nil && (!private || isPublic(cached.Header)) {
+					dst := resp.Header()
+					for k, v := range cached.Header {
+						dst[k] = v
+					}
+					dst.Set(CacheStatusHeader, "HIT")
+					resp.WriteHeader(cached.Status)
+					_, err := resp.Write(cached.Body)
+					return err
+				}
+			}
+			resp.Header().Set(CacheStatusHeader, "MISS")
+			bw := &bufferedWriter{ResponseWriter: resp, status: http.StatusOK}
+			err := next(bw, req)
+			if bw.streaming {
+				return err
+			}
+			if !bw.wroteHeader {
+				// Nothing written by the handler, leave the error response
+				// to Handle
+				resp.Header().Del(CacheStatusHeader)
+				return err
+			}
+			if err == nil && bw.status == http.StatusOK && cacheable(resp.Header()) && (!private || isPublic(resp.Header())) {
+				header := resp.Header().Clone()
+				header.Del(RequestIDHeader)
+				c.setVary(base, varyHeaders(header))
+				c.set(c.key(base, req), &StoredResponse{Status: bw.status, Header: header, Body: append([]byte{}, bw.buf.Bytes()...)})
+			}
+			bw.flush()
+			return err
+		}
+	}
+}
+
+// cacheable checks the response headers allow shared caching
+func cacheable(header http.Header) bool {
+	if header.Get("Set-Cookie") != "" {
+		return false
+	}
+	for _, name := range varyHeaders(header) {
+		if name == "*" {
+			return false
+		}
+	}
+	cc := header.Get("Cache-Control")
+	return !strings.Contains(cc, "no-store") && !strings.Contains(cc, "private")
+}
+
+// isPublic tells if the response can be shared even if the request was
+// authenticated
+func isPublic(header http.Header) bool {
+	return strings.Contains(header.Get("Cache-Control"), "public")
+}
+
+// varyHeaders returns the canonical names in the Vary of the response
+func varyHeaders(header http.Header) []string {
+	var names []string
+	for _, v := range header.Values("Vary") {
+		for _, name := range strings.Split(v, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				names = append(names, http.CanonicalHeaderKey(name))
+			}
+		}
+	}
+	return names
+}
+
+// responseCache is an LRU of responses with expiration
+type responseCache struct {
+	opts    ResponseCacheOptions
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	lru     *list.List
+	// Vary of the last response stored for every path and query
+	vary map[string][]string
+}
+
+type cacheEntry struct {
+	key     string
+	resp    *StoredResponse
+	expires time.Time
+}
+
+// key returns the key of the response to req for base, path and query,
+// with the values of the headers the stored responses vary on
+func (c *responseCache) key(base string, req *http.Request) string {
+	c.mu.Lock()
+	names := c.vary[base]
+	c.mu.Unlock()
+	key := base
+	for _, name := range names {
+		key += "\n" + name + ": " + strings.Join(req.Header.Values(name), ",")
+	}
+	return key
+}
+
+// setVary records the headers the responses for base vary on
+func (c *responseCache) setVary(base string, names []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(names) == 0 {
+		delete(c.vary, base)
+		return
+	}
+	if _, ok := c.vary[base]; !ok && len(c.vary) >= c.opts.MaxEntries {
+		// Bounded as the entries: forgetting a Vary only causes misses
+		for k := range c.vary {
+			delete(c.vary, k)
+			break
+		}
+	}
+	c.vary[base] = names
+}
+
+func (c *responseCache) get(key string) *StoredResponse {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.entries[key]
+	if !ok {
+		return nil
+	}
+	e := el.Value.(*cacheEntry)
+	if time.Now().After(e.expires) {
+		c.lru.Remove(el)
+		delete(c.entries, key)
+		return nil
+	}
+	c.lru.MoveToFront(el)
+	return e.resp
+}
+
+func (c *responseCache) set(key string, resp *StoredResponse) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e := &cacheEntry{key: key, resp: resp, expires: time.Now().Add(c.opts.TTL)}
+	if el, ok := c.entries[key]; ok {
+		el.Value = e
+		c.lru.MoveToFront(el)
+		return
+	}
+	c.entries[key] = c.lru.PushFront(e)
+	for c.lru.Len() > c.opts.MaxEntries {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key)
+	}
+}
@@ -0,0 +1,72 @@
+package hang
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestResponseCacheSharing(t *testing.T) {
+	h := testHandler(t)
+	h.Use(ResponseCache(ResponseCacheOptions{}))
+	// Echoes the credentials, as a user specific page would
+	h.AddRoute("me", func(resp http.ResponseWriter, req *http.Request) error {
+		resp.Write([]byte(req.Header.Get("Authorization") + req.Header.Get("Cookie")))
+		return nil
+	})
+	h.AddRoute("public", func(resp http.ResponseWriter, req *http.Request) error {
+		SetCacheControl(resp, 60e9, "public")
+		resp.Write([]byte(req.Header.Get("Authorization")))
+		return nil
+	})
+	h.AddRoute("lang", func(resp http.ResponseWriter, req *http.Request) error {
+		resp.Header().Set("Vary", "Accept-Language")
+		resp.Write([]byte(req.Header.Get("Accept-Language")))
+		return nil
+	})
+	tests := []struct {
+		name   string
+		target string
+		header http.Header
+		cache  string
+		body   string
+	}{
+		{"authorization miss", "/me", http.Header{"Authorization": {"alice"}}, "MISS", "alice"},
+		{"authorization not shared", "/me", http.Header{"Authorization": {"bob"}}, "MISS", "bob"},
+		{"cookie not shared", "/me", http.Header{"Cookie": {"s=carol"}}, "MISS", "s=carol"},
+		{"anonymous not served private", "/me", nil, "MISS", ""},
+		{"anonymous hit", "/me", nil, "HIT", ""},
+		{"credentials skip anonymous entry", "/me", http.Header{"Authorization": {"dave"}}, "MISS", "dave"},
+		{"public stored", "/public", http.Header{"Authorization": {"alice"}}, "MISS", "alice"},
+		{"public shared", "/public", http.Header{"Authorization": {"bob"}}, "HIT", "alice"},
+		{"vary miss", "/lang", http.Header{"Accept-Language": {"it"}}, "MISS", "it"},
+		{"vary other value", "/lang", http.Header{"Accept-Language": {"en"}}, "MISS", "en"},
+		{"vary hit", "/lang", http.Header{"Accept-Language": {"it"}}, "HIT", "it"},
+	}
+	for _, tt := range tests {
+		resp := serve(h, "GET", tt.target, tt.header)
+		if got := resp.Header().Get(CacheStatusHeader); got != tt.cache {
+			t.Errorf("%v: cache %v, want %v", tt.name, got, tt.cache)
+		}
+		if got := resp.Body.String(); got != tt.body {
+			t.Errorf("%v: body %q, want %q", tt.name, got, tt.body)
+		}
+	}
+}
+
+func TestResponseCacheHandlerError(t *testing.T) {
+	h := testHandler(t)
+	h.SetErrorRenderer(FormatErrorRenderer(ProblemJSONErrors))
+	h.Use(ResponseCache(ResponseCacheOptions{}))
+	h.AddRoute("fail", func(resp http.ResponseWriter, req *http.Request) error {
+		return errors.New("db down")
+	})
+
+	for i := 0; i < 2; i++ {
+		rec := serve(h, http.MethodGet, "/fail", nil)
+		if rec.Code != http.StatusInternalServerError || rec.Body.Len() == 0 || rec.Header().Get(CacheStatusHeader) != "" {
+			t.Errorf("request %d: got status %d, body %q and %s %q, want the rendered 500", i, rec.Code, rec.Body.String(), CacheStatusHeader, rec.Header().Get(CacheStatusHeader))
+		}
+	}
+}
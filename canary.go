@@ -0,0 +1,104 @@
+package hang
+
+import (
+	"hash/fnv"
+	"math"
+	"math/rand"
+	"net/http"
+	"sync/atomic"
+)
+
+// Canary variants, as stored in the sticky cookie
+const (
+	CanaryStable = "stable"
+	CanaryNew    = "canary"
+)
+
+// CanaryOptions configures the traffic split of a canary route
+type CanaryOptions struct {
+	// Percentage of the requests sent to the canary handler
+	Percentage float64
+	// Name of the cookie keeping a client on the variant it got first, no
+	// cookie if empty
+	Cookie string
+	// Header whose value (e.g. a user ID) always selects the same variant,
+	// checked before the cookie; not used if empty
+	StickyHeader string
+}
+
+// Canary splits the requests of a route between a stable and a canary
+// handler, to roll out a new implementation gradually
+type Canary struct {
+	stable HandleFunc
+	canary HandleFunc
+	opts   CanaryOptions
+	// Percentage as float64 bits, changed by SetPercentage
+	percentage uint64
+}
+
+// NewCanary returns a Canary sending opts.Percentage of the requests to canary
+func NewCanary(stable, canary HandleFunc, opts CanaryOptions) *Canary {
+	c := &Canary{stable: stable, canary: canary, opts: opts}
+	c.SetPercentage(opts.Percentage)
+	return c
+}
+
+// AddCanaryRoute registers route splitting the requests between stable and
+// canary; the returned Canary allows changing the split at runtime
+func (h *Handler) AddCanaryRoute(route string, stable, canary HandleFunc, opts CanaryOptions) (*Canary, error) {
+	c := NewCanary(stable, canary, opts)
+	return c, h.AddRoute(route, c.Handle)
+}
+
+// SetPercentage changes the percentage of the requests sent to the canary
+// handler; clients with a sticky cookie keep their variant, unless p is 0
+// or 100 so that a rollback or a promotion moves everyone
+func (c *Canary) SetPercentage(p float64) {
+	atomic.StoreUint64(&c.percentage, math.Float64bits(math.Max(0, math.Min(100, p))))
+}
+
+// Percentage returns the percentage of the requests sent to the canary handler
+func (c *Canary) Percentage() float64 {
+	return math.Float64frombits(atomic.LoadUint64(&c.percentage))
+}
+
+// Variant returns CanaryNew or CanaryStable for the request, without
+// setting the sticky cookie
+func (c *Canary) Variant(req *http.Request) string {
+	p := c.Percentage()
+	if c.opts.StickyHeader != "" {
+		if v := req.Header.Get(c.opts.StickyHeader); v != "" {
+			h := fnv.New32a()
+			h.Write([]byte(v))
+			if float64(h.Sum32()%10000) < p*100 {
+				return CanaryNew
+			}
+			return CanaryStable
+		}
+	}
+	// The cookie only pins the variant while traffic is split, then
+	// Handle rewrites it
+	if c.opts.Cookie != "" && p > 0 && p < 100 {
+		if ck, err := req.Cookie(c.opts.Cookie); err == nil && (ck.Value == CanaryNew || ck.Value == CanaryStable) {
+			return ck.Value
+		}
+	}
+	if rand.Float64()*100 < p {
+		return CanaryNew
+	}
+	return CanaryStable
+}
+
+// Handle serves the request with the variant selected by Variant
+func (c *Canary) Handle(resp http.ResponseWriter, req *http.Request) error {
+	variant := c.Variant(req)
+	if c.opts.Cookie != "" {
+		if ck, err := req.Cookie(c.opts.Cookie); err != nil || ck.Value != variant {
+			http.SetCookie(resp, &http.Cookie{Name: c.opts.Cookie, Value: variant, Path: "/", HttpOnly: true, SameSite: http.SameSiteLaxMode})
+		}
+	}
+	if variant == CanaryNew {
+		return c.canary(resp, req)
+	}
+	return c.stable(resp, req)
+}
@@ -0,0 +1,73 @@
+package hang
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestCanary(t *testing.T) {
+	h := testHandler(t)
+	variant := func(name string) HandleFunc {
+		return func(resp http.ResponseWriter, req *http.Request) error {
+			resp.Write([]byte(name))
+			return nil
+		}
+	}
+	c, err := h.AddCanaryRoute("search", variant(CanaryStable), variant(CanaryNew), CanaryOptions{Percentage: 20, Cookie: "variant", StickyHeader: "X-User"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Split
+	counts := map[string]int{}
+	for i := 0; i < 2000; i++ {
+		counts[serve(h, http.MethodGet, "/search", nil).Body.String()]++
+	}
+	if n := counts[CanaryNew]; n < 300 || n > 500 {
+		t.Errorf("got %d of 2000 requests on the canary, want about 400", n)
+	}
+
+	// Sticky header
+	first := serve(h, http.MethodGet, "/search", http.Header{"X-User": {"42"}}).Body.String()
+	for i := 0; i < 20; i++ {
+		if got := serve(h, http.MethodGet, "/search", http.Header{"X-User": {"42"}}).Body.String(); got != first {
+			t.Fatalf("user 42 got %s after %s", got, first)
+		}
+	}
+
+	// Sticky cookie
+	pinned := http.Header{"Cookie": {"variant=" + CanaryNew}}
+	for i := 0; i < 20; i++ {
+		rec := serve(h, http.MethodGet, "/search", pinned)
+		if rec.Body.String() != CanaryNew || len(rec.Result().Cookies()) != 0 {
+			t.Fatalf("pinned client got %s with cookies %v", rec.Body.String(), rec.Result().Cookies())
+		}
+	}
+	rec := serve(h, http.MethodGet, "/search", nil)
+	if cookies := rec.Result().Cookies(); len(cookies) != 1 || cookies[0].Value != rec.Body.String() {
+		t.Errorf("got cookies %v for variant %s, want the variant pinned", cookies, rec.Body.String())
+	}
+
+	// Rollback and promotion move the pinned clients too
+	tests := []struct {
+		percentage float64
+		cookie     string
+		want       string
+	}{
+		{0, CanaryNew, CanaryStable},
+		{100, CanaryStable, CanaryNew},
+	}
+	for _, tt := range tests {
+		c.SetPercentage(tt.percentage)
+		rec := serve(h, http.MethodGet, "/search", http.Header{"Cookie": {"variant=" + tt.cookie}})
+		if rec.Body.String() != tt.want {
+			t.Errorf("at %v%% client pinned to %s got %s, want %s", tt.percentage, tt.cookie, rec.Body.String(), tt.want)
+		}
+		if cookies := rec.Result().Cookies(); len(cookies) != 1 || cookies[0].Value != tt.want {
+			t.Errorf("at %v%% got cookies %v, want the cookie rewritten to %s", tt.percentage, cookies, tt.want)
+		}
+		if got := serve(h, http.MethodGet, "/search", http.Header{"X-User": {"42"}}).Body.String(); got != tt.want {
+			t.Errorf("at %v%% user 42 got %s, want %s", tt.percentage, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package hang
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// CapturedExchange is a request and its response as recorded by Capture,
+// one JSON object per line, for the replay package to send again
+type CapturedExchange struct {
+	Time          time.Time   `json:"time"`
+	Route         string      `json:"route"`
+	Method        string      `json:"method"`
+	URL           string      `json:"url"`
+	Host          string      `json:"host"`
+	RequestHeader http.Header `json:"request_header"`
+	RequestBody   []byte      `json:"request_body,omitempty"`
+	// The bodies are cut at the capture MaxBodySize
+	RequestTruncated bool        `json:"request_truncated,omitempty"`
+	Status           int         `json:"status"`
+	ResponseHeader   http.Header `json:"response_header"`
+	ResponseBody     []byte      `json:"response_body,omitempty"`
+	// The bodies are cut at the capture MaxBodySize
+	ResponseTruncated bool    `json:"response_truncated,omitempty"`
+	LatencyMs         float64 `json:"latency_ms"`
+	RequestID         string  `json:"request_id,omitempty"`
+}
+
+// CaptureOptions configures Capture
+type CaptureOptions struct {
+	// Destination of the JSON lines
+	Output io.Writer
+	// Percentage of the requests captured, 100 if zero
+	Percentage float64
+	// Bodies larger than this are truncated, 64KB if zero
+	MaxBodySize int64
+	// Headers whose values are replaced by "REDACTED", Authorization,
+	// Cookie and Set-Cookie if nil
+	RedactHeaders []string
+}
+
+// Capture returns a middleware writing a sample of the requests and of
+// their responses, with headers, bodies and timing, to opts.Output, to be
+// replayed against another host with the replay package. Failures to
+// write are logged.
+func (h *Handler) Capture(opts CaptureOptions) Middleware {
+	if opts.Percentage <= 0 {
+		opts.Percentage = 100
+	}
+	if opts.MaxBodySize <= 0 {
+		opts.MaxBodySize = 64 << 10
+	}
+	if opts.RedactHeaders == nil {
+		opts.RedactHeaders = []string{"Authorization", "Cookie", "Set-Cookie"}
+	}
+	var mu sync.Mutex
+	return func(next HandleFunc) HandleFunc {
+		return func(resp http.ResponseWriter, req *http.Request) error {
+			if opts.Percentage < 100 && rand.Float64()*100 >= opts.Percentage {
+				return next(resp, req)
+			}
+			e := CapturedExchange{
+				Time:          time.Now(),
+				Route:         RouteFrom(req),
+				Method:        req.Method,
+				URL:           req.URL.RequestURI(),
+				Host:          req.Host,
+				RequestHeader: redactHeader(req.Header, opts.RedactHeaders),
+			}
+			if req.Body != nil && req.Body != http.NoBody {
+				buf, err := ioutil.ReadAll(io.LimitReader(req.Body, opts.MaxBodySize+1))
+				if err != nil {
+					return errors.Wrap(err, "can't read request body")
+				}
+				// The handler reads the whole body
+				req.Body = struct {
+					io.Reader
+					io.Closer
+				}{io.MultiReader(bytes.NewReader(buf), req.Body), req.Body}
+				e.RequestBody, e.RequestTruncated = truncate(buf, opts.MaxBodySize)
+			}
+			cw := &exchangeWriter{ResponseRecorder: NewResponseRecorder(resp), limit: opts.MaxBodySize}
+			err := next(cw, req)
+			e.Status = cw.Status
+			if !cw.WroteHeader && err != nil {
+				e.Status = http.StatusInternalServerError
+			}
+			e.ResponseHeader = redactHeader(cw.Header(), opts.RedactHeaders)
+			e.ResponseBody, e.ResponseTruncated = cw.body.Bytes(), cw.truncated
+			e.LatencyMs = float64(time.Since(e.Time).Microseconds()) / 1000
+			e.RequestID = GetRequestID(req)
+			if e.RequestID == "" {
+				e.RequestID = cw.Header().Get(RequestIDHeader)
+			}
+			b, e2 := json.Marshal(e)
+			if e2 == nil {
+				mu.Lock()
+				_, e2 = opts.Output.Write(append(b, '\n'))
+				mu.Unlock()
+			}
+			if e2 != nil {
+				h.Log.WithFields(Fields{"route": e.Route}).Error(errors.Wrap(e2, "can't write captured request"))
+			}
+			return err
+		}
+	}
+}
+
+// exchangeWriter keeps a copy of the first limit bytes of the response body
+type exchangeWriter struct {
+	*ResponseRecorder
+	body      bytes.Buffer
+	limit     int64
+	truncated bool
+}
+
+func (cw *exchangeWriter) Write(b []byte) (int, error) {
+	if room := cw.limit - int64(cw.body.Len()); room < int64(len(b)) {
+		cw.body.Write(b[:room])
+		cw.truncated = true
+	} else {
+		cw.body.Write(b)
+	}
+	return cw.ResponseRecorder.Write(b)
+}
+
+// truncate cuts b at max bytes, reporting whether it did
+func truncate(b []byte, max int64) ([]byte, bool) {
+	if int64(len(b)) > max {
+		return b[:max], true
+	}
+	return b, false
+}
+
+// redactHeader returns a copy of header with the values of the names
+// replaced
+func redactHeader(header http.Header, names []string) http.Header {
+	header = header.Clone()
+	for _, k := range names {
+		if _, ok := header[http.CanonicalHeaderKey(k)]; ok {
+			header.Set(k, "REDACTED")
+		}
+	}
+	return header
+}
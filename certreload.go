@@ -0,0 +1,132 @@
+package hang
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// CertReloader serves a certificate loaded from files and reloads it,
+// without restarting the servers, when the files change, e.g. when
+// cert-manager or Vault rotate it. Set its GetCertificate in the TLS
+// configuration of the listeners, or use TLSConfig; any other
+// tls.Config.GetCertificate callback works the same way.
+type CertReloader struct {
+	Log Logger
+	// How often the files are checked for changes
+	Interval time.Duration
+
+	certFile, keyFile string
+	mu                sync.RWMutex
+	cert              *tls.Certificate
+	modTime           time.Time
+}
+
+// NewCertReloader loads the PEM certificate and key in certFile and keyFile,
+// checking them for changes every 30s when run
+func NewCertReloader(lg Logger, certFile, keyFile string) (*CertReloader, error) {
+	r := &CertReloader{Log: lg, Interval: 30 * time.Second, certFile: certFile, keyFile: keyFile}
+	err := r.Reload()
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// GetCertificate returns the current certificate, for tls.Config
+func (r *CertReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
+
+// TLSConfig returns a copy of base, nil for the defaults, serving the
+// current certificate
+func (r *CertReloader) TLSConfig(base *tls.Config) *tls.Config {
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	if base != nil {
+		cfg = base.Clone()
+	}
+	cfg.Certificates = nil
+	cfg.GetCertificate = r.GetCertificate
+	return cfg
+}
+
+// Reload loads the certificate from the files, keeping the current one if
+// they are invalid (e.g. the key being rotated after the certificate)
+func (r *CertReloader) Reload() error {
+	mt := r.filesModTime()
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return errors.Wrap(err, "can't load certificate "+r.certFile)
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return errors.Wrap(err, "can't parse certificate "+r.certFile)
+	}
+	cert.Leaf = leaf
+	sum := sha256.Sum256(leaf.Raw)
+	r.mu.Lock()
+	r.cert = &cert
+	r.modTime = mt
+	r.mu.Unlock()
+	r.Log.WithFields(Fields{
+		"file":        r.certFile,
+		"subject":     leaf.Subject.String(),
+		"fingerprint": hex.EncodeToString(sum[:]),
+		"not_after":   leaf.NotAfter.Format(time.RFC3339),
+		"expires_in":  time.Until(leaf.NotAfter).Round(time.Second).String(),
+	}).Info("certificate loaded")
+	return nil
+}
+
+// Run checks the files for changes until ctx is cancelled, to be added to
+// a Lifecycle
+func (r *CertReloader) Run(ctx context.Context) error {
+	if r.Interval <= 0 {
+		<-ctx.Done()
+		return nil
+	}
+	ticker := time.NewTicker(r.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			r.mu.RLock()
+			changed := !r.filesModTime().Equal(r.modTime)
+			r.mu.RUnlock()
+			if !changed {
+				continue
+			}
+			if err := r.Reload(); err != nil {
+				// Retried at the next check
+				r.Log.Warn(err)
+			}
+		}
+	}
+}
+
+// filesModTime returns the latest modification time of the files, which
+// are followed if symlinks as in the Kubernetes secret volumes
+func (r *CertReloader) filesModTime() time.Time {
+	var latest time.Time
+	for _, f := range []string{r.certFile, r.keyFile} {
+		fi, err := os.Stat(f)
+		if err != nil {
+			continue
+		}
+		if fi.ModTime().After(latest) {
+			latest = fi.ModTime()
+		}
+	}
+	return latest
+}
@@ -0,0 +1,181 @@
+package hang
+
+import (
+	"math/rand"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// FaultRule describes the faults injected on a route. Each fault is applied
+// to its own percentage of the requests.
+type FaultRule struct {
+	// Percentage of the requests delayed by LatencyMS milliseconds
+	LatencyPercentage float64 `json:"latency_percentage,omitempty"`
+	LatencyMS         int     `json:"latency_ms,omitempty"`
+	// Percentage of the requests answered with ErrorStatus (500 if zero)
+	ErrorPercentage float64 `json:"error_percentage,omitempty"`
+	ErrorStatus     int     `json:"error_status,omitempty"`
+	// Percentage of the requests whose connection is reset
+	ResetPercentage float64 `json:"reset_percentage,omitempty"`
+}
+
+// FaultInjector injects latency, errors and connection resets for
+// resilience testing of the clients. It is disabled until enabled through
+// Enable or its endpoint; it must not be used in production.
+type FaultInjector struct {
+	mu      sync.Mutex
+	enabled bool
+	// Rules by route, "*" applying to routes without a rule
+	rules map[string]FaultRule
+	rnd   *rand.Rand
+}
+
+// faultState is the state of the injector exchanged by the endpoint
+type faultState struct {
+	Enabled bool                 `json:"enabled"`
+	Rules   map[string]FaultRule `json:"rules"`
+}
+
+// NewFaultInjector returns a disabled injector without rules
+func NewFaultInjector() *FaultInjector {
+	return &FaultInjector{rules: map[string]FaultRule{}, rnd: rand.New(rand.NewSource(time.Now().UnixNano()))}
+}
+
+// Enable turns the fault injection on or off
+func (f *FaultInjector) Enable(on bool) {
+	f.mu.Lock()
+	f.enabled = on
+	f.mu.Unlock()
+}
+
+// SetRule sets the faults of route, "*" for all the routes without a rule
+func (f *FaultInjector) SetRule(route string, rule FaultRule) {
+	f.mu.Lock()
+	f.rules[route] = rule
+	f.mu.Unlock()
+}
+
+// ClearRules removes all the rules
+func (f *FaultInjector) ClearRules() {
+	f.mu.Lock()
+	f.rules = map[string]FaultRule{}
+	f.mu.Unlock()
+}
+
+// draw returns the faults to inject on a request to route
+func (f *FaultInjector) draw(route string) (latency time.Duration, status int, reset bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !f.enabled {
+		return 0, 0, false
+	}
+	rule, ok := f.rules[route]
+	if !ok {
+		if rule, ok = f.rules["*"]; !ok {
+			return 0, 0, false
+		}
+	}
+	if f.rnd.Float64()*100 < rule.LatencyPercentage {
+		latency = time.Duration(rule.LatencyMS) * time.Millisecond
+	}
+	if f.rnd.Float64()*100 < rule.ResetPercentage {
+		return latency, 0, true
+	}
+	if f.rnd.Float64()*100 < rule.ErrorPercentage {
+		status = rule.ErrorStatus
+		if status == 0 {
+			status = http.StatusInternalServerError
+		}
+	}
+	return latency, status, false
+}
+
+// Middleware returns the middleware injecting the faults
+func (f *FaultInjector) Middleware() Middleware {
+	return func(next HandleFunc) HandleFunc {
+		return func(resp http.ResponseWriter, req *http.Request) error {
+			latency, status, reset := f.draw(RouteFrom(req))
+			if latency > 0 {
+				select {
+				case <-time.After(latency):
+				case <-req.Context().Done():
+					return errors.Wrap(req.Context().Err(), "request cancelled during injected latency")
+				}
+			}
+			if reset {
+				return resetConn(resp)
+			}
+			if status != 0 {
+				err := errors.Errorf("injected fault: status %v", status)
+				WriteError(resp, req, status, err)
+				return err
+			}
+			return next(resp, req)
+		}
+	}
+}
+
+// resetConn closes the client connection with a TCP reset
+func resetConn(resp http.ResponseWriter) error {
+	conn, _, err := http.NewResponseController(resp).Hijack()
+	if err != nil {
+		return errors.Wrap(err, "can't hijack connection to inject reset")
+	}
+	if tc, ok := conn.(*net.TCPConn); ok {
+		tc.SetLinger(0)
+	}
+	conn.Close()
+	return errors.New("injected fault: connection reset")
+}
+
+// EnableFaultInjectionEndpoint registers the endpoint controlling f (on the
+// admin listener, if enabled) protected by token, which can be empty only
+// with the admin listener
+func (h *Handler) EnableFaultInjectionEndpoint(token string, f *FaultInjector) error {
+	if err := h.checkControlToken("chaos", token); err != nil {
+		return err
+	}
+	return h.ops().AddRoute("chaos", RequireToken(token, DebugTokenHeader, f.Endpoint))
+}
+
+// Endpoint returns the injector state on GET, replaces it on PUT from a
+// {"enabled": true, "rules": {"route": {...}}} body and disables it
+// removing all the rules on DELETE
+func (f *FaultInjector) Endpoint(resp http.ResponseWriter, req *http.Request) error {
+	var err error
+	switch req.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		var data faultState
+		err = GetReqJSONData(resp, req, &data)
+		if err != nil {
+			return err
+		}
+		f.mu.Lock()
+		f.enabled = data.Enabled
+		f.rules = data.Rules
+		if f.rules == nil {
+			f.rules = map[string]FaultRule{}
+		}
+		f.mu.Unlock()
+	case http.MethodDelete:
+		f.Enable(false)
+		f.ClearRules()
+	default:
+		resp.Header().Set("Allow", "GET, PUT, DELETE")
+		err = errors.New("method " + req.Method + " not allowed")
+		WriteError(resp, req, http.StatusMethodNotAllowed, err)
+		return err
+	}
+	f.mu.Lock()
+	state := faultState{Enabled: f.enabled, Rules: make(map[string]FaultRule, len(f.rules))}
+	for route, rule := range f.rules {
+		state.Rules[route] = rule
+	}
+	f.mu.Unlock()
+	return WriteJSON(resp, http.StatusOK, state)
+}
@@ -0,0 +1,49 @@
+package hang
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestControlEndpointsToken(t *testing.T) {
+	enable := map[string]func(h *Handler, token string) error{
+		"chaos": func(h *Handler, token string) error {
+			return h.EnableFaultInjectionEndpoint(token, NewFaultInjector())
+		},
+		"loglevel":    (*Handler).EnableLogLevelEndpoint,
+		"maintenance": (*Handler).EnableMaintenanceEndpoint,
+	}
+	for route, fn := range enable {
+		t.Run(route, func(t *testing.T) {
+			if err := fn(testHandler(t), ""); err == nil {
+				t.Error("empty token accepted on the public listener")
+			}
+
+			h := testHandler(t)
+			h.EnableAdminListener("localhost:0")
+			if err := fn(h, ""); err != nil {
+				t.Errorf("empty token refused on the admin listener: %v", err)
+			}
+
+			h = testHandler(t)
+			if err := fn(h, "secret"); err != nil {
+				t.Fatal(err)
+			}
+			tests := []struct {
+				name       string
+				header     http.Header
+				authorized bool
+			}{
+				{"no token", nil, false},
+				{"wrong token", http.Header{DebugTokenHeader: {"wrong"}}, false},
+				{"token", http.Header{DebugTokenHeader: {"secret"}}, true},
+			}
+			for _, tt := range tests {
+				rec := serve(h, http.MethodGet, "/"+route, tt.header)
+				if authorized := rec.Code != http.StatusUnauthorized; authorized != tt.authorized {
+					t.Errorf("%s: got status %d, want authorized %v", tt.name, rec.Code, tt.authorized)
+				}
+			}
+		})
+	}
+}
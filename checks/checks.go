@@ -0,0 +1,128 @@
+// Package checks provides readiness checks for the common dependencies, to
+// be registered with hang's AddReadinessCheck:
+//
+//	h.AddReadinessCheck("redis", checks.Redis("localhost:6379", ""))
+//	h.AddReadinessCheck("billing", checks.HTTP("http://billing/livecheck", http.StatusOK))
+package checks
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/smtp"
+	"strings"
+	"time"
+
+	"github.com/brunetto/hang"
+	"github.com/pkg/errors"
+)
+
+// dialer is used by the TCP based checks, bounded by the context deadline
+var dialer net.Dialer
+
+// TCP checks that addr accepts connections
+func TCP(addr string) hang.CheckFunc {
+	return func(ctx context.Context) error {
+		conn, err := dialer.DialContext(ctx, "tcp", addr)
+		if err != nil {
+			return errors.Wrap(err, "can't connect to "+addr)
+		}
+		return conn.Close()
+	}
+}
+
+// HTTP checks that a GET to url responds with expectedStatus
+func HTTP(url string, expectedStatus int) hang.CheckFunc {
+	return func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return errors.Wrap(err, "can't create request")
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return errors.Wrap(err, "can't reach "+url)
+		}
+		// Drain to reuse the connection
+		io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 64<<10))
+		resp.Body.Close()
+		if resp.StatusCode != expectedStatus {
+			return errors.Errorf("%s responded %d, expected %d", url, resp.StatusCode, expectedStatus)
+		}
+		return nil
+	}
+}
+
+// Redis checks that the Redis server at addr answers PING, authenticating
+// with password if not empty
+func Redis(addr, password string) hang.CheckFunc {
+	return func(ctx context.Context) error {
+		conn, err := dialer.DialContext(ctx, "tcp", addr)
+		if err != nil {
+			return errors.Wrap(err, "can't connect to Redis at "+addr)
+		}
+		defer conn.Close()
+		setDeadline(ctx, conn)
+		r := bufio.NewReader(conn)
+		if password != "" {
+			if err = redisCommand(conn, r, "AUTH", password); err != nil {
+				return errors.Wrap(err, "Redis authentication failed")
+			}
+		}
+		return errors.Wrap(redisCommand(conn, r, "PING"), "Redis PING failed")
+	}
+}
+
+// redisCommand sends a command in RESP format and checks the reply is not
+// an error
+func redisCommand(w io.Writer, r *bufio.Reader, args ...string) error {
+	cmd := fmt.Sprintf("*%d\r\n", len(args))
+	for _, a := range args {
+		cmd += fmt.Sprintf("$%d\r\n%s\r\n", len(a), a)
+	}
+	if _, err := io.WriteString(w, cmd); err != nil {
+		return err
+	}
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return err
+	}
+	if strings.HasPrefix(line, "-") {
+		return errors.New(strings.TrimSpace(line[1:]))
+	}
+	return nil
+}
+
+// SMTP checks that the SMTP server at addr greets and answers NOOP
+func SMTP(addr string) hang.CheckFunc {
+	return func(ctx context.Context) error {
+		conn, err := dialer.DialContext(ctx, "tcp", addr)
+		if err != nil {
+			return errors.Wrap(err, "can't connect to SMTP server at "+addr)
+		}
+		setDeadline(ctx, conn)
+		host, _, _ := net.SplitHostPort(addr)
+		c, err := smtp.NewClient(conn, host)
+		if err != nil {
+			conn.Close()
+			return errors.Wrap(err, "bad SMTP greeting")
+		}
+		defer c.Close()
+		if err = c.Noop(); err != nil {
+			return errors.Wrap(err, "SMTP NOOP failed")
+		}
+		return c.Quit()
+	}
+}
+
+// setDeadline bounds the connection I/O to the context deadline, or to 5s
+func setDeadline(ctx context.Context, conn net.Conn) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(5 * time.Second)
+	}
+	conn.SetDeadline(deadline)
+}
@@ -0,0 +1,261 @@
+package hang
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// ClientOptions configures the outbound HTTP client
+type ClientOptions struct {
+	// Timeout of every single attempt, no timeout if zero
+	AttemptTimeout time.Duration
+	// Retries after the first attempt on connection errors and 5xx responses
+	MaxRetries int
+	// Backoff before the first retry, doubled at every retry up to MaxBackoff
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+	// Retry also non idempotent methods (POST, PATCH) without Idempotency-Key
+	RetryNonIdempotent bool
+	// Underlying client, http.DefaultClient if nil
+	HTTPClient *http.Client
+	// Propagator injecting the trace headers, W3C trace context if nil
+	Propagator propagation.TextMapPropagator
+	// Per-host circuit breaker settings, no breaker if nil; with a Resolver
+	// every instance has its own breaker
+	Breaker *BreakerOptions
+	// Resolver of the logical service names (see ServiceHostSuffix), e.g.
+	// a SRVResolver or a service registry
+	Resolver Resolver
+	// How long the instances of a service are cached, 10s if zero
+	ResolveTTL time.Duration
+	// Choice of the instance for every attempt
+	Balance BalancePolicy
+}
+
+// Client wraps http.Client adding logging, retries with exponential
+// backoff, per-attempt timeouts and propagation of the request ID and of
+// the trace context found in the request context
+type Client struct {
+	Log  Logger
+	opts ClientOptions
+	// Circuit breakers by host
+	breakersMu sync.Mutex
+	breakers   map[string]*CircuitBreaker
+	// Resolved services and requests in flight by instance
+	discovery discovery
+}
+
+// NewClient creates a new client with the given options; sensible
+// defaults are used for zero backoff values
+func NewClient(lg Logger, opts ClientOptions) *Client {
+	if opts.HTTPClient == nil {
+		opts.HTTPClient = http.DefaultClient
+	}
+	if opts.BaseBackoff == 0 {
+		opts.BaseBackoff = 100 * time.Millisecond
+	}
+	if opts.MaxBackoff == 0 {
+		opts.MaxBackoff = 5 * time.Second
+	}
+	if opts.Propagator == nil {
+		opts.Propagator = propagation.TraceContext{}
+	}
+	if opts.ResolveTTL == 0 {
+		opts.ResolveTTL = 10 * time.Second
+	}
+	return &Client{Log: lg, opts: opts}
+}
+
+// Get issues a GET to url with the given context
+func (c *Client) Get(ctx context.Context, url string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't create request")
+	}
+	return c.Do(req)
+}
+
+// Post issues a POST to url with the given context, content type and body
+func (c *Client) Post(ctx context.Context, url, contentType string, body []byte) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, errors.Wrap(err, "can't create request")
+	}
+	req.Header.Set("Content-Type", contentType)
+	return c.Do(req)
+}
+
+// Do sends the request, retrying on connection errors and 5xx responses.
+// The context of the request bounds all the attempts.
+func (c *Client) Do(req *http.Request) (*http.Response, error) {
+	var (
+		resp *http.Response
+		body []byte
+		err  error
+	)
+	// Buffer the body to replay it at every attempt
+	if req.Body != nil && req.GetBody == nil {
+		body, err = ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, errors.Wrap(err, "can't read request body")
+		}
+		req.GetBody = func() (io.ReadCloser, error) {
+			return ioutil.NopCloser(bytes.NewReader(body)), nil
+		}
+		req.Body, _ = req.GetBody()
+	}
+
+	// Propagate request ID and trace context
+	ctx := req.Context()
+	if id := RequestIDFromContext(ctx); id != "" && req.Header.Get(RequestIDHeader) == "" {
+		req.Header.Set(RequestIDHeader, id)
+	}
+	c.opts.Propagator.Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	retries := c.opts.MaxRetries
+	if !c.opts.RetryNonIdempotent && !isIdempotent(req) {
+		retries = 0
+	}
+	for attempt := 0; ; attempt++ {
+		resp, err = c.attempt(req, attempt)
+		if attempt >= retries || !shouldRetry(resp, err) || ctx.Err() != nil {
+			break
+		}
+		wait := c.backoff(attempt)
+		fields := Fields{"method": req.Method, "url": req.URL.String(), "attempt": attempt + 1, "backoff": wait.String()}
+		if err != nil {
+			c.Log.WithFields(fields).Warn(errors.Wrap(err, "request failed, retrying"))
+		} else {
+			c.Log.WithFields(fields).Warnf("request failed with status %v, retrying", resp.StatusCode)
+			// Discard the failed response
+			io.Copy(ioutil.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return nil, errors.Wrap(ctx.Err(), "request cancelled while waiting to retry")
+		}
+		if req.GetBody != nil {
+			req.Body, err = req.GetBody()
+			if err != nil {
+				return nil, errors.Wrap(err, "can't rewind request body")
+			}
+		}
+	}
+	if err != nil {
+		c.Log.WithFields(Fields{"method": req.Method, "url": req.URL.String()}).Error(err)
+	}
+	return resp, err
+}
+
+// attempt sends the request once, with the per-attempt timeout, through
+// the circuit breaker of the host, to an instance of the service if the
+// host is a logical service name
+func (c *Client) attempt(req *http.Request, n int) (*http.Response, error) {
+	var (
+		ctx    = req.Context()
+		cancel = context.CancelFunc(func() {})
+		start  = time.Now()
+	)
+	if service := serviceName(req.URL.Host); service != "" && c.opts.Resolver != nil {
+		addr, err := c.pick(ctx, service)
+		if err != nil {
+			return nil, errors.Wrap(err, "can't find an instance of "+service)
+		}
+		r := req.Clone(ctx)
+		r.URL.Host, r.Host = addr, addr
+		req = r
+		pending := c.pendingCounter(addr)
+		atomic.AddInt64(pending, 1)
+		cancel = func() { atomic.AddInt64(pending, -1) }
+	}
+	cb := c.breaker(req.URL.Host)
+	if cb != nil {
+		if err := cb.Allow(); err != nil {
+			cancel()
+			return nil, errors.Wrap(err, "request to "+req.URL.Host+" refused")
+		}
+	}
+	if c.opts.AttemptTimeout > 0 {
+		var timeoutCancel context.CancelFunc
+		ctx, timeoutCancel = context.WithTimeout(ctx, c.opts.AttemptTimeout)
+		done := cancel
+		cancel = func() {
+			timeoutCancel()
+			done()
+		}
+	}
+	resp, err := c.opts.HTTPClient.Do(req.WithContext(ctx))
+	fields := Fields{"method": req.Method, "url": req.URL.String(), "attempt": n + 1, "latency": time.Since(start).String()}
+	if err != nil {
+		cancel()
+		if cb != nil {
+			cb.Failure()
+		}
+		return nil, errors.Wrap(err, "request to "+req.URL.Host+" failed")
+	}
+	if cb != nil {
+		if resp.StatusCode >= 500 {
+			cb.Failure()
+		} else {
+			cb.Success()
+		}
+	}
+	fields["status"] = resp.StatusCode
+	c.Log.WithFields(fields).Debug("outbound request")
+	// Release the attempt context when the body is closed
+	resp.Body = &cancelBody{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+// backoff returns the wait before the retry following attempt, with jitter
+func (c *Client) backoff(attempt int) time.Duration {
+	d := c.opts.BaseBackoff << uint(attempt)
+	if d <= 0 || d > c.opts.MaxBackoff {
+		d = c.opts.MaxBackoff
+	}
+	// Between d/2 and d
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+func shouldRetry(resp *http.Response, err error) bool {
+	if errors.Is(err, ErrCircuitOpen) {
+		return false
+	}
+	if err != nil {
+		return true
+	}
+	return resp.StatusCode >= 500
+}
+
+func isIdempotent(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return req.Header.Get("Idempotency-Key") != ""
+}
+
+// cancelBody cancels the attempt context on close
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
@@ -0,0 +1,261 @@
+package hang
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CompressOptions configures the compression middleware
+type CompressOptions struct {
+	// Responses smaller than MinSize bytes are not compressed, 1024 if zero
+	MinSize int
+	// Compressed content types; a trailing /* matches a whole type.
+	// Text, JSON, JavaScript, XML and SVG if empty.
+	ContentTypes []string
+	// Compression level, gzip.DefaultCompression if zero
+	Level int
+}
+
+var defaultCompressTypes = []string{
+	"text/*",
+	"application/json",
+	"application/problem+json",
+	"application/javascript",
+	"application/xml",
+	"image/svg+xml",
+}
+
+func (o CompressOptions) withDefaults() CompressOptions {
+	if o.MinSize <= 0 {
+		o.MinSize = 1024
+	}
+	if len(o.ContentTypes) == 0 {
+		o.ContentTypes = defaultCompressTypes
+	}
+	if o.Level == 0 {
+		o.Level = gzip.DefaultCompression
+	}
+	return o
+}
+
+// allowed tells if the content type has to be compressed
+func (o CompressOptions) allowed(contentType string) bool {
+	mt, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, t := range o.ContentTypes {
+		if t == mt || (strings.HasSuffix(t, "/*") && strings.HasPrefix(mt, strings.TrimSuffix(t, "*"))) {
+			return true
+		}
+	}
+	return false
+}
+
+// Compress returns a middleware compressing the responses with gzip or
+// deflate, as negotiated with the Accept-Encoding header
+func Compress(opts CompressOptions) Middleware {
+	opts = opts.withDefaults()
+	return func(next HandleFunc) HandleFunc {
+		return func(resp http.ResponseWriter, req *http.Request) error {
+			resp.Header().Add("Vary", "Accept-Encoding")
+			encoding := negotiateEncoding(req.Header.Get("Accept-Encoding"))
+			if encoding == "" || req.Method == http.MethodHead {
+				return next(resp, req)
+			}
+			cw := newCompressWriter(resp, encoding, opts)
+			err := next(cw, req)
+			cw.Close()
+			return err
+		}
+	}
+}
+
+// GinCompress is the Compress middleware for gin engines
+func GinCompress(opts CompressOptions) gin.HandlerFunc {
+	opts = opts.withDefaults()
+	return func(c *gin.Context) {
+		c.Header("Vary", "Accept-Encoding")
+		encoding := negotiateEncoding(c.GetHeader("Accept-Encoding"))
+		if encoding == "" || c.Request.Method == http.MethodHead {
+			c.Next()
+			return
+		}
+		cw := newCompressWriter(c.Writer, encoding, opts)
+		c.Writer = &ginCompressWriter{ResponseWriter: c.Writer, cw: cw}
+		c.Next()
+		cw.Close()
+	}
+}
+
+// negotiateEncoding returns gzip, deflate or "" from the Accept-Encoding header
+func negotiateEncoding(accept string) string {
+	var (
+		best  string
+		bestQ float64
+	)
+	for _, part := range strings.Split(accept, ",") {
+		fields := strings.Split(strings.TrimSpace(part), ";")
+		enc := strings.ToLower(strings.TrimSpace(fields[0]))
+		q := 1.0
+		for _, p := range fields[1:] {
+			p = strings.TrimSpace(p)
+			if strings.HasPrefix(p, "q=") {
+				if v, err := strconv.ParseFloat(p[2:], 64); err == nil {
+					q = v
+				}
+			}
+		}
+		if enc == "*" {
+			enc = "gzip"
+		}
+		if (enc != "gzip" && enc != "deflate") || q <= 0 {
+			continue
+		}
+		// Prefer gzip on equal weight
+		if q > bestQ || (q == bestQ && enc == "gzip") {
+			best, bestQ = enc, q
+		}
+	}
+	return best
+}
+
+// compressWriter buffers the beginning of the response to decide whether
+// to compress it
+type compressWriter struct {
+	http.ResponseWriter
+	encoding string
+	opts     CompressOptions
+	status   int
+	buf      []byte
+	decided  bool
+	enc      io.WriteCloser
+}
+
+func newCompressWriter(resp http.ResponseWriter, encoding string, opts CompressOptions) *compressWriter {
+	return &compressWriter{ResponseWriter: resp, encoding: encoding, opts: opts}
+}
+
+func (cw *compressWriter) WriteHeader(status int) {
+	if cw.status == 0 {
+		cw.status = status
+	}
+}
+
+func (cw *compressWriter) Write(b []byte) (int, error) {
+	if cw.decided {
+		if cw.enc != nil {
+			return cw.enc.Write(b)
+		}
+		return cw.ResponseWriter.Write(b)
+	}
+	cw.buf = append(cw.buf, b...)
+	if len(cw.buf) >= cw.opts.MinSize {
+		if err := cw.decide(true); err != nil {
+			return 0, err
+		}
+	}
+	return len(b), nil
+}
+
+// decide starts the compression if possible, writing the header and the
+// buffered bytes
+func (cw *compressWriter) decide(bigEnough bool) error {
+	cw.decided = true
+	h := cw.Header()
+	if h.Get("Content-Type") == "" && len(cw.buf) > 0 {
+		h.Set("Content-Type", http.DetectContentType(cw.buf))
+	}
+	status := cw.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	compress := bigEnough &&
+		h.Get("Content-Encoding") == "" &&
+		status != http.StatusNoContent && status != http.StatusNotModified &&
+		cw.opts.allowed(h.Get("Content-Type"))
+	if compress {
+		h.Set("Content-Encoding", cw.encoding)
+		h.Del("Content-Length")
+		if cw.encoding == "gzip" {
+			cw.enc, _ = gzip.NewWriterLevel(cw.ResponseWriter, cw.opts.Level)
+		} else {
+			cw.enc, _ = flate.NewWriter(cw.ResponseWriter, cw.opts.Level)
+		}
+	}
+	cw.ResponseWriter.WriteHeader(status)
+	buf := cw.buf
+	cw.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	var err error
+	if cw.enc != nil {
+		_, err = cw.enc.Write(buf)
+	} else {
+		_, err = cw.ResponseWriter.Write(buf)
+	}
+	return err
+}
+
+// Flush sends what has been written so far, compressing it if allowed
+func (cw *compressWriter) Flush() {
+	if !cw.decided {
+		cw.decide(true)
+	}
+	if f, ok := cw.enc.(interface{ Flush() error }); ok {
+		f.Flush()
+	}
+	if f, ok := cw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Close writes the pending bytes and terminates the compressed stream
+func (cw *compressWriter) Close() error {
+	if !cw.decided {
+		if cw.status == 0 && len(cw.buf) == 0 {
+			// Nothing written by the handler
+			return nil
+		}
+		cw.decide(false)
+	}
+	if cw.enc != nil {
+		return cw.enc.Close()
+	}
+	return nil
+}
+
+// Unwrap returns the wrapped writer, for http.ResponseController
+func (cw *compressWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+// ginCompressWriter adapts compressWriter to gin.ResponseWriter
+type ginCompressWriter struct {
+	gin.ResponseWriter
+	cw *compressWriter
+}
+
+func (g *ginCompressWriter) WriteHeader(status int) {
+	g.cw.WriteHeader(status)
+}
+
+func (g *ginCompressWriter) Write(b []byte) (int, error) {
+	return g.cw.Write(b)
+}
+
+func (g *ginCompressWriter) WriteString(s string) (int, error) {
+	return g.cw.Write([]byte(s))
+}
+
+func (g *ginCompressWriter) Flush() {
+	g.cw.Flush()
+}
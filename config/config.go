@@ -0,0 +1,515 @@
+// Package config loads a typed configuration struct from a file (YAML, JSON
+// or TOML), environment variables and command line flags.
+//
+// Precedence, from lowest to highest: `default` struct tags, file, remote
+// source (Consul KV, etcd), environment, flags. Environment variables are named after the field path
+// (PREFIX_SECTION_FIELD) unless an `env` tag is given, flags after the
+// lowercase dotted path (section.field) unless a `flag` tag is given; `-`
+// disables either. The `usage` tag documents the flag. String values can
+// reference secrets as ${vault:secret/path#key}, resolved by the providers in
+// Options.Secrets so that they never land in files or environment variables.
+// After loading, the struct is validated with the `validate` tags
+// (go-playground/validator).
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/go-playground/validator/v10"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// Options tells Load where to read the configuration from
+type Options struct {
+	// Config file path, format from the extension (.yaml, .yml, .json, .toml).
+	// No file is read if empty.
+	Path string
+	// Prefix of the environment variables, e.g. APP for APP_HTTP_ADDR
+	EnvPrefix string
+	// Command line arguments, os.Args[1:] if nil
+	Args []string
+	// Flag set where the flags are registered, a new one if nil
+	FlagSet *flag.FlagSet
+	// Do not read environment variables
+	DisableEnv bool
+	// Do not register and parse flags
+	DisableFlags bool
+	// Centrally managed settings, loaded after the file
+	Remote RemoteSource
+	// Providers of the secrets referenced by the string fields as
+	// ${scheme:path#key}, by scheme (e.g. "vault")
+	Secrets map[string]SecretProvider
+}
+
+// Load fills cfg, a pointer to struct, from defaults, file, environment and
+// flags, then validates it
+func Load(cfg interface{}, opts Options) error {
+	_, err := load(cfg, opts, nil)
+	return err
+}
+
+// flagArgs are the values of the config flags set on the command line, by
+// flag name, in order
+type flagArgs map[string][]string
+
+// load implements Load, applying the flags already parsed, if not nil,
+// instead of parsing them. It returns the flags applied.
+func load(cfg interface{}, opts Options, flags flagArgs) (flagArgs, error) {
+	var (
+		fields []field
+		err    error
+	)
+	rv := reflect.ValueOf(cfg)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Struct {
+		return nil, errors.New("config must be a pointer to struct")
+	}
+	fields = collect(rv.Elem(), nil)
+
+	// Defaults
+	for _, f := range fields {
+		if def, ok := f.tag.Lookup("default"); ok {
+			if err = set(f.value, def); err != nil {
+				return nil, errors.Wrap(err, "invalid default for "+f.path())
+			}
+		}
+	}
+
+	// File
+	if opts.Path != "" {
+		if err = LoadFile(opts.Path, cfg); err != nil {
+			return nil, err
+		}
+	}
+
+	// Remote settings
+	if opts.Remote != nil {
+		if err = applyRemote(fields, opts.Remote); err != nil {
+			return nil, err
+		}
+	}
+
+	// Environment
+	if !opts.DisableEnv {
+		for _, f := range fields {
+			name := f.envName(opts.EnvPrefix)
+			if name == "" {
+				continue
+			}
+			if s, ok := os.LookupEnv(name); ok {
+				if err = set(f.value, s); err != nil {
+					return nil, errors.Wrap(err, "invalid value for "+name)
+				}
+			}
+		}
+	}
+
+	// Flags
+	if !opts.DisableFlags {
+		if flags == nil {
+			flags, err = parseFlags(fields, opts)
+		} else {
+			err = applyFlags(fields, flags)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Secrets
+	if len(opts.Secrets) > 0 {
+		if err = resolveSecrets(fields, opts.Secrets); err != nil {
+			return nil, err
+		}
+	}
+
+	return flags, Validate(cfg)
+}
+
+// LoadFile decodes the file at path into cfg, choosing the format from the
+// file extension. Durations can be written as strings, e.g. "5s", and, in
+// JSON, also as nanoseconds.
+func LoadFile(path string, cfg interface{}) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return errors.Wrap(err, "can't read config file")
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(b, cfg)
+	case ".json":
+		var data interface{}
+		dec := json.NewDecoder(bytes.NewReader(b))
+		// Keep the nanoseconds exact
+		dec.UseNumber()
+		if err = dec.Decode(&data); err == nil {
+			var changed bool
+			// encoding/json decodes durations from numbers only
+			if changed, err = parseDurations(reflect.TypeOf(cfg), data); changed {
+				b, err = json.Marshal(data)
+			}
+			if err == nil {
+				err = json.Unmarshal(b, cfg)
+			}
+		}
+	case ".toml":
+		err = toml.Unmarshal(b, cfg)
+	default:
+		return errors.New("unknown config file format " + filepath.Ext(path))
+	}
+	if err != nil {
+		return errors.Wrap(err, "can't decode config file "+path)
+	}
+	return nil
+}
+
+// parseDurations walks data, decoded from a JSON file, along the type t
+// replacing the duration strings with nanoseconds. It reports whether data
+// was changed.
+func parseDurations(t reflect.Type, data interface{}) (bool, error) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	changed := false
+	switch t.Kind() {
+	case reflect.Slice, reflect.Array:
+		items, _ := data.([]interface{})
+		for _, item := range items {
+			c, err := parseDurations(t.Elem(), item)
+			if err != nil {
+				return false, err
+			}
+			changed = changed || c
+		}
+	case reflect.Map:
+		m, _ := data.(map[string]interface{})
+		for _, item := range m {
+			c, err := parseDurations(t.Elem(), item)
+			if err != nil {
+				return false, err
+			}
+			changed = changed || c
+		}
+	case reflect.Struct:
+		m, ok := data.(map[string]interface{})
+		if !ok || t == reflect.TypeOf(time.Time{}) {
+			return false, nil
+		}
+		for i := 0; i < t.NumField(); i++ {
+			sf := t.Field(i)
+			if sf.PkgPath != "" && !sf.Anonymous {
+				continue
+			}
+			parts := strings.Split(sf.Tag.Get("json"), ",")
+			name := parts[0]
+			if name == "-" && len(parts) == 1 {
+				continue
+			}
+			if sf.Anonymous && name == "" {
+				// Embedded fields are decoded from the same object
+				c, err := parseDurations(sf.Type, m)
+				if err != nil {
+					return false, err
+				}
+				changed = changed || c
+				continue
+			}
+			if name == "" {
+				name = sf.Name
+			}
+			key, ok := fileKey(m, name)
+			if !ok {
+				continue
+			}
+			ft := sf.Type
+			for ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft != durationType {
+				c, err := parseDurations(ft, m[key])
+				if err != nil {
+					return false, err
+				}
+				changed = changed || c
+				continue
+			}
+			if s, ok := m[key].(string); ok {
+				d, err := time.ParseDuration(s)
+				if err != nil {
+					return false, errors.Wrap(err, "invalid duration for "+key)
+				}
+				m[key] = int64(d)
+				changed = true
+			}
+		}
+	}
+	return changed, nil
+}
+
+// fileKey returns the key of m decoded into the field called name: the
+// exact match or, as encoding/json does, one differing in case
+func fileKey(m map[string]interface{}, name string) (string, bool) {
+	if _, ok := m[name]; ok {
+		return name, true
+	}
+	for k := range m {
+		if strings.EqualFold(k, name) {
+			return k, true
+		}
+	}
+	return "", false
+}
+
+var validate = validator.New()
+
+// Validate checks the `validate` struct tags of cfg
+func Validate(cfg interface{}) error {
+	err := validate.Struct(cfg)
+	if err != nil {
+		return errors.Wrap(err, "invalid configuration")
+	}
+	return nil
+}
+
+// field is a leaf of the configuration struct
+type field struct {
+	names []string
+	tag   reflect.StructTag
+	value reflect.Value
+}
+
+func (f field) path() string {
+	return strings.Join(f.names, ".")
+}
+
+func (f field) envName(prefix string) string {
+	if name, ok := f.tag.Lookup("env"); ok {
+		if name == "-" {
+			return ""
+		}
+		return name
+	}
+	parts := []string{}
+	if prefix != "" {
+		parts = append(parts, prefix)
+	}
+	for _, n := range f.names {
+		parts = append(parts, strings.ToUpper(n))
+	}
+	return strings.Join(parts, "_")
+}
+
+func (f field) flagName() string {
+	if name, ok := f.tag.Lookup("flag"); ok {
+		if name == "-" {
+			return ""
+		}
+		return name
+	}
+	return strings.ToLower(f.path())
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// collect walks the struct returning its settable leaves
+func collect(v reflect.Value, parents []string) []field {
+	var fields []field
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.PkgPath != "" {
+			// Unexported
+			continue
+		}
+		names := append(append([]string{}, parents...), fieldName(sf))
+		fv := v.Field(i)
+		if sf.Type.Kind() == reflect.Struct && sf.Type != reflect.TypeOf(time.Time{}) {
+			fields = append(fields, collect(fv, names)...)
+			continue
+		}
+		fields = append(fields, field{names: names, tag: sf.Tag, value: fv})
+	}
+	return fields
+}
+
+// fieldName uses the name from the file format tags, if any
+func fieldName(sf reflect.StructField) string {
+	for _, key := range []string{"yaml", "json", "toml"} {
+		name := strings.SplitN(sf.Tag.Get(key), ",", 2)[0]
+		if name != "" && name != "-" {
+			return name
+		}
+	}
+	return sf.Name
+}
+
+// set parses s into v according to its type
+func set(v reflect.Value, s string) error {
+	if v.Type() == durationType {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+	if v.Type() == reflect.TypeOf(time.Time{}) {
+		t, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(t))
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(n)
+	case reflect.Slice:
+		// Comma separated values
+		parts := []string{}
+		if s != "" {
+			parts = strings.Split(s, ",")
+		}
+		sl := reflect.MakeSlice(v.Type(), len(parts), len(parts))
+		for i, p := range parts {
+			if err := set(sl.Index(i), strings.TrimSpace(p)); err != nil {
+				return err
+			}
+		}
+		v.Set(sl)
+	default:
+		return errors.New("unsupported type " + v.Type().String())
+	}
+	return nil
+}
+
+// flagValue sets a config field from a flag, recording the values in args
+type flagValue struct {
+	value reflect.Value
+	name  string
+	args  flagArgs
+}
+
+func (fv *flagValue) String() string {
+	if !fv.value.IsValid() {
+		return ""
+	}
+	return toString(fv.value)
+}
+
+func (fv *flagValue) Set(s string) error {
+	if fv.args != nil {
+		fv.args[fv.name] = append(fv.args[fv.name], s)
+	}
+	return set(fv.value, s)
+}
+
+// IsBoolFlag allows -flag without value for booleans
+func (fv *flagValue) IsBoolFlag() bool {
+	return fv.value.IsValid() && fv.value.Kind() == reflect.Bool
+}
+
+func toString(v reflect.Value) string {
+	if v.Type() == durationType {
+		return time.Duration(v.Int()).String()
+	}
+	if v.Kind() == reflect.Slice {
+		parts := make([]string, v.Len())
+		for i := range parts {
+			parts[i] = toString(v.Index(i))
+		}
+		return strings.Join(parts, ",")
+	}
+	if t, ok := v.Interface().(time.Time); ok {
+		return t.Format(time.RFC3339)
+	}
+	return fmtValue(v)
+}
+
+func fmtValue(v reflect.Value) string {
+	switch v.Kind() {
+	case reflect.String:
+		return v.String()
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(v.Uint(), 10)
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'g', -1, v.Type().Bits())
+	}
+	return ""
+}
+
+// parseFlags parses the command line setting the fields, returning the
+// config flags set
+func parseFlags(fields []field, opts Options) (flagArgs, error) {
+	fs := opts.FlagSet
+	if fs == nil {
+		fs = flag.NewFlagSet(filepath.Base(os.Args[0]), flag.ContinueOnError)
+	}
+	args := opts.Args
+	if args == nil {
+		args = os.Args[1:]
+	}
+	flags := flagArgs{}
+	for _, f := range fields {
+		name := f.flagName()
+		if name == "" {
+			continue
+		}
+		// Flags get the value set so far as default, for the usage message
+		fs.Var(&flagValue{value: f.value, name: name, args: flags}, name, f.tag.Get("usage"))
+	}
+	err := fs.Parse(args)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't parse flags")
+	}
+	return flags, nil
+}
+
+// applyFlags sets the fields from the flags parsed by parseFlags
+func applyFlags(fields []field, flags flagArgs) error {
+	for _, f := range fields {
+		for _, s := range flags[f.flagName()] {
+			if err := set(f.value, s); err != nil {
+				return errors.Wrap(err, "invalid value for flag "+f.flagName())
+			}
+		}
+	}
+	return nil
+}
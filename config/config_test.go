@@ -0,0 +1,74 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLoadFileDurations(t *testing.T) {
+	type server struct {
+		Timeout time.Duration `json:"timeout" yaml:"timeout" toml:"timeout"`
+	}
+	type cfg struct {
+		ReadTimeout time.Duration `json:"read_timeout" yaml:"read_timeout" toml:"read_timeout"`
+		Interval    time.Duration
+		Retry       *time.Duration    `json:"retry" yaml:"retry" toml:"retry"`
+		Server      server            `json:"server" yaml:"server" toml:"server"`
+		Backends    []server          `json:"backends" yaml:"backends" toml:"backends"`
+		Named       map[string]server `json:"named" yaml:"named" toml:"named"`
+		Name        string            `json:"name" yaml:"name" toml:"name"`
+	}
+	want := cfg{
+		ReadTimeout: 5 * time.Second,
+		Interval:    time.Minute,
+		Server:      server{Timeout: 1500 * time.Millisecond},
+		Backends:    []server{{Timeout: time.Hour}, {Timeout: 2}},
+		Named:       map[string]server{"db": {Timeout: 3 * time.Second}},
+		Name:        "app",
+	}
+	tests := []struct {
+		file    string
+		content string
+	}{
+		{"config.json", `{"read_timeout": "5s", "interval": "1m", "server": {"timeout": "1.5s"},
+			"backends": [{"timeout": "1h"}, {"timeout": 2}], "named": {"db": {"timeout": "3s"}}, "name": "app"}`},
+		{"config.yaml", "read_timeout: 5s\ninterval: 1m\nserver:\n  timeout: 1.5s\nbackends:\n  - timeout: 1h\n  - timeout: 2ns\nnamed:\n  db:\n    timeout: 3s\nname: app\n"},
+		{"config.toml", "read_timeout = \"5s\"\ninterval = \"1m\"\nname = \"app\"\n[server]\ntimeout = \"1.5s\"\n[[backends]]\ntimeout = \"1h\"\n[[backends]]\ntimeout = \"2ns\"\n[named.db]\ntimeout = \"3s\"\n"},
+		{"nanoseconds.json", `{"read_timeout": 5000000000, "interval": 60000000000, "server": {"timeout": 1500000000},
+			"backends": [{"timeout": 3600000000000}, {"timeout": 2}], "named": {"db": {"timeout": 3000000000}}, "name": "app"}`},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(t.TempDir(), tt.file)
+		if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		var got cfg
+		if err := LoadFile(path, &got); err != nil {
+			t.Errorf("%s: %v", tt.file, err)
+			continue
+		}
+		if got.ReadTimeout != want.ReadTimeout || got.Interval != want.Interval || got.Server != want.Server ||
+			len(got.Backends) != 2 || got.Backends[0] != want.Backends[0] || got.Backends[1] != want.Backends[1] ||
+			got.Named["db"] != want.Named["db"] || got.Name != want.Name {
+			t.Errorf("%s: got %+v, want %+v", tt.file, got, want)
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(`{"retry": "10ms"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var got cfg
+	if err := LoadFile(path, &got); err != nil || got.Retry == nil || *got.Retry != 10*time.Millisecond {
+		t.Errorf("got retry %v (%v), want 10ms", got.Retry, err)
+	}
+
+	if err := os.WriteFile(path, []byte(`{"read_timeout": "5 seconds"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := LoadFile(path, &got); err == nil {
+		t.Error("invalid duration accepted")
+	}
+}
@@ -0,0 +1,316 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// RemoteSource provides centrally managed settings, such as a Consul KV
+// prefix or an etcd keyspace, as string values by field path (the lowercase
+// dotted path of the flags, e.g. "http.addr"). They are loaded after the
+// file and before the environment, and the Watcher reloads the
+// configuration when they change.
+type RemoteSource interface {
+	// Values returns the settings by field path
+	Values(ctx context.Context) (map[string]string, error)
+	// Wait blocks until the settings changed since the last Values, or ctx
+	// is cancelled
+	Wait(ctx context.Context) error
+}
+
+// applyRemote sets the fields from the remote settings
+func applyRemote(fields []field, src RemoteSource) error {
+	ctx, cancel := context.WithTimeout(context.Background(), SecretTimeout)
+	defer cancel()
+	values, err := src.Values(ctx)
+	if err != nil {
+		return errors.Wrap(err, "can't load remote configuration")
+	}
+	for _, f := range fields {
+		s, ok := values[strings.ToLower(f.path())]
+		if !ok {
+			continue
+		}
+		if err = set(f.value, s); err != nil {
+			return errors.Wrap(err, "invalid remote value for "+f.path())
+		}
+	}
+	return nil
+}
+
+// keyPath turns the key of a remote setting relative to the prefix into a
+// field path: "http/addr" becomes "http.addr"
+func keyPath(key, prefix string) string {
+	key = strings.Trim(strings.TrimPrefix(key, prefix), "/")
+	return strings.ToLower(strings.Replace(key, "/", ".", -1))
+}
+
+// ConsulKV is a RemoteSource reading the keys under a Consul KV prefix,
+// e.g. config/billing/http/addr for the field http.addr of the prefix
+// config/billing, watching them with blocking queries
+type ConsulKV struct {
+	// Agent address and ACL token, from CONSUL_HTTP_ADDR and
+	// CONSUL_HTTP_TOKEN by default
+	Addr  string
+	Token string
+	// Prefix of the keys
+	Prefix string
+	// Longest blocking query
+	WaitTime time.Duration
+	Client   *http.Client
+
+	mu    sync.Mutex
+	index uint64
+}
+
+// NewConsulKV returns a source for prefix on the Consul agent at addr
+func NewConsulKV(addr, token, prefix string) *ConsulKV {
+	if addr == "" {
+		addr = os.Getenv("CONSUL_HTTP_ADDR")
+	}
+	if addr == "" {
+		addr = "http://127.0.0.1:8500"
+	}
+	if !strings.Contains(addr, "://") {
+		addr = "http://" + addr
+	}
+	if token == "" {
+		token = os.Getenv("CONSUL_HTTP_TOKEN")
+	}
+	return &ConsulKV{
+		Addr:     strings.TrimSuffix(addr, "/"),
+		Token:    token,
+		Prefix:   strings.Trim(prefix, "/"),
+		WaitTime: 5 * time.Minute,
+		// Longer than the blocking queries
+		Client: &http.Client{Timeout: 6 * time.Minute},
+	}
+}
+
+// Values implements RemoteSource
+func (c *ConsulKV) Values(ctx context.Context) (map[string]string, error) {
+	var entries []struct {
+		Key   string
+		Value string
+	}
+	index, err := c.get(ctx, 0, &entries)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	c.index = index
+	c.mu.Unlock()
+	values := make(map[string]string, len(entries))
+	for _, e := range entries {
+		if strings.HasSuffix(e.Key, "/") {
+			// Folder
+			continue
+		}
+		v, err := base64.StdEncoding.DecodeString(e.Value)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid value of "+e.Key)
+		}
+		values[keyPath(e.Key, c.Prefix)] = string(v)
+	}
+	return values, nil
+}
+
+// Wait implements RemoteSource with a blocking query
+func (c *ConsulKV) Wait(ctx context.Context) error {
+	c.mu.Lock()
+	last := c.index
+	c.mu.Unlock()
+	for {
+		index, err := c.get(ctx, last, nil)
+		if err != nil {
+			return err
+		}
+		// The index also changes on timeout or when it goes backwards
+		if index != last {
+			return nil
+		}
+	}
+}
+
+// get reads the prefix, blocking until index changes if not zero, and
+// returns the new index
+func (c *ConsulKV) get(ctx context.Context, index uint64, out interface{}) (uint64, error) {
+	q := url.Values{"recurse": {"true"}}
+	if index > 0 {
+		q.Set("index", strconv.FormatUint(index, 10))
+		q.Set("wait", strconv.Itoa(int(c.WaitTime/time.Second))+"s")
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.Addr+"/v1/kv/"+c.Prefix+"?"+q.Encode(), nil)
+	if err != nil {
+		return 0, errors.Wrap(err, "can't create Consul request")
+	}
+	if c.Token != "" {
+		req.Header.Set("X-Consul-Token", c.Token)
+	}
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		return 0, errors.Wrap(err, "can't reach Consul")
+	}
+	defer resp.Body.Close()
+	newIndex, _ := strconv.ParseUint(resp.Header.Get("X-Consul-Index"), 10, 64)
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		// No key under the prefix
+		return newIndex, nil
+	case resp.StatusCode != http.StatusOK:
+		return 0, errors.New("Consul error reading " + c.Prefix + ": " + resp.Status)
+	case out == nil:
+		return newIndex, nil
+	}
+	return newIndex, errors.Wrap(json.NewDecoder(resp.Body).Decode(out), "can't decode Consul response")
+}
+
+// EtcdKV is a RemoteSource reading the keys under an etcd prefix, e.g.
+// /config/billing/http/addr for the field http.addr of the prefix
+// /config/billing, through the v3 JSON gateway, and watching them
+type EtcdKV struct {
+	// Endpoint of the etcd cluster, http://127.0.0.1:2379 if empty
+	Endpoint string
+	// Prefix of the keys
+	Prefix string
+	// Client for the reads; the watches have no timeout
+	Client *http.Client
+
+	mu       sync.Mutex
+	revision int64
+}
+
+// NewEtcdKV returns a source for prefix on the etcd cluster at endpoint
+func NewEtcdKV(endpoint, prefix string) *EtcdKV {
+	if endpoint == "" {
+		endpoint = "http://127.0.0.1:2379"
+	}
+	return &EtcdKV{
+		Endpoint: strings.TrimSuffix(endpoint, "/"),
+		Prefix:   "/" + strings.Trim(prefix, "/") + "/",
+		Client:   &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// etcdRange returns the range of the keys under the prefix
+func (e *EtcdKV) etcdRange() map[string]string {
+	end := []byte(e.Prefix)
+	end[len(end)-1]++
+	return map[string]string{
+		"key":       base64.StdEncoding.EncodeToString([]byte(e.Prefix)),
+		"range_end": base64.StdEncoding.EncodeToString(end),
+	}
+}
+
+// Values implements RemoteSource
+func (e *EtcdKV) Values(ctx context.Context) (map[string]string, error) {
+	var rng struct {
+		Header struct {
+			Revision string `json:"revision"`
+		} `json:"header"`
+		KVs []struct {
+			Key   string `json:"key"`
+			Value string `json:"value"`
+		} `json:"kvs"`
+	}
+	resp, err := e.post(ctx, e.Client, "/v3/kv/range", e.etcdRange())
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if err = json.NewDecoder(resp.Body).Decode(&rng); err != nil {
+		return nil, errors.Wrap(err, "can't decode etcd response")
+	}
+	rev, _ := strconv.ParseInt(rng.Header.Revision, 10, 64)
+	e.mu.Lock()
+	e.revision = rev
+	e.mu.Unlock()
+	values := make(map[string]string, len(rng.KVs))
+	for _, kv := range rng.KVs {
+		k, err := base64.StdEncoding.DecodeString(kv.Key)
+		if err != nil {
+			continue
+		}
+		v, err := base64.StdEncoding.DecodeString(kv.Value)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid value of "+string(k))
+		}
+		values[keyPath(string(k), e.Prefix)] = string(v)
+	}
+	return values, nil
+}
+
+// Wait implements RemoteSource with a watch from the revision of the last
+// Values
+func (e *EtcdKV) Wait(ctx context.Context) error {
+	e.mu.Lock()
+	rev := e.revision
+	e.mu.Unlock()
+	create := map[string]interface{}{}
+	for k, v := range e.etcdRange() {
+		create[k] = v
+	}
+	create["start_revision"] = strconv.FormatInt(rev+1, 10)
+	resp, err := e.post(ctx, &http.Client{Transport: e.Client.Transport}, "/v3/watch", map[string]interface{}{"create_request": create})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	dec := json.NewDecoder(resp.Body)
+	for {
+		var msg struct {
+			Result struct {
+				Events   []json.RawMessage `json:"events"`
+				Canceled bool              `json:"canceled"`
+			} `json:"result"`
+		}
+		if err := dec.Decode(&msg); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return errors.Wrap(err, "etcd watch interrupted")
+		}
+		if msg.Result.Canceled {
+			// E.g. compacted revision: read again
+			return nil
+		}
+		if len(msg.Result.Events) > 0 {
+			return nil
+		}
+	}
+}
+
+// post sends the JSON body to the etcd path
+func (e *EtcdKV) post(ctx context.Context, client *http.Client, path string, body interface{}) (*http.Response, error) {
+	b, err := json.Marshal(body)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't encode etcd request")
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.Endpoint+path, bytes.NewReader(b))
+	if err != nil {
+		return nil, errors.Wrap(err, "can't create etcd request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't reach etcd")
+	}
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		return nil, errors.Errorf("etcd error on %v: %v %s", path, resp.Status, bytes.TrimSpace(msg))
+	}
+	return resp, nil
+}
@@ -0,0 +1,72 @@
+package config
+
+import (
+	"context"
+	"reflect"
+	"regexp"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// SecretProvider resolves the secret references of the configuration
+type SecretProvider interface {
+	// Secret returns the value of key in the secret at path
+	Secret(ctx context.Context, path, key string) (string, error)
+}
+
+// SecretProviderFunc adapts a function to the SecretProvider interface
+type SecretProviderFunc func(ctx context.Context, path, key string) (string, error)
+
+// Secret calls f
+func (f SecretProviderFunc) Secret(ctx context.Context, path, key string) (string, error) {
+	return f(ctx, path, key)
+}
+
+// SecretTimeout bounds the resolution of the secrets of a Load
+var SecretTimeout = 30 * time.Second
+
+// secretRef matches ${scheme:path#key}
+var secretRef = regexp.MustCompile(`\$\{([a-zA-Z][a-zA-Z0-9_-]*):([^#}]+)#([^}]+)\}`)
+
+// resolveSecrets replaces the secret references in the string fields
+func resolveSecrets(fields []field, providers map[string]SecretProvider) error {
+	ctx, cancel := context.WithTimeout(context.Background(), SecretTimeout)
+	defer cancel()
+	resolve := func(s string) (string, error) {
+		var err error
+		out := secretRef.ReplaceAllStringFunc(s, func(ref string) string {
+			m := secretRef.FindStringSubmatch(ref)
+			p, ok := providers[m[1]]
+			if !ok {
+				// Not a secret reference
+				return ref
+			}
+			v, e := p.Secret(ctx, m[2], m[3])
+			if e != nil && err == nil {
+				err = errors.Wrap(e, "can't resolve secret "+m[1]+":"+m[2]+"#"+m[3])
+			}
+			return v
+		})
+		return out, err
+	}
+	for _, f := range fields {
+		switch {
+		case f.value.Kind() == reflect.String:
+			v, err := resolve(f.value.String())
+			if err != nil {
+				return errors.Wrap(err, "invalid value for "+f.path())
+			}
+			f.value.SetString(v)
+		case f.value.Kind() == reflect.Slice && f.value.Type().Elem().Kind() == reflect.String:
+			for i := 0; i < f.value.Len(); i++ {
+				v, err := resolve(f.value.Index(i).String())
+				if err != nil {
+					return errors.Wrap(err, "invalid value for "+f.path())
+				}
+				f.value.Index(i).SetString(v)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,276 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Vault is a SecretProvider reading the secrets from HashiCorp Vault
+// through its HTTP API: KV version 1 and 2 secrets and dynamic secrets
+// with a lease (e.g. database/creds/role). The secrets are cached; when
+// run, Vault renews the leases and re-reads the secrets which can not be
+// renewed or, for KV, which changed, calling the rotation callbacks.
+type Vault struct {
+	// Address and token, from VAULT_ADDR and VAULT_TOKEN by default
+	Addr  string
+	Token string
+	// Client for the requests, with a 10s timeout by default
+	Client *http.Client
+	// How often the secrets are checked, the leases being renewed at 2/3
+	// of their duration; 10s if zero
+	Interval time.Duration
+	// How often the KV secrets are read again to detect rotations
+	RefreshInterval time.Duration
+	// Called when a renewal or refresh fails, may be nil
+	OnError func(err error)
+
+	mu        sync.Mutex
+	secrets   map[string]*vaultSecret
+	callbacks []func(path string, data map[string]string)
+}
+
+// vaultSecret is a cached secret
+type vaultSecret struct {
+	data      map[string]string
+	leaseID   string
+	renewable bool
+	// When the secret has to be renewed or read again
+	due time.Time
+}
+
+// vaultResponse is the body of the secret reads and lease renewals
+type vaultResponse struct {
+	LeaseID       string                 `json:"lease_id"`
+	LeaseDuration int                    `json:"lease_duration"`
+	Renewable     bool                   `json:"renewable"`
+	Data          map[string]interface{} `json:"data"`
+	Errors        []string               `json:"errors"`
+}
+
+// NewVault returns a provider for the Vault at addr authenticated by
+// token, VAULT_ADDR and VAULT_TOKEN being used if empty
+func NewVault(addr, token string) *Vault {
+	if addr == "" {
+		addr = os.Getenv("VAULT_ADDR")
+	}
+	if token == "" {
+		token = os.Getenv("VAULT_TOKEN")
+	}
+	return &Vault{
+		Addr:            strings.TrimSuffix(addr, "/"),
+		Token:           token,
+		Client:          &http.Client{Timeout: 10 * time.Second},
+		Interval:        10 * time.Second,
+		RefreshInterval: 5 * time.Minute,
+		secrets:         map[string]*vaultSecret{},
+	}
+}
+
+// Secret returns the value of key in the secret at path, e.g. "password"
+// in "secret/data/db" for KV version 2, reading it once
+func (v *Vault) Secret(ctx context.Context, path, key string) (string, error) {
+	v.mu.Lock()
+	s, ok := v.secrets[path]
+	v.mu.Unlock()
+	if !ok {
+		var err error
+		s, err = v.read(ctx, path)
+		if err != nil {
+			return "", err
+		}
+		v.mu.Lock()
+		if v.secrets == nil {
+			v.secrets = map[string]*vaultSecret{}
+		}
+		v.secrets[path] = s
+		v.mu.Unlock()
+	}
+	value, ok := s.data[key]
+	if !ok {
+		return "", errors.New("no key " + key + " in secret " + path)
+	}
+	return value, nil
+}
+
+// OnRotate registers a callback receiving the new data of the secrets
+// rotated while running, e.g. to reload the configuration
+func (v *Vault) OnRotate(fn func(path string, data map[string]string)) {
+	v.mu.Lock()
+	v.callbacks = append(v.callbacks, fn)
+	v.mu.Unlock()
+}
+
+// Run renews the leases and refreshes the secrets until ctx is cancelled,
+// to be added to a Lifecycle
+func (v *Vault) Run(ctx context.Context) error {
+	interval := v.Interval
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			v.check(ctx)
+		}
+	}
+}
+
+// check renews or reads again the secrets which are due
+func (v *Vault) check(ctx context.Context) {
+	now := time.Now()
+	v.mu.Lock()
+	due := map[string]*vaultSecret{}
+	for path, s := range v.secrets {
+		if !s.due.IsZero() && !now.Before(s.due) {
+			due[path] = s
+		}
+	}
+	v.mu.Unlock()
+	for path, s := range due {
+		if s.leaseID != "" && s.renewable {
+			ok, err := v.renew(ctx, s)
+			if err != nil {
+				v.fail(errors.Wrap(err, "can't renew the lease of "+path))
+			}
+			if ok {
+				continue
+			}
+		}
+		// Not renewable any more, or a KV secret to refresh
+		fresh, err := v.read(ctx, path)
+		if err != nil {
+			v.fail(errors.Wrap(err, "can't refresh secret "+path))
+			continue
+		}
+		v.mu.Lock()
+		v.secrets[path] = fresh
+		callbacks := append([]func(string, map[string]string){}, v.callbacks...)
+		v.mu.Unlock()
+		if reflect.DeepEqual(fresh.data, s.data) {
+			continue
+		}
+		for _, fn := range callbacks {
+			fn(path, fresh.data)
+		}
+	}
+}
+
+// defaultVaultClient is used by the Vault values built without NewVault
+var defaultVaultClient = &http.Client{Timeout: 10 * time.Second}
+
+// client returns the client for the requests
+func (v *Vault) client() *http.Client {
+	if v.Client == nil {
+		return defaultVaultClient
+	}
+	return v.Client
+}
+
+// renew extends the lease of s, returning false if the lease could not be
+// extended for another period
+func (v *Vault) renew(ctx context.Context, s *vaultSecret) (bool, error) {
+	var vr vaultResponse
+	err := v.do(ctx, http.MethodPut, "sys/leases/renew", map[string]string{"lease_id": s.leaseID}, &vr)
+	if err != nil {
+		return false, err
+	}
+	if vr.LeaseDuration <= 0 {
+		return false, nil
+	}
+	v.mu.Lock()
+	s.renewable = vr.Renewable
+	s.due = leaseDue(vr.LeaseDuration)
+	v.mu.Unlock()
+	return true, nil
+}
+
+// read reads the secret at path
+func (v *Vault) read(ctx context.Context, path string) (*vaultSecret, error) {
+	var vr vaultResponse
+	err := v.do(ctx, http.MethodGet, path, nil, &vr)
+	if err != nil {
+		return nil, err
+	}
+	data := vr.Data
+	// KV version 2 nests the secret with its metadata
+	if inner, ok := data["data"].(map[string]interface{}); ok {
+		if _, ok := data["metadata"]; ok {
+			data = inner
+		}
+	}
+	s := &vaultSecret{data: map[string]string{}, leaseID: vr.LeaseID, renewable: vr.Renewable}
+	for k, val := range data {
+		if str, ok := val.(string); ok {
+			s.data[k] = str
+		} else {
+			s.data[k] = fmt.Sprint(val)
+		}
+	}
+	if vr.LeaseID != "" && vr.LeaseDuration > 0 {
+		s.due = leaseDue(vr.LeaseDuration)
+	} else if v.RefreshInterval > 0 {
+		s.due = time.Now().Add(v.RefreshInterval)
+	}
+	return s, nil
+}
+
+// leaseDue returns when a lease of the given seconds has to be renewed
+func leaseDue(seconds int) time.Time {
+	return time.Now().Add(time.Duration(seconds) * time.Second * 2 / 3)
+}
+
+// do calls the Vault API decoding the response into out
+func (v *Vault) do(ctx context.Context, method, path string, in, out interface{}) error {
+	if v.Addr == "" {
+		return errors.New("Vault address not set")
+	}
+	var body bytes.Buffer
+	if in != nil {
+		if err := json.NewEncoder(&body).Encode(in); err != nil {
+			return errors.Wrap(err, "can't encode Vault request")
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(v.Addr, "/")+"/v1/"+strings.TrimPrefix(path, "/"), &body)
+	if err != nil {
+		return errors.Wrap(err, "can't create Vault request")
+	}
+	req.Header.Set("X-Vault-Token", v.Token)
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := v.client().Do(req)
+	if err != nil {
+		return errors.Wrap(err, "can't reach Vault")
+	}
+	defer resp.Body.Close()
+	err = json.NewDecoder(resp.Body).Decode(out)
+	if resp.StatusCode != http.StatusOK {
+		msg := resp.Status
+		if vr, ok := out.(*vaultResponse); ok && err == nil && len(vr.Errors) > 0 {
+			msg = strings.Join(vr.Errors, "; ")
+		}
+		return errors.New("Vault error on " + path + ": " + msg)
+	}
+	return errors.Wrap(err, "can't decode Vault response")
+}
+
+// fail reports err to OnError
+func (v *Vault) fail(err error) {
+	if v.OnError != nil {
+		v.OnError(err)
+	}
+}
@@ -0,0 +1,44 @@
+package config
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestVaultZeroValue(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != "/v1/secret/data/db" || req.Header.Get("X-Vault-Token") != "root" {
+			http.NotFound(resp, req)
+			return
+		}
+		resp.Write([]byte(`{"data": {"data": {"password": "s3cret", "port": 5432}, "metadata": {"version": 1}}}`))
+	}))
+	defer srv.Close()
+	v := &Vault{Addr: srv.URL + "/", Token: "root"}
+
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{"password", "s3cret"},
+		{"port", "5432"},
+	}
+	for _, tt := range tests {
+		got, err := v.Secret(context.Background(), "secret/data/db", tt.key)
+		if err != nil || got != tt.want {
+			t.Errorf("%s: got %q (%v), want %q", tt.key, got, err, tt.want)
+		}
+	}
+	if _, err := v.Secret(context.Background(), "secret/data/db", "user"); err == nil {
+		t.Error("missing key found")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := v.Run(ctx); err != nil {
+		t.Error(err)
+	}
+}
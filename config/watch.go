@@ -0,0 +1,156 @@
+package config
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Watcher keeps the current configuration, reloading it on SIGHUP or when
+// the config file or the remote settings change, and delivers every new valid snapshot to the
+// registered callbacks. Invalid reloads keep the previous snapshot.
+type Watcher struct {
+	// How often the config file is checked for changes, 0 disables polling
+	Interval time.Duration
+	// Called when a reload fails, may be nil
+	OnError func(err error)
+
+	opts Options
+	// Config flags parsed by the first load, applied again at every reload
+	flags     flagArgs
+	newCfg    func() interface{}
+	mu        sync.RWMutex
+	current   interface{}
+	modTime   time.Time
+	callbacks []func(cfg interface{})
+}
+
+// NewWatcher loads the configuration into the struct pointer returned by
+// newCfg, which is called for every reload to get a fresh snapshot
+func NewWatcher(opts Options, newCfg func() interface{}) (*Watcher, error) {
+	w := &Watcher{Interval: 10 * time.Second, opts: opts, newCfg: newCfg}
+	cfg := newCfg()
+	flags, err := load(cfg, opts, nil)
+	if err != nil {
+		return nil, err
+	}
+	w.current = cfg
+	w.modTime = w.fileModTime()
+	// The command line does not change, and the flags can't be registered
+	// again on the same set
+	w.flags = flags
+	return w, nil
+}
+
+// Current returns the current configuration snapshot
+func (w *Watcher) Current() interface{} {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.current
+}
+
+// OnChange registers a callback receiving every new snapshot
+func (w *Watcher) OnChange(fn func(cfg interface{})) {
+	w.mu.Lock()
+	w.callbacks = append(w.callbacks, fn)
+	w.mu.Unlock()
+}
+
+// Reload loads a new snapshot and, if valid, delivers it to the callbacks
+func (w *Watcher) Reload() error {
+	cfg := w.newCfg()
+	_, err := load(cfg, w.opts, w.flags)
+	if err != nil {
+		return errors.Wrap(err, "can't reload configuration")
+	}
+	w.mu.Lock()
+	w.current = cfg
+	callbacks := append([]func(interface{}){}, w.callbacks...)
+	w.mu.Unlock()
+	for _, fn := range callbacks {
+		fn(cfg)
+	}
+	return nil
+}
+
+// Run watches for SIGHUP and file changes until ctx is cancelled
+func (w *Watcher) Run(ctx context.Context) error {
+	var tick <-chan time.Time
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	if w.Interval > 0 && w.opts.Path != "" {
+		ticker := time.NewTicker(w.Interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	if w.opts.Remote != nil {
+		go w.watchRemote(ctx)
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-hup:
+			w.reload()
+		case <-tick:
+			mt := w.fileModTime()
+			if mt.IsZero() || mt.Equal(w.modTime) {
+				continue
+			}
+			w.modTime = mt
+			w.reload()
+		}
+	}
+}
+
+// watchRemote reloads when the remote settings change, until ctx is
+// cancelled
+func (w *Watcher) watchRemote(ctx context.Context) {
+	for {
+		err := w.opts.Remote.Wait(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			if w.OnError != nil {
+				w.OnError(errors.Wrap(err, "can't watch remote configuration"))
+			}
+			// Back off before watching again
+			wait := w.Interval
+			if wait <= 0 {
+				wait = time.Second
+			}
+			select {
+			case <-time.After(wait):
+			case <-ctx.Done():
+				return
+			}
+			continue
+		}
+		w.reload()
+	}
+}
+
+func (w *Watcher) reload() {
+	err := w.Reload()
+	if err != nil && w.OnError != nil {
+		w.OnError(err)
+	}
+}
+
+func (w *Watcher) fileModTime() time.Time {
+	if w.opts.Path == "" {
+		return time.Time{}
+	}
+	fi, err := os.Stat(w.opts.Path)
+	if err != nil {
+		return time.Time{}
+	}
+	return fi.ModTime()
+}
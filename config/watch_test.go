@@ -0,0 +1,43 @@
+package config
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWatcherReloadKeepsFlags(t *testing.T) {
+	type cfg struct {
+		Addr string `default:":8080"`
+		Name string
+	}
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(`{"Name": "a"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	fs := flag.NewFlagSet("app", flag.ContinueOnError)
+	verbose := fs.Bool("verbose", false, "defined by the application")
+	w, err := NewWatcher(Options{
+		Path:       path,
+		Args:       []string{"-verbose", "-addr", ":9090"},
+		FlagSet:    fs,
+		DisableEnv: true,
+	}, func() interface{} { return &cfg{} })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !*verbose {
+		t.Error("application flag not parsed")
+	}
+	if err := os.WriteFile(path, []byte(`{"Name": "b"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	got := w.Current().(*cfg)
+	if got.Addr != ":9090" || got.Name != "b" {
+		t.Errorf("reloaded %+v", got)
+	}
+}
@@ -0,0 +1,134 @@
+package hang
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"mime"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// CSRFOptions configures the CSRF middleware, zero values meaning the defaults
+type CSRFOptions struct {
+	// Cookie holding the token, "csrf_token" by default
+	CookieName string
+	// Header carrying the token, "X-CSRF-Token" by default
+	HeaderName string
+	// Form field carrying the token, "csrf_token" by default
+	FieldName string
+	// Cookie attributes
+	CookiePath   string
+	CookieDomain string
+	CookieMaxAge time.Duration
+	Insecure     bool
+	SameSite     http.SameSite
+	// Routes not checked, e.g. API routes authenticated by header
+	SkipRoutes []string
+}
+
+// CSRF returns a middleware implementing the double submit cookie protection:
+// a random token is set in a cookie and the unsafe requests (other than GET,
+// HEAD, OPTIONS and TRACE) must send it back in the header or in the form
+// field, otherwise they get a 403. Checking the form field parses
+// url-encoded bodies into req.PostForm.
+func CSRF(opts CSRFOptions) Middleware {
+	if opts.CookieName == "" {
+		opts.CookieName = "csrf_token"
+	}
+	if opts.HeaderName == "" {
+		opts.HeaderName = "X-CSRF-Token"
+	}
+	if opts.FieldName == "" {
+		opts.FieldName = "csrf_token"
+	}
+	if opts.CookiePath == "" {
+		opts.CookiePath = "/"
+	}
+	if opts.CookieMaxAge <= 0 {
+		opts.CookieMaxAge = 12 * time.Hour
+	}
+	if opts.SameSite == 0 {
+		opts.SameSite = http.SameSiteLaxMode
+	}
+	return func(next HandleFunc) HandleFunc {
+		return func(resp http.ResponseWriter, req *http.Request) error {
+			var token string
+			if c, err := req.Cookie(opts.CookieName); err == nil && len(c.Value) == csrfTokenLen {
+				token = c.Value
+			} else {
+				token, err = newCSRFToken()
+				if err != nil {
+					// Respond
+					WriteError(resp, req, http.StatusInternalServerError, err)
+					return err
+				}
+				http.SetCookie(resp, &http.Cookie{
+					Name:     opts.CookieName,
+					Value:    token,
+					Path:     opts.CookiePath,
+					Domain:   opts.CookieDomain,
+					MaxAge:   int(opts.CookieMaxAge.Seconds()),
+					Secure:   !opts.Insecure,
+					SameSite: opts.SameSite,
+					// Read by scripts to fill the header
+					HttpOnly: false,
+				})
+			}
+			req = req.WithContext(context.WithValue(req.Context(), csrfTokenKey, token))
+
+			if safeMethod(req.Method) || containsString(opts.SkipRoutes, RouteFrom(req)) {
+				return next(resp, req)
+			}
+			sent := req.Header.Get(opts.HeaderName)
+			if sent == "" && isURLEncodedForm(req) {
+				sent = req.PostFormValue(opts.FieldName)
+			}
+			if subtle.ConstantTimeCompare([]byte(sent), []byte(token)) != 1 {
+				err := errors.New("invalid or missing CSRF token")
+				// Respond
+				WriteError(resp, req, http.StatusForbidden, err)
+				return err
+			}
+			return next(resp, req)
+		}
+	}
+}
+
+// CSRFToken returns the token to be embedded in forms (as the field named
+// CSRFOptions.FieldName) or sent as header, empty if the CSRF middleware is
+// not in use
+func CSRFToken(req *http.Request) string {
+	token, _ := req.Context().Value(csrfTokenKey).(string)
+	return token
+}
+
+// csrfTokenLen is the length of the encoded tokens
+var csrfTokenLen = base64.RawURLEncoding.EncodedLen(32)
+
+// newCSRFToken returns a random token
+func newCSRFToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", errors.Wrap(err, "can't generate CSRF token")
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// safeMethod reports whether method can't change the server state
+func safeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	return false
+}
+
+// isURLEncodedForm reports whether the body is an url-encoded form
+func isURLEncodedForm(req *http.Request) bool {
+	mediaType, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	return mediaType == "application/x-www-form-urlencoded"
+}
@@ -0,0 +1,90 @@
+package hang
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestCSRF(t *testing.T) {
+	h := testHandler(t)
+	h.Use(CSRF(CSRFOptions{SkipRoutes: []string{"api"}}))
+	ok := func(resp http.ResponseWriter, req *http.Request) error { return nil }
+	h.AddRoute("form", ok)
+	h.AddRoute("api", ok)
+
+	token, err := newCSRFToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := newCSRFToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name   string
+		method string
+		route  string
+		cookie string
+		header string
+		field  string
+		status int
+	}{
+		{"safe method without cookie", http.MethodGet, "form", "", "", "", http.StatusOK},
+		{"no cookie", http.MethodPost, "form", "", "", "", http.StatusForbidden},
+		{"no token sent", http.MethodPost, "form", token, "", "", http.StatusForbidden},
+		{"wrong header", http.MethodPost, "form", token, other, "", http.StatusForbidden},
+		{"wrong field", http.MethodPost, "form", token, "", other, http.StatusForbidden},
+		{"header", http.MethodPost, "form", token, token, "", http.StatusOK},
+		{"field", http.MethodPost, "form", token, "", token, http.StatusOK},
+		{"delete with header", http.MethodDelete, "form", token, token, "", http.StatusOK},
+		{"short cookie echoed", http.MethodPost, "form", "x", "x", "", http.StatusForbidden},
+		{"skipped route", http.MethodPost, "api", "", "", "", http.StatusOK},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, "/"+tt.route, strings.NewReader(url.Values{"csrf_token": {tt.field}}.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if tt.cookie != "" {
+			req.AddCookie(&http.Cookie{Name: "csrf_token", Value: tt.cookie})
+		}
+		if tt.header != "" {
+			req.Header.Set("X-CSRF-Token", tt.header)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != tt.status {
+			t.Errorf("%s: got status %d, want %d", tt.name, rec.Code, tt.status)
+		}
+	}
+}
+
+func TestCSRFCookie(t *testing.T) {
+	h := testHandler(t)
+	h.Use(CSRF(CSRFOptions{}))
+	var seen string
+	h.AddRoute("form", func(resp http.ResponseWriter, req *http.Request) error {
+		seen = CSRFToken(req)
+		return nil
+	})
+
+	rec := serve(h, http.MethodGet, "/form", nil)
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 {
+		t.Fatalf("got %d cookies, want 1", len(cookies))
+	}
+	c := cookies[0]
+	if c.Value != seen || len(c.Value) != csrfTokenLen {
+		t.Errorf("got cookie %q and token %q, want the same token", c.Value, seen)
+	}
+	if !c.Secure || c.SameSite != http.SameSiteLaxMode {
+		t.Errorf("got Secure %v and SameSite %v, want a secure lax cookie", c.Secure, c.SameSite)
+	}
+
+	// A valid cookie is kept
+	rec = serve(h, http.MethodGet, "/form", http.Header{"Cookie": {"csrf_token=" + c.Value}})
+	if len(rec.Result().Cookies()) != 0 || seen != c.Value {
+		t.Errorf("valid cookie replaced, token %q", seen)
+	}
+}
@@ -0,0 +1,262 @@
+package hang
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// MaxCSVErrors is the maximum number of row errors collected by GetReqCSVData
+// before giving up
+var MaxCSVErrors = 100
+
+// CSVRowError describes a CSV row that can't be decoded
+type CSVRowError struct {
+	// Line number in the file, the header being line 1
+	Line    int    `json:"line"`
+	Column  string `json:"column,omitempty"`
+	Message string `json:"message"`
+}
+
+// Error implements the error interface
+func (e *CSVRowError) Error() string {
+	if e.Column != "" {
+		return fmt.Sprintf("line %d, column %s: %s", e.Line, e.Column, e.Message)
+	}
+	return fmt.Sprintf("line %d: %s", e.Line, e.Message)
+}
+
+// CSVErrors is the list of row errors returned by GetReqCSVData
+type CSVErrors []*CSVRowError
+
+// Error implements the error interface
+func (ce CSVErrors) Error() string {
+	msgs := make([]string, len(ce))
+	for i, e := range ce {
+		msgs[i] = e.Error()
+	}
+	return "invalid CSV: " + strings.Join(msgs, "; ")
+}
+
+// CSVDecoder reads structs from a CSV stream with a header row, matching the
+// columns with the "csv" tags (or the field names)
+type CSVDecoder struct {
+	r       *csv.Reader
+	columns []string
+	line    int
+	// Column to field index of the last decoded type
+	fieldsType reflect.Type
+	fields     map[string][]int
+}
+
+// NewCSVDecoder reads the header row from r
+func NewCSVDecoder(r io.Reader) (*CSVDecoder, error) {
+	d := &CSVDecoder{r: csv.NewReader(r)}
+	d.r.ReuseRecord = true
+	// Rows may omit the trailing empty columns
+	d.r.FieldsPerRecord = -1
+	header, err := d.r.Read()
+	if err != nil {
+		return nil, errors.Wrap(err, "can't read CSV header")
+	}
+	for _, c := range header {
+		d.columns = append(d.columns, strings.TrimSpace(c))
+	}
+	return d, nil
+}
+
+// Decode reads the next row into the struct pointed by v, returning io.EOF
+// at the end of the stream and a *CSVRowError for invalid rows
+func (d *CSVDecoder) Decode(v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Struct {
+		return errors.New("CSVDecoder needs a pointer to struct")
+	}
+	record, err := d.r.Read()
+	if err == io.EOF {
+		return err
+	}
+	if err != nil {
+		var perr *csv.ParseError
+		if errors.As(err, &perr) {
+			// Continue from the next row
+			return &CSVRowError{Line: perr.Line, Message: perr.Err.Error()}
+		}
+		return errors.Wrap(err, "can't read CSV")
+	}
+	d.line, _ = d.r.FieldPos(0)
+	if d.fieldsType != rv.Elem().Type() {
+		d.fieldsType = rv.Elem().Type()
+		d.fields = csvFields(d.fieldsType)
+	}
+	fields := d.fields
+	for i, value := range record {
+		if i >= len(d.columns) {
+			break
+		}
+		idx, ok := fields[d.columns[i]]
+		if !ok || value == "" {
+			continue
+		}
+		if err := setQueryValue(rv.Elem().FieldByIndex(idx), []string{value}); err != nil {
+			return &CSVRowError{Line: d.line, Column: d.columns[i], Message: "invalid value " + value}
+		}
+	}
+	return nil
+}
+
+// GetReqCSVData decodes the CSV body into the slice of structs pointed by
+// rows, responding 422 with the list of invalid rows on failure
+func GetReqCSVData(resp http.ResponseWriter, req *http.Request, rows interface{}) error {
+	sl := reflect.ValueOf(rows)
+	if sl.Kind() != reflect.Ptr || sl.Elem().Kind() != reflect.Slice || sl.Elem().Type().Elem().Kind() != reflect.Struct {
+		err := errors.New("GetReqCSVData needs a pointer to a slice of structs")
+		// Respond
+		WriteError(resp, req, http.StatusInternalServerError, err)
+		return err
+	}
+	body, err := csvBody(resp, req)
+	if err != nil {
+		return err
+	}
+	dec, err := NewCSVDecoder(body)
+	if err != nil {
+		// Respond
+		WriteError(resp, req, http.StatusBadRequest, err)
+		return err
+	}
+	var (
+		ce   CSVErrors
+		elem = sl.Elem().Type().Elem()
+	)
+	for len(ce) < MaxCSVErrors {
+		row := reflect.New(elem)
+		err = dec.Decode(row.Interface())
+		if err == io.EOF {
+			break
+		}
+		var rerr *CSVRowError
+		if errors.As(err, &rerr) {
+			ce = append(ce, rerr)
+			continue
+		}
+		if err != nil {
+			err = errors.Wrap(err, "error reading request body")
+			// Respond
+			WriteError(resp, req, bodyErrorStatus(err), err)
+			return err
+		}
+		sl.Elem().Set(reflect.Append(sl.Elem(), row.Elem()))
+	}
+	if len(ce) > 0 {
+		// Respond with the row errors
+		writeError(resp, req, RequestErrorFormat(req), http.StatusUnprocessableEntity, ce, ce)
+		return ce
+	}
+	return nil
+}
+
+// WriteCSV writes the slice of structs rows as a CSV download named filename,
+// with a header row from the "csv" tags
+func WriteCSV(resp http.ResponseWriter, status int, filename string, rows interface{}) error {
+	sl := reflect.ValueOf(rows)
+	if sl.Kind() != reflect.Slice || sl.Type().Elem().Kind() != reflect.Struct {
+		resp.WriteHeader(http.StatusInternalServerError)
+		return errors.New("WriteCSV needs a slice of structs")
+	}
+	var (
+		t       = sl.Type().Elem()
+		header  []string
+		indexes [][]int
+	)
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if name := csvName(sf); sf.PkgPath == "" && name != "" {
+			header = append(header, name)
+			indexes = append(indexes, sf.Index)
+		}
+	}
+	resp.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	if filename != "" {
+		resp.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+	}
+	resp.WriteHeader(status)
+
+	w := csv.NewWriter(resp)
+	w.Write(header)
+	record := make([]string, len(header))
+	for i := 0; i < sl.Len(); i++ {
+		for j, idx := range indexes {
+			record[j] = csvValue(sl.Index(i).FieldByIndex(idx))
+		}
+		if err := w.Write(record); err != nil {
+			return errors.Wrap(err, "can't write CSV")
+		}
+	}
+	w.Flush()
+	return errors.Wrap(w.Error(), "can't write CSV")
+}
+
+// csvBody returns the request body, read in memory only if compressed
+func csvBody(resp http.ResponseWriter, req *http.Request) (io.Reader, error) {
+	switch strings.ToLower(strings.TrimSpace(req.Header.Get("Content-Encoding"))) {
+	case "", "identity":
+		if req.Body != nil {
+			return req.Body, nil
+		}
+	}
+	body, err := GetReqData(resp, req)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(body), nil
+}
+
+// csvFields maps the column names to the field indexes of t
+func csvFields(t reflect.Type) map[string][]int {
+	fields := map[string][]int{}
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if name := csvName(sf); sf.PkgPath == "" && name != "" {
+			fields[name] = sf.Index
+		}
+	}
+	return fields
+}
+
+// csvName returns the column name of the field, empty if skipped
+func csvName(sf reflect.StructField) string {
+	name := strings.SplitN(sf.Tag.Get("csv"), ",", 2)[0]
+	if name == "-" {
+		return ""
+	}
+	if name == "" {
+		return sf.Name
+	}
+	return name
+}
+
+// csvValue formats a field value for WriteCSV
+func csvValue(v reflect.Value) string {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return ""
+		}
+		v = v.Elem()
+	}
+	if t, ok := v.Interface().(time.Time); ok {
+		if t.IsZero() {
+			return ""
+		}
+		return t.Format(time.RFC3339)
+	}
+	return fmt.Sprint(v.Interface())
+}
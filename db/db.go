@@ -0,0 +1,124 @@
+// Package db opens database/sql pools configured through the config package,
+// logging the slow queries, and ties them to the hang.Handler readiness
+// checks and to the hang.Lifecycle shutdown.
+package db
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"time"
+
+	"github.com/brunetto/hang"
+	"github.com/pkg/errors"
+)
+
+// Config describes a connection pool, to be embedded in the service
+// configuration loaded with the config package. Open uses the defaults for
+// the zero values, as for a Config not loaded with config.Load.
+type Config struct {
+	// Driver name as registered with database/sql (postgres, mysql, ...)
+	Driver string `yaml:"driver" json:"driver" validate:"required"`
+	DSN    string `yaml:"dsn" json:"dsn" validate:"required"`
+	// Pool settings
+	MaxOpenConns    int           `yaml:"max_open_conns" json:"max_open_conns" default:"10"`
+	MaxIdleConns    int           `yaml:"max_idle_conns" json:"max_idle_conns" default:"5"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime" json:"conn_max_lifetime" default:"30m"`
+	ConnMaxIdleTime time.Duration `yaml:"conn_max_idle_time" json:"conn_max_idle_time" default:"5m"`
+	// Queries lasting longer are logged, 0 disables the logging
+	SlowQueryThreshold time.Duration `yaml:"slow_query_threshold" json:"slow_query_threshold" default:"200ms"`
+	// Timeout of the connection check in Open
+	ConnectTimeout time.Duration `yaml:"connect_timeout" json:"connect_timeout" default:"5s"`
+}
+
+// Open opens the pool described by cfg, wrapping the driver to log the slow
+// queries, and checks the connection
+func Open(lg hang.Logger, cfg Config) (*sql.DB, error) {
+	cfg = cfg.withDefaults()
+	db, err := sql.Open(cfg.Driver, cfg.DSN)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't open database")
+	}
+	base := db.Driver()
+	// Only the driver was needed
+	db.Close()
+
+	var connector driver.Connector = dsnConnector{dsn: cfg.DSN, driver: base}
+	if dc, ok := base.(driver.DriverContext); ok {
+		connector, err = dc.OpenConnector(cfg.DSN)
+		if err != nil {
+			return nil, errors.Wrap(err, "can't open database")
+		}
+	}
+	if cfg.SlowQueryThreshold > 0 {
+		connector = &slowConnector{Connector: connector, log: lg, threshold: cfg.SlowQueryThreshold}
+	}
+	db = sql.OpenDB(connector)
+	db.SetMaxOpenConns(cfg.MaxOpenConns)
+	db.SetMaxIdleConns(cfg.MaxIdleConns)
+	db.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+	db.SetConnMaxIdleTime(cfg.ConnMaxIdleTime)
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ConnectTimeout)
+	defer cancel()
+	if err = db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, errors.Wrap(err, "can't connect to database")
+	}
+	return db, nil
+}
+
+// withDefaults fills the unset pool settings, the slow query logging
+// staying disabled
+func (cfg Config) withDefaults() Config {
+	if cfg.MaxOpenConns <= 0 {
+		cfg.MaxOpenConns = 10
+	}
+	if cfg.MaxIdleConns <= 0 {
+		cfg.MaxIdleConns = 5
+	}
+	if cfg.ConnMaxLifetime <= 0 {
+		cfg.ConnMaxLifetime = 30 * time.Minute
+	}
+	if cfg.ConnMaxIdleTime <= 0 {
+		cfg.ConnMaxIdleTime = 5 * time.Minute
+	}
+	if cfg.ConnectTimeout <= 0 {
+		cfg.ConnectTimeout = 5 * time.Second
+	}
+	return cfg
+}
+
+// Check returns a readiness check pinging db
+func Check(db *sql.DB) hang.CheckFunc {
+	return func(ctx context.Context) error {
+		return errors.Wrap(db.PingContext(ctx), "database ping failed")
+	}
+}
+
+// Register adds to h the readiness check of db, named "db:<name>", and to l
+// a shutdown hook closing it. Both h and l can be nil.
+func Register(h *hang.Handler, l *hang.Lifecycle, name string, db *sql.DB) {
+	if h != nil {
+		h.AddReadinessCheck("db:"+name, Check(db))
+	}
+	if l != nil {
+		l.AddShutdownHook(func(ctx context.Context) error {
+			return errors.Wrap(db.Close(), "can't close database "+name)
+		})
+	}
+}
+
+// dsnConnector opens connections with the legacy driver interface
+type dsnConnector struct {
+	dsn    string
+	driver driver.Driver
+}
+
+func (c dsnConnector) Connect(context.Context) (driver.Conn, error) {
+	return c.driver.Open(c.dsn)
+}
+
+func (c dsnConnector) Driver() driver.Driver {
+	return c.driver
+}
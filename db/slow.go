@@ -0,0 +1,173 @@
+package db
+
+import (
+	"context"
+	"database/sql/driver"
+	"time"
+
+	"github.com/brunetto/hang"
+)
+
+// slowConnector wraps the connections to time the queries
+type slowConnector struct {
+	driver.Connector
+	log       hang.Logger
+	threshold time.Duration
+}
+
+func (c *slowConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &slowConn{Conn: conn, c: c}, nil
+}
+
+// observe logs query if it lasted more than the threshold
+func (c *slowConnector) observe(ctx context.Context, query string, start time.Time, err error) {
+	d := time.Since(start)
+	if d < c.threshold {
+		return
+	}
+	fields := hang.Fields{"query": query, "duration": d.String()}
+	if id := hang.RequestIDFromContext(ctx); id != "" {
+		fields["request_id"] = id
+	}
+	if err != nil && err != driver.ErrSkip {
+		fields["error"] = err.Error()
+	}
+	c.log.WithFields(fields).Warn("Slow query")
+}
+
+// slowConn implements the optional driver interfaces, falling back to the
+// database/sql default behaviour when the wrapped connection does not
+type slowConn struct {
+	driver.Conn
+	c *slowConnector
+}
+
+func (sc *slowConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	var (
+		stmt driver.Stmt
+		err  error
+	)
+	if p, ok := sc.Conn.(driver.ConnPrepareContext); ok {
+		stmt, err = p.PrepareContext(ctx, query)
+	} else {
+		stmt, err = sc.Conn.Prepare(query)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &slowStmt{Stmt: stmt, query: query, c: sc.c}, nil
+}
+
+func (sc *slowConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	e, ok := sc.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	start := time.Now()
+	res, err := e.ExecContext(ctx, query, args)
+	sc.c.observe(ctx, query, start, err)
+	return res, err
+}
+
+func (sc *slowConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	q, ok := sc.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	start := time.Now()
+	rows, err := q.QueryContext(ctx, query, args)
+	sc.c.observe(ctx, query, start, err)
+	return rows, err
+}
+
+func (sc *slowConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if b, ok := sc.Conn.(driver.ConnBeginTx); ok {
+		return b.BeginTx(ctx, opts)
+	}
+	return sc.Conn.Begin()
+}
+
+func (sc *slowConn) Ping(ctx context.Context) error {
+	if p, ok := sc.Conn.(driver.Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
+
+func (sc *slowConn) ResetSession(ctx context.Context) error {
+	if r, ok := sc.Conn.(driver.SessionResetter); ok {
+		return r.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (sc *slowConn) IsValid() bool {
+	if v, ok := sc.Conn.(driver.Validator); ok {
+		return v.IsValid()
+	}
+	return true
+}
+
+func (sc *slowConn) CheckNamedValue(nv *driver.NamedValue) error {
+	if c, ok := sc.Conn.(driver.NamedValueChecker); ok {
+		return c.CheckNamedValue(nv)
+	}
+	return driver.ErrSkip
+}
+
+// slowStmt times the prepared statements
+type slowStmt struct {
+	driver.Stmt
+	query string
+	c     *slowConnector
+}
+
+func (ss *slowStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	start := time.Now()
+	var (
+		res driver.Result
+		err error
+	)
+	if e, ok := ss.Stmt.(driver.StmtExecContext); ok {
+		res, err = e.ExecContext(ctx, args)
+	} else {
+		res, err = ss.Stmt.Exec(values(args))
+	}
+	ss.c.observe(ctx, ss.query, start, err)
+	return res, err
+}
+
+func (ss *slowStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	start := time.Now()
+	var (
+		rows driver.Rows
+		err  error
+	)
+	if q, ok := ss.Stmt.(driver.StmtQueryContext); ok {
+		rows, err = q.QueryContext(ctx, args)
+	} else {
+		rows, err = ss.Stmt.Query(values(args))
+	}
+	ss.c.observe(ctx, ss.query, start, err)
+	return rows, err
+}
+
+func (ss *slowStmt) CheckNamedValue(nv *driver.NamedValue) error {
+	if c, ok := ss.Stmt.(driver.NamedValueChecker); ok {
+		return c.CheckNamedValue(nv)
+	}
+	return driver.ErrSkip
+}
+
+// values converts the arguments for the legacy statement interface
+func values(args []driver.NamedValue) []driver.Value {
+	v := make([]driver.Value, len(args))
+	for i, a := range args {
+		v[i] = a.Value
+	}
+	return v
+}
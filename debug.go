@@ -0,0 +1,120 @@
+package hang
+
+import (
+	"crypto/subtle"
+	"expvar"
+	"net/http"
+	"net/http/pprof"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// DebugTokenHeader is the header carrying the token for the debug endpoints
+const DebugTokenHeader = "X-Debug-Token"
+
+// DebugTokenParam is the query parameter carrying the token for the debug
+// endpoints mounted by EnableDebugBrowserEndpoints
+const DebugTokenParam = "token"
+
+// EnableDebugEndpoints mounts the net/http/pprof and expvar handlers under
+// the debug/ prefix (on the admin listener, if enabled). If token is not empty requests must carry it in the
+// X-Debug-Token header.
+func (h *Handler) EnableDebugEndpoints(token string) error {
+	return h.enableDebugEndpoints(token, false)
+}
+
+// EnableDebugBrowserEndpoints is EnableDebugEndpoints also accepting the
+// token in the token query parameter, so that the pprof index can be browsed.
+// The token ends up in access logs and Referer headers: use a short lived one.
+func (h *Handler) EnableDebugBrowserEndpoints(token string) error {
+	return h.enableDebugEndpoints(token, true)
+}
+
+func (h *Handler) enableDebugEndpoints(token string, query bool) error {
+	var (
+		err    error
+		routes = map[string]http.Handler{
+			"debug/pprof":         http.HandlerFunc(pprof.Index),
+			"debug/pprof/cmdline": http.HandlerFunc(pprof.Cmdline),
+			"debug/pprof/profile": http.HandlerFunc(pprof.Profile),
+			"debug/pprof/symbol":  http.HandlerFunc(pprof.Symbol),
+			"debug/pprof/trace":   http.HandlerFunc(pprof.Trace),
+			"debug/vars":          expvar.Handler(),
+		}
+	)
+	// Named profiles (heap, goroutine, ...)
+	for _, p := range []string{"allocs", "block", "goroutine", "heap", "mutex", "threadcreate"} {
+		routes["debug/pprof/"+p] = pprof.Handler(p)
+	}
+	for route, handler := range routes {
+		fn := RequireToken(token, DebugTokenHeader, FromHTTPHandler(handler))
+		if query {
+			fn = RequireTokenOrQuery(token, DebugTokenHeader, DebugTokenParam, FromHTTPHandler(handler))
+		}
+		err = h.ops().AddRoute(route, fn)
+		if err != nil {
+			return errors.Wrap(err, "can't enable debug endpoints")
+		}
+	}
+	h.Log.Infof("%v: debug endpoints enabled", h.ProcessName)
+	return nil
+}
+
+// RequireToken protects handleFunc with a static token to be found in the
+// given header. An empty token disables the check.
+func RequireToken(token, header string, handleFunc HandleFunc) HandleFunc {
+	return RequireTokenOrQuery(token, header, "", handleFunc)
+}
+
+// RequireTokenOrQuery is RequireToken also looking for the token in the
+// param query parameter when the header is missing. Query strings are
+// logged by proxies and leaked through Referer, prefer RequireToken.
+func RequireTokenOrQuery(token, header, param string, handleFunc HandleFunc) HandleFunc {
+	if token == "" {
+		return handleFunc
+	}
+	return func(resp http.ResponseWriter, req *http.Request) error {
+		got := req.Header.Get(header)
+		if got == "" && param != "" {
+			got = req.URL.Query().Get(param)
+		}
+		if subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			err := errors.New("invalid or missing token")
+			WriteError(resp, req, http.StatusUnauthorized, err)
+			return errors.Wrap(err, "unauthorized request to "+GetRoute(req))
+		}
+		return handleFunc(resp, req)
+	}
+}
+
+// checkControlToken refuses to expose without token an endpoint changing
+// the behaviour of the service on the public listener
+func (h *Handler) checkControlToken(route, token string) error {
+	if token == "" && h.Admin == nil {
+		return errors.New("the " + route + " endpoint needs a token unless served on the admin listener")
+	}
+	return nil
+}
+
+// RequireBasicAuth protects handleFunc with HTTP basic authentication,
+// asking the browser for the credentials of realm. An empty user disables
+// the check.
+func RequireBasicAuth(user, password, realm string, handleFunc HandleFunc) HandleFunc {
+	if user == "" {
+		return handleFunc
+	}
+	return func(resp http.ResponseWriter, req *http.Request) error {
+		u, p, _ := req.BasicAuth()
+		// Compare both to not leak which one is wrong
+		userOK := subtle.ConstantTimeCompare([]byte(u), []byte(user)) == 1
+		passwordOK := subtle.ConstantTimeCompare([]byte(p), []byte(password)) == 1
+		if !userOK || !passwordOK {
+			err := errors.New("invalid or missing credentials")
+			resp.Header().Set("WWW-Authenticate", `Basic realm="`+strings.Replace(realm, `"`, "", -1)+`", charset="UTF-8"`)
+			WriteError(resp, req, http.StatusUnauthorized, err)
+			return errors.Wrap(err, "unauthorized request to "+GetRoute(req))
+		}
+		return handleFunc(resp, req)
+	}
+}
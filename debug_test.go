@@ -0,0 +1,66 @@
+package hang
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequireBasicAuth(t *testing.T) {
+	h := testHandler(t)
+	h.AddRoute("admin", RequireBasicAuth("admin", "secret", `Ops "area"`, func(resp http.ResponseWriter, req *http.Request) error { return nil }))
+
+	tests := []struct {
+		name     string
+		user     string
+		password string
+		status   int
+	}{
+		{"no credentials", "", "", http.StatusUnauthorized},
+		{"wrong user", "root", "secret", http.StatusUnauthorized},
+		{"wrong password", "admin", "wrong", http.StatusUnauthorized},
+		{"password prefix", "admin", "secre", http.StatusUnauthorized},
+		{"credentials", "admin", "secret", http.StatusOK},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/admin", nil)
+		if tt.user != "" {
+			req.SetBasicAuth(tt.user, tt.password)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != tt.status {
+			t.Errorf("%s: got status %d, want %d", tt.name, rec.Code, tt.status)
+		}
+		if want := `Basic realm="Ops area", charset="UTF-8"`; rec.Code == http.StatusUnauthorized && rec.Header().Get("WWW-Authenticate") != want {
+			t.Errorf("%s: got WWW-Authenticate %q, want %q", tt.name, rec.Header().Get("WWW-Authenticate"), want)
+		}
+	}
+}
+
+func TestRequireToken(t *testing.T) {
+	h := testHandler(t)
+	ok := func(resp http.ResponseWriter, req *http.Request) error { return nil }
+	h.AddRoute("debug", RequireToken("secret", DebugTokenHeader, ok))
+	h.AddRoute("browse", RequireTokenOrQuery("secret", DebugTokenHeader, DebugTokenParam, ok))
+
+	tests := []struct {
+		name   string
+		target string
+		header http.Header
+		status int
+	}{
+		{"no token", "/debug", nil, http.StatusUnauthorized},
+		{"wrong header", "/debug", http.Header{DebugTokenHeader: {"wrong"}}, http.StatusUnauthorized},
+		{"header", "/debug", http.Header{DebugTokenHeader: {"secret"}}, http.StatusOK},
+		{"query not accepted", "/debug?token=secret", nil, http.StatusUnauthorized},
+		{"opt-in query", "/browse?token=secret", nil, http.StatusOK},
+		{"opt-in header", "/browse", http.Header{DebugTokenHeader: {"secret"}}, http.StatusOK},
+		{"opt-in wrong header right query", "/browse?token=secret", http.Header{DebugTokenHeader: {"wrong"}}, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		if rec := serve(h, http.MethodGet, tt.target, tt.header); rec.Code != tt.status {
+			t.Errorf("%s: got status %d, want %d", tt.name, rec.Code, tt.status)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package hang
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// MaxDecompressedBodySize is the maximum size of a compressed request body
+// once decompressed by GetReqData
+var MaxDecompressedBodySize int64 = 10 << 20
+
+// errBodyTooLarge is returned when the decompressed body exceeds the limit
+var errBodyTooLarge = errors.New("decompressed request body too large")
+
+// errUnsupportedEncoding is returned for unknown Content-Encoding values
+var errUnsupportedEncoding = errors.New("unsupported content encoding")
+
+// errMissingBody is returned for requests without body
+var errMissingBody = errors.New("Missing input data")
+
+// errBodyConsumed is returned reading a body already read, with the message
+// of io.EOF
+var errBodyConsumed = errors.New("EOF")
+
+// readBody reads the request body, decompressing it according to the
+// Content-Encoding header (gzip, deflate)
+func readBody(req *http.Request) ([]byte, error) {
+	var (
+		r   io.Reader = req.Body
+		err error
+	)
+	switch strings.ToLower(strings.TrimSpace(req.Header.Get("Content-Encoding"))) {
+	case "", "identity":
+		return ioutil.ReadAll(req.Body)
+	case "gzip", "x-gzip":
+		r, err = gzip.NewReader(req.Body)
+		if err != nil {
+			return nil, errors.Wrap(err, "can't decompress gzip body")
+		}
+	case "deflate":
+		r, err = deflateReader(req.Body)
+		if err != nil {
+			return nil, errors.Wrap(err, "can't decompress deflate body")
+		}
+	default:
+		return nil, errors.Wrap(errUnsupportedEncoding, req.Header.Get("Content-Encoding"))
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(r, MaxDecompressedBodySize+1))
+	if err != nil {
+		return nil, errors.Wrap(err, "can't decompress body")
+	}
+	if int64(len(body)) > MaxDecompressedBodySize {
+		return nil, errBodyTooLarge
+	}
+	return body, nil
+}
+
+// deflateReader accepts both zlib wrapped (as per RFC 9110) and raw deflate
+// streams, as sent by some clients
+func deflateReader(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	head, err := br.Peek(2)
+	if err != nil {
+		return nil, err
+	}
+	if head[0]&0x0f == 8 && (uint16(head[0])<<8|uint16(head[1]))%31 == 0 {
+		return zlib.NewReader(br)
+	}
+	return flate.NewReader(br), nil
+}
+
+// bodyErrorStatus returns the response status for a body reading error
+func bodyErrorStatus(err error) int {
+	switch errors.Cause(err) {
+	case errBodyTooLarge:
+		return http.StatusRequestEntityTooLarge
+	case errUnsupportedEncoding:
+		return http.StatusUnsupportedMediaType
+	case errBodyConsumed:
+		return http.StatusInternalServerError
+	}
+	return http.StatusBadRequest
+}
@@ -0,0 +1,180 @@
+package hang
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ServiceHostSuffix marks the logical service names in the URLs of the
+// Client requests: http://billing.service/invoices is sent to an instance
+// of the billing service found by the Resolver
+const ServiceHostSuffix = ".service"
+
+// Resolver returns the addresses (host:port) of the instances of a service
+type Resolver interface {
+	Resolve(ctx context.Context, service string) ([]string, error)
+}
+
+// ResolverFunc adapts a function to the Resolver interface
+type ResolverFunc func(ctx context.Context, service string) ([]string, error)
+
+// Resolve calls f
+func (f ResolverFunc) Resolve(ctx context.Context, service string) ([]string, error) {
+	return f(ctx, service)
+}
+
+// SRVResolver resolves the services with DNS SRV records, looking up
+// _Service._Proto.name.Domain
+type SRVResolver struct {
+	// Service and protocol of the records, e.g. "http" and "tcp"; the
+	// name is looked up directly if Service is empty
+	Service string
+	Proto   string
+	// Domain appended to the service name, e.g. "service.consul"
+	Domain string
+	// DNS resolver, net.DefaultResolver if nil
+	Resolver *net.Resolver
+}
+
+// Resolve implements Resolver
+func (r SRVResolver) Resolve(ctx context.Context, service string) ([]string, error) {
+	resolver := r.Resolver
+	if resolver == nil {
+		resolver = net.DefaultResolver
+	}
+	name := service
+	if r.Domain != "" {
+		name += "." + strings.Trim(r.Domain, ".")
+	}
+	_, srvs, err := resolver.LookupSRV(ctx, r.Service, r.Proto, name)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't resolve "+name)
+	}
+	addrs := make([]string, 0, len(srvs))
+	for _, srv := range srvs {
+		addrs = append(addrs, net.JoinHostPort(strings.TrimSuffix(srv.Target, "."), strconv.Itoa(int(srv.Port))))
+	}
+	return addrs, nil
+}
+
+// BalancePolicy chooses the instance of a service receiving a request
+type BalancePolicy int
+
+const (
+	// RoundRobin cycles through the instances (default)
+	RoundRobin BalancePolicy = iota
+	// LeastPending picks the instance with fewer requests in flight
+	LeastPending
+)
+
+// resolvedService is a cached resolution
+type resolvedService struct {
+	addrs   []string
+	expires time.Time
+	next    uint32
+}
+
+// discovery is the client state for the service resolution
+type discovery struct {
+	mu       sync.Mutex
+	services map[string]*resolvedService
+	pending  map[string]*int64
+}
+
+// serviceName returns the logical service name of host, "" if none
+func serviceName(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if !strings.HasSuffix(host, ServiceHostSuffix) {
+		return ""
+	}
+	return strings.TrimSuffix(host, ServiceHostSuffix)
+}
+
+// instances returns the addresses of service, cached for ResolveTTL; the
+// stale ones are used if the resolution fails
+func (c *Client) instances(ctx context.Context, service string) ([]string, *resolvedService, error) {
+	c.discovery.mu.Lock()
+	rs, ok := c.discovery.services[service]
+	c.discovery.mu.Unlock()
+	if ok && time.Now().Before(rs.expires) {
+		return rs.addrs, rs, nil
+	}
+	addrs, err := c.opts.Resolver.Resolve(ctx, service)
+	if err == nil && len(addrs) == 0 {
+		err = errors.New("no instance of service " + service)
+	}
+	if err != nil {
+		if ok {
+			c.Log.WithFields(Fields{"service": service}).Warn(errors.Wrap(err, "using stale instances"))
+			return rs.addrs, rs, nil
+		}
+		return nil, nil, err
+	}
+	c.discovery.mu.Lock()
+	defer c.discovery.mu.Unlock()
+	if c.discovery.services == nil {
+		c.discovery.services = map[string]*resolvedService{}
+	}
+	next := uint32(0)
+	if ok {
+		next = atomic.LoadUint32(&rs.next)
+	}
+	rs = &resolvedService{addrs: addrs, expires: time.Now().Add(c.opts.ResolveTTL), next: next}
+	c.discovery.services[service] = rs
+	return addrs, rs, nil
+}
+
+// pick returns the instance of service for the next request, skipping the
+// ones whose circuit is open
+func (c *Client) pick(ctx context.Context, service string) (string, error) {
+	addrs, rs, err := c.instances(ctx, service)
+	if err != nil {
+		return "", err
+	}
+	candidates := make([]string, 0, len(addrs))
+	for _, addr := range addrs {
+		if cb := c.breaker(addr); cb == nil || cb.State() != BreakerOpen {
+			candidates = append(candidates, addr)
+		}
+	}
+	if len(candidates) == 0 {
+		return "", errors.Wrap(ErrCircuitOpen, "all instances of "+service)
+	}
+	if c.opts.Balance == LeastPending {
+		best, bestPending := "", int64(-1)
+		// Start from the round robin position to spread the ties
+		start := int(atomic.AddUint32(&rs.next, 1))
+		for i := range candidates {
+			addr := candidates[(start+i)%len(candidates)]
+			if p := atomic.LoadInt64(c.pendingCounter(addr)); bestPending < 0 || p < bestPending {
+				best, bestPending = addr, p
+			}
+		}
+		return best, nil
+	}
+	return candidates[int(atomic.AddUint32(&rs.next, 1)-1)%len(candidates)], nil
+}
+
+// pendingCounter returns the counter of the requests in flight to addr
+func (c *Client) pendingCounter(addr string) *int64 {
+	c.discovery.mu.Lock()
+	defer c.discovery.mu.Unlock()
+	if c.discovery.pending == nil {
+		c.discovery.pending = map[string]*int64{}
+	}
+	p, ok := c.discovery.pending[addr]
+	if !ok {
+		p = new(int64)
+		c.discovery.pending[addr] = p
+	}
+	return p
+}
@@ -0,0 +1,364 @@
+package hang
+
+import (
+	"html"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gitlab.com/brunetto/swaggo"
+)
+
+// RouteDoc documents one method of a route for the generated swagger spec
+type RouteDoc struct {
+	// HTTP method, GET if empty
+	Method string
+	// Short and long description of the endpoint
+	Summary     string
+	Description string
+	// Tags to group endpoints in the UI
+	Tags []string
+	// Mime types accepted and produced
+	Consumes string
+	Produces string
+	// Description of the possible responses by status code
+	Responses map[int]string
+	// Values of the types of the JSON request body and of the JSON response
+	// of the successful status, e.g. CreateUser{} and User{}, nil if none;
+	// their schemas are reflected into the spec definitions
+	Request  interface{}
+	Response interface{}
+}
+
+// Spec is a minimal swagger 2.0 document
+type Spec struct {
+	Swagger     string                          `json:"swagger"`
+	Info        SpecInfo                        `json:"info"`
+	Paths       map[string]map[string]Operation `json:"paths"`
+	Definitions map[string]*Schema              `json:"definitions,omitempty"`
+}
+
+// SpecInfo contains the API metadata
+type SpecInfo struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+// Operation documents a method on a path
+type Operation struct {
+	Summary     string                  `json:"summary,omitempty"`
+	Description string                  `json:"description,omitempty"`
+	OperationID string                  `json:"operationId,omitempty"`
+	Tags        []string                `json:"tags,omitempty"`
+	Consumes    []string                `json:"consumes,omitempty"`
+	Produces    []string                `json:"produces,omitempty"`
+	Parameters  []Parameter             `json:"parameters,omitempty"`
+	Responses   map[string]SpecResponse `json:"responses"`
+}
+
+// Parameter documents a path parameter or the request body
+type Parameter struct {
+	Name     string  `json:"name"`
+	In       string  `json:"in"`
+	Required bool    `json:"required"`
+	Type     string  `json:"type,omitempty"`
+	Schema   *Schema `json:"schema,omitempty"`
+}
+
+// SpecResponse documents a response
+type SpecResponse struct {
+	Description string  `json:"description"`
+	Schema      *Schema `json:"schema,omitempty"`
+}
+
+// AddDocumentedRoute registers a handler for a route together with its
+// documentation, one RouteDoc per method
+func (h *Handler) AddDocumentedRoute(route string, handleFunc HandleFunc, docs ...RouteDoc) error {
+	err := h.AddRoute(route, handleFunc)
+	if err != nil {
+		return err
+	}
+	if h.Docs == nil {
+		h.Docs = map[string][]RouteDoc{}
+	}
+	h.Docs[route] = docs
+	return nil
+}
+
+// DocumentRoute adds documentation to a registered route, e.g. one added
+// with AddMethodRoute
+func (h *Handler) DocumentRoute(route string, docs ...RouteDoc) error {
+	if _, exists := h.Routes[route]; !exists {
+		return errors.New("Route " + route + " does not exist.")
+	}
+	if h.Docs == nil {
+		h.Docs = map[string][]RouteDoc{}
+	}
+	h.Docs[route] = append(h.Docs[route], docs...)
+	return nil
+}
+
+// AddSwaggoRoute registers fn for method on route, documenting it with doc
+// both in the spec generated by SwaggerSpec and, as swaggo endpoint
+// metadata, in docs, the swaggo instance also serving a gin engine
+func (h *Handler) AddSwaggoRoute(docs *swaggo.Swaggo, method, route string, fn HandleFunc, doc RouteDoc) error {
+	doc.Method = strings.ToUpper(method)
+	err := h.AddMethodRoute(doc.Method, route, fn)
+	if err != nil {
+		return err
+	}
+	err = h.DocumentRoute(route, doc)
+	if err != nil {
+		return err
+	}
+	path, _ := specPath(route)
+	docs.AddEndpoint(path, doc.Method, "", swaggoOptions(doc)...)
+	return nil
+}
+
+// swaggoOptions returns the swaggo endpoint metadata of doc
+func swaggoOptions(doc RouteDoc) []swaggo.Option {
+	opts := []swaggo.Option{
+		swaggo.Description(strings.TrimSpace(doc.Summary + "\n" + doc.Description)),
+		swaggo.Consumes(doc.Consumes),
+		swaggo.Produces(doc.Produces),
+	}
+	if doc.Request != nil && doc.Consumes == "" {
+		opts[1] = swaggo.Consumes(MIMEJSON)
+	}
+	if doc.Response != nil && doc.Produces == "" {
+		opts[2] = swaggo.Produces(MIMEJSON)
+	}
+	codes := make([]int, 0, len(doc.Responses))
+	for code := range doc.Responses {
+		codes = append(codes, code)
+	}
+	sort.Ints(codes)
+	for _, code := range codes {
+		opts = append(opts, swaggo.Response(code, "", doc.Responses[code]))
+	}
+	return opts
+}
+
+// SwaggerSpec generates the swagger document from the documentation of the
+// routes (see AddDocumentedRoute, DocumentRoute and AddSwaggoRoute). Routes
+// without documentation are not listed, as regex routes.
+func (h *Handler) SwaggerSpec(version string) Spec {
+	spec := Spec{
+		Swagger:     "2.0",
+		Info:        SpecInfo{Title: h.ProcessName, Version: version},
+		Paths:       map[string]map[string]Operation{},
+		Definitions: map[string]*Schema{},
+	}
+	for route := range h.Routes {
+		if route == "default" || route == "swagger.json" || route == "docs" || route == h.docsRoute || route == "openapi.json" || route == "openapi.yaml" || isRegexRoute(route) {
+			continue
+		}
+		docs := h.Docs[route]
+		if len(docs) == 0 {
+			continue
+		}
+		path, params := specPath(route)
+		ops := map[string]Operation{}
+		for _, d := range docs {
+			method := strings.ToLower(d.Method)
+			if method == "" {
+				method = "get"
+			}
+			op := Operation{
+				Summary:     d.Summary,
+				Description: d.Description,
+				OperationID: method + "_" + operationName.Replace(route),
+				Tags:        d.Tags,
+				Parameters:  append([]Parameter{}, params...),
+				Responses:   map[string]SpecResponse{},
+			}
+			if d.Request != nil {
+				op.Parameters = append(op.Parameters, Parameter{Name: "body", In: "body", Required: true, Schema: SchemaOf(d.Request, spec.Definitions, "")})
+			}
+			if d.Consumes != "" {
+				op.Consumes = []string{d.Consumes}
+			}
+			if d.Produces != "" {
+				op.Produces = []string{d.Produces}
+			}
+			for code, desc := range d.Responses {
+				op.Responses[strconv.Itoa(code)] = SpecResponse{Description: desc}
+			}
+			if len(op.Responses) == 0 {
+				op.Responses["default"] = SpecResponse{Description: "Response"}
+			}
+			if d.Response != nil {
+				code := successCode(op.Responses)
+				r := op.Responses[code]
+				r.Schema = SchemaOf(d.Response, spec.Definitions, "")
+				op.Responses[code] = r
+			}
+			ops[method] = op
+		}
+		spec.Paths[path] = ops
+	}
+	return spec
+}
+
+// operationName makes a route usable in an operation ID
+var operationName = strings.NewReplacer("/", "_", ":", "", "*", "path", HostSeparator, "_")
+
+// specPath returns the spec path of route, with {name} for the :name
+// segments and {path} for the wildcard, and its path parameters
+func specPath(route string) (string, []Parameter) {
+	var params []Parameter
+	_, rpath := splitHostRoute(route)
+	segs := strings.Split(rpath, "/")
+	for i, seg := range segs {
+		name := ""
+		switch {
+		case strings.HasPrefix(seg, ":"):
+			name = seg[1:]
+		case seg == "*":
+			name = "path"
+		default:
+			continue
+		}
+		segs[i] = "{" + name + "}"
+		params = append(params, Parameter{Name: name, In: "path", Required: true, Type: "string"})
+	}
+	return "/" + strings.Join(segs, "/"), params
+}
+
+// successCode returns the first 2xx status of the responses, "200" if none
+func successCode(responses map[string]SpecResponse) string {
+	best := ""
+	for code := range responses {
+		if strings.HasPrefix(code, "2") && (best == "" || code < best) {
+			best = code
+		}
+	}
+	if best == "" {
+		best = "200"
+		if r, ok := responses["default"]; ok && len(responses) == 1 {
+			delete(responses, "default")
+			responses[best] = SpecResponse{Description: r.Description}
+		}
+	}
+	return best
+}
+
+// DocsUI selects the documentation UI
+type DocsUI int
+
+const (
+	// ReDoc UI (default)
+	ReDocUI DocsUI = iota
+	// Swagger UI, allowing to try the endpoints
+	SwaggerUI
+)
+
+// Bundles of the documentation UIs, pinned so that the docs do not change
+// with a new release; see DocsOptions.ScriptURL to serve them locally
+const (
+	ReDocScriptURL = "https://cdn.redoc.ly/redoc/v2.1.5/bundles/redoc.standalone.js"
+	SwaggerUIURL   = "https://unpkg.com/swagger-ui-dist@5.17.14"
+)
+
+// DocsOptions configures the documentation routes
+type DocsOptions struct {
+	// Version of the API in the spec
+	Version string
+	// UI serving the spec
+	UI DocsUI
+	// Route of the UI, "docs" if empty
+	Route string
+	// Credentials required to read the UI and the spec, none if User is empty
+	User     string
+	Password string
+	// Location of the UI bundle, e.g. a static route for the docs to work
+	// offline: the redoc.standalone.js script for ReDoc, the swagger-ui-dist
+	// folder for Swagger UI. ReDocScriptURL or SwaggerUIURL if empty.
+	ScriptURL string
+}
+
+// EnableDocs registers the swagger.json route serving the spec generated
+// from the documented routes and the docs route serving the ReDoc UI
+func (h *Handler) EnableDocs(version string) error {
+	return h.EnableDocsWithOptions(DocsOptions{Version: version})
+}
+
+// EnableDocsWithOptions registers the swagger.json route serving the spec
+// generated from the documented routes and the route serving the UI,
+// both protected by basic auth if credentials are set
+func (h *Handler) EnableDocsWithOptions(opts DocsOptions) error {
+	if opts.Route == "" {
+		opts.Route = "docs"
+	}
+	realm := h.ProcessName + " API docs"
+	err := h.AddRoute("swagger.json", RequireBasicAuth(opts.User, opts.Password, realm, func(resp http.ResponseWriter, req *http.Request) error {
+		return WriteJSON(resp, http.StatusOK, h.SwaggerSpec(opts.Version))
+	}))
+	if err != nil {
+		return errors.Wrap(err, "can't enable docs")
+	}
+	var page string
+	switch opts.UI {
+	case SwaggerUI:
+		if opts.ScriptURL == "" {
+			opts.ScriptURL = SwaggerUIURL
+		}
+		page = swaggerUIPage(h.ProcessName, "/swagger.json", strings.TrimRight(opts.ScriptURL, "/"))
+	default:
+		if opts.ScriptURL == "" {
+			opts.ScriptURL = ReDocScriptURL
+		}
+		page = redocPage(h.ProcessName, "/swagger.json", opts.ScriptURL)
+	}
+	h.docsRoute = opts.Route
+	err = h.AddRoute(opts.Route, RequireBasicAuth(opts.User, opts.Password, realm, func(resp http.ResponseWriter, req *http.Request) error {
+		resp.Header().Set("Content-Type", "text/html; charset=utf-8")
+		resp.WriteHeader(http.StatusOK)
+		_, err := resp.Write([]byte(page))
+		return err
+	}))
+	if err != nil {
+		return errors.Wrap(err, "can't enable docs")
+	}
+	return nil
+}
+
+func redocPage(title, specURL, scriptURL string) string {
+	return `<!DOCTYPE html>
+<html>
+<head>
+<title>` + html.EscapeString(title) + ` - API docs</title>
+<meta charset="utf-8"/>
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<style>body { margin: 0; padding: 0; }</style>
+</head>
+<body>
+<redoc spec-url="` + specURL + `"></redoc>
+<script src="` + html.EscapeString(scriptURL) + `"></script>
+</body>
+</html>`
+}
+
+func swaggerUIPage(title, specURL, distURL string) string {
+	return `<!DOCTYPE html>
+<html>
+<head>
+<title>` + html.EscapeString(title) + ` - API docs</title>
+<meta charset="utf-8"/>
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<link rel="stylesheet" href="` + html.EscapeString(distURL) + `/swagger-ui.css">
+</head>
+<body>
+<div id="swagger-ui"></div>
+<script src="` + html.EscapeString(distURL) + `/swagger-ui-bundle.js"></script>
+<script>
+window.onload = function() {
+	SwaggerUIBundle({url: "` + specURL + `", dom_id: "#swagger-ui"});
+};
+</script>
+</body>
+</html>`
+}
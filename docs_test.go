@@ -0,0 +1,63 @@
+package hang
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"gitlab.com/brunetto/swaggo"
+)
+
+func TestSwaggerSpec(t *testing.T) {
+	h := testHandler(t)
+	ok := func(resp http.ResponseWriter, req *http.Request) error { return nil }
+	h.AddRoute("internal", ok)
+	h.AddDocumentedRoute("users/:id", ok, RouteDoc{Summary: "Get a user", Responses: map[int]string{http.StatusOK: "The user"}})
+	sw, err := swaggo.NewSwaggo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := h.AddSwaggoRoute(sw, "post", "users", ok, RouteDoc{Summary: "Create a user"}); err != nil {
+		t.Fatal(err)
+	}
+
+	spec := h.SwaggerSpec("1.0")
+	for _, path := range []string{"/internal", "/livecheck", "/version"} {
+		if _, ok := spec.Paths[path]; ok {
+			t.Errorf("undocumented route %s listed", path)
+		}
+	}
+	if op, ok := spec.Paths["/users/{id}"]["get"]; !ok || op.Summary != "Get a user" || len(op.Parameters) != 1 {
+		t.Errorf("got /users/{id} %+v, want the documented GET with the id parameter", spec.Paths["/users/{id}"])
+	}
+	if ops := spec.Paths["/users"]; len(ops) != 1 || ops["post"].Summary != "Create a user" {
+		t.Errorf("got /users %+v, want only the documented POST", ops)
+	}
+}
+
+func TestDocsPage(t *testing.T) {
+	tests := []struct {
+		opts DocsOptions
+		want []string
+	}{
+		{DocsOptions{}, []string{ReDocScriptURL}},
+		{DocsOptions{UI: SwaggerUI}, []string{SwaggerUIURL + "/swagger-ui-bundle.js", SwaggerUIURL + "/swagger-ui.css"}},
+		{DocsOptions{ScriptURL: "/static/redoc.standalone.js"}, []string{`src="/static/redoc.standalone.js"`}},
+		{DocsOptions{UI: SwaggerUI, ScriptURL: "/static/swagger/"}, []string{`src="/static/swagger/swagger-ui-bundle.js"`}},
+	}
+	for _, tt := range tests {
+		h := testHandler(t)
+		if err := h.EnableDocsWithOptions(tt.opts); err != nil {
+			t.Fatal(err)
+		}
+		page := serve(h, http.MethodGet, "/docs", nil).Body.String()
+		for _, want := range tt.want {
+			if !strings.Contains(page, want) {
+				t.Errorf("%+v: page does not load %s", tt.opts, want)
+			}
+		}
+		if strings.Contains(page, "latest") || strings.Contains(page, "@5/") {
+			t.Errorf("%+v: page loads an unpinned bundle", tt.opts)
+		}
+	}
+}
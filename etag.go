@@ -0,0 +1,164 @@
+package hang
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ETags returns a middleware buffering the successful GET and HEAD responses
+// to set their ETag (unless set by the handler) and answering 304 to the
+// requests whose If-None-Match matches it. Flushing the response, as
+// streaming handlers do, disables the buffering.
+func ETags() Middleware {
+	return func(next HandleFunc) HandleFunc {
+		return func(resp http.ResponseWriter, req *http.Request) error {
+			if req.Method != http.MethodGet && req.Method != http.MethodHead {
+				return next(resp, req)
+			}
+			bw := &bufferedWriter{ResponseWriter: resp, status: http.StatusOK}
+			err := next(bw, req)
+			if bw.streaming || !bw.wroteHeader {
+				// Nothing to tag if the handler wrote nothing, the error
+				// response is left to Handle
+				return err
+			}
+			if bw.status == http.StatusOK {
+				etag := resp.Header().Get("ETag")
+				if etag == "" {
+					etag = ComputeETag(bw.buf.Bytes())
+					resp.Header().Set("ETag", etag)
+				}
+				if etagMatch(req.Header.Get("If-None-Match"), etag, true) {
+					resp.Header().Del("Content-Type")
+					resp.Header().Del("Content-Length")
+					resp.WriteHeader(http.StatusNotModified)
+					return err
+				}
+			}
+			bw.flush()
+			return err
+		}
+	}
+}
+
+// ComputeETag returns a strong ETag for body
+func ComputeETag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// CheckIfMatch verifies the If-Match precondition of a mutating request
+// against the current ETag of the resource, responding 412 if it fails. A
+// request without If-Match passes unless required is set, in which case it
+// gets a 428.
+func CheckIfMatch(resp http.ResponseWriter, req *http.Request, currentETag string, required bool) error {
+	ifMatch := req.Header.Get("If-Match")
+	if ifMatch == "" {
+		if !required {
+			return nil
+		}
+		err := errors.New("missing If-Match header")
+		// Respond
+		WriteError(resp, req, http.StatusPreconditionRequired, err)
+		return err
+	}
+	if etagMatch(ifMatch, currentETag, false) {
+		return nil
+	}
+	err := errors.New("resource has been modified")
+	// Respond
+	WriteError(resp, req, http.StatusPreconditionFailed, err)
+	return err
+}
+
+// CheckIfNoneMatch reports whether the If-None-Match header matches etag,
+// responding 304 in that case, for handlers knowing the ETag before building
+// the response
+func CheckIfNoneMatch(resp http.ResponseWriter, req *http.Request, etag string) bool {
+	resp.Header().Set("ETag", etag)
+	if !etagMatch(req.Header.Get("If-None-Match"), etag, true) {
+		return false
+	}
+	resp.WriteHeader(http.StatusNotModified)
+	return true
+}
+
+// etagMatch compares etag with the list in header, with the weak comparison
+// (If-None-Match) or the strong one (If-Match)
+func etagMatch(header, etag string, weak bool) bool {
+	if header == "" || etag == "" {
+		return false
+	}
+	if strings.TrimSpace(header) == "*" {
+		return true
+	}
+	if weak {
+		etag = strings.TrimPrefix(etag, "W/")
+	} else if strings.HasPrefix(etag, "W/") {
+		return false
+	}
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if weak {
+			candidate = strings.TrimPrefix(candidate, "W/")
+		}
+		if candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// bufferedWriter holds status and body until flush, headers go straight
+// to the wrapped writer. Flushing it switches to pass through.
+type bufferedWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	buf         bytes.Buffer
+	streaming   bool
+}
+
+func (bw *bufferedWriter) WriteHeader(status int) {
+	if bw.streaming {
+		bw.ResponseWriter.WriteHeader(status)
+		return
+	}
+	if !bw.wroteHeader {
+		bw.status = status
+		bw.wroteHeader = true
+	}
+}
+
+func (bw *bufferedWriter) Write(b []byte) (int, error) {
+	if bw.streaming {
+		return bw.ResponseWriter.Write(b)
+	}
+	bw.wroteHeader = true
+	return bw.buf.Write(b)
+}
+
+// Flush writes what has been buffered and stops buffering
+func (bw *bufferedWriter) Flush() {
+	if !bw.streaming {
+		bw.flush()
+		bw.streaming = true
+	}
+	http.NewResponseController(bw.ResponseWriter).Flush()
+}
+
+// flush writes status and buffered body, nothing if the handler wrote
+// nothing
+func (bw *bufferedWriter) flush() {
+	if !bw.wroteHeader {
+		return
+	}
+	bw.ResponseWriter.WriteHeader(bw.status)
+	bw.ResponseWriter.Write(bw.buf.Bytes())
+	bw.buf.Reset()
+}
@@ -0,0 +1,40 @@
+package hang
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestETags(t *testing.T) {
+	h := testHandler(t)
+	h.SetErrorRenderer(FormatErrorRenderer(ProblemJSONErrors))
+	h.Use(ETags())
+	h.AddRoute("doc", func(resp http.ResponseWriter, req *http.Request) error {
+		return WriteJSON(resp, http.StatusOK, "content")
+	})
+	h.AddRoute("fail", func(resp http.ResponseWriter, req *http.Request) error {
+		return errors.New("db down")
+	})
+
+	rec := serve(h, http.MethodGet, "/doc", nil)
+	etag := rec.Header().Get("ETag")
+	if rec.Code != http.StatusOK || etag != ComputeETag(rec.Body.Bytes()) {
+		t.Fatalf("got status %d and ETag %q, want 200 tagged with the body hash", rec.Code, etag)
+	}
+	if rec = serve(h, http.MethodGet, "/doc", http.Header{"If-None-Match": {etag}}); rec.Code != http.StatusNotModified || rec.Body.Len() != 0 {
+		t.Errorf("matching If-None-Match: got status %d and body %q, want an empty 304", rec.Code, rec.Body.String())
+	}
+	if rec = serve(h, http.MethodGet, "/doc", http.Header{"If-None-Match": {`"other"`}}); rec.Code != http.StatusOK {
+		t.Errorf("other If-None-Match: got status %d, want 200", rec.Code)
+	}
+
+	emptyETag := ComputeETag(nil)
+	for _, header := range []http.Header{nil, {"If-None-Match": {emptyETag}}} {
+		rec = serve(h, http.MethodGet, "/fail", header)
+		if rec.Code != http.StatusInternalServerError || rec.Header().Get("ETag") != "" || rec.Body.Len() == 0 {
+			t.Errorf("handler error with %v: got status %d, ETag %q and body %q, want the rendered 500 without ETag", header, rec.Code, rec.Header().Get("ETag"), rec.Body.String())
+		}
+	}
+}
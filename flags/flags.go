@@ -0,0 +1,217 @@
+// Package flags provides named feature flags, either on/off or enabled for
+// a percentage of the requests, to dark-launch endpoint behaviour. Flags are
+// loaded from the configuration, can be overridden at runtime through an
+// admin endpoint and are queried by the handlers from the request context.
+package flags
+
+import (
+	"context"
+	"hash/fnv"
+	"net/http"
+	"sort"
+	"sync"
+
+	"github.com/brunetto/hang"
+	"github.com/pkg/errors"
+)
+
+// Flag is the definition of a feature flag. A flag is on when Enabled is
+// true or, for the requests whose key falls in the first Percentage
+// buckets out of 100, when Percentage is set.
+type Flag struct {
+	Enabled    bool    `json:"enabled" yaml:"enabled" toml:"enabled"`
+	Percentage float64 `json:"percentage,omitempty" yaml:"percentage" toml:"percentage"`
+}
+
+// Options configures a Set
+type Options struct {
+	// Flags by name, usually loaded from the configuration
+	Flags map[string]Flag
+	// Key of the request for percentage flags, the same key always getting
+	// the same result; the client address if nil
+	Key func(req *http.Request) string
+}
+
+// State is the current definition of a flag
+type State struct {
+	Name       string  `json:"name"`
+	Enabled    bool    `json:"enabled"`
+	Percentage float64 `json:"percentage,omitempty"`
+	Overridden bool    `json:"overridden"`
+}
+
+// Set holds the feature flags
+type Set struct {
+	Log       hang.Logger
+	key       func(req *http.Request) string
+	mu        sync.RWMutex
+	flags     map[string]Flag
+	overrides map[string]Flag
+}
+
+type ctxKey struct{}
+
+// requestFlags is what Middleware stores in the request context
+type requestFlags struct {
+	set *Set
+	key string
+}
+
+// New returns a Set with the given flags
+func New(lg hang.Logger, opts Options) *Set {
+	if opts.Key == nil {
+		opts.Key = hang.RealIP
+	}
+	s := &Set{Log: lg, key: opts.Key, overrides: map[string]Flag{}}
+	s.Load(opts.Flags)
+	return s
+}
+
+// Load replaces the configured flags, e.g. on a configuration reload;
+// runtime overrides are kept
+func (s *Set) Load(flags map[string]Flag) {
+	m := make(map[string]Flag, len(flags))
+	for name, f := range flags {
+		m[name] = f
+	}
+	s.mu.Lock()
+	s.flags = m
+	s.mu.Unlock()
+}
+
+// Override sets the flag at runtime, taking precedence over the configuration
+func (s *Set) Override(name string, f Flag) {
+	s.mu.Lock()
+	s.overrides[name] = f
+	s.mu.Unlock()
+	s.Log.WithFields(hang.Fields{"flag": name, "enabled": f.Enabled, "percentage": f.Percentage}).Warn("Feature flag overridden")
+}
+
+// Reset removes the runtime override of the flag
+func (s *Set) Reset(name string) {
+	s.mu.Lock()
+	delete(s.overrides, name)
+	s.mu.Unlock()
+	s.Log.WithFields(hang.Fields{"flag": name}).Warn("Feature flag override removed")
+}
+
+// lookup returns the current definition of the flag
+func (s *Set) lookup(name string) (Flag, bool, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if f, ok := s.overrides[name]; ok {
+		return f, true, true
+	}
+	f, ok := s.flags[name]
+	return f, ok, false
+}
+
+// Enabled tells if the flag is on for key; unknown flags are off
+func (s *Set) Enabled(name, key string) bool {
+	f, ok, _ := s.lookup(name)
+	if !ok {
+		return false
+	}
+	if f.Enabled || f.Percentage >= 100 {
+		return true
+	}
+	if f.Percentage <= 0 {
+		return false
+	}
+	return float64(bucket(name, key)) < f.Percentage
+}
+
+// bucket maps name and key to [0, 100)
+func bucket(name, key string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(name))
+	h.Write([]byte{0})
+	h.Write([]byte(key))
+	return h.Sum32() % 100
+}
+
+// States returns the current definition of all the flags, sorted by name
+func (s *Set) States() []State {
+	s.mu.RLock()
+	names := make(map[string]bool, len(s.flags)+len(s.overrides))
+	for name := range s.flags {
+		names[name] = true
+	}
+	for name := range s.overrides {
+		names[name] = true
+	}
+	s.mu.RUnlock()
+	out := make([]State, 0, len(names))
+	for name := range names {
+		f, _, overridden := s.lookup(name)
+		out = append(out, State{Name: name, Enabled: f.Enabled, Percentage: f.Percentage, Overridden: overridden})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// Middleware stores the set and the request key in the request context,
+// for handlers to call Enabled
+func (s *Set) Middleware() hang.Middleware {
+	return func(next hang.HandleFunc) hang.HandleFunc {
+		return func(resp http.ResponseWriter, req *http.Request) error {
+			ctx := context.WithValue(req.Context(), ctxKey{}, requestFlags{set: s, key: s.key(req)})
+			return next(resp, req.WithContext(ctx))
+		}
+	}
+}
+
+// Enabled tells if the flag is on for the request of ctx; it is always off
+// if the context does not come from Middleware
+func Enabled(ctx context.Context, name string) bool {
+	rf, ok := ctx.Value(ctxKey{}).(requestFlags)
+	if !ok {
+		return false
+	}
+	return rf.set.Enabled(name, rf.key)
+}
+
+// EnableEndpoint registers the flags endpoint on h (on its admin listener,
+// if enabled) protected by token if not empty
+func (s *Set) EnableEndpoint(h *hang.Handler, token string) error {
+	if h.Admin != nil {
+		h = h.Admin
+	}
+	return h.AddRoute("flags", hang.RequireToken(token, hang.DebugTokenHeader, s.Endpoint))
+}
+
+// Endpoint returns the flags on GET, overrides one on PUT from a
+// {"name": "...", "enabled": true, "percentage": 10} body and removes the
+// override on DELETE with the name query parameter
+func (s *Set) Endpoint(resp http.ResponseWriter, req *http.Request) error {
+	var err error
+	switch req.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		var data State
+		err = hang.GetReqJSONData(resp, req, &data)
+		if err != nil {
+			return err
+		}
+		if data.Name == "" || data.Percentage < 0 || data.Percentage > 100 {
+			err = errors.New("a name and a percentage between 0 and 100 are required")
+			hang.WriteError(resp, req, http.StatusBadRequest, err)
+			return err
+		}
+		s.Override(data.Name, Flag{Enabled: data.Enabled, Percentage: data.Percentage})
+	case http.MethodDelete:
+		name := req.URL.Query().Get("name")
+		if name == "" {
+			err = errors.New("name query parameter required")
+			hang.WriteError(resp, req, http.StatusBadRequest, err)
+			return err
+		}
+		s.Reset(name)
+	default:
+		resp.Header().Set("Allow", "GET, PUT, DELETE")
+		err = errors.New("method " + req.Method + " not allowed")
+		hang.WriteError(resp, req, http.StatusMethodNotAllowed, err)
+		return err
+	}
+	return hang.WriteJSON(resp, http.StatusOK, s.States())
+}
@@ -0,0 +1,137 @@
+package hang
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/brunetto/gin-logrus"
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"gitlab.com/brunetto/swaggo"
+)
+
+// GinOptions configures the engine created by GinOnTheRocksWithOptions.
+// The zero value gives the GinOnTheRocks defaults.
+type GinOptions struct {
+	// Logger used by the engine; if nil one is created with LoggerOptions
+	Logger Logger
+	// Options of the logger created if Logger is nil, a daily rotated JSON
+	// file storage/logs/<appName>.log teed to stderr at debug level if nil
+	LoggerOptions *LoggerOptions
+	// Gin mode (gin.DebugMode, gin.ReleaseMode, gin.TestMode), unchanged if empty
+	Mode string
+	// Middleware of the engine, request logging and recovery if nil
+	Middleware []gin.HandlerFunc
+	// Do not register the livecheck endpoints
+	DisableLivecheck bool
+	// Do not register the empty favicon.ico endpoint
+	DisableFavicon bool
+	// Do not document the default endpoints
+	DisableDefaultDocs bool
+	// Do not log the start and the stop of the process
+	DisableStartStopLog bool
+}
+
+// GinOnTheRocks returns a gin engine with request logging and recovery,
+// the swaggo docs, a logger writing to storage/logs/<appName>.log and the
+// livecheck endpoints
+func GinOnTheRocks(appName string) (*gin.Engine, *swaggo.Swaggo, Logger, error) {
+	return GinOnTheRocksWithOptions(appName, GinOptions{})
+}
+
+// GinOnTheRocksWithOptions is GinOnTheRocks with control over logger, gin
+// mode, middleware and default endpoints
+func GinOnTheRocksWithOptions(appName string, opts GinOptions) (*gin.Engine, *swaggo.Swaggo, Logger, error) {
+	var (
+		err error
+		r   *gin.Engine
+		s   *swaggo.Swaggo
+		log = opts.Logger
+	)
+	if log == nil {
+		lo := LoggerOptions{Path: "storage/logs/" + appName + ".log", Rotation: DailyRotation, TeeToStderr: true}
+		if opts.LoggerOptions != nil {
+			lo = *opts.LoggerOptions
+		}
+		log, err = NewLogger(lo)
+		if err != nil {
+			return r, s, log, errors.Wrap(err, "can't create logger")
+		}
+	}
+	if opts.Mode != "" {
+		gin.SetMode(opts.Mode)
+	}
+
+	// New engine
+	r = gin.New()
+	if opts.Middleware == nil {
+		opts.Middleware = []gin.HandlerFunc{GinLogger(log), gin.Recovery()}
+	}
+	r.Use(opts.Middleware...)
+
+	// Swagger addDocs with redoc UI
+	s, err = swaggo.NewSwaggo()
+	if err != nil {
+		return r, s, log, errors.Wrap(err, "can't create new swaggo")
+	}
+
+	if !opts.DisableLivecheck {
+		r.GET("/livecheck", func(c *gin.Context) { c.String(http.StatusOK, "%v", "OK") })
+		r.POST("/livecheck", func(c *gin.Context) { c.String(http.StatusOK, "%v", "OK") })
+		if !opts.DisableDefaultDocs {
+			for _, method := range []string{"GET", "POST"} {
+				s.AddEndpoint("/livecheck", method, "",
+					swaggo.Response(http.StatusOK, "", "Service is alive"),
+					swaggo.Description("Endpoint to ensure service is up and running"),
+					swaggo.Consumes(""),
+					swaggo.Produces("text/plain"),
+				)
+			}
+		}
+	}
+	if !opts.DisableFavicon {
+		r.GET("/favicon.ico", func(*gin.Context) {})
+		s.AddUndocPaths("favicon")
+	}
+
+	if !opts.DisableStartStopLog {
+		LogStartAndStop(appName, log)
+	}
+	return r, s, log, err
+}
+
+// GinLogger returns the gin middleware logging the requests with lg,
+// through gin-logrus if lg is backed by logrus
+func GinLogger(lg Logger) gin.HandlerFunc {
+	if lb, ok := lg.(interface{ logrusBase() *logrus.Logger }); ok {
+		if lr := lb.logrusBase(); lr != nil {
+			return ginlogrus.Logger(lr)
+		}
+	}
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+		status := c.Writer.Status()
+		entry := lg.WithFields(Fields{
+			"status":     status,
+			"method":     c.Request.Method,
+			"path":       c.Request.URL.Path,
+			"route":      c.FullPath(),
+			"latency_ms": float64(time.Since(start).Microseconds()) / 1000,
+			"bytes":      c.Writer.Size(),
+			"origin":     RealIP(c.Request),
+			"user_agent": c.Request.UserAgent(),
+		})
+		switch {
+		case len(c.Errors) > 0:
+			entry.Error(c.Errors.String())
+		case status >= 500:
+			entry.Error("request")
+		case status >= 400:
+			entry.Warn("request")
+		default:
+			entry.Info("request")
+		}
+	}
+}
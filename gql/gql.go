@@ -0,0 +1,224 @@
+// Package gql serves a GraphQL schema, provided by the user with its
+// resolvers, on a hang route so that it goes through the handler middleware.
+// Queries and, optionally, every resolver are logged with their timing, and
+// a GraphiQL playground can be enabled on another route.
+package gql
+
+import (
+	"context"
+	"encoding/json"
+	"html"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/brunetto/hang"
+	graphql "github.com/graph-gophers/graphql-go"
+	gqlerrors "github.com/graph-gophers/graphql-go/errors"
+	"github.com/graph-gophers/graphql-go/introspection"
+	"github.com/pkg/errors"
+)
+
+// Options configures a Server
+type Options struct {
+	// Route of the endpoint, "graphql" if empty
+	Route string
+	// Route of the GraphiQL playground, "graphiql" if empty
+	PlaygroundRoute string
+	// Serve the playground
+	Playground bool
+	// Log every non trivial resolver at debug level
+	LogResolvers bool
+	// Log at warn level the resolvers slower than this, 0 to disable
+	SlowResolver time.Duration
+	// More options for graphql.ParseSchema
+	SchemaOptions []graphql.SchemaOpt
+}
+
+// Server executes the GraphQL requests
+type Server struct {
+	Log    hang.Logger
+	Schema *graphql.Schema
+	opts   Options
+}
+
+// request is the body of a GraphQL request
+type request struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+// New parses schema, resolved by resolver, returning a Server logging on lg
+func New(lg hang.Logger, schema string, resolver interface{}, opts Options) (*Server, error) {
+	if opts.Route == "" {
+		opts.Route = "graphql"
+	}
+	if opts.PlaygroundRoute == "" {
+		opts.PlaygroundRoute = "graphiql"
+	}
+	s := &Server{Log: lg, opts: opts}
+	sopts := append([]graphql.SchemaOpt{graphql.Tracer(&tracer{s: s})}, opts.SchemaOptions...)
+	var err error
+	s.Schema, err = graphql.ParseSchema(schema, resolver, sopts...)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't parse GraphQL schema")
+	}
+	return s, nil
+}
+
+// Mount registers the endpoint and, if enabled, the playground on h
+func (s *Server) Mount(h *hang.Handler) error {
+	err := h.AddRoute(s.opts.Route, s.Handle)
+	if err != nil {
+		return errors.Wrap(err, "can't mount GraphQL")
+	}
+	if s.opts.Playground {
+		err = h.AddRoute(s.opts.PlaygroundRoute, s.Playground)
+		if err != nil {
+			return errors.Wrap(err, "can't mount GraphiQL")
+		}
+	}
+	return nil
+}
+
+// Handle executes the query POSTed as JSON or, for GET, in the query string
+func (s *Server) Handle(resp http.ResponseWriter, req *http.Request) error {
+	var r request
+	switch req.Method {
+	case http.MethodGet:
+		q := req.URL.Query()
+		r.Query, r.OperationName = q.Get("query"), q.Get("operationName")
+		if v := q.Get("variables"); v != "" {
+			if err := json.Unmarshal([]byte(v), &r.Variables); err != nil {
+				err = errors.Wrap(err, "invalid GraphQL variables")
+				hang.WriteError(resp, req, http.StatusBadRequest, err)
+				return err
+			}
+		}
+	case http.MethodPost:
+		if err := hang.GetReqJSONData(resp, req, &r); err != nil {
+			return err
+		}
+	default:
+		resp.Header().Set("Allow", "GET, POST")
+		err := errors.New("method not allowed")
+		hang.WriteError(resp, req, http.StatusMethodNotAllowed, err)
+		return err
+	}
+	if r.Query == "" {
+		err := errors.New("missing GraphQL query")
+		hang.WriteError(resp, req, http.StatusBadRequest, err)
+		return err
+	}
+	ctx := context.WithValue(req.Context(), reqKey{}, req)
+	result := s.Schema.Exec(ctx, r.Query, r.OperationName, r.Variables)
+	return hang.WriteJSON(resp, http.StatusOK, result)
+}
+
+// Playground serves the GraphiQL page querying the endpoint
+func (s *Server) Playground(resp http.ResponseWriter, req *http.Request) error {
+	resp.Header().Set("Content-Type", "text/html; charset=utf-8")
+	resp.WriteHeader(http.StatusOK)
+	_, err := resp.Write([]byte(graphiqlPage("/" + s.opts.Route)))
+	return err
+}
+
+// reqKey is the context key of the HTTP request, for the tracer
+type reqKey struct{}
+
+// queryStats is the context value collecting the resolver timing of a query
+type queryStats struct {
+	resolvers int64
+	nanos     int64
+}
+
+type statsKey struct{}
+
+// tracer logs the queries and the resolvers
+type tracer struct {
+	s *Server
+}
+
+// fields returns the log fields of the HTTP request carrying ctx
+func (t *tracer) fields(ctx context.Context) hang.Fields {
+	fields := hang.Fields{}
+	if req, ok := ctx.Value(reqKey{}).(*http.Request); ok {
+		fields["route"] = hang.RouteFrom(req)
+		if id := hang.GetRequestID(req); id != "" {
+			fields["request_id"] = id
+		}
+	}
+	return fields
+}
+
+func (t *tracer) TraceQuery(ctx context.Context, queryString, operationName string, variables map[string]interface{}, varTypes map[string]*introspection.Type) (context.Context, func([]*gqlerrors.QueryError)) {
+	start := time.Now()
+	stats := &queryStats{}
+	ctx = context.WithValue(ctx, statsKey{}, stats)
+	return ctx, func(errs []*gqlerrors.QueryError) {
+		fields := t.fields(ctx)
+		fields["operation"] = operationName
+		fields["resolvers"] = atomic.LoadInt64(&stats.resolvers)
+		fields["resolvers_ms"] = float64(atomic.LoadInt64(&stats.nanos)/1000) / 1000
+		fields["latency_ms"] = float64(time.Since(start).Microseconds()) / 1000
+		if len(errs) > 0 {
+			fields["errors"] = len(errs)
+			t.s.Log.WithFields(fields).Warn(errs[0])
+			return
+		}
+		t.s.Log.WithFields(fields).Info("graphql query")
+	}
+}
+
+func (t *tracer) TraceField(ctx context.Context, label, typeName, fieldName string, trivial bool, args map[string]interface{}) (context.Context, func(*gqlerrors.QueryError)) {
+	if trivial {
+		return ctx, func(*gqlerrors.QueryError) {}
+	}
+	start := time.Now()
+	return ctx, func(err *gqlerrors.QueryError) {
+		elapsed := time.Since(start)
+		if stats, ok := ctx.Value(statsKey{}).(*queryStats); ok {
+			atomic.AddInt64(&stats.resolvers, 1)
+			atomic.AddInt64(&stats.nanos, int64(elapsed))
+		}
+		slow := t.s.opts.SlowResolver > 0 && elapsed >= t.s.opts.SlowResolver
+		if !slow && !t.s.opts.LogResolvers && err == nil {
+			return
+		}
+		fields := t.fields(ctx)
+		fields["resolver"] = typeName + "." + fieldName
+		fields["latency_ms"] = float64(elapsed.Microseconds()) / 1000
+		switch {
+		case err != nil:
+			t.s.Log.WithFields(fields).Warn(err)
+		case slow:
+			t.s.Log.WithFields(fields).Warn("slow graphql resolver")
+		default:
+			t.s.Log.WithFields(fields).Debug("graphql resolver")
+		}
+	}
+}
+
+func graphiqlPage(endpoint string) string {
+	return `<!DOCTYPE html>
+<html>
+<head>
+<title>GraphiQL</title>
+<meta charset="utf-8"/>
+<style>body { height: 100vh; margin: 0; } #graphiql { height: 100vh; }</style>
+<link rel="stylesheet" href="https://unpkg.com/graphiql@3/graphiql.min.css"/>
+</head>
+<body>
+<div id="graphiql"></div>
+<script src="https://unpkg.com/react@18/umd/react.production.min.js"></script>
+<script src="https://unpkg.com/react-dom@18/umd/react-dom.production.min.js"></script>
+<script src="https://unpkg.com/graphiql@3/graphiql.min.js"></script>
+<script>
+ReactDOM.createRoot(document.getElementById("graphiql")).render(
+	React.createElement(GraphiQL, {fetcher: GraphiQL.createFetcher({url: "` + html.EscapeString(endpoint) + `"})})
+);
+</script>
+</body>
+</html>`
+}
@@ -0,0 +1,61 @@
+package grpcserver
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/brunetto/hang"
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"google.golang.org/grpc/metadata"
+)
+
+// TimeoutHeader carries how long the REST client is willing to wait, as a
+// Go duration ("1.5s") or in seconds, becoming the deadline of the gRPC call
+const TimeoutHeader = "X-Request-Timeout"
+
+// NewGateway returns a grpc-gateway mux forwarding the request ID to the
+// gRPC services as x-request-id metadata, with opts appended to the defaults
+func NewGateway(opts ...runtime.ServeMuxOption) *runtime.ServeMux {
+	opts = append([]runtime.ServeMuxOption{
+		runtime.WithMetadata(func(ctx context.Context, req *http.Request) metadata.MD {
+			if id := hang.GetRequestID(req); id != "" {
+				return metadata.Pairs(strings.ToLower(hang.RequestIDHeader), id)
+			}
+			return nil
+		}),
+	}, opts...)
+	return runtime.NewServeMux(opts...)
+}
+
+// MountGateway serves the gateway mux on h under prefix, the paths of the
+// gateway patterns being relative to it, so that the REST surface goes
+// through the hang middleware, logging and lifecycle. The TimeoutHeader
+// shortens the deadline of the request, the gateway forwarding it to the
+// gRPC call as it does for the Grpc-Timeout header.
+func MountGateway(h *hang.Handler, prefix string, mux http.Handler) error {
+	return h.Mount(prefix, http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		if d := parseTimeout(req.Header.Get(TimeoutHeader)); d > 0 {
+			ctx, cancel := context.WithTimeout(req.Context(), d)
+			defer cancel()
+			req = req.WithContext(ctx)
+		}
+		mux.ServeHTTP(resp, req)
+	}))
+}
+
+// parseTimeout parses the TimeoutHeader, 0 if missing or invalid
+func parseTimeout(s string) time.Duration {
+	if s == "" {
+		return 0
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		return d
+	}
+	if secs, err := strconv.ParseFloat(s, 64); err == nil {
+		return time.Duration(secs * float64(time.Second))
+	}
+	return 0
+}
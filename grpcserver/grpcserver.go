@@ -0,0 +1,226 @@
+// Package grpcserver runs a gRPC server alongside the hang HTTP handler
+// under the same lifecycle, with logging interceptors sharing the hang
+// logger, the standard health service, optional reflection and graceful
+// stop on shutdown. The two servers can share a port, dispatching the
+// connections with cmux.
+package grpcserver
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"github.com/brunetto/hang"
+	"github.com/pkg/errors"
+	"github.com/soheilhy/cmux"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+)
+
+// Options configures a Server
+type Options struct {
+	// Register the reflection service, for grpcurl and similar tools
+	Reflection bool
+	// Do not register the health service
+	DisableHealth bool
+	// Interceptors run after the logging ones
+	UnaryInterceptors  []grpc.UnaryServerInterceptor
+	StreamInterceptors []grpc.StreamServerInterceptor
+	// More options for grpc.NewServer
+	ServerOptions []grpc.ServerOption
+}
+
+// Server is a gRPC server managed by a hang.Lifecycle
+type Server struct {
+	Log hang.Logger
+	// Server to register the services on
+	GRPC *grpc.Server
+	// Health service, nil if disabled
+	Health *health.Server
+}
+
+// New returns a Server logging the calls on lg. The services have to be
+// registered on Server.GRPC before running it.
+func New(lg hang.Logger, opts Options) *Server {
+	s := &Server{Log: lg}
+	unary := append([]grpc.UnaryServerInterceptor{s.UnaryLogger()}, opts.UnaryInterceptors...)
+	stream := append([]grpc.StreamServerInterceptor{s.StreamLogger()}, opts.StreamInterceptors...)
+	sopts := append([]grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(unary...),
+		grpc.ChainStreamInterceptor(stream...),
+	}, opts.ServerOptions...)
+	s.GRPC = grpc.NewServer(sopts...)
+	if !opts.DisableHealth {
+		s.Health = health.NewServer()
+		healthpb.RegisterHealthServer(s.GRPC, s.Health)
+	}
+	if opts.Reflection {
+		reflection.Register(s.GRPC)
+	}
+	return s
+}
+
+// UnaryLogger returns the interceptor logging the unary calls
+func (s *Server) UnaryLogger() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		start := time.Now()
+		resp, err := handler(ctx, req)
+		s.logCall(ctx, info.FullMethod, start, err)
+		return resp, err
+	}
+}
+
+// StreamLogger returns the interceptor logging the streaming calls when
+// they end
+func (s *Server) StreamLogger() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		start := time.Now()
+		err := handler(srv, ss)
+		s.logCall(ss.Context(), info.FullMethod, start, err)
+		return err
+	}
+}
+
+// logCall logs a call with the fields of the hang access log
+func (s *Server) logCall(ctx context.Context, method string, start time.Time, err error) {
+	code := status.Code(err)
+	fields := hang.Fields{
+		"method":     method,
+		"code":       code.String(),
+		"latency_ms": float64(time.Since(start).Microseconds()) / 1000,
+	}
+	if p, ok := peer.FromContext(ctx); ok {
+		fields["origin"] = p.Addr.String()
+	}
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if ids := md.Get(hang.RequestIDHeader); len(ids) > 0 {
+			fields["request_id"] = ids[0]
+		}
+	}
+	switch code {
+	case codes.OK:
+		s.Log.WithFields(fields).Info("grpc call")
+	case codes.Unknown, codes.Internal, codes.Unavailable, codes.DataLoss, codes.DeadlineExceeded:
+		s.Log.WithFields(fields).Error(errors.Wrap(err, "grpc call failed"))
+	default:
+		s.Log.WithFields(fields).Warn(err)
+	}
+}
+
+// Runner returns a Runner serving on addr and stopping gracefully, waiting
+// for up to shutdownTimeout, when the context is cancelled
+func (s *Server) Runner(addr string, shutdownTimeout time.Duration) hang.Runner {
+	return hang.RunnerFunc(func(ctx context.Context) error {
+		ln, err := net.Listen("tcp", addr)
+		if err != nil {
+			return errors.Wrap(err, "can't listen on "+addr)
+		}
+		return s.ListenerRunner(ln, shutdownTimeout).Run(ctx)
+	})
+}
+
+// ListenerRunner is Runner serving on ln
+func (s *Server) ListenerRunner(ln net.Listener, shutdownTimeout time.Duration) hang.Runner {
+	return hang.RunnerFunc(func(ctx context.Context) error {
+		errc := make(chan error, 1)
+		s.Log.Infof("grpc: listening on %v", ln.Addr())
+		go func() { errc <- s.GRPC.Serve(ln) }()
+		select {
+		case err := <-errc:
+			return errors.Wrap(err, "can't serve grpc on "+ln.Addr().String())
+		case <-ctx.Done():
+		}
+		s.stop(shutdownTimeout)
+		err := <-errc
+		if err == grpc.ErrServerStopped || err == cmux.ErrListenerClosed || err == cmux.ErrServerClosed {
+			return nil
+		}
+		return errors.Wrap(err, "can't serve grpc on "+ln.Addr().String())
+	})
+}
+
+// stop reports NOT_SERVING and stops the server, waiting for the pending
+// calls up to timeout
+func (s *Server) stop(timeout time.Duration) {
+	if s.Health != nil {
+		s.Health.Shutdown()
+	}
+	done := make(chan struct{})
+	go func() {
+		s.GRPC.GracefulStop()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		s.Log.Warn("grpc: timeout waiting for the pending calls, stopping")
+		s.GRPC.Stop()
+	}
+}
+
+// Add registers the server on the lifecycle, serving on addr
+func (s *Server) Add(l *hang.Lifecycle, addr string) {
+	l.Add("grpc "+addr, s.Runner(addr, l.ShutdownTimeout))
+}
+
+// AddShared registers on the lifecycle the server and the handler sharing
+// addr: HTTP/2 connections with the application/grpc content type go to
+// the gRPC server, the others to the handler. The admin listener of the
+// handler, if enabled, keeps its own address.
+func (s *Server) AddShared(l *hang.Lifecycle, h *hang.Handler, addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return errors.Wrap(err, "can't listen on "+addr)
+	}
+	m := cmux.New(ln)
+	grpcL := m.MatchWithWriters(cmux.HTTP2MatchHeaderFieldSendSettings("content-type", "application/grpc"))
+	httpL := m.Match(cmux.Any())
+
+	var (
+		httpRunner = h.ListenerRunner(httpL, l.ShutdownTimeout)
+		grpcRunner = s.ListenerRunner(grpcL, l.ShutdownTimeout)
+	)
+	l.AddHandlerRunner(h, "http+grpc "+addr, hang.RunnerFunc(func(ctx context.Context) error {
+		var (
+			errc     = make(chan error, 2)
+			muxErr   = make(chan error, 1)
+			firstErr error
+		)
+		// A server failing stops the other
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		go func() { errc <- httpRunner.Run(ctx) }()
+		go func() { errc <- grpcRunner.Run(ctx) }()
+		go func() {
+			err := m.Serve()
+			select {
+			case <-ctx.Done():
+				// Closed below
+				err = nil
+			default:
+			}
+			muxErr <- err
+			cancel()
+		}()
+		for i := 0; i < 2; i++ {
+			if err := <-errc; err != nil && firstErr == nil {
+				firstErr = err
+			}
+			cancel()
+		}
+		// Close the root listener last, not to fail the servers while
+		// they drain
+		m.Close()
+		if err := <-muxErr; err != nil && firstErr == nil {
+			firstErr = err
+		}
+		return errors.Wrap(firstErr, "shared listener on "+addr)
+	}))
+	return nil
+}
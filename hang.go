@@ -3,6 +3,7 @@ package hang
 import (
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
@@ -10,18 +11,17 @@ import (
 	"runtime"
 	"strings"
 	"syscall"
+	"sync"
+	"time"
 	"path/filepath"
-	"gitlab.com/brunetto/ritter"
 	"io/ioutil"
 	"encoding/json"
 	"bytes"
 	"io"
-	"gitlab.com/brunetto/swaggo"
-	"github.com/gin-gonic/gin"
-	"github.com/brunetto/gin-logrus"
 )
 
-// Logger defines which methods are requested for a logger to be used in this package
+// Logger defines which methods are requested for a logger to be used in this package.
+// Use NewLogrusLogger to adapt a logrus logger, or the adapters subpackages.
 type Logger interface {
 	Debug(args ...interface{})
 	Debugf(format string, args ...interface{})
@@ -47,7 +47,7 @@ type Logger interface {
 	Warningf(format string, args ...interface{})
 	Warningln(args ...interface{})
 	Warnln(args ...interface{})
-	WithFields(fields logrus.Fields) *logrus.Entry
+	WithFields(fields Fields) Entry
 }
 
 // HandleFunc is the type of function to be used to handle a route in this package
@@ -59,31 +59,85 @@ type Handler struct {
 	Log         Logger
 	// Map to match a route with the correct handler
 	Routes      map[string]HandleFunc
+	// Documentation of the routes, used to generate the swagger spec
+	Docs        map[string][]RouteDoc
+	// Middleware applied to all the routes and to single routes
+	Middleware      []Middleware
+	RouteMiddleware map[string][]Middleware
 	// Channel to listen for quit signal
 	c           chan os.Signal
 	// Name of the called process
 	ExecName    string
 	// Nice name of the service, given by the user
 	ProcessName string
+	// Format of the error responses
+	ErrorFormat ErrorFormat
+	// Handler for the operational endpoints, served on AdminAddr
+	Admin     *Handler
+	AdminAddr string
+	// Servers started by Serve and their listeners by address
+	serversMu sync.Mutex
+	servers   []*http.Server
+	listeners map[string]net.Listener
+	// Tracks the running Shutdown calls
+	draining sync.WaitGroup
+	// Closed by Serve once listening and by Shutdown
+	listening chan struct{}
+	stopping  chan struct{}
+	// Request counters by route
+	stats statsTable
+	// Open websocket connections
+	websockets wsRegistry
+	// Proxies trusted to report the client address
+	trustedProxies []*net.IPNet
+	// Maintenance mode, see SetMaintenanceMode
+	maintenance maintenanceState
+	// Compiled regex routes, in registration order
+	regexRoutes []regexRoute
+	// Names of the route handlers, resolved at registration
+	handlerNames map[string]namedHandler
+	// Handlers by method of the routes added with AddMethodRoute
+	methodRoutes map[string]map[string]HandleFunc
+	// Custom error rendering, see SetErrorRenderer
+	errorRenderer ErrorRenderer
+	// Error tracking, see SetErrorReporter
+	errorReporter ErrorReporter
+	// Route of the documentation UI, see EnableDocsWithOptions
+	docsRoute string
+	// Path normalization, see SetTrailingSlashPolicy and SetCaseInsensitiveRoutes
+	trailingSlash   TrailingSlashPolicy
+	caseInsensitive bool
+	// Slow request log settings
+	slowThreshold time.Duration
+	slowWithStack bool
+	// Readiness state and checks
+	notReady int32
+	checksMu sync.Mutex
+	checks   []*namedCheck
+	// systemd notifications
+	systemdNotify bool
+	watchdogStop  chan struct{}
+	// Callbacks registered with OnSignal
+	signalMu    sync.Mutex
+	signalHooks map[os.Signal][]func(os.Signal)
+	// Whether SIGINT/SIGTERM exit the process
+	keepRunningOnSignal bool
+	// HTTP/2 settings, see EnableHTTP2
+	http2 *HTTP2Options
 }
 
 // NewHandler provides a new, initialized, generic handler
 func NewHandler(lg Logger, processName string) *Handler {
 	if lg == nil {
-		lg = &logrus.Logger{
+		lg = NewLogrusLogger(&logrus.Logger{
 			Out:       os.Stderr,
 			Formatter: new(logrus.TextFormatter),
 			Hooks:     make(logrus.LevelHooks),
 			Level:     logrus.DebugLevel,
-		}
+		})
 	}
 	h := &Handler{}
 
-	// Log app sigterm (stop by the user - killing can't be catched)
-	h.c = make(chan os.Signal, 1)
-	signal.Notify(h.c, os.Interrupt, syscall.SIGTERM, syscall.SIGINT)
-	go h.WaitForShutdown()
-
 	h.ExecName = os.Args[0]
 
 	// Can be set by the user
@@ -94,12 +148,22 @@ func NewHandler(lg Logger, processName string) *Handler {
 	}
 
 	h.Log = lg
+	h.ErrorFormat = DefaultErrorFormat
+
+	// Log app sigterm (stop by the user - killing can't be catched)
+	h.signalHooks = map[os.Signal][]func(os.Signal){}
+	h.c = make(chan os.Signal, 1)
+	signal.Notify(h.c, os.Interrupt, syscall.SIGTERM, syscall.SIGINT)
+	go h.WaitForShutdown()
 
-	h.Log.Infof("%v: started", h.ProcessName)
+	bi := GetBuildInfo()
+	h.Log.WithFields(Fields{"version": bi.Version, "commit": bi.Commit, "build_date": bi.BuildDate, "go_version": bi.GoVersion}).Infof("%v: started", h.ProcessName)
 
 	h.Routes = map[string]HandleFunc{}
 	h.AddRoute("default", h.RouteNotSet)
 	h.AddRoute("livecheck", h.LiveCheck)
+	h.AddRoute("readycheck", h.ReadyCheck)
+	h.AddRoute("version", h.Version)
 
 	return h
 }
@@ -109,12 +173,34 @@ func (h *Handler) SetProcessName(name string) {
 	h.ProcessName = name
 }
 
+// SetErrorFormat sets the format of the error responses written by the
+// handler and by the helper functions called from its routes
+func (h *Handler) SetErrorFormat(f ErrorFormat) {
+	h.ErrorFormat = f
+}
+
+// SetErrorRenderer sets the function writing the error responses of the
+// handler and of the helper functions called from its routes, replacing
+// the error format. It also renders, with a 500, the errors returned by the
+// route handlers without writing a response. nil restores the error format.
+func (h *Handler) SetErrorRenderer(r ErrorRenderer) {
+	h.errorRenderer = r
+}
+
+// SetNotFoundHandler sets the handler of the requests matching no route,
+// RouteNotSet by default
+func (h *Handler) SetNotFoundHandler(handleFunc HandleFunc) {
+	h.Routes["default"] = handleFunc
+	h.setHandlerName("default", handleFunc)
+}
+
 // RouteNotSet is the default handler for routes with no handler registered
 func (h *Handler) RouteNotSet(resp http.ResponseWriter, req *http.Request) error {
 	path := GetRoute(req)
-	resp.WriteHeader(http.StatusBadRequest)
-	resp.Write([]byte("Route not found: " + path))
-	h.Log.WithFields(logrus.Fields{"origin": req.RemoteAddr}).Info("Route not found: " + path)
+	writeError(resp, req, h.ErrorFormat, http.StatusNotFound, errors.New("Route not found: "+path), nil)
+	if h.logEnabled(InfoLevel) {
+		h.Log.WithFields(Fields{"origin": RealIP(req)}).Info("Route not found: " + path)
+	}
 	return nil
 }
 
@@ -122,23 +208,38 @@ func (h *Handler) RouteNotSet(resp http.ResponseWriter, req *http.Request) error
 func (h *Handler) LiveCheck(resp http.ResponseWriter, req *http.Request) error {
 	resp.WriteHeader(http.StatusOK)
 	resp.Write([]byte("OK"))
-	h.Log.WithFields(logrus.Fields{"origin": req.RemoteAddr}).Debug("LiveCheck invoked")
+	h.Log.WithFields(Fields{"origin": RealIP(req)}).Debug("LiveCheck invoked")
 	return nil
 }
 
-// AddRoute registers a handler for a route
+// AddRoute registers a handler for a route. Segments starting with : match
+// any single segment, available to the handler through Param, e.g.
+// "users/:id". Routes ending with /* (or just *) match any deeper path, the
+// matched part being available to the handler through RouteSuffix. Exact
+// routes take precedence, then routes with params, regex routes and the
+// longest prefix (see DumpRouteTree). Routes ambiguous with a registered
+// one are rejected.
 func (h *Handler) AddRoute(route string, handleFunc HandleFunc) error {
 	// If route already exists fire an error
 	if _, exists := h.Routes[route]; exists {
 		return errors.New("Route " + route + " already exists.")
 	}
+	if err := h.checkRoute(route); err != nil {
+		return err
+	}
 	h.Routes[route] = handleFunc
+	h.setHandlerName(route, handleFunc)
 	return nil
 }
 
 // DeleteRoute unregister a route
 func (h *Handler) DeleteRoute(route string) {
 	delete(h.Routes, route)
+	delete(h.handlerNames, route)
+	delete(h.Docs, route)
+	delete(h.RouteMiddleware, route)
+	delete(h.methodRoutes, route)
+	h.deleteRegexRoute(route)
 }
 
 // ModifyRoute registers a new handler for a route
@@ -147,6 +248,8 @@ func (h *Handler) ModifyRoute(route string, handleFunc HandleFunc) error {
 		return errors.New("Route " + route + "does not exists.")
 	}
 	h.Routes[route] = handleFunc
+	h.setHandlerName(route, handleFunc)
+	delete(h.methodRoutes, route)
 	return nil
 }
 
@@ -159,35 +262,65 @@ func (h *Handler) Handle(resp http.ResponseWriter, req *http.Request) {
 		handled bool
 		err     error
 	)
+	// Let the helpers know how to render errors and the client address
+	// behind the trusted proxies
+	info := &requestInfo{
+		errorFormat:   h.ErrorFormat,
+		errorRenderer: h.errorRenderer,
+		realIP:        h.clientIP(req),
+	}
+	req = withRequestInfo(req, info)
+	// Record status and size for the stats
+	rr := NewResponseRecorder(resp)
+	resp = rr
+	if h.redirectTrailingSlash(resp, req) {
+		h.stats.record("redirect", rr.Status, nil)
+		return
+	}
 	// Find the route requested
 	path = GetRoute(req)
+	if h.serveMaintenance(resp, req, path) {
+		h.stats.record("maintenance", rr.Status, nil)
+		return
+	}
 	handled = false
-	for route, handler = range h.Routes {
-		if path == route {
-			h.Log.WithFields(logrus.Fields{"route": route, "function": GetFunctionName(handler),"origin": req.RemoteAddr}).Debug()
-			err = handler(resp, req)
-			if err != nil {
-				h.Log.WithFields(logrus.Fields{"route": route, "function": GetFunctionName(handler), "origin": req.RemoteAddr}).Error(err)
-			}
-			handled = true
-			break
+	if route, req = h.match(req, path); route != "" {
+		handler = h.Routes[route]
+		sw := h.watchSlow(route, handler)
+		info.route = route
+		err = h.call(h.wrap(route, handler), rr, req)
+		sw.done(req)
+		if err != nil {
+			h.renderUnwritten(rr, req, err)
+			h.logHandlerError(rr, req, route, err)
 		}
+		h.stats.record(route, rr.Status, err)
+		handled = true
 	}
 	if !handled {
-		h.Routes["default"](resp, req)
+		info.route = "default"
+		err = h.wrap("default", h.Routes["default"])(resp, req)
+		h.stats.record("default", rr.Status, err)
 	}
 }
 
-// WaitForShutdown waits the quit signal
+// WaitForShutdown waits the quit signal, running the callbacks registered
+// with OnSignal for every signal received
 func (h *Handler) WaitForShutdown() {
-	// Waiting for exit signal on the channel
-	<-h.c
+	// Waiting for signals on the channel
+	for sig := range h.c {
+		h.runSignalHooks(sig)
+		if (sig == os.Interrupt || sig == syscall.SIGTERM) && !h.exitDisabled() {
+			break
+		}
+	}
 
 	h.Log.Infof("%v: stopped by the user", h.ProcessName)
 	os.Exit(0)
 }
 
-// WaitForShutdown waits the quit signal
+// LogStartAndStop logs the start of the process and its stop on SIGINT or
+// SIGTERM, exiting. Lifecycle allows to stop gracefully instead.
 func LogStartAndStop(processName string, logger Logger) {
 	// Create signal channel
 	c := make(chan os.Signal, 1)
@@ -210,15 +343,45 @@ func GetFunctionName(handler HandleFunc) string {
 	return filepath.Base(runtime.FuncForPC(reflect.ValueOf(handler).Pointer()).Name())
 }
 
+// namedHandler is the name of a handler with the entry point it was
+// resolved from
+type namedHandler struct {
+	pc   uintptr
+	name string
+}
+
+// setHandlerName stores the name of the handler of route, not to resolve
+// it with reflection on every request
+func (h *Handler) setHandlerName(route string, handler HandleFunc) {
+	if h.handlerNames == nil {
+		h.handlerNames = map[string]namedHandler{}
+	}
+	h.handlerNames[route] = namedHandler{reflect.ValueOf(handler).Pointer(), GetFunctionName(handler)}
+}
+
+// handlerName returns the name of the handler of route, resolving it again
+// when the handler was replaced by writing Routes directly
+func (h *Handler) handlerName(route string) string {
+	handler := h.Routes[route]
+	if n, ok := h.handlerNames[route]; ok && n.pc == reflect.ValueOf(handler).Pointer() {
+		return n.name
+	}
+	return GetFunctionName(handler)
+}
+
+// funcName returns the name of any function for debugging purposes
+func funcName(fn interface{}) string {
+	return filepath.Base(runtime.FuncForPC(reflect.ValueOf(fn).Pointer()).Name())
+}
+
 func GetRoute (req *http.Request) string {
 	//return strings.Replace(req.URL.Path, "/", "", -1)
 	return strings.TrimLeft(strings.TrimRight(req.URL.Path, "/"), "/")
 }
 
-//type LogFields logrus.Fields//map[string]interface{} // same as logrus.Fields
 
-func At() logrus.Fields {
-	return logrus.Fields{"app_method": Here()}
+func At() Fields {
+	return Fields{"app_method": Here()}
 }
 
 func Here() string {
@@ -246,33 +409,26 @@ func HereForGoroutines() string {
 }
 
 
-func NewDefaultLogger() Logger {
-	var (
-		rotatedWriter *ritter.TimeWriter
-		err           error
-	)
-	// New writer with rotation
-	rotatedWriter, err = ritter.NewRitterTime("default.log")
+// NewDefaultLogger creates a JSON logger writing to the daily rotated
+// default.log and to stderr, backed by logrus or, optionally, by log/slog.
+//
+// Deprecated: use NewLogger, which allows to configure every setting.
+func NewDefaultLogger(backend ...LoggerBackend) Logger {
+	opts := LoggerOptions{
+		Path:        "default.log",
+		Rotation:    DailyRotation,
+		Level:       "debug",
+		Format:      "json",
+		Fields:      Fields{"url": "syncer.udctracker.pixartprinting.local"},
+		TeeToStderr: true,
+	}
+	if len(backend) > 0 {
+		opts.Backend = backend[0]
+	}
+	lg, err := NewLogger(opts)
 	if err != nil {
 		logrus.Fatal("can't create log file: " + err.Error())
 	}
-
-	// Tee to stderr
-	rotatedWriter.TeeToStdErr = true
-
-	//logFormatter := new(logrus.TextFormatter)
-	//logFormatter.FullTimestamp = true
-
-	// Create logger
-	lg := (&logrus.Logger{
-		Out: rotatedWriter,
-		//Formatter: logFormatter,
-		Formatter: new(logrus.JSONFormatter),
-		Hooks:     make(logrus.LevelHooks),
-		Level:     logrus.DebugLevel,
-	}).WithFields(logrus.Fields{
-		"url": "syncer.udctracker.pixartprinting.local",
-	})
 	return lg
 }
 
@@ -295,131 +451,82 @@ func ChooseLogLevel(level string) logrus.Level {
 	}
 }
 
-func GetReqData(resp http.ResponseWriter, req *http.Request) ([]byte, error) {
-	var (
-		err error
-		body []byte
-	)
-
+// ReadBody reads the request body, transparently decompressing it if the
+// Content-Encoding is gzip or deflate (up to MaxDecompressedBodySize),
+// without responding: GetReqData is ReadBody writing the error response
+func ReadBody(req *http.Request) ([]byte, error) {
 	// Check the request contains data
 	if req.Body == nil {
-		// Generate error
-		err = errors.New("Missing input data")
-		// Send response
-		resp.WriteHeader(http.StatusBadRequest)
-		resp.Write([]byte(err.Error()))
-		// Exit
-		return body, err
+		return nil, errMissingBody
 	}
-
-	// Extract
-	body, err = ioutil.ReadAll(req.Body)
+	// Extract, decompressing gzip and deflate bodies
+	body, err := readBody(req)
 	if err != nil {
-		if err.Error() == "EOF" {
-			// Wrap error
-			err = errors.Wrap(err, "EOF error reading JSON, maybe you are trying to read again an already processed response body")
-			// Respond
-			resp.WriteHeader(http.StatusInternalServerError)
-			resp.Write([]byte(err.Error()))
-			// Exit
-			return body, err
-		} else {
-			// Wrap error
-			err = errors.Wrap(err, "error reading request body")
-			// Respond
-			resp.WriteHeader(http.StatusBadRequest)
-			resp.Write([]byte(err.Error()))
-			// Exit
-			return body, err
+		if err == io.EOF {
+			return body, errors.Wrap(errBodyConsumed, "EOF error reading JSON, maybe you are trying to read again an already processed response body")
 		}
+		return body, errors.Wrap(err, "error reading request body")
 	}
 	req.Body.Close()
-	// Return
+	return body, nil
+}
+
+// Decode decodes the JSON data into v. It has no side effects, to be used
+// outside the handlers and fuzzed: GetReqJSONData is ReadBody and Decode
+// writing the error responses.
+func Decode(data []byte, v interface{}) error {
+	if err := json.Unmarshal(data, v); err != nil {
+		return errors.Wrap(err, "can't decode input JSON")
+	}
+	return nil
+}
+
+// GetReqData reads the request body, transparently decompressing it if the
+// Content-Encoding is gzip or deflate (up to MaxDecompressedBodySize)
+func GetReqData(resp http.ResponseWriter, req *http.Request) ([]byte, error) {
+	body, err := ReadBody(req)
+	if err != nil {
+		// Respond
+		WriteError(resp, req, bodyErrorStatus(err), err)
+	}
 	return body, err
 }
 
+// GetReqJSONData reads the request body and decodes it as JSON into data,
+// responding on failure
 func GetReqJSONData(resp http.ResponseWriter, req *http.Request, data interface{}) error {
-	var (
-		body []byte
-		err error
-	)
-	body, err = GetReqData(resp, req)
+	body, err := GetReqData(resp, req)
 	if err != nil {
 		return err
 	}
-	err = json.Unmarshal(body, data)
+	err = Decode(body, data)
 	if err != nil {
-		err = errors.Wrap(err, "can't decode input JSON")
 		// Respond
 		if resp != nil {
-			resp.WriteHeader(http.StatusBadRequest)
-			resp.Write([]byte(err.Error()))
+			WriteError(resp, req, http.StatusBadRequest, err)
 		}
 		return err
 	}
 	return nil
 }
 
+// WriteJSON serializes data as JSON and writes it with the given status
+func WriteJSON(resp http.ResponseWriter, status int, data interface{}) error {
+	b, err := json.Marshal(data)
+	if err != nil {
+		err = errors.Wrap(err, "can't encode output JSON")
+		resp.WriteHeader(http.StatusInternalServerError)
+		return err
+	}
+	resp.Header().Set("Content-Type", "application/json")
+	resp.WriteHeader(status)
+	_, err = resp.Write(b)
+	return err
+}
+
 func Tee(httpReqBody *io.ReadCloser) []byte {
 	var b []byte
 	b, _ = ioutil.ReadAll(*httpReqBody)
 	*httpReqBody = ioutil.NopCloser(bytes.NewBuffer(b))
 	return b
 }
-
-func GinOnTheRocks(appName string) (*gin.Engine, *swaggo.Swaggo, Logger, error) {
-	var (
-		err           error
-		rotatedWriter *ritter.TimeWriter
-		r             *gin.Engine
-		s *swaggo.Swaggo
-		log Logger
-	)
-	// NewMonitor writer with rotation
-	rotatedWriter, err = ritter.NewRitterTime("storage/logs/" + appName + ".log")
-	if err != nil {
-		return r, s, log, errors.Wrap(err, "can't create log file")
-	}
-
-	// Tee to stderr
-	rotatedWriter.TeeToStdErr = true
-
-	// Create logger
-	log = &logrus.Logger{
-		Out:   rotatedWriter,
-		Hooks: make(logrus.LevelHooks),
-		Level: logrus.DebugLevel,
-		Formatter: new(logrus.JSONFormatter),
-	}
-
-	// New engine
-	r = gin.New()
-	r.Use(ginlogrus.Logger(log.(*logrus.Logger)), gin.Recovery())
-
-	// Swagger addDocs with redoc UI
-	s, err = swaggo.NewSwaggo()
-	if err != nil {
-		return r, s, log, errors.Wrap(err, "can't create new swaggo")
-	}
-
-	r.GET("/livecheck", func(c *gin.Context) { c.String(http.StatusOK, "%v", "OK") })
-	r.POST("/livecheck", func(c *gin.Context) { c.String(http.StatusOK, "%v", "OK") })
-	r.GET("/favicon.ico", func(*gin.Context) { return })
-
-	s.AddUndocPaths("favicon")
-	s.AddEndpoint("/livecheck", "GET", "",
-		swaggo.Response(http.StatusOK, "", "Service is alive"),
-		swaggo.Description("Endpoint to ensure service is up and running"),
-		swaggo.Consumes(""),
-		swaggo.Produces("text/plain"),
-	)
-	s.AddEndpoint("/livecheck", "POST", "",
-		swaggo.Response(http.StatusOK, "", "Service is alive"),
-		swaggo.Description("Endpoint to ensure service is up and running"),
-		swaggo.Consumes(""),
-		swaggo.Produces("text/plain"),
-	)
-
-	LogStartAndStop(appName, log)
-	return r, s, log, err
-}
@@ -1 +1,156 @@
 package hang
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// testHandler returns a handler recording its log entries
+func testHandler(t *testing.T) *Handler {
+	return NewHandler(NewTestLogger(), t.Name())
+}
+
+// serve serves a request with method and target, as sent on the wire, and
+// the given headers, returning the response
+func serve(h http.Handler, method, target string, header http.Header) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, nil)
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	resp := httptest.NewRecorder()
+	h.ServeHTTP(resp, req)
+	return resp
+}
+
+func TestHandlerName(t *testing.T) {
+	h := testHandler(t)
+	h.AddRoute("live", h.LiveCheck)
+	if name := h.handlerName("live"); !strings.Contains(name, "LiveCheck") {
+		t.Errorf("got handler name %q, want LiveCheck", name)
+	}
+	h.Routes["live"] = h.RouteNotSet
+	if name := h.handlerName("live"); !strings.Contains(name, "RouteNotSet") {
+		t.Errorf("got handler name %q after replacing Routes, want RouteNotSet", name)
+	}
+}
+
+// benchHandler returns a handler logging nowhere with the routes of the
+// benchmarks
+func benchHandler(b *testing.B, mw ...Middleware) *Handler {
+	lg := logrus.New()
+	lg.Out = ioutil.Discard
+	h := NewHandler(NewLogrusLogger(lg), "bench")
+	h.Use(mw...)
+	ok := func(resp http.ResponseWriter, req *http.Request) error {
+		resp.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	h.AddRoute("static/path", ok)
+	h.AddRoute("users/:id", ok)
+	h.AddRoute("fail", func(resp http.ResponseWriter, req *http.Request) error {
+		return errors.New("failed")
+	})
+	return h
+}
+
+// benchServe serves b.N requests for target
+func benchServe(b *testing.B, h *Handler, target string) {
+	var (
+		req  = httptest.NewRequest(http.MethodGet, target, nil)
+		resp = httptest.NewRecorder()
+	)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		h.ServeHTTP(resp, req)
+	}
+}
+
+func BenchmarkHandleStatic(b *testing.B) {
+	benchServe(b, benchHandler(b), "/static/path")
+}
+
+func BenchmarkHandleParams(b *testing.B) {
+	benchServe(b, benchHandler(b), "/users/42")
+}
+
+func BenchmarkHandleMiddleware(b *testing.B) {
+	pass := func(next HandleFunc) HandleFunc {
+		return func(resp http.ResponseWriter, req *http.Request) error {
+			return next(resp, req)
+		}
+	}
+	benchServe(b, benchHandler(b, pass, pass, pass), "/static/path")
+}
+
+func BenchmarkHandleNotFound(b *testing.B) {
+	benchServe(b, benchHandler(b), "/missing")
+}
+
+func BenchmarkHandleError(b *testing.B) {
+	h := benchHandler(b)
+	h.SetLogLevel("fatal")
+	benchServe(b, h, "/fail")
+}
+
+func BenchmarkHandleErrorLogged(b *testing.B) {
+	benchServe(b, benchHandler(b), "/fail")
+}
+
+func FuzzDecode(f *testing.F) {
+	for _, seed := range []string{`{"name": "a", "tags": ["x"], "n": 1}`, `[1, 2]`, `null`, `{"n": "1"}`, `{`, ""} {
+		f.Add([]byte(seed))
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var v struct {
+			Name string            `json:"name"`
+			Tags []string          `json:"tags"`
+			N    int               `json:"n"`
+			Meta map[string]string `json:"meta"`
+		}
+		Decode(data, &v)
+		var any interface{}
+		if err := Decode(data, &any); (err == nil) != json.Valid(data) {
+			t.Errorf("got error %v decoding %q, want one only for invalid JSON", err, data)
+		}
+	})
+}
+
+func FuzzReadBody(f *testing.F) {
+	f.Add([]byte(`{"name": "a"}`), false)
+	f.Add([]byte{}, true)
+	f.Fuzz(func(t *testing.T, data []byte, compressed bool) {
+		body := data
+		req := httptest.NewRequest(http.MethodPost, "/", nil)
+		if compressed {
+			var buf bytes.Buffer
+			zw := gzip.NewWriter(&buf)
+			zw.Write(data)
+			zw.Close()
+			body = buf.Bytes()
+			req.Header.Set("Content-Encoding", "gzip")
+		}
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+		got, err := ReadBody(req)
+		if err != nil {
+			t.Fatalf("can't read %q: %v", data, err)
+		}
+		if !bytes.Equal(got, data) {
+			t.Errorf("got body %q, want %q", got, data)
+		}
+
+		// Arbitrary bytes claimed to be gzip must fail cleanly
+		req = httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(data))
+		req.Header.Set("Content-Encoding", "gzip")
+		ReadBody(req)
+	})
+}
@@ -0,0 +1,190 @@
+// Package hangtest serves the requests of tests through a hang.Handler
+// without opening sockets, with assertions on the responses, on the routes
+// and middleware and on the log entries.
+package hangtest
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/brunetto/hang"
+)
+
+// Server serves the requests of a test through Handler
+type Server struct {
+	T       testing.TB
+	Handler *hang.Handler
+	// Records the entries logged by Handler
+	Log *hang.TestLogger
+}
+
+// New returns a Server for h, a new hang.Handler if nil, whose logger is
+// replaced by one recording the entries, see Server.Log, and writing them
+// to the test log
+func New(t testing.TB, h *hang.Handler) *Server {
+	s := &Server{T: t, Log: hang.NewTestLogger()}
+	lg := hang.HookLogger(s.Log, hang.DebugLevel, func(level hang.Level, msg string, fields hang.Fields) {
+		t.Logf("%v: %v %v", level, msg, fields)
+	})
+	if h == nil {
+		h = hang.NewHandler(lg, t.Name())
+	}
+	h.Log = lg
+	s.Handler = h
+	return s
+}
+
+// Do serves req, returning the response
+func (s *Server) Do(req *http.Request) *Response {
+	s.T.Helper()
+	rec := httptest.NewRecorder()
+	s.Handler.ServeHTTP(rec, req)
+	return &Response{T: s.T, ResponseRecorder: rec}
+}
+
+// Request serves a request with the given method, path and body, nil for
+// none
+func (s *Server) Request(method, path string, body io.Reader) *Response {
+	s.T.Helper()
+	return s.Do(httptest.NewRequest(method, path, body))
+}
+
+// Get serves a GET request for path
+func (s *Server) Get(path string) *Response {
+	s.T.Helper()
+	return s.Request(http.MethodGet, path, nil)
+}
+
+// JSON serves a request with body encoded as JSON, nil for none
+func (s *Server) JSON(method, path string, body interface{}) *Response {
+	s.T.Helper()
+	var r io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			s.T.Fatalf("can't encode request body: %v", err)
+		}
+		r = bytes.NewReader(b)
+	}
+	req := httptest.NewRequest(method, path, r)
+	req.Header.Set("Content-Type", hang.MIMEJSON)
+	req.Header.Set("Accept", hang.MIMEJSON)
+	return s.Do(req)
+}
+
+// AssertRoute checks that a request with method and path is routed to route
+func (s *Server) AssertRoute(method, path, route string) {
+	s.T.Helper()
+	if got := s.Handler.MatchRoute(httptest.NewRequest(method, path, nil)); got != route {
+		s.T.Errorf("%v %v: routed to %q, want %q", method, path, got, route)
+	}
+}
+
+// AssertMiddleware checks that the middleware applied to route include
+// names, in order, each matching the end of a middleware name (see
+// hang.RouteInfo), e.g. "(*Handler).Audit"
+func (s *Server) AssertMiddleware(route string, names ...string) {
+	s.T.Helper()
+	for _, info := range s.Handler.ListRoutes() {
+		if info.Route != route {
+			continue
+		}
+		i := 0
+		for _, mw := range info.Middleware {
+			if i < len(names) && strings.HasSuffix(mw, names[i]) {
+				i++
+			}
+		}
+		if i < len(names) {
+			s.T.Errorf("route %v: middleware %v, want %v", route, info.Middleware, names)
+		}
+		return
+	}
+	s.T.Errorf("route %v not registered", route)
+}
+
+// AssertLogged checks that an entry at level containing msg was logged
+func (s *Server) AssertLogged(level hang.Level, msg string) {
+	s.T.Helper()
+	if !s.Log.Contains(level, msg) {
+		s.T.Errorf("no %v entry containing %q logged", level, msg)
+	}
+}
+
+// Response is a recorded response with assertions, returning the response
+// to chain them
+type Response struct {
+	T testing.TB
+	*httptest.ResponseRecorder
+}
+
+// AssertStatus checks the status code
+func (r *Response) AssertStatus(status int) *Response {
+	r.T.Helper()
+	if r.Code != status {
+		r.T.Errorf("status %v, want %v (body %q)", r.Code, status, r.Body.String())
+	}
+	return r
+}
+
+// AssertHeader checks the value of a response header
+func (r *Response) AssertHeader(key, value string) *Response {
+	r.T.Helper()
+	if got := r.Header().Get(key); got != value {
+		r.T.Errorf("header %v: %q, want %q", key, got, value)
+	}
+	return r
+}
+
+// AssertBody checks the body
+func (r *Response) AssertBody(body string) *Response {
+	r.T.Helper()
+	if got := r.Body.String(); got != body {
+		r.T.Errorf("body %q, want %q", got, body)
+	}
+	return r
+}
+
+// AssertBodyContains checks that the body contains s
+func (r *Response) AssertBodyContains(s string) *Response {
+	r.T.Helper()
+	if !strings.Contains(r.Body.String(), s) {
+		r.T.Errorf("body %q does not contain %q", r.Body.String(), s)
+	}
+	return r
+}
+
+// AssertJSON checks that the body is the JSON encoding of want, regardless
+// of formatting and key order
+func (r *Response) AssertJSON(want interface{}) *Response {
+	r.T.Helper()
+	var got, exp interface{}
+	if err := json.Unmarshal(r.Body.Bytes(), &got); err != nil {
+		r.T.Errorf("body %q is not JSON: %v", r.Body.String(), err)
+		return r
+	}
+	b, err := json.Marshal(want)
+	if err != nil {
+		r.T.Fatalf("can't encode expected body: %v", err)
+	}
+	json.Unmarshal(b, &exp)
+	if !reflect.DeepEqual(got, exp) {
+		r.T.Errorf("body %s, want %s", r.Body.Bytes(), b)
+	}
+	return r
+}
+
+// DecodeJSON decodes the body into v, failing the test if it can't
+func (r *Response) DecodeJSON(v interface{}) *Response {
+	r.T.Helper()
+	if err := json.Unmarshal(r.Body.Bytes(), v); err != nil {
+		r.T.Fatalf("can't decode body %q: %v", r.Body.String(), err)
+	}
+	return r
+}
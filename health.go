@@ -0,0 +1,209 @@
+package hang
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// CheckFunc verifies a dependency of the service, returning an error if it
+// is not usable
+type CheckFunc func(ctx context.Context) error
+
+// ReadinessCheckTimeout is the maximum duration of each readiness check
+var ReadinessCheckTimeout = 5 * time.Second
+
+type namedCheck struct {
+	name  string
+	check CheckFunc
+	// Outcome of the previous runs, guarded by the Handler checksMu
+	lastError   string
+	lastErrorAt time.Time
+}
+
+// CheckResult is the outcome of a readiness check
+type CheckResult struct {
+	Name      string  `json:"name"`
+	Healthy   bool    `json:"healthy"`
+	LatencyMs float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+	// Most recent failure, even if the check is healthy now
+	LastError   string     `json:"last_error,omitempty"`
+	LastErrorAt *time.Time `json:"last_error_at,omitempty"`
+}
+
+// HealthReport is the response of the deep health endpoint
+type HealthReport struct {
+	Healthy bool          `json:"healthy"`
+	Ready   bool          `json:"ready"`
+	Checks  []CheckResult `json:"checks"`
+}
+
+// AddReadinessCheck registers a check run by the readiness endpoint
+func (h *Handler) AddReadinessCheck(name string, check CheckFunc) {
+	h.checksMu.Lock()
+	h.checks = append(h.checks, &namedCheck{name: name, check: check})
+	h.checksMu.Unlock()
+}
+
+// SetReady marks the handler as ready (the default) or not ready to
+// receive traffic, regardless of the readiness checks
+func (h *Handler) SetReady(ready bool) {
+	var v int32
+	if !ready {
+		v = 1
+	}
+	atomic.StoreInt32(&h.notReady, v)
+}
+
+// Ready runs the readiness checks and returns the failures by check name
+func (h *Handler) Ready(ctx context.Context) (bool, map[string]error) {
+	var failures = map[string]error{}
+	if atomic.LoadInt32(&h.notReady) == 1 {
+		return false, failures
+	}
+	for _, r := range h.runChecks(ctx) {
+		if !r.Healthy {
+			failures[r.Name] = errors.New(r.Error)
+		}
+	}
+	return len(failures) == 0, failures
+}
+
+// runChecks runs the readiness checks recording their last failure
+func (h *Handler) runChecks(ctx context.Context) []CheckResult {
+	h.checksMu.Lock()
+	checks := append([]*namedCheck{}, h.checks...)
+	h.checksMu.Unlock()
+	results := make([]CheckResult, len(checks))
+	for i, c := range checks {
+		cctx, cancel := context.WithTimeout(ctx, ReadinessCheckTimeout)
+		start := time.Now()
+		err := c.check(cctx)
+		latency := time.Since(start)
+		cancel()
+
+		h.checksMu.Lock()
+		if err != nil {
+			c.lastError, c.lastErrorAt = err.Error(), time.Now()
+		}
+		results[i] = CheckResult{
+			Name:      c.name,
+			Healthy:   err == nil,
+			LatencyMs: float64(latency) / float64(time.Millisecond),
+			LastError: c.lastError,
+		}
+		if !c.lastErrorAt.IsZero() {
+			at := c.lastErrorAt
+			results[i].LastErrorAt = &at
+		}
+		h.checksMu.Unlock()
+		if err != nil {
+			results[i].Error = err.Error()
+		}
+	}
+	return results
+}
+
+// Health runs the readiness checks returning the detail of each one
+func (h *Handler) Health(ctx context.Context) HealthReport {
+	report := HealthReport{Healthy: true, Checks: h.runChecks(ctx)}
+	for _, r := range report.Checks {
+		report.Healthy = report.Healthy && r.Healthy
+	}
+	report.Ready = report.Healthy && atomic.LoadInt32(&h.notReady) == 0
+	return report
+}
+
+// EnableDeepHealthEndpoint registers health/deep (on the admin listener, if
+// enabled), protected by token if not empty. Unlike LiveCheck it runs all
+// the readiness checks, so it is meant for humans and dashboards rather than
+// for frequent probes.
+func (h *Handler) EnableDeepHealthEndpoint(token string) error {
+	return h.ops().AddRoute("health/deep", RequireToken(token, DebugTokenHeader, h.DeepHealth))
+}
+
+// DeepHealth responds with the JSON HealthReport, with status 503 if a
+// check fails
+func (h *Handler) DeepHealth(resp http.ResponseWriter, req *http.Request) error {
+	report := h.Health(req.Context())
+	status := http.StatusOK
+	if !report.Healthy {
+		status = http.StatusServiceUnavailable
+	}
+	return WriteJSON(resp, status, report)
+}
+
+// ReadyCheck responds 200 if the service is ready to receive traffic,
+// 503 while shutting down or if a readiness check fails
+func (h *Handler) ReadyCheck(resp http.ResponseWriter, req *http.Request) error {
+	ready, failures := h.Ready(req.Context())
+	if ready {
+		resp.WriteHeader(http.StatusOK)
+		resp.Write([]byte("OK"))
+		return nil
+	}
+	msgs := []string{}
+	for name, err := range failures {
+		msgs = append(msgs, name+": "+err.Error())
+	}
+	if len(msgs) == 0 {
+		msgs = append(msgs, "not ready")
+	}
+	resp.WriteHeader(http.StatusServiceUnavailable)
+	resp.Write([]byte(strings.Join(msgs, "\n")))
+	h.Log.WithFields(Fields{"origin": RealIP(req), "failures": len(failures)}).Debug("ReadyCheck failed")
+	return nil
+}
+
+// CachedCheck wraps check so that it runs at most once every ttl, the calls
+// in between getting the cached verdict and the concurrent calls sharing the
+// same run, which lasts at most ReadinessCheckTimeout whatever the context of
+// the caller starting it. Useful for checks hitting databases, probed often by the kubelet:
+//
+//	h.AddReadinessCheck("db", hang.CachedCheck(10*time.Second, dbCheck))
+func CachedCheck(ttl time.Duration, check CheckFunc) CheckFunc {
+	var (
+		mu      sync.Mutex
+		err     error
+		checked time.Time
+		running chan struct{}
+	)
+	return func(ctx context.Context) error {
+		mu.Lock()
+		if !checked.IsZero() && time.Since(checked) < ttl {
+			defer mu.Unlock()
+			return err
+		}
+		if running == nil {
+			running = make(chan struct{})
+			// Detached from the caller, whose cancellation must not become
+			// the cached verdict of all the callers
+			cctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), ReadinessCheckTimeout)
+			go func(done chan struct{}) {
+				defer cancel()
+				e := check(cctx)
+				mu.Lock()
+				err, checked, running = e, time.Now(), nil
+				mu.Unlock()
+				close(done)
+			}(running)
+		}
+		done := running
+		mu.Unlock()
+
+		select {
+		case <-done:
+		case <-ctx.Done():
+			return errors.Wrap(ctx.Err(), "check timed out")
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		return err
+	}
+}
@@ -0,0 +1,38 @@
+package hang
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestCachedCheckCallerCancel(t *testing.T) {
+	var (
+		runs  int
+		check = CachedCheck(time.Minute, func(ctx context.Context) error {
+			runs++
+			select {
+			case <-time.After(50 * time.Millisecond):
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		})
+	)
+	// The first caller gives up before the check ends
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := check(ctx); err == nil {
+		t.Fatal("expected the first caller to time out")
+	}
+	// The others get the result of the same run, not the cancellation
+	if err := check(context.Background()); err != nil {
+		t.Errorf("second caller: %v", err)
+	}
+	if err := check(context.Background()); err != nil {
+		t.Errorf("cached verdict: %v", err)
+	}
+	if runs != 1 {
+		t.Errorf("%d runs, want 1", runs)
+	}
+}
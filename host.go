@@ -0,0 +1,82 @@
+package hang
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// HostSeparator separates the host pattern from the route in the routes
+// bound to a host, e.g. "api.example.com|users" or "*.example.com|orders"
+const HostSeparator = "|"
+
+// AddHostRoute registers a route served only for requests to host, either
+// a name (api.example.com) or a pattern whose first label is * matching a
+// single subdomain (*.tenant.example.com), available to the handler
+// through Subdomain. Routes bound to a host take precedence over the
+// others for the same path.
+func (h *Handler) AddHostRoute(host, route string, handleFunc HandleFunc) error {
+	return h.AddRoute(strings.ToLower(host)+HostSeparator+route, handleFunc)
+}
+
+// splitHostRoute returns host pattern and path of a route
+func splitHostRoute(route string) (string, string) {
+	if i := strings.Index(route, HostSeparator); i >= 0 {
+		return route[:i], route[i+len(HostSeparator):]
+	}
+	return "", route
+}
+
+// requestHost returns the lowercase host of the request, without port
+func requestHost(req *http.Request) string {
+	host := req.Host
+	// Not to allocate the error for the hosts without port
+	if strings.Contains(host, ":") {
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+	}
+	return strings.ToLower(strings.TrimSuffix(host, "."))
+}
+
+// hostPatterns returns the patterns host can match, exactly and by
+// wildcard ("" if none), with the subdomain matched by the *
+func hostPatterns(host string) (string, string, string) {
+	if host == "" {
+		return "", "", ""
+	}
+	i := strings.Index(host, ".")
+	if i <= 0 {
+		return host, "", ""
+	}
+	return host, "*" + host[i:], host[:i]
+}
+
+// matchHost tells if host matches pattern, returning the subdomain
+// matched by the * of the pattern
+func matchHost(pattern, host string) (string, bool) {
+	if pattern == host {
+		return "", true
+	}
+	if strings.HasPrefix(pattern, "*.") {
+		if i := strings.Index(host, "."); i > 0 && host[i:] == pattern[1:] {
+			return host[:i], true
+		}
+	}
+	return "", false
+}
+
+// withSubdomain stores the subdomain matched by a host pattern in the
+// request context
+func withSubdomain(req *http.Request, sub string) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), subdomainKey, sub))
+}
+
+// Subdomain returns the subdomain matched by the * of the host pattern of
+// the route, e.g. the tenant "acme" for acme.tenant.example.com on
+// "*.tenant.example.com|orders"
+func Subdomain(req *http.Request) string {
+	sub, _ := req.Context().Value(subdomainKey).(string)
+	return sub
+}
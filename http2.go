@@ -0,0 +1,53 @@
+package hang
+
+import (
+	"net/http"
+	"time"
+
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// HTTP2Options configures HTTP/2 serving
+type HTTP2Options struct {
+	// Serve HTTP/2 also in clear text (h2c), with prior knowledge or
+	// through the Upgrade header, for internal mesh traffic and gRPC-web or
+	// streaming clients without a TLS terminating proxy
+	H2C bool
+	// Maximum number of concurrent streams per connection, 250 if zero
+	MaxConcurrentStreams uint32
+	// Maximum size of the frames read, 1MB if zero, between 16KB and 16MB
+	MaxReadFrameSize uint32
+	// Flow control windows, the http2 package defaults if zero
+	MaxUploadBufferPerConnection int32
+	MaxUploadBufferPerStream     int32
+	// Time an idle connection is kept open, the server IdleTimeout if zero
+	IdleTimeout time.Duration
+}
+
+// EnableHTTP2 applies the HTTP/2 settings to the servers started by Serve:
+// on TLS listeners HTTP/2 is negotiated with ALPN, on plain ones it is
+// served if H2C is set. It must be called before Serve.
+func (h *Handler) EnableHTTP2(opts HTTP2Options) {
+	h.http2 = &opts
+}
+
+// configureHTTP2 applies the HTTP/2 settings to srv
+func (h *Handler) configureHTTP2(srv *http.Server) {
+	if h.http2 == nil {
+		return
+	}
+	h2s := &http2.Server{
+		MaxConcurrentStreams:         h.http2.MaxConcurrentStreams,
+		MaxReadFrameSize:             h.http2.MaxReadFrameSize,
+		MaxUploadBufferPerConnection: h.http2.MaxUploadBufferPerConnection,
+		MaxUploadBufferPerStream:     h.http2.MaxUploadBufferPerStream,
+		IdleTimeout:                  h.http2.IdleTimeout,
+	}
+	if h.http2.H2C && srv.TLSConfig == nil {
+		srv.Handler = h2c.NewHandler(srv.Handler, h2s)
+	}
+	if err := http2.ConfigureServer(srv, h2s); err != nil {
+		h.Log.Error(err)
+	}
+}
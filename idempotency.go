@@ -0,0 +1,291 @@
+package hang
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// IdempotencyKeyHeader is the header carrying the client idempotency key
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// IdempotentReplayHeader is set on responses replayed from the store
+const IdempotentReplayHeader = "Idempotent-Replayed"
+
+// StoredResponse is a response saved for replay
+type StoredResponse struct {
+	Status int         `json:"status"`
+	Header http.Header `json:"header"`
+	Body   []byte      `json:"body"`
+	// Hash of method, path and body of the original request
+	Fingerprint string `json:"fingerprint"`
+}
+
+// IdempotencyStore keeps the responses by idempotency key. Lock and Unlock
+// guard the requests in flight and map onto SET NX PX and DEL in Redis.
+type IdempotencyStore interface {
+	// Get returns the response stored for key, nil if none
+	Get(ctx context.Context, key string) (*StoredResponse, error)
+	// Set stores the response for key for ttl
+	Set(ctx context.Context, key string, resp *StoredResponse, ttl time.Duration) error
+	// Lock reserves key for ttl, returning false if already reserved
+	Lock(ctx context.Context, key string, ttl time.Duration) (bool, error)
+	// Unlock releases the reservation of key
+	Unlock(ctx context.Context, key string) error
+}
+
+// IdempotencyOptions configures the Idempotency middleware
+type IdempotencyOptions struct {
+	// Response store, an in-memory one if nil
+	Store IdempotencyStore
+	// Retention of the responses, 24h if zero
+	TTL time.Duration
+	// Maximum duration of a request holding its key, 1m if zero
+	LockTTL time.Duration
+	// Methods honoring the header, POST and PATCH if empty
+	Methods []string
+	// Reject the covered methods missing the header with a 400
+	Required bool
+}
+
+// Idempotency returns a middleware honoring the Idempotency-Key header: the
+// first response for a key is stored and replayed to the retries, unless
+// the handler failed (returned an error, wrote nothing or a 5xx), so that
+// retries run it again. Retries arriving while the first request runs get a 409, reusing
+// a key with a different request gets a 422.
+func Idempotency(opts IdempotencyOptions) Middleware {
+	if opts.Store == nil {
+		opts.Store = NewMemoryIdempotencyStore()
+	}
+	if opts.TTL <= 0 {
+		opts.TTL = 24 * time.Hour
+	}
+	if opts.LockTTL <= 0 {
+		opts.LockTTL = time.Minute
+	}
+	if len(opts.Methods) == 0 {
+		opts.Methods = []string{http.MethodPost, http.MethodPatch}
+	}
+	return func(next HandleFunc) HandleFunc {
+		return func(resp http.ResponseWriter, req *http.Request) error {
+			if !containsString(opts.Methods, req.Method) {
+				return next(resp, req)
+			}
+			key := req.Header.Get(IdempotencyKeyHeader)
+			if key == "" {
+				if opts.Required {
+					err := errors.New("missing " + IdempotencyKeyHeader + " header")
+					// Respond
+					WriteError(resp, req, http.StatusBadRequest, err)
+					return err
+				}
+				return next(resp, req)
+			}
+			var (
+				ctx = req.Context()
+				// Keys are scoped by route
+				storeKey = RouteFrom(req) + ":" + key
+			)
+			fingerprint, err := requestFingerprint(req)
+			if err != nil {
+				// Respond
+				WriteError(resp, req, http.StatusBadRequest, err)
+				return err
+			}
+
+			stored, err := opts.Store.Get(ctx, storeKey)
+			if err != nil {
+				err = errors.Wrap(err, "can't read idempotency store")
+				// Respond
+				WriteError(resp, req, http.StatusInternalServerError, err)
+				return err
+			}
+			if stored != nil {
+				return replay(resp, req, stored, fingerprint)
+			}
+
+			locked, err := opts.Store.Lock(ctx, storeKey, opts.LockTTL)
+			if err != nil {
+				err = errors.Wrap(err, "can't lock idempotency key")
+				// Respond
+				WriteError(resp, req, http.StatusInternalServerError, err)
+				return err
+			}
+			if !locked {
+				err = errors.New("a request with the same idempotency key is in progress")
+				// Respond
+				WriteError(resp, req, http.StatusConflict, err)
+				return err
+			}
+			// Released even if the client goes away
+			defer opts.Store.Unlock(context.Background(), storeKey)
+			// The request holding the lock may have completed in between
+			if stored, err = opts.Store.Get(ctx, storeKey); err == nil && stored != nil {
+				return replay(resp, req, stored, fingerprint)
+			}
+
+			cw := &captureWriter{ResponseWriter: resp, status: http.StatusOK}
+			err = next(cw, req)
+			if err == nil && cw.wroteHeader && cw.status < http.StatusInternalServerError {
+				sr := &StoredResponse{
+					Status:      cw.status,
+					Header:      resp.Header().Clone(),
+					Body:        cw.buf.Bytes(),
+					Fingerprint: fingerprint,
+				}
+				// Retries keep their own request ID
+				sr.Header.Del(RequestIDHeader)
+				if e := opts.Store.Set(context.Background(), storeKey, sr, opts.TTL); e != nil && err == nil {
+					err = errors.Wrap(e, "can't store idempotent response")
+				}
+			}
+			return err
+		}
+	}
+}
+
+// replay writes a stored response if it belongs to the same request
+func replay(resp http.ResponseWriter, req *http.Request, stored *StoredResponse, fingerprint string) error {
+	if stored.Fingerprint != fingerprint {
+		err := errors.New("idempotency key reused with a different request")
+		// Respond
+		WriteError(resp, req, http.StatusUnprocessableEntity, err)
+		return err
+	}
+	dst := resp.Header()
+	for k, v := range stored.Header {
+		dst[k] = v
+	}
+	dst.Set(IdempotentReplayHeader, "true")
+	resp.WriteHeader(stored.Status)
+	_, err := resp.Write(stored.Body)
+	return err
+}
+
+// requestFingerprint hashes method, path and body, restoring the body
+func requestFingerprint(req *http.Request) (string, error) {
+	h := sha256.New()
+	h.Write([]byte(req.Method + " " + req.URL.Path + "\n"))
+	if req.Body != nil {
+		body, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			return "", errors.Wrap(err, "error reading request body")
+		}
+		req.Body.Close()
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+		h.Write(body)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// containsString reports whether list contains s
+func containsString(list []string, s string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+	return false
+}
+
+// captureWriter copies status and body while writing them through
+type captureWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	buf         bytes.Buffer
+}
+
+func (cw *captureWriter) WriteHeader(status int) {
+	if !cw.wroteHeader {
+		cw.status = status
+		cw.wroteHeader = true
+	}
+	cw.ResponseWriter.WriteHeader(status)
+}
+
+func (cw *captureWriter) Write(b []byte) (int, error) {
+	cw.wroteHeader = true
+	cw.buf.Write(b)
+	return cw.ResponseWriter.Write(b)
+}
+
+// Unwrap returns the wrapped writer, for http.ResponseController
+func (cw *captureWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+// MemoryIdempotencyStore is an IdempotencyStore for a single instance
+type MemoryIdempotencyStore struct {
+	mu        sync.Mutex
+	responses map[string]memoryEntry
+	locks     map[string]time.Time
+}
+
+type memoryEntry struct {
+	resp    *StoredResponse
+	expires time.Time
+}
+
+// NewMemoryIdempotencyStore returns an empty in-memory store
+func NewMemoryIdempotencyStore() *MemoryIdempotencyStore {
+	return &MemoryIdempotencyStore{
+		responses: map[string]memoryEntry{},
+		locks:     map[string]time.Time{},
+	}
+}
+
+// Get implements IdempotencyStore
+func (s *MemoryIdempotencyStore) Get(_ context.Context, key string) (*StoredResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.responses[key]
+	if !ok {
+		return nil, nil
+	}
+	if time.Now().After(e.expires) {
+		delete(s.responses, key)
+		return nil, nil
+	}
+	return e.resp, nil
+}
+
+// Set implements IdempotencyStore, dropping the expired entries
+func (s *MemoryIdempotencyStore) Set(_ context.Context, key string, resp *StoredResponse, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	for k, e := range s.responses {
+		if now.After(e.expires) {
+			delete(s.responses, k)
+		}
+	}
+	s.responses[key] = memoryEntry{resp: resp, expires: now.Add(ttl)}
+	return nil
+}
+
+// Lock implements IdempotencyStore
+func (s *MemoryIdempotencyStore) Lock(_ context.Context, key string, ttl time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if exp, ok := s.locks[key]; ok && time.Now().Before(exp) {
+		return false, nil
+	}
+	s.locks[key] = time.Now().Add(ttl)
+	return true, nil
+}
+
+// Unlock implements IdempotencyStore
+func (s *MemoryIdempotencyStore) Unlock(_ context.Context, key string) error {
+	s.mu.Lock()
+	delete(s.locks, key)
+	s.mu.Unlock()
+	return nil
+}
@@ -0,0 +1,115 @@
+package hang
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+// idempotentPost sends a POST with body and the idempotency key
+func idempotentPost(h http.Handler, target, key, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, target, strings.NewReader(body))
+	req.Header.Set(IdempotencyKeyHeader, key)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestIdempotencyReplay(t *testing.T) {
+	h := testHandler(t)
+	h.Use(Idempotency(IdempotencyOptions{}))
+	calls := 0
+	h.AddRoute("pay", func(resp http.ResponseWriter, req *http.Request) error {
+		calls++
+		return WriteJSON(resp, http.StatusCreated, map[string]int{"payment": calls})
+	})
+
+	first := idempotentPost(h, "/pay", "k1", `{"amount": 10}`)
+	retry := idempotentPost(h, "/pay", "k1", `{"amount": 10}`)
+	if calls != 1 {
+		t.Errorf("handler called %d times, want 1", calls)
+	}
+	if retry.Code != http.StatusCreated || retry.Body.String() != first.Body.String() || retry.Header().Get(IdempotentReplayHeader) != "true" {
+		t.Errorf("got replay %d %q (replayed %q), want %d %q", retry.Code, retry.Body.String(), retry.Header().Get(IdempotentReplayHeader), first.Code, first.Body.String())
+	}
+	if first.Header().Get(IdempotentReplayHeader) != "" {
+		t.Error("first response marked as replayed")
+	}
+
+	if rec := idempotentPost(h, "/pay", "k1", `{"amount": 20}`); rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("key reused with another body: got status %d, want %d", rec.Code, http.StatusUnprocessableEntity)
+	}
+	if rec := idempotentPost(h, "/pay", "k2", `{"amount": 10}`); rec.Code != http.StatusCreated || calls != 2 {
+		t.Errorf("new key: got status %d after %d calls, want %d after 2", rec.Code, calls, http.StatusCreated)
+	}
+}
+
+func TestIdempotencyConflict(t *testing.T) {
+	h := testHandler(t)
+	h.Use(Idempotency(IdempotencyOptions{}))
+	var (
+		started = make(chan struct{})
+		release = make(chan struct{})
+	)
+	h.AddRoute("pay", func(resp http.ResponseWriter, req *http.Request) error {
+		close(started)
+		<-release
+		return WriteJSON(resp, http.StatusOK, "paid")
+	})
+
+	done := make(chan *httptest.ResponseRecorder)
+	go func() { done <- idempotentPost(h, "/pay", "k", "{}") }()
+	<-started
+	if rec := idempotentPost(h, "/pay", "k", "{}"); rec.Code != http.StatusConflict {
+		t.Errorf("retry in flight: got status %d, want %d", rec.Code, http.StatusConflict)
+	}
+	close(release)
+	if rec := <-done; rec.Code != http.StatusOK {
+		t.Errorf("first request: got status %d, want %d", rec.Code, http.StatusOK)
+	}
+	if rec := idempotentPost(h, "/pay", "k", "{}"); rec.Code != http.StatusOK || rec.Header().Get(IdempotentReplayHeader) != "true" {
+		t.Errorf("retry after completion: got status %d, want a replayed %d", rec.Code, http.StatusOK)
+	}
+}
+
+func TestIdempotencyFailureNotStored(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler HandleFunc
+	}{
+		{"error without response", func(resp http.ResponseWriter, req *http.Request) error {
+			return errors.New("db down")
+		}},
+		{"error with response", func(resp http.ResponseWriter, req *http.Request) error {
+			err := errors.New("invalid amount")
+			WriteError(resp, req, http.StatusBadRequest, err)
+			return err
+		}},
+		{"server error", func(resp http.ResponseWriter, req *http.Request) error {
+			resp.WriteHeader(http.StatusServiceUnavailable)
+			return nil
+		}},
+	}
+	for _, tt := range tests {
+		h := testHandler(t)
+		h.SetErrorRenderer(FormatErrorRenderer(ProblemJSONErrors))
+		h.Use(Idempotency(IdempotencyOptions{}))
+		calls := 0
+		h.AddRoute("pay", func(resp http.ResponseWriter, req *http.Request) error {
+			calls++
+			return tt.handler(resp, req)
+		})
+
+		first := idempotentPost(h, "/pay", "k", "{}")
+		retry := idempotentPost(h, "/pay", "k", "{}")
+		if calls != 2 || retry.Header().Get(IdempotentReplayHeader) != "" {
+			t.Errorf("%s: handler called %d times, retry replayed %q, want the retry to run it again", tt.name, calls, retry.Header().Get(IdempotentReplayHeader))
+		}
+		if retry.Code != first.Code || first.Code < http.StatusBadRequest {
+			t.Errorf("%s: got statuses %d and %d, want the same error", tt.name, first.Code, retry.Code)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package hang
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// IPFilterOptions lists the client addresses (IPs or CIDRs) accepted or
+// rejected by the IPFilter middleware
+type IPFilterOptions struct {
+	// Accepted clients, any if empty
+	Allow []string
+	// Rejected clients, checked before Allow
+	Deny []string
+	// Proxies whose X-Forwarded-For is trusted to find the client address,
+	// replacing the ones of the Handler (see SetTrustedProxies)
+	TrustedProxies []string
+}
+
+// IPFilter returns a middleware rejecting with a 403, and logging, the
+// clients in opts.Deny or, if opts.Allow is not empty, not in it. Register it
+// with Use or UseForRoute to filter globally or per route.
+func (h *Handler) IPFilter(opts IPFilterOptions) (Middleware, error) {
+	allow, err := parseCIDRs(opts.Allow)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid allow list")
+	}
+	deny, err := parseCIDRs(opts.Deny)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid deny list")
+	}
+	trusted, err := parseCIDRs(opts.TrustedProxies)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid trusted proxies")
+	}
+	return func(next HandleFunc) HandleFunc {
+		return func(resp http.ResponseWriter, req *http.Request) error {
+			ip := net.ParseIP(RealIP(req))
+			if len(trusted) > 0 {
+				ip = resolveClientIP(req, trusted)
+			}
+			if ip == nil || containsIP(deny, ip) || (len(allow) > 0 && !containsIP(allow, ip)) {
+				h.Log.WithFields(Fields{"route": RouteFrom(req), "origin": ip.String()}).Warn("Request from rejected address")
+				err := errors.New("forbidden")
+				// Respond
+				WriteError(resp, req, http.StatusForbidden, err)
+				// Logged above
+				return nil
+			}
+			return next(resp, req)
+		}
+	}, nil
+}
+
+// parseCIDRs parses a list of CIDRs and plain IPs
+func parseCIDRs(list []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(list))
+	for _, s := range list {
+		s = strings.TrimSpace(s)
+		if !strings.Contains(s, "/") {
+			ip := net.ParseIP(s)
+			if ip == nil {
+				return nil, errors.New("invalid IP " + s)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid CIDR "+s)
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+// containsIP reports whether ip is in one of nets
+func containsIP(nets []*net.IPNet, ip net.IP) bool {
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
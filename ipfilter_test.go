@@ -0,0 +1,64 @@
+package hang
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestIPFilter(t *testing.T) {
+	tests := []struct {
+		name      string
+		opts      IPFilterOptions
+		remote    string
+		forwarded string
+		status    int
+	}{
+		{"no lists", IPFilterOptions{}, "192.0.2.1:1234", "", http.StatusOK},
+		{"allowed ip", IPFilterOptions{Allow: []string{"192.0.2.1"}}, "192.0.2.1:1234", "", http.StatusOK},
+		{"allowed cidr", IPFilterOptions{Allow: []string{"192.0.2.0/24"}}, "192.0.2.7:1234", "", http.StatusOK},
+		{"not allowed", IPFilterOptions{Allow: []string{"192.0.2.0/24"}}, "198.51.100.1:1234", "", http.StatusForbidden},
+		{"denied", IPFilterOptions{Deny: []string{"192.0.2.0/24"}}, "192.0.2.1:1234", "", http.StatusForbidden},
+		{"deny before allow", IPFilterOptions{Allow: []string{"192.0.2.0/24"}, Deny: []string{"192.0.2.1"}}, "192.0.2.1:1234", "", http.StatusForbidden},
+		{"ipv6", IPFilterOptions{Allow: []string{"2001:db8::/32"}}, "[2001:db8::1]:1234", "", http.StatusOK},
+		{"ipv4 mapped", IPFilterOptions{Deny: []string{"192.0.2.1"}}, "[::ffff:192.0.2.1]:1234", "", http.StatusForbidden},
+		{"unparsable peer", IPFilterOptions{Deny: []string{"198.51.100.1"}}, "garbage", "", http.StatusForbidden},
+		{"forwarded by untrusted peer", IPFilterOptions{Allow: []string{"192.0.2.1"}}, "198.51.100.1:1234", "192.0.2.1", http.StatusForbidden},
+		{"forwarded by trusted proxy", IPFilterOptions{Allow: []string{"192.0.2.1"}, TrustedProxies: []string{"10.0.0.0/8"}}, "10.0.0.1:1234", "192.0.2.1", http.StatusOK},
+		{"spoofed hop before client", IPFilterOptions{Allow: []string{"192.0.2.1"}, TrustedProxies: []string{"10.0.0.0/8"}}, "10.0.0.1:1234", "192.0.2.1, 198.51.100.1", http.StatusForbidden},
+		{"denied behind proxies", IPFilterOptions{Deny: []string{"192.0.2.1"}, TrustedProxies: []string{"10.0.0.0/8"}}, "10.0.0.1:1234", "192.0.2.1, 10.0.0.2", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		h := testHandler(t)
+		mw, err := h.IPFilter(tt.opts)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		h.Use(mw)
+		h.AddRoute("admin", func(resp http.ResponseWriter, req *http.Request) error { return nil })
+
+		req := httptest.NewRequest(http.MethodGet, "/admin", nil)
+		req.RemoteAddr = tt.remote
+		if tt.forwarded != "" {
+			req.Header.Set("X-Forwarded-For", tt.forwarded)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != tt.status {
+			t.Errorf("%s: got status %d, want %d", tt.name, rec.Code, tt.status)
+		}
+	}
+}
+
+func TestIPFilterInvalidList(t *testing.T) {
+	h := testHandler(t)
+	for _, opts := range []IPFilterOptions{
+		{Allow: []string{"192.0.2"}},
+		{Deny: []string{"192.0.2.0/33"}},
+		{TrustedProxies: []string{"proxy"}},
+	} {
+		if _, err := h.IPFilter(opts); err == nil {
+			t.Errorf("invalid options %+v accepted", opts)
+		}
+	}
+}
@@ -0,0 +1,216 @@
+// Package jobs runs named background workers alongside the HTTP handler:
+// workers start with Run, are restarted with backoff when they fail or panic,
+// stop when the context is done and report their health to the readiness
+// checks of a hang.Handler. The Scheduler runs functions periodically, by
+// cron expression or interval.
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/brunetto/hang"
+	"github.com/pkg/errors"
+)
+
+// Func is a background worker, running until ctx is done. Returning nil
+// before that means the work is complete and the job is not restarted.
+type Func func(ctx context.Context) error
+
+// Options configures the restarts, zero values meaning the defaults
+type Options struct {
+	// Wait before the first restart, doubling up to MaxBackoff (1s, 1m)
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+	// Runs lasting longer reset backoff and failure count, 1m by default
+	ResetAfter time.Duration
+	// Consecutive failures making the job unhealthy, 3 by default
+	UnhealthyAfter int
+}
+
+// Status is the state of a job
+type Status struct {
+	Running             bool      `json:"running"`
+	Done                bool      `json:"done"`
+	Restarts            int       `json:"restarts"`
+	ConsecutiveFailures int       `json:"consecutive_failures"`
+	LastError           string    `json:"last_error,omitempty"`
+	LastStart           time.Time `json:"last_start"`
+}
+
+// Manager runs the registered jobs
+type Manager struct {
+	Log  hang.Logger
+	opts Options
+	mu   sync.Mutex
+	jobs map[string]*job
+}
+
+type job struct {
+	name   string
+	fn     Func
+	status Status
+}
+
+// New returns a Manager without jobs
+func New(lg hang.Logger, opts Options) *Manager {
+	if opts.BaseBackoff <= 0 {
+		opts.BaseBackoff = time.Second
+	}
+	if opts.MaxBackoff <= 0 {
+		opts.MaxBackoff = time.Minute
+	}
+	if opts.ResetAfter <= 0 {
+		opts.ResetAfter = time.Minute
+	}
+	if opts.UnhealthyAfter <= 0 {
+		opts.UnhealthyAfter = 3
+	}
+	return &Manager{Log: lg, opts: opts, jobs: map[string]*job{}}
+}
+
+// Add registers a job, to be called before Run
+func (m *Manager) Add(name string, fn Func) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, exists := m.jobs[name]; exists {
+		return errors.New("job " + name + " already exists")
+	}
+	m.jobs[name] = &job{name: name, fn: fn}
+	return nil
+}
+
+// Run starts the jobs and waits for them to stop once ctx is done. It
+// implements hang.Runner, to be added to a hang.Lifecycle.
+func (m *Manager) Run(ctx context.Context) error {
+	var wg sync.WaitGroup
+	m.mu.Lock()
+	for _, j := range m.jobs {
+		wg.Add(1)
+		go func(j *job) {
+			defer wg.Done()
+			m.supervise(ctx, j)
+		}(j)
+	}
+	m.mu.Unlock()
+	wg.Wait()
+	return nil
+}
+
+// supervise runs j, restarting it on failure until ctx is done
+func (m *Manager) supervise(ctx context.Context, j *job) {
+	log := m.Log.WithFields(hang.Fields{"job": j.name})
+	backoff := m.opts.BaseBackoff
+	for {
+		start := time.Now()
+		m.update(j, func(s *Status) {
+			s.Running = true
+			s.LastStart = start
+		})
+		log.Debug("job started")
+		// A long enough run makes the job healthy again
+		healthy := time.AfterFunc(m.opts.ResetAfter, func() {
+			m.update(j, func(s *Status) { s.ConsecutiveFailures = 0 })
+		})
+		err := runSafely(ctx, j.fn)
+		healthy.Stop()
+
+		if ctx.Err() != nil {
+			m.update(j, func(s *Status) { s.Running = false })
+			log.Debug("job stopped")
+			return
+		}
+		if err == nil {
+			m.update(j, func(s *Status) {
+				s.Running = false
+				s.Done = true
+				s.ConsecutiveFailures = 0
+			})
+			log.WithFields(hang.Fields{"duration": time.Since(start).String()}).Info("job completed")
+			return
+		}
+
+		if time.Since(start) > m.opts.ResetAfter {
+			backoff = m.opts.BaseBackoff
+		}
+		m.update(j, func(s *Status) {
+			s.Running = false
+			s.Restarts++
+			s.ConsecutiveFailures++
+			s.LastError = err.Error()
+		})
+		log.WithFields(hang.Fields{"backoff": backoff.String()}).Error(errors.Wrap(err, "job failed"))
+		select {
+		case <-time.After(backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))):
+		case <-ctx.Done():
+			return
+		}
+		if backoff *= 2; backoff > m.opts.MaxBackoff {
+			backoff = m.opts.MaxBackoff
+		}
+	}
+}
+
+// runSafely runs fn turning panics into errors
+func runSafely(ctx context.Context, fn Func) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = errors.New(fmt.Sprintf("panic: %v", p))
+		}
+	}()
+	return fn(ctx)
+}
+
+// update changes the status of j
+func (m *Manager) update(j *job, fn func(s *Status)) {
+	m.mu.Lock()
+	fn(&j.status)
+	m.mu.Unlock()
+}
+
+// Status returns the state of the jobs by name
+func (m *Manager) Status() map[string]Status {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	st := make(map[string]Status, len(m.jobs))
+	for name, j := range m.jobs {
+		st[name] = j.status
+	}
+	return st
+}
+
+// Check returns a readiness check failing when the job named name has failed
+// UnhealthyAfter times in a row
+func (m *Manager) Check(name string) hang.CheckFunc {
+	return func(ctx context.Context) error {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		j, ok := m.jobs[name]
+		if !ok {
+			return errors.New("unknown job " + name)
+		}
+		if j.status.ConsecutiveFailures >= m.opts.UnhealthyAfter {
+			return errors.Errorf("failed %d times in a row: %s", j.status.ConsecutiveFailures, j.status.LastError)
+		}
+		return nil
+	}
+}
+
+// RegisterChecks adds a readiness check for every job to h, named
+// "job:<name>"
+func (m *Manager) RegisterChecks(h *hang.Handler) {
+	m.mu.Lock()
+	names := make([]string, 0, len(m.jobs))
+	for name := range m.jobs {
+		names = append(names, name)
+	}
+	m.mu.Unlock()
+	sort.Strings(names)
+	for _, name := range names {
+		h.AddReadinessCheck("job:"+name, m.Check(name))
+	}
+}
@@ -0,0 +1,87 @@
+package jobs
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/brunetto/hang"
+	"github.com/pkg/errors"
+)
+
+func TestRestarts(t *testing.T) {
+	m := New(hang.NewTestLogger(), Options{BaseBackoff: 20 * time.Millisecond, MaxBackoff: 40 * time.Millisecond, UnhealthyAfter: 2})
+	var (
+		starts []time.Time
+		checks []error
+		check  = m.Check("worker")
+	)
+	m.Add("worker", func(ctx context.Context) error {
+		starts = append(starts, time.Now())
+		checks = append(checks, check(ctx))
+		switch len(starts) {
+		case 1, 2:
+			return errors.New("boom")
+		case 3:
+			panic("bad state")
+		}
+		return nil
+	})
+	if err := m.Add("worker", nil); err == nil {
+		t.Error("duplicate job accepted")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	m.Run(ctx)
+
+	if len(starts) != 4 {
+		t.Fatalf("got %d runs, want 4", len(starts))
+	}
+	// Backoff of 20ms, 40ms and 40ms, with jitter down to the half
+	for i, min := range []time.Duration{10 * time.Millisecond, 20 * time.Millisecond, 20 * time.Millisecond} {
+		if gap := starts[i+1].Sub(starts[i]); gap < min {
+			t.Errorf("restart %d after %v, want at least %v", i+1, gap, min)
+		}
+	}
+	if checks[1] != nil || checks[2] == nil {
+		t.Errorf("got checks %v, want unhealthy only after 2 failures in a row", checks)
+	}
+	st := m.Status()["worker"]
+	if !st.Done || st.Running || st.Restarts != 3 || st.ConsecutiveFailures != 0 || st.LastError != "panic: bad state" {
+		t.Errorf("got status %+v, want done after 3 restarts", st)
+	}
+	if err := check(ctx); err != nil {
+		t.Errorf("got check %v after completion, want healthy", err)
+	}
+}
+
+func TestStop(t *testing.T) {
+	m := New(hang.NewTestLogger(), Options{})
+	started := make(chan struct{})
+	m.Add("worker", func(ctx context.Context) error {
+		close(started)
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		m.Run(ctx)
+		close(done)
+	}()
+	<-started
+	if st := m.Status()["worker"]; !st.Running {
+		t.Errorf("got status %+v, want running", st)
+	}
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return after the context was cancelled")
+	}
+	if st := m.Status()["worker"]; st.Running || st.Done || st.Restarts != 0 {
+		t.Errorf("got status %+v, want stopped without restarts", st)
+	}
+}
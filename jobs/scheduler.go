@@ -0,0 +1,172 @@
+package jobs
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/brunetto/hang"
+	"github.com/pkg/errors"
+	"github.com/robfig/cron/v3"
+)
+
+// Scheduler runs functions periodically, by cron expression or interval.
+// A run still in progress when the next one is due makes the scheduler skip
+// the latter.
+type Scheduler struct {
+	Log     hang.Logger
+	mu      sync.Mutex
+	entries []*entry
+}
+
+type entry struct {
+	name     string
+	spec     string
+	schedule cron.Schedule
+	fn       Func
+	status   EntryStatus
+}
+
+// EntryStatus is the state of a scheduled function
+type EntryStatus struct {
+	Name         string        `json:"name"`
+	Schedule     string        `json:"schedule"`
+	Running      bool          `json:"running"`
+	Next         time.Time     `json:"next"`
+	LastRun      time.Time     `json:"last_run"`
+	LastDuration time.Duration `json:"last_duration"`
+	LastError    string        `json:"last_error,omitempty"`
+	Skipped      int           `json:"skipped"`
+}
+
+// every is a fixed interval schedule
+type every time.Duration
+
+func (e every) Next(t time.Time) time.Time {
+	return t.Add(time.Duration(e))
+}
+
+// NewScheduler returns an empty Scheduler
+func NewScheduler(lg hang.Logger) *Scheduler {
+	return &Scheduler{Log: lg}
+}
+
+// Cron schedules fn with a standard 5 fields cron expression or a descriptor
+// (@hourly, @daily, @every 10m, ...), in local time unless prefixed by
+// CRON_TZ=<zone>
+func (s *Scheduler) Cron(name, expr string, fn Func) error {
+	schedule, err := cron.ParseStandard(expr)
+	if err != nil {
+		return errors.Wrap(err, "invalid cron expression for "+name)
+	}
+	s.add(&entry{name: name, spec: expr, schedule: schedule, fn: fn})
+	return nil
+}
+
+// Every schedules fn every d, the first run being after d
+func (s *Scheduler) Every(name string, d time.Duration, fn Func) error {
+	if d <= 0 {
+		return errors.New("invalid interval for " + name)
+	}
+	s.add(&entry{name: name, spec: "@every " + d.String(), schedule: every(d), fn: fn})
+	return nil
+}
+
+func (s *Scheduler) add(e *entry) {
+	e.status.Name = e.name
+	e.status.Schedule = e.spec
+	s.mu.Lock()
+	s.entries = append(s.entries, e)
+	s.mu.Unlock()
+}
+
+// Run runs the scheduled functions until ctx is done, then waits for the runs
+// in progress, whose context is canceled, to return. It implements
+// hang.Runner.
+func (s *Scheduler) Run(ctx context.Context) error {
+	var wg sync.WaitGroup
+	s.mu.Lock()
+	for _, e := range s.entries {
+		wg.Add(1)
+		go func(e *entry) {
+			defer wg.Done()
+			s.loop(ctx, e)
+		}(e)
+	}
+	s.mu.Unlock()
+	wg.Wait()
+	return nil
+}
+
+// loop fires e on its schedule
+func (s *Scheduler) loop(ctx context.Context, e *entry) {
+	var (
+		runs sync.WaitGroup
+		log  = s.Log.WithFields(hang.Fields{"job": e.name})
+	)
+	defer runs.Wait()
+	for {
+		next := e.schedule.Next(time.Now())
+		s.update(func() { e.status.Next = next })
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		}
+
+		var running bool
+		s.update(func() {
+			running = e.status.Running
+			if running {
+				e.status.Skipped++
+			} else {
+				e.status.Running = true
+			}
+		})
+		if running {
+			log.Warn("previous run still in progress, skipping")
+			continue
+		}
+		runs.Add(1)
+		go func() {
+			defer runs.Done()
+			start := time.Now()
+			err := runSafely(ctx, e.fn)
+			d := time.Since(start)
+			s.update(func() {
+				e.status.Running = false
+				e.status.LastRun = start
+				e.status.LastDuration = d
+				e.status.LastError = ""
+				if err != nil {
+					e.status.LastError = err.Error()
+				}
+			})
+			fields := hang.Fields{"duration": d.String()}
+			if err != nil {
+				log.WithFields(fields).Error(errors.Wrap(err, "scheduled run failed"))
+				return
+			}
+			log.WithFields(fields).Info("scheduled run completed")
+		}()
+	}
+}
+
+func (s *Scheduler) update(fn func()) {
+	s.mu.Lock()
+	fn()
+	s.mu.Unlock()
+}
+
+// Entries returns the state of the scheduled functions
+func (s *Scheduler) Entries() []EntryStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := make([]EntryStatus, len(s.entries))
+	for i, e := range s.entries {
+		list[i] = e.status
+	}
+	return list
+}
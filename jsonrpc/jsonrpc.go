@@ -0,0 +1,204 @@
+// Package jsonrpc serves JSON-RPC 2.0 over a hang route, for interop with
+// legacy clients: methods are registered by name on a Server whose Handle
+// method is added as route handler, e.g. h.AddRoute("rpc", s.Handle).
+// Batches and notifications are supported.
+package jsonrpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"sync"
+
+	"github.com/brunetto/hang"
+	"github.com/pkg/errors"
+)
+
+// Version is the protocol version
+const Version = "2.0"
+
+// Standard error codes
+const (
+	ParseError     = -32700
+	InvalidRequest = -32600
+	MethodNotFound = -32601
+	InvalidParams  = -32602
+	InternalError  = -32603
+)
+
+// Error is a JSON-RPC error. Methods return it to choose the code and the
+// data sent to the client; other errors become an InternalError.
+type Error struct {
+	Code    int         `json:"code"`
+	Message string      `json:"message"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+// Error implements the error interface
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// NewError returns an error with the given code, message and data
+func NewError(code int, message string, data interface{}) *Error {
+	return &Error{Code: code, Message: message, Data: data}
+}
+
+// Request is a JSON-RPC request, a notification if ID is missing
+type Request struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	ID      json.RawMessage `json:"id,omitempty"`
+}
+
+// Response is a JSON-RPC response
+type Response struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *Error          `json:"error,omitempty"`
+	ID      json.RawMessage `json:"id"`
+}
+
+// Method handles a call, req being the HTTP request carrying it
+type Method func(req *http.Request, params json.RawMessage) (interface{}, error)
+
+// Server dispatches the calls to the registered methods
+type Server struct {
+	Log hang.Logger
+	// Maximum size of the request body
+	MaxBodySize int64
+	// Maximum number of calls in a batch
+	MaxBatch int
+	mu       sync.RWMutex
+	methods  map[string]Method
+}
+
+// New returns a Server with 1MB body and 100 calls batch limits
+func New(lg hang.Logger) *Server {
+	return &Server{
+		Log:         lg,
+		MaxBodySize: 1 << 20,
+		MaxBatch:    100,
+		methods:     map[string]Method{},
+	}
+}
+
+// Register sets the method handling the calls to name
+func (s *Server) Register(name string, fn Method) {
+	s.mu.Lock()
+	s.methods[name] = fn
+	s.mu.Unlock()
+}
+
+// DecodeParams decodes the params of a call into v, returning an
+// InvalidParams error on failure
+func DecodeParams(params json.RawMessage, v interface{}) error {
+	if len(params) == 0 {
+		return NewError(InvalidParams, "Invalid params", "missing params")
+	}
+	if err := json.Unmarshal(params, v); err != nil {
+		return NewError(InvalidParams, "Invalid params", err.Error())
+	}
+	return nil
+}
+
+// Handle is the route handler serving the POSTed calls
+func (s *Server) Handle(resp http.ResponseWriter, req *http.Request) error {
+	if req.Method != http.MethodPost {
+		resp.Header().Set("Allow", http.MethodPost)
+		err := errors.New("method not allowed")
+		hang.WriteError(resp, req, http.StatusMethodNotAllowed, err)
+		return err
+	}
+	body, err := ioutil.ReadAll(http.MaxBytesReader(resp, req.Body, s.MaxBodySize))
+	if err != nil {
+		err = errors.Wrap(err, "can't read JSON-RPC request")
+		hang.WriteError(resp, req, http.StatusRequestEntityTooLarge, err)
+		return err
+	}
+	body = bytes.TrimSpace(body)
+
+	// Batch
+	if len(body) > 0 && body[0] == '[' {
+		var calls []json.RawMessage
+		if err := json.Unmarshal(body, &calls); err != nil {
+			return s.write(resp, Response{JSONRPC: Version, Error: NewError(ParseError, "Parse error", nil), ID: null})
+		}
+		if len(calls) == 0 {
+			return s.write(resp, Response{JSONRPC: Version, Error: NewError(InvalidRequest, "Invalid Request", "empty batch"), ID: null})
+		}
+		if s.MaxBatch > 0 && len(calls) > s.MaxBatch {
+			return s.write(resp, Response{JSONRPC: Version, Error: NewError(InvalidRequest, "Invalid Request", "batch too large"), ID: null})
+		}
+		responses := make([]Response, 0, len(calls))
+		for _, call := range calls {
+			if r, ok := s.call(req, call); ok {
+				responses = append(responses, r)
+			}
+		}
+		if len(responses) == 0 {
+			// Only notifications
+			resp.WriteHeader(http.StatusNoContent)
+			return nil
+		}
+		return s.write(resp, responses)
+	}
+
+	r, ok := s.call(req, body)
+	if !ok {
+		resp.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	return s.write(resp, r)
+}
+
+// null is the ID of the responses to unidentifiable requests
+var null = json.RawMessage("null")
+
+// call runs a single call, returning false for notifications
+func (s *Server) call(req *http.Request, raw json.RawMessage) (Response, bool) {
+	var r Request
+	if err := json.Unmarshal(raw, &r); err != nil {
+		code, msg := ParseError, "Parse error"
+		if _, ok := err.(*json.UnmarshalTypeError); ok || json.Valid(raw) {
+			code, msg = InvalidRequest, "Invalid Request"
+		}
+		return Response{JSONRPC: Version, Error: NewError(code, msg, nil), ID: null}, true
+	}
+	id := r.ID
+	if id == nil {
+		id = null
+	}
+	if r.JSONRPC != Version || r.Method == "" {
+		return Response{JSONRPC: Version, Error: NewError(InvalidRequest, "Invalid Request", nil), ID: id}, true
+	}
+	notification := r.ID == nil
+
+	s.mu.RLock()
+	fn, ok := s.methods[r.Method]
+	s.mu.RUnlock()
+	if !ok {
+		return Response{JSONRPC: Version, Error: NewError(MethodNotFound, "Method not found", r.Method), ID: id}, !notification
+	}
+	result, err := fn(req, r.Params)
+	if err != nil {
+		rpcErr, ok := err.(*Error)
+		if !ok {
+			s.Log.WithFields(hang.Fields{"method": r.Method, "route": hang.RouteFrom(req)}).Error(errors.Wrap(err, "JSON-RPC call failed"))
+			rpcErr = NewError(InternalError, "Internal error", nil)
+		}
+		return Response{JSONRPC: Version, Error: rpcErr, ID: id}, !notification
+	}
+	if result == nil {
+		// A result is required on success
+		result = null
+	}
+	return Response{JSONRPC: Version, Result: result, ID: id}, !notification
+}
+
+// write writes v as the JSON-RPC response
+func (s *Server) write(resp http.ResponseWriter, v interface{}) error {
+	return hang.WriteJSON(resp, http.StatusOK, v)
+}
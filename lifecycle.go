@@ -0,0 +1,263 @@
+package hang
+
+import (
+	"context"
+	"net"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Runner is a long running component (HTTP server, consumer, cron, ...)
+// managed by a Lifecycle. Run must return when ctx is cancelled.
+type Runner interface {
+	Run(ctx context.Context) error
+}
+
+// RunnerFunc adapts a function to the Runner interface
+type RunnerFunc func(ctx context.Context) error
+
+// Run calls f(ctx)
+func (f RunnerFunc) Run(ctx context.Context) error {
+	return f(ctx)
+}
+
+// ShutdownHook is called by the Lifecycle after all the runners stopped
+type ShutdownHook func(ctx context.Context) error
+
+type namedRunner struct {
+	name   string
+	runner Runner
+}
+
+// Lifecycle runs a set of Runners until a stop signal is received or one
+// of them fails, then waits for all of them to stop and runs the shutdown
+// hooks, returning an error instead of exiting the process
+type Lifecycle struct {
+	// Name of the service, for logging
+	Name string
+	// Logger to be used
+	Log Logger
+	// Signals stopping the lifecycle, SIGINT and SIGTERM by default
+	Signals []os.Signal
+	// Maximum time for the runners to stop and for the shutdown hooks
+	ShutdownTimeout time.Duration
+	// Delay between failing the readiness endpoints and stopping the runners
+	// on a stop signal, to let Kubernetes remove the pod from the load
+	// balancers before the connections are drained
+	PreStopDelay time.Duration
+
+	mu      sync.Mutex
+	runners []namedRunner
+	hooks   []ShutdownHook
+	// Handlers to be marked not ready when stopping
+	handlers []*Handler
+	ctx      context.Context
+}
+
+// NewLifecycle creates a lifecycle with the default signals and a 30s shutdown timeout
+func NewLifecycle(name string, lg Logger) *Lifecycle {
+	return &Lifecycle{
+		Name:            name,
+		Log:             lg,
+		Signals:         []os.Signal{os.Interrupt, syscall.SIGTERM},
+		ShutdownTimeout: 30 * time.Second,
+	}
+}
+
+// Add registers a runner
+func (l *Lifecycle) Add(name string, r Runner) {
+	l.mu.Lock()
+	l.runners = append(l.runners, namedRunner{name: name, runner: r})
+	l.mu.Unlock()
+}
+
+// AddFunc registers a function as runner
+func (l *Lifecycle) AddFunc(name string, fn func(ctx context.Context) error) {
+	l.Add(name, RunnerFunc(fn))
+}
+
+// AddShutdownHook registers a function to be called, in registration
+// order, after all the runners stopped
+func (l *Lifecycle) AddShutdownHook(fn ShutdownHook) {
+	l.mu.Lock()
+	l.hooks = append(l.hooks, fn)
+	l.mu.Unlock()
+}
+
+// AddHandler registers the Handler servers (business and admin listeners)
+// as a runner. The handler stops exiting the process on SIGINT/SIGTERM,
+// leaving the shutdown to the lifecycle.
+func (l *Lifecycle) AddHandler(h *Handler, addr string) {
+	l.AddHandlerRunner(h, "http "+addr, h.Runner(addr, l.ShutdownTimeout))
+}
+
+// AddHandlerRunner registers a runner serving h in a custom way (e.g. on a
+// listener shared with other protocols), marking h not ready when stopping
+// as AddHandler does
+func (l *Lifecycle) AddHandlerRunner(h *Handler, name string, r Runner) {
+	h.DisableExitOnSignal()
+	l.mu.Lock()
+	l.handlers = append(l.handlers, h)
+	l.mu.Unlock()
+	l.Add(name, r)
+}
+
+// Context returns the context cancelled when the lifecycle starts stopping,
+// before the pre-stop delay, nil before Run is called
+func (l *Lifecycle) Context() context.Context {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.ctx
+}
+
+// Run starts all the runners and blocks until ctx is cancelled, a stop
+// signal is received or a runner returns. On a stop signal the handlers are
+// marked not ready and Run waits PreStopDelay. It then cancels the context
+// of the runners, waits for them to drain for up to ShutdownTimeout, runs
+// the shutdown hooks and returns the first error.
+func (l *Lifecycle) Run(ctx context.Context) error {
+	var (
+		wg       sync.WaitGroup
+		errc     = make(chan error, 1)
+		firstErr error
+		stopped  = make(chan struct{})
+	)
+	// Runners context, cancelled after the pre-stop delay
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	// Stopping context, cancelled as soon as a stop signal arrives
+	sctx, stop := signal.NotifyContext(ctx, l.Signals...)
+	defer stop()
+
+	l.mu.Lock()
+	l.ctx = sctx
+	runners := append([]namedRunner{}, l.runners...)
+	handlers := append([]*Handler{}, l.handlers...)
+	l.mu.Unlock()
+
+	l.Log.Infof("%v: started", l.Name)
+	for _, nr := range runners {
+		wg.Add(1)
+		go func(nr namedRunner) {
+			defer wg.Done()
+			err := runSafely(ctx, nr.runner)
+			if err != nil {
+				err = errors.Wrap(err, "runner "+nr.name)
+				l.Log.WithFields(Fields{"runner": nr.name}).Error(err)
+				select {
+				case errc <- err:
+				default:
+				}
+			} else {
+				l.Log.WithFields(Fields{"runner": nr.name}).Debug("runner stopped")
+			}
+			// Any runner stopping stops the whole lifecycle
+			cancel()
+		}(nr)
+	}
+
+	<-sctx.Done()
+	l.Log.Infof("%v: stopping", l.Name)
+	for _, h := range handlers {
+		h.SetReady(false)
+	}
+	if ctx.Err() == nil && l.PreStopDelay > 0 {
+		// Stop signal: wait for the load balancers to stop sending traffic
+		l.Log.Infof("%v: waiting %v before draining", l.Name, l.PreStopDelay)
+		select {
+		case <-time.After(l.PreStopDelay):
+		case <-ctx.Done():
+		}
+	}
+	cancel()
+
+	// Wait for the runners, with timeout
+	go func() {
+		wg.Wait()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(l.ShutdownTimeout):
+		firstErr = errors.New("timeout waiting for the runners to stop")
+		l.Log.Error(firstErr)
+	}
+	select {
+	case err := <-errc:
+		firstErr = err
+	default:
+	}
+
+	// Shutdown hooks
+	hctx, hcancel := context.WithTimeout(context.Background(), l.ShutdownTimeout)
+	defer hcancel()
+	l.mu.Lock()
+	hooks := append([]ShutdownHook{}, l.hooks...)
+	l.mu.Unlock()
+	for _, hook := range hooks {
+		if err := hook(hctx); err != nil {
+			err = errors.Wrap(err, "shutdown hook "+funcName(hook))
+			l.Log.Error(err)
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+
+	l.Log.Infof("%v: stopped", l.Name)
+	return firstErr
+}
+
+// runSafely runs r converting panics into errors
+func runSafely(ctx context.Context, r Runner) (err error) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			err = errors.Errorf("panic: %v", rec)
+		}
+	}()
+	return r.Run(ctx)
+}
+
+// Runner returns a Runner serving the handler on addr (and on the admin
+// listener, if enabled) and shutting it down gracefully, waiting for up
+// to shutdownTimeout, when the context is cancelled
+func (h *Handler) Runner(addr string, shutdownTimeout time.Duration) Runner {
+	return h.runner(func() error { return h.Serve(addr) }, shutdownTimeout)
+}
+
+// ListenerRunner is Runner serving the handler on ln
+func (h *Handler) ListenerRunner(ln net.Listener, shutdownTimeout time.Duration) Runner {
+	return h.runner(func() error { return h.ServeListener(ln) }, shutdownTimeout)
+}
+
+// ListenersRunner is Runner serving the handler on several listeners, see
+// ServeListeners
+func (h *Handler) ListenersRunner(shutdownTimeout time.Duration, listeners ...ListenerConfig) Runner {
+	return h.runner(func() error { return h.ServeListeners(listeners...) }, shutdownTimeout)
+}
+
+// runner returns a Runner calling serve and shutting the handler down when
+// the context is cancelled
+func (h *Handler) runner(serve func() error, shutdownTimeout time.Duration) Runner {
+	return RunnerFunc(func(ctx context.Context) error {
+		errc := make(chan error, 1)
+		go func() { errc <- serve() }()
+		select {
+		case err := <-errc:
+			return err
+		case <-ctx.Done():
+		}
+		sctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		err := h.Shutdown(sctx)
+		if e := <-errc; e != nil && err == nil {
+			err = e
+		}
+		return err
+	})
+}
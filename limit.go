@@ -0,0 +1,172 @@
+package hang
+
+import (
+	"expvar"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ConcurrencyOptions configures the concurrency limiter
+type ConcurrencyOptions struct {
+	// Maximum in-flight requests for the whole handler, unlimited if zero
+	MaxInFlight int
+	// Maximum in-flight requests by route, routes not listed are unlimited
+	RouteMaxInFlight map[string]int
+	// How long a request waits for a free slot before being shed, 100ms if zero
+	QueueTimeout time.Duration
+	// Retry-After sent with the 503, 1s if zero
+	RetryAfter time.Duration
+	// Name of the expvar publishing the in-flight gauges, "inflight" if empty
+	Name string
+}
+
+// ConcurrencyLimiter bounds the in-flight requests globally and by route,
+// shedding with a 503 the requests that can't get a slot in time
+type ConcurrencyLimiter struct {
+	opts     ConcurrencyOptions
+	global   chan struct{}
+	routes   map[string]chan struct{}
+	mu       sync.RWMutex
+	inFlight map[string]*int64
+	shed     uint64
+}
+
+// NewConcurrencyLimiter returns a limiter publishing its gauges to expvar
+func NewConcurrencyLimiter(opts ConcurrencyOptions) *ConcurrencyLimiter {
+	if opts.QueueTimeout <= 0 {
+		opts.QueueTimeout = 100 * time.Millisecond
+	}
+	if opts.RetryAfter <= 0 {
+		opts.RetryAfter = time.Second
+	}
+	if opts.Name == "" {
+		opts.Name = "inflight"
+	}
+	l := &ConcurrencyLimiter{opts: opts, routes: map[string]chan struct{}{}, inFlight: map[string]*int64{}}
+	if opts.MaxInFlight > 0 {
+		l.global = make(chan struct{}, opts.MaxInFlight)
+	}
+	for route, n := range opts.RouteMaxInFlight {
+		if n > 0 {
+			l.routes[route] = make(chan struct{}, n)
+		}
+	}
+	// Publishing twice the same name panics
+	if expvar.Get(opts.Name) == nil {
+		expvar.Publish(opts.Name, expvar.Func(func() interface{} { return l.Gauges() }))
+	}
+	return l
+}
+
+// Middleware returns the middleware enforcing the limits
+func (l *ConcurrencyLimiter) Middleware() Middleware {
+	return func(next HandleFunc) HandleFunc {
+		return func(resp http.ResponseWriter, req *http.Request) error {
+			route := RouteFrom(req)
+			release, err := l.acquire(req, route)
+			if err != nil {
+				atomic.AddUint64(&l.shed, 1)
+				resp.Header().Set("Retry-After", strconv.Itoa(int(l.opts.RetryAfter.Seconds()+0.5)))
+				WriteError(resp, req, http.StatusServiceUnavailable, errors.New("server overloaded"))
+				return err
+			}
+			defer release()
+			return next(resp, req)
+		}
+	}
+}
+
+// acquire takes the global and route slots, waiting at most QueueTimeout
+func (l *ConcurrencyLimiter) acquire(req *http.Request, route string) (func(), error) {
+	timer := time.NewTimer(l.opts.QueueTimeout)
+	defer timer.Stop()
+	wait := func(sem chan struct{}, what string) error {
+		if sem == nil {
+			return nil
+		}
+		select {
+		case sem <- struct{}{}:
+			return nil
+		default:
+		}
+		select {
+		case sem <- struct{}{}:
+			return nil
+		case <-timer.C:
+			return errors.Errorf("%v concurrency limit of %v reached", what, cap(sem))
+		case <-req.Context().Done():
+			return errors.Wrap(req.Context().Err(), "request cancelled waiting for a slot")
+		}
+	}
+	if err := wait(l.global, "global"); err != nil {
+		return nil, err
+	}
+	rsem := l.routes[route]
+	if err := wait(rsem, "route "+route); err != nil {
+		if l.global != nil {
+			<-l.global
+		}
+		return nil, err
+	}
+	n := l.gauge(route)
+	atomic.AddInt64(n, 1)
+	return func() {
+		atomic.AddInt64(n, -1)
+		if rsem != nil {
+			<-rsem
+		}
+		if l.global != nil {
+			<-l.global
+		}
+	}, nil
+}
+
+// gauge returns the in-flight counter of route
+func (l *ConcurrencyLimiter) gauge(route string) *int64 {
+	l.mu.RLock()
+	n, ok := l.inFlight[route]
+	l.mu.RUnlock()
+	if ok {
+		return n
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if n, ok = l.inFlight[route]; !ok {
+		n = new(int64)
+		l.inFlight[route] = n
+	}
+	return n
+}
+
+// InFlight returns the requests being served by route
+func (l *ConcurrencyLimiter) InFlight() map[string]int64 {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	out := make(map[string]int64, len(l.inFlight))
+	for route, n := range l.inFlight {
+		out[route] = atomic.LoadInt64(n)
+	}
+	return out
+}
+
+// Gauges returns the in-flight requests, total and by route, with the
+// limits and the number of requests shed since the start
+func (l *ConcurrencyLimiter) Gauges() map[string]interface{} {
+	var total int64
+	routes := l.InFlight()
+	for _, n := range routes {
+		total += n
+	}
+	return map[string]interface{}{
+		"total":     total,
+		"routes":    routes,
+		"max":       l.opts.MaxInFlight,
+		"route_max": l.opts.RouteMaxInFlight,
+		"shed":      atomic.LoadUint64(&l.shed),
+	}
+}
@@ -0,0 +1,65 @@
+package hang
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestConcurrencyLimiter(t *testing.T) {
+	l := NewConcurrencyLimiter(ConcurrencyOptions{
+		MaxInFlight:      2,
+		RouteMaxInFlight: map[string]int{"slow": 1},
+		QueueTimeout:     20 * time.Millisecond,
+		RetryAfter:       2 * time.Second,
+		Name:             "test_inflight",
+	})
+	h := testHandler(t)
+	h.Use(l.Middleware())
+	var (
+		started = make(chan struct{})
+		release = make(chan struct{})
+	)
+	block := func(resp http.ResponseWriter, req *http.Request) error {
+		started <- struct{}{}
+		<-release
+		return nil
+	}
+	h.AddRoute("slow", block)
+	h.AddRoute("other", block)
+	h.AddRoute("fast", func(resp http.ResponseWriter, req *http.Request) error { return nil })
+
+	done := make(chan int, 2)
+	go func() { done <- serve(h, http.MethodGet, "/slow", nil).Code }()
+	<-started
+	rec := serve(h, http.MethodGet, "/slow", nil)
+	if rec.Code != http.StatusServiceUnavailable || rec.Header().Get("Retry-After") != "2" {
+		t.Errorf("route limit reached: got status %d and Retry-After %q, want %d and 2", rec.Code, rec.Header().Get("Retry-After"), http.StatusServiceUnavailable)
+	}
+	if rec := serve(h, http.MethodGet, "/fast", nil); rec.Code != http.StatusOK {
+		t.Errorf("other route under the global limit: got status %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	go func() { done <- serve(h, http.MethodGet, "/other", nil).Code }()
+	<-started
+	if rec := serve(h, http.MethodGet, "/fast", nil); rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("global limit reached: got status %d, want %d", rec.Code, http.StatusServiceUnavailable)
+	}
+	if got := l.InFlight(); got["slow"] != 1 || got["other"] != 1 {
+		t.Errorf("got in-flight %v, want one slow and one other", got)
+	}
+
+	release <- struct{}{}
+	release <- struct{}{}
+	for i := 0; i < 2; i++ {
+		if code := <-done; code != http.StatusOK {
+			t.Errorf("admitted request: got status %d, want %d", code, http.StatusOK)
+		}
+	}
+	if shed := l.Gauges()["shed"]; shed.(uint64) < 2 {
+		t.Errorf("got %v requests shed, want at least 2", shed)
+	}
+	if got := l.InFlight(); got["slow"] != 0 || got["other"] != 0 || got["fast"] != 0 {
+		t.Errorf("got in-flight %v after the requests ended, want none", got)
+	}
+}
@@ -0,0 +1,69 @@
+package hang
+
+import (
+	"crypto/tls"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ListenerConfig is an address ServeListeners serves the handler on
+type ListenerConfig struct {
+	// Network, "tcp" (default) or "unix"
+	Network string
+	// Address: host:port, the path of a Unix socket or, on Linux, the name
+	// of an abstract socket starting with "@"
+	Addr string
+	// TLS settings, with the certificates, plain text if nil
+	TLS *tls.Config
+	// Permissions of the Unix socket file, left to the umask if zero
+	SocketMode os.FileMode
+	// Already open listener
+	ln net.Listener
+}
+
+// String describes the listener for logging
+func (lc ListenerConfig) String() string {
+	s := lc.Addr
+	if lc.network() != "tcp" {
+		s = lc.network() + ":" + s
+	}
+	if lc.TLS != nil {
+		s += " (tls)"
+	}
+	return s
+}
+
+func (lc ListenerConfig) network() string {
+	if lc.Network == "" {
+		return "tcp"
+	}
+	return lc.Network
+}
+
+// removeStaleSocket removes the socket file left at path by a previous
+// process, which would make listening fail
+func removeStaleSocket(path string) {
+	if strings.HasPrefix(path, "@") {
+		// Abstract sockets have no file
+		return
+	}
+	if fi, err := os.Stat(path); err == nil && fi.Mode()&os.ModeSocket != 0 {
+		os.Remove(path)
+	}
+}
+
+// prepareUnixListener sets the permissions of the socket file and keeps it
+// on close, for the process taking over the listener on a restart
+func prepareUnixListener(ln net.Listener, lc ListenerConfig) error {
+	if ul, ok := ln.(*net.UnixListener); ok {
+		ul.SetUnlinkOnClose(false)
+	}
+	if lc.SocketMode == 0 || strings.HasPrefix(lc.Addr, "@") {
+		return nil
+	}
+	err := os.Chmod(lc.Addr, lc.SocketMode)
+	return errors.Wrap(err, "can't set the permissions of "+lc.Addr)
+}
@@ -0,0 +1,270 @@
+package hang
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Fields is the set of structured fields attached to a log entry
+type Fields map[string]interface{}
+
+// Entry is a log entry carrying fields, as returned by Logger.WithFields
+type Entry interface {
+	Debug(args ...interface{})
+	Debugf(format string, args ...interface{})
+	Info(args ...interface{})
+	Infof(format string, args ...interface{})
+	Warn(args ...interface{})
+	Warnf(format string, args ...interface{})
+	Error(args ...interface{})
+	Errorf(format string, args ...interface{})
+	Fatal(args ...interface{})
+	Fatalf(format string, args ...interface{})
+	Panic(args ...interface{})
+	Panicf(format string, args ...interface{})
+	WithFields(fields Fields) Entry
+}
+
+// Level is the severity of a log entry, same ordering as logrus
+type Level uint32
+
+const (
+	PanicLevel Level = iota
+	FatalLevel
+	ErrorLevel
+	WarnLevel
+	InfoLevel
+	DebugLevel
+)
+
+// String returns the lower case name of the level
+func (l Level) String() string {
+	switch l {
+	case PanicLevel:
+		return "panic"
+	case FatalLevel:
+		return "fatal"
+	case ErrorLevel:
+		return "error"
+	case WarnLevel:
+		return "warning"
+	case InfoLevel:
+		return "info"
+	default:
+		return "debug"
+	}
+}
+
+// ParseLevel converts a level name (debug, info, warn, error, fatal, panic)
+// into a Level
+func ParseLevel(level string) (Level, error) {
+	switch strings.ToLower(level) {
+	case "debug":
+		return DebugLevel, nil
+	case "info":
+		return InfoLevel, nil
+	case "warn", "warning":
+		return WarnLevel, nil
+	case "err", "error":
+		return ErrorLevel, nil
+	case "fatal":
+		return FatalLevel, nil
+	case "panic":
+		return PanicLevel, nil
+	}
+	return DebugLevel, errors.New("unknown log level " + level)
+}
+
+// LevelSetter is implemented by the loggers whose level can be changed at runtime
+type LevelSetter interface {
+	GetLevel() Level
+	SetLevel(level Level)
+}
+
+// NewLogrusLogger adapts a logrus logger (or entry) to the Logger interface
+func NewLogrusLogger(lg logrus.FieldLogger) Logger {
+	return logrusLogger{lg}
+}
+
+type logrusLogger struct {
+	logrus.FieldLogger
+}
+
+func (l logrusLogger) WithFields(fields Fields) Entry {
+	return logrusEntry{l.FieldLogger.WithFields(logrus.Fields(fields))}
+}
+
+// logrusBase returns the logrus logger behind the adapter, if any
+func (l logrusLogger) logrusBase() *logrus.Logger {
+	switch lg := l.FieldLogger.(type) {
+	case *logrus.Logger:
+		return lg
+	case *logrus.Entry:
+		return lg.Logger
+	}
+	return nil
+}
+
+func (l logrusLogger) GetLevel() Level {
+	if lg := l.logrusBase(); lg != nil {
+		return Level(lg.GetLevel())
+	}
+	return DebugLevel
+}
+
+func (l logrusLogger) SetLevel(level Level) {
+	if lg := l.logrusBase(); lg != nil {
+		lg.SetLevel(logrus.Level(level))
+	}
+}
+
+type logrusEntry struct {
+	*logrus.Entry
+}
+
+func (e logrusEntry) WithFields(fields Fields) Entry {
+	return logrusEntry{e.Entry.WithFields(logrus.Fields(fields))}
+}
+
+// LogFunc receives the entries of a logger built with NewFuncLogger
+type LogFunc func(level Level, msg string, fields Fields)
+
+// NewFuncLogger builds a Logger sending every entry to fn, so that any
+// logging library can be adapted implementing a single function.
+// Fatal entries exit the process and Panic entries panic after logging.
+// The returned logger implements LevelSetter, starting at DebugLevel.
+func NewFuncLogger(fn LogFunc) Logger {
+	level := uint32(DebugLevel)
+	return &funcLogger{fn: fn, level: &level}
+}
+
+type funcLogger struct {
+	fn     LogFunc
+	fields Fields
+	// Shared with the entries derived from the logger
+	level *uint32
+}
+
+func (l *funcLogger) GetLevel() Level {
+	return Level(atomic.LoadUint32(l.level))
+}
+
+func (l *funcLogger) SetLevel(level Level) {
+	atomic.StoreUint32(l.level, uint32(level))
+}
+
+func (l *funcLogger) log(level Level, msg string) {
+	if level <= l.GetLevel() {
+		l.fn(level, msg, l.fields)
+	}
+	switch level {
+	case FatalLevel:
+		os.Exit(1)
+	case PanicLevel:
+		panic(msg)
+	}
+}
+
+func sprint(args ...interface{}) string {
+	return fmt.Sprint(args...)
+}
+
+func sprintln(args ...interface{}) string {
+	return strings.TrimSuffix(fmt.Sprintln(args...), "\n")
+}
+
+func (l *funcLogger) WithFields(fields Fields) Entry {
+	merged := make(Fields, len(l.fields)+len(fields))
+	for k, v := range l.fields {
+		merged[k] = v
+	}
+	for k, v := range fields {
+		merged[k] = v
+	}
+	return &funcLogger{fn: l.fn, fields: merged, level: l.level}
+}
+
+func (l *funcLogger) Debug(args ...interface{}) { l.log(DebugLevel, sprint(args...)) }
+func (l *funcLogger) Debugf(format string, args ...interface{}) {
+	l.log(DebugLevel, fmt.Sprintf(format, args...))
+}
+func (l *funcLogger) Debugln(args ...interface{}) { l.log(DebugLevel, sprintln(args...)) }
+func (l *funcLogger) Info(args ...interface{})    { l.log(InfoLevel, sprint(args...)) }
+func (l *funcLogger) Infof(format string, args ...interface{}) {
+	l.log(InfoLevel, fmt.Sprintf(format, args...))
+}
+func (l *funcLogger) Infoln(args ...interface{}) { l.log(InfoLevel, sprintln(args...)) }
+func (l *funcLogger) Print(args ...interface{})  { l.log(InfoLevel, sprint(args...)) }
+func (l *funcLogger) Printf(format string, args ...interface{}) {
+	l.log(InfoLevel, fmt.Sprintf(format, args...))
+}
+func (l *funcLogger) Println(args ...interface{}) { l.log(InfoLevel, sprintln(args...)) }
+func (l *funcLogger) Warn(args ...interface{})    { l.log(WarnLevel, sprint(args...)) }
+func (l *funcLogger) Warnf(format string, args ...interface{}) {
+	l.log(WarnLevel, fmt.Sprintf(format, args...))
+}
+func (l *funcLogger) Warnln(args ...interface{})  { l.log(WarnLevel, sprintln(args...)) }
+func (l *funcLogger) Warning(args ...interface{}) { l.log(WarnLevel, sprint(args...)) }
+func (l *funcLogger) Warningf(format string, args ...interface{}) {
+	l.log(WarnLevel, fmt.Sprintf(format, args...))
+}
+func (l *funcLogger) Warningln(args ...interface{}) { l.log(WarnLevel, sprintln(args...)) }
+func (l *funcLogger) Error(args ...interface{})     { l.log(ErrorLevel, sprint(args...)) }
+func (l *funcLogger) Errorf(format string, args ...interface{}) {
+	l.log(ErrorLevel, fmt.Sprintf(format, args...))
+}
+func (l *funcLogger) Errorln(args ...interface{}) { l.log(ErrorLevel, sprintln(args...)) }
+func (l *funcLogger) Fatal(args ...interface{})   { l.log(FatalLevel, sprint(args...)) }
+func (l *funcLogger) Fatalf(format string, args ...interface{}) {
+	l.log(FatalLevel, fmt.Sprintf(format, args...))
+}
+func (l *funcLogger) Fatalln(args ...interface{}) { l.log(FatalLevel, sprintln(args...)) }
+func (l *funcLogger) Panic(args ...interface{})   { l.log(PanicLevel, sprint(args...)) }
+func (l *funcLogger) Panicf(format string, args ...interface{}) {
+	l.log(PanicLevel, fmt.Sprintf(format, args...))
+}
+func (l *funcLogger) Panicln(args ...interface{}) { l.log(PanicLevel, sprintln(args...)) }
+
+// HookLogger returns a logger writing to lg and calling hook, before
+// writing, with the entries at level or more severe, e.g. FatalLevel to
+// alert on the fatal and panic entries before the process stops
+func HookLogger(lg Logger, level Level, hook LogFunc) Logger {
+	return NewFuncLogger(func(l Level, msg string, fields Fields) {
+		if l <= level {
+			hook(l, msg, fields)
+		}
+		e := lg.WithFields(fields)
+		switch l {
+		case DebugLevel:
+			e.Debug(msg)
+		case InfoLevel:
+			e.Info(msg)
+		case WarnLevel:
+			e.Warn(msg)
+		case ErrorLevel:
+			e.Error(msg)
+		case FatalLevel:
+			e.Fatal(msg)
+		case PanicLevel:
+			e.Panic(msg)
+		}
+	})
+}
+
+// SortedKeys returns the field names in alphabetical order, for adapters
+// needing a stable output
+func (f Fields) SortedKeys() []string {
+	keys := make([]string, 0, len(f))
+	for k := range f {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
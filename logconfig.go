@@ -0,0 +1,268 @@
+package hang
+
+import (
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"gitlab.com/brunetto/ritter"
+)
+
+// Rotation is the rotation policy of the log file
+type Rotation int
+
+const (
+	// NoRotation appends to a single file
+	NoRotation Rotation = iota
+	// DailyRotation rotates the file every day (via ritter)
+	DailyRotation
+)
+
+// LoggerOptions configures the logger created by NewLogger
+type LoggerOptions struct {
+	// Log file path, no file is written if empty (see Outputs)
+	Path string
+	// Rotation policy of the log file
+	Rotation Rotation
+	// Minimum level (debug, info, warn, error, fatal, panic), debug if empty
+	Level string
+	// Output format: "json" (default) or "text"
+	Format string
+	// Fields added to every entry
+	Fields Fields
+	// Write also to stderr (always true if there are no other outputs)
+	TeeToStderr bool
+	// Library backing the logger
+	Backend LoggerBackend
+	// Additional destinations, the entries are written to all of them
+	Outputs []LogOutput
+}
+
+// OutputType is the kind of a log output
+type OutputType string
+
+const (
+	// FileOutput writes to Path with the given Rotation
+	FileOutput OutputType = "file"
+	// StderrOutput writes to the standard error
+	StderrOutput OutputType = "stderr"
+	// StdoutOutput writes to the standard output
+	StdoutOutput OutputType = "stdout"
+	// SyslogOutput writes RFC 5424 messages to the local syslog or to Network/Address
+	SyslogOutput OutputType = "syslog"
+	// JournaldOutput writes to systemd-journald
+	JournaldOutput OutputType = "journald"
+	// RemoteOutput ships the entries, one per line, to Network/Address
+	RemoteOutput OutputType = "remote"
+	// WriterOutput writes to Writer
+	WriterOutput OutputType = "writer"
+)
+
+// LogOutput is a destination for the log entries
+type LogOutput struct {
+	Type OutputType
+	// File path and rotation for file outputs
+	Path     string
+	Rotation Rotation
+	// Network ("tcp", "udp", ...) and address for syslog and remote outputs,
+	// empty for the local syslog
+	Network string
+	Address string
+	// Syslog and journald identifier, the process name if empty
+	Tag string
+	// Syslog facility, FacilityDaemon if zero
+	Facility SyslogFacility
+	// Custom writer for writer outputs
+	Writer io.Writer
+}
+
+// NewLogger creates a logger configured by opts
+func NewLogger(opts LoggerOptions) (Logger, error) {
+	var (
+		out   io.Writer
+		sinks []levelWriter
+		level Level
+		err   error
+	)
+	level = DebugLevel
+	if opts.Level != "" {
+		level, err = ParseLevel(opts.Level)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if opts.Format != "" && opts.Format != "json" && opts.Format != "text" {
+		return nil, errors.New("unknown log format " + opts.Format)
+	}
+	out, sinks, err = logOutput(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.Backend == SlogBackend {
+		var (
+			handler    slog.Handler
+			lv         = new(slog.LevelVar)
+			hOpts      = &slog.HandlerOptions{Level: lv}
+			newHandler = func(w io.Writer) slog.Handler { return slog.NewJSONHandler(w, hOpts) }
+		)
+		if opts.Format == "text" {
+			newHandler = func(w io.Writer) slog.Handler { return slog.NewTextHandler(w, hOpts) }
+		}
+		handler = newHandler(out)
+		if len(sinks) > 0 {
+			mh := multiHandler{handler}
+			for _, sink := range sinks {
+				mh = append(mh, newSinkHandler(sink, newHandler))
+			}
+			handler = mh
+		}
+		sl := slog.New(handler)
+		for _, k := range opts.Fields.SortedKeys() {
+			sl = sl.With(k, opts.Fields[k])
+		}
+		lg := &slogLevelLogger{Logger: NewSlogLogger(sl), level: lv}
+		lg.SetLevel(level)
+		return lg, nil
+	}
+
+	lr := &logrus.Logger{
+		Out:   out,
+		Hooks: make(logrus.LevelHooks),
+		Level: logrus.Level(level),
+	}
+	if opts.Format == "text" {
+		lr.Formatter = &logrus.TextFormatter{FullTimestamp: true}
+	} else {
+		lr.Formatter = new(logrus.JSONFormatter)
+	}
+	if len(sinks) > 0 {
+		lr.AddHook(&levelHook{sinks: sinks})
+	}
+	if len(opts.Fields) > 0 {
+		return NewLogrusLogger(lr.WithFields(logrus.Fields(opts.Fields))), nil
+	}
+	return NewLogrusLogger(lr), nil
+}
+
+// logOutput opens the writers for the log entries, fanning them out, and
+// the destinations needing the entry level (syslog, journald)
+func logOutput(opts LoggerOptions) (io.Writer, []levelWriter, error) {
+	var (
+		outputs []LogOutput
+		writers []io.Writer
+		sinks   []levelWriter
+	)
+	if opts.Path != "" {
+		outputs = append(outputs, LogOutput{Type: FileOutput, Path: opts.Path, Rotation: opts.Rotation})
+	}
+	if opts.TeeToStderr || (opts.Path == "" && len(opts.Outputs) == 0) {
+		outputs = append(outputs, LogOutput{Type: StderrOutput})
+	}
+	outputs = append(outputs, opts.Outputs...)
+
+	for _, o := range outputs {
+		switch o.Type {
+		case SyslogOutput:
+			sinks = append(sinks, newSyslogWriter(o.Network, o.Address, o.Facility, o.Tag))
+			continue
+		case JournaldOutput:
+			sinks = append(sinks, newJournaldWriter(o.Tag))
+			continue
+		}
+		w, err := o.open()
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "can't open "+string(o.Type)+" log output")
+		}
+		writers = append(writers, w)
+	}
+	switch len(writers) {
+	case 0:
+		return io.Discard, sinks, nil
+	case 1:
+		return writers[0], sinks, nil
+	}
+	return fanOut(writers), sinks, nil
+}
+
+// open creates the writer for the output
+func (o LogOutput) open() (io.Writer, error) {
+	switch o.Type {
+	case FileOutput:
+		return openLogFile(o.Path, o.Rotation)
+	case StderrOutput:
+		return os.Stderr, nil
+	case StdoutOutput:
+		return os.Stdout, nil
+	case RemoteOutput:
+		if o.Network == "" || o.Address == "" {
+			return nil, errors.New("remote output needs network and address")
+		}
+		return newRemoteWriter(o.Network, o.Address), nil
+	case WriterOutput:
+		if o.Writer == nil {
+			return nil, errors.New("writer output needs a writer")
+		}
+		return o.Writer, nil
+	}
+	return nil, errors.New("unknown output type")
+}
+
+func openLogFile(path string, rotation Rotation) (io.Writer, error) {
+	switch rotation {
+	case DailyRotation:
+		rotatedWriter, err := ritter.NewRitterTime(path)
+		if err != nil {
+			return nil, errors.Wrap(err, "can't create log file")
+		}
+		return rotatedWriter, nil
+	case NoRotation:
+		if dir := filepath.Dir(path); dir != "." {
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				return nil, errors.Wrap(err, "can't create log folder")
+			}
+		}
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return nil, errors.Wrap(err, "can't create log file")
+		}
+		return f, nil
+	}
+	return nil, errors.New("unknown rotation policy")
+}
+
+// fanOut writes to all the writers even if some of them fail,
+// returning the first error
+type fanOut []io.Writer
+
+func (f fanOut) Write(p []byte) (int, error) {
+	var err error
+	for _, w := range f {
+		if _, e := w.Write(p); e != nil && err == nil {
+			err = e
+		}
+	}
+	return len(p), err
+}
+
+// remoteWriter ships the log lines to a network address, in the
+// background (see shipper)
+type remoteWriter struct {
+	*shipper
+}
+
+func newRemoteWriter(network, address string) *remoteWriter {
+	return &remoteWriter{newShipper(func() (net.Conn, error) {
+		return net.DialTimeout(network, address, 5*time.Second)
+	})}
+}
+
+func (w *remoteWriter) Write(p []byte) (int, error) {
+	w.send(p)
+	return len(p), nil
+}
@@ -0,0 +1,30 @@
+package hang
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestLoggerSetLevel(t *testing.T) {
+	for _, backend := range []LoggerBackend{LogrusBackend, SlogBackend} {
+		var buf bytes.Buffer
+		lg, err := NewLogger(LoggerOptions{
+			Level:   "info",
+			Backend: backend,
+			Outputs: []LogOutput{{Type: WriterOutput, Writer: &buf}},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		lg.Debug("hidden")
+		lg.(LevelSetter).SetLevel(DebugLevel)
+		if got := lg.(LevelSetter).GetLevel(); got != DebugLevel {
+			t.Errorf("backend %v: level %v, want debug", backend, got)
+		}
+		lg.Debug("shown")
+		if out := buf.String(); strings.Contains(out, "hidden") || !strings.Contains(out, "shown") {
+			t.Errorf("backend %v: output %q", backend, out)
+		}
+	}
+}
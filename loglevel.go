@@ -0,0 +1,91 @@
+package hang
+
+import (
+	"net/http"
+
+	"github.com/pkg/errors"
+)
+
+// LogLevel returns the current level of the handler logger
+func (h *Handler) LogLevel() (Level, error) {
+	ls, ok := h.Log.(LevelSetter)
+	if !ok {
+		return DebugLevel, errors.New("logger does not support reading the level")
+	}
+	return ls.GetLevel(), nil
+}
+
+// logEnabled tells whether the handler logger writes the entries at level,
+// to skip building the fields of the others
+func (h *Handler) logEnabled(level Level) bool {
+	lvl, err := h.LogLevel()
+	return err != nil || level <= lvl
+}
+
+// SetLogLevel changes the level of the handler logger at runtime
+func (h *Handler) SetLogLevel(level string) error {
+	var (
+		lvl Level
+		err error
+	)
+	ls, ok := h.Log.(LevelSetter)
+	if !ok {
+		return errors.New("logger does not support changing the level")
+	}
+	lvl, err = ParseLevel(level)
+	if err != nil {
+		return err
+	}
+	ls.SetLevel(lvl)
+	h.Log.Infof("%v: log level set to %v", h.ProcessName, lvl)
+	return nil
+}
+
+// EnableLogLevelEndpoint registers the loglevel endpoint (on the admin
+// listener, if enabled) protected by token, which can be empty only with
+// the admin listener
+func (h *Handler) EnableLogLevelEndpoint(token string) error {
+	if err := h.checkControlToken("loglevel", token); err != nil {
+		return err
+	}
+	return h.ops().AddRoute("loglevel", RequireToken(token, DebugTokenHeader, h.LogLevelEndpoint))
+}
+
+// LogLevelEndpoint returns the current log level on GET and sets it on PUT,
+// reading it from the level query parameter or from a {"level": "debug"} body
+func (h *Handler) LogLevelEndpoint(resp http.ResponseWriter, req *http.Request) error {
+	var (
+		data struct {
+			Level string `json:"level"`
+		}
+		lvl Level
+		err error
+	)
+	switch req.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		data.Level = req.URL.Query().Get("level")
+		if data.Level == "" {
+			err = GetReqJSONData(resp, req, &data)
+			if err != nil {
+				return err
+			}
+		}
+		err = h.SetLogLevel(data.Level)
+		if err != nil {
+			WriteError(resp, req, http.StatusBadRequest, err)
+			return err
+		}
+	default:
+		resp.Header().Set("Allow", "GET, PUT")
+		err = errors.New("method " + req.Method + " not allowed")
+		WriteError(resp, req, http.StatusMethodNotAllowed, err)
+		return err
+	}
+	lvl, err = h.LogLevel()
+	if err != nil {
+		WriteError(resp, req, http.StatusNotImplemented, err)
+		return err
+	}
+	return WriteJSON(resp, http.StatusOK, map[string]string{"level": lvl.String()})
+}
@@ -0,0 +1,362 @@
+package hang
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"expvar"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// SyslogFacility is a syslog facility code
+type SyslogFacility int
+
+// Syslog facilities
+const (
+	FacilityUser   SyslogFacility = 1
+	FacilityDaemon SyslogFacility = 3
+	FacilityLocal0 SyslogFacility = 16
+	FacilityLocal1 SyslogFacility = 17
+	FacilityLocal2 SyslogFacility = 18
+	FacilityLocal3 SyslogFacility = 19
+	FacilityLocal4 SyslogFacility = 20
+	FacilityLocal5 SyslogFacility = 21
+	FacilityLocal6 SyslogFacility = 22
+	FacilityLocal7 SyslogFacility = 23
+)
+
+// levelWriter is a log destination needing the level of every entry
+type levelWriter interface {
+	WriteLevel(level Level, p []byte) error
+}
+
+// ShipperQueueSize is the number of entries the network log outputs
+// (remote, syslog) keep while the destination is slow or unreachable;
+// further entries are dropped
+var ShipperQueueSize = 4096
+
+// shipper writes the entries to a network connection from a goroutine, so
+// that logging never waits for the network: the entries are queued,
+// reconnecting with backoff when the connection is lost, and dropped when
+// the queue is full. Entries still queued when the process exits are lost.
+type shipper struct {
+	dial  func() (net.Conn, error)
+	queue chan []byte
+	start sync.Once
+}
+
+// droppedLogEntries counts the entries dropped by all the shippers
+var droppedLogEntries uint64
+
+// DroppedLogEntries returns the number of entries the network log outputs
+// (remote, syslog) dropped because their queue was full. It is also
+// published as the log_dropped_entries expvar.
+func DroppedLogEntries() uint64 {
+	return atomic.LoadUint64(&droppedLogEntries)
+}
+
+func newShipper(dial func() (net.Conn, error)) *shipper {
+	// Publishing twice the same name panics
+	if expvar.Get("log_dropped_entries") == nil {
+		expvar.Publish("log_dropped_entries", expvar.Func(func() interface{} { return DroppedLogEntries() }))
+	}
+	return &shipper{dial: dial, queue: make(chan []byte, ShipperQueueSize)}
+}
+
+// send queues a copy of p, dropping it if the queue is full
+func (s *shipper) send(p []byte) {
+	s.start.Do(func() { go s.run() })
+	select {
+	case s.queue <- append([]byte(nil), p...):
+	default:
+		atomic.AddUint64(&droppedLogEntries, 1)
+	}
+}
+
+// run writes the queued entries
+func (s *shipper) run() {
+	var (
+		conn    net.Conn
+		backoff time.Duration
+	)
+	for msg := range s.queue {
+		// One retry on a fresh connection
+		for attempt := 0; attempt < 2; attempt++ {
+			for conn == nil {
+				c, err := s.dial()
+				if err == nil {
+					conn, backoff = c, 0
+					break
+				}
+				if backoff < time.Second {
+					backoff = time.Second
+				} else if backoff < 30*time.Second {
+					backoff *= 2
+				}
+				time.Sleep(backoff)
+			}
+			conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
+			if _, err := conn.Write(msg); err == nil {
+				break
+			}
+			conn.Close()
+			conn = nil
+		}
+	}
+}
+
+// SyslogSeverity maps a level on the syslog severity (0 emerg ... 7 debug)
+func SyslogSeverity(level Level) int {
+	switch level {
+	case PanicLevel, FatalLevel:
+		return 2 // crit
+	case ErrorLevel:
+		return 3 // err
+	case WarnLevel:
+		return 4 // warning
+	case InfoLevel:
+		return 6 // info
+	default:
+		return 7 // debug
+	}
+}
+
+// syslogWriter writes RFC 5424 messages to the local syslog socket or to a
+// remote collector (udp, or tcp with octet counting framing)
+type syslogWriter struct {
+	network  string
+	address  string
+	facility SyslogFacility
+	tag      string
+	hostname string
+	*shipper
+}
+
+func newSyslogWriter(network, address string, facility SyslogFacility, tag string) *syslogWriter {
+	if facility == 0 {
+		facility = FacilityDaemon
+	}
+	if tag == "" {
+		tag = filepath.Base(os.Args[0])
+	}
+	hostname, _ := os.Hostname()
+	if hostname == "" {
+		hostname = "-"
+	}
+	w := &syslogWriter{network: network, address: address, facility: facility, tag: tag, hostname: hostname}
+	w.shipper = newShipper(w.dial)
+	return w
+}
+
+func (w *syslogWriter) dial() (net.Conn, error) {
+	if w.address != "" {
+		return net.DialTimeout(w.network, w.address, 5*time.Second)
+	}
+	// Local syslog
+	var err error
+	for _, path := range []string{"/dev/log", "/var/run/syslog", "/var/run/log"} {
+		for _, network := range []string{"unixgram", "unix"} {
+			var conn net.Conn
+			conn, err = net.Dial(network, path)
+			if err == nil {
+				return conn, nil
+			}
+		}
+	}
+	return nil, errors.Wrap(err, "can't connect to local syslog")
+}
+
+func (w *syslogWriter) WriteLevel(level Level, p []byte) error {
+	msg := fmt.Sprintf("<%d>1 %s %s %s %d - - %s",
+		int(w.facility)*8+SyslogSeverity(level),
+		time.Now().Format(time.RFC3339Nano),
+		w.hostname, w.tag, os.Getpid(),
+		bytes.TrimRight(p, "\n"))
+	if w.network == "tcp" || w.network == "tcp4" || w.network == "tcp6" {
+		// RFC 6587 octet counting
+		msg = strconv.Itoa(len(msg)) + " " + msg
+	}
+	w.send([]byte(msg))
+	return nil
+}
+
+// journaldWriter sends entries to systemd-journald using its native protocol
+type journaldWriter struct {
+	tag  string
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+// JournaldSocket is the path of the journald native protocol socket
+var JournaldSocket = "/run/systemd/journal/socket"
+
+func newJournaldWriter(tag string) *journaldWriter {
+	if tag == "" {
+		tag = filepath.Base(os.Args[0])
+	}
+	return &journaldWriter{tag: tag}
+}
+
+func (w *journaldWriter) WriteLevel(level Level, p []byte) error {
+	var b bytes.Buffer
+	b.WriteString("PRIORITY=" + strconv.Itoa(SyslogSeverity(level)) + "\n")
+	b.WriteString("SYSLOG_IDENTIFIER=" + w.tag + "\n")
+	b.WriteString("SYSLOG_PID=" + strconv.Itoa(os.Getpid()) + "\n")
+	// Binary safe field: name, newline, little endian length, value, newline
+	msg := bytes.TrimRight(p, "\n")
+	b.WriteString("MESSAGE\n")
+	binary.Write(&b, binary.LittleEndian, uint64(len(msg)))
+	b.Write(msg)
+	b.WriteString("\n")
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.conn == nil {
+		conn, err := net.Dial("unixgram", JournaldSocket)
+		if err != nil {
+			return errors.Wrap(err, "can't connect to journald")
+		}
+		w.conn = conn
+	}
+	_, err := w.conn.Write(b.Bytes())
+	if err != nil {
+		w.conn.Close()
+		w.conn = nil
+		return errors.Wrap(err, "can't write to journald")
+	}
+	return nil
+}
+
+// levelHook sends the logrus entries to the leveled destinations
+type levelHook struct {
+	sinks []levelWriter
+}
+
+func (hk *levelHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (hk *levelHook) Fire(entry *logrus.Entry) error {
+	var err error
+	b, e := entry.Bytes()
+	if e != nil {
+		return e
+	}
+	level := Level(entry.Level)
+	if level > DebugLevel {
+		level = DebugLevel
+	}
+	for _, s := range hk.sinks {
+		if e := s.WriteLevel(level, b); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// slogLevel maps a slog level back on the hang levels
+func slogLevel(level slog.Level) Level {
+	switch {
+	case level >= SlogLevelPanic:
+		return PanicLevel
+	case level >= SlogLevelFatal:
+		return FatalLevel
+	case level >= slog.LevelError:
+		return ErrorLevel
+	case level >= slog.LevelWarn:
+		return WarnLevel
+	case level >= slog.LevelInfo:
+		return InfoLevel
+	}
+	return DebugLevel
+}
+
+// sinkHandler formats slog records for a leveled destination
+type sinkHandler struct {
+	slog.Handler
+	out *sinkWriter
+}
+
+// sinkWriter passes the level of the record being formatted to the sink
+type sinkWriter struct {
+	mu    sync.Mutex
+	sink  levelWriter
+	level Level
+}
+
+func (w *sinkWriter) Write(p []byte) (int, error) {
+	return len(p), w.sink.WriteLevel(w.level, p)
+}
+
+func newSinkHandler(sink levelWriter, newHandler func(io.Writer) slog.Handler) *sinkHandler {
+	out := &sinkWriter{sink: sink}
+	return &sinkHandler{Handler: newHandler(out), out: out}
+}
+
+func (h *sinkHandler) Handle(ctx context.Context, r slog.Record) error {
+	h.out.mu.Lock()
+	defer h.out.mu.Unlock()
+	h.out.level = slogLevel(r.Level)
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h *sinkHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &sinkHandler{Handler: h.Handler.WithAttrs(attrs), out: h.out}
+}
+
+func (h *sinkHandler) WithGroup(name string) slog.Handler {
+	return &sinkHandler{Handler: h.Handler.WithGroup(name), out: h.out}
+}
+
+// multiHandler sends the slog records to several handlers
+type multiHandler []slog.Handler
+
+func (m multiHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	for _, h := range m {
+		if h.Enabled(ctx, level) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m multiHandler) Handle(ctx context.Context, r slog.Record) error {
+	var err error
+	for _, h := range m {
+		if !h.Enabled(ctx, r.Level) {
+			continue
+		}
+		if e := h.Handle(ctx, r.Clone()); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+func (m multiHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	hs := make(multiHandler, len(m))
+	for i, h := range m {
+		hs[i] = h.WithAttrs(attrs)
+	}
+	return hs
+}
+
+func (m multiHandler) WithGroup(name string) slog.Handler {
+	hs := make(multiHandler, len(m))
+	for i, h := range m {
+		hs[i] = h.WithGroup(name)
+	}
+	return hs
+}
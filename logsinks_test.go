@@ -0,0 +1,129 @@
+package hang
+
+import (
+	"bufio"
+	"expvar"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRemoteWriterDoesNotBlock(t *testing.T) {
+	// A shipper accepting the connection and never reading
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		conn, err := ln.Accept()
+		if err == nil {
+			defer conn.Close()
+			time.Sleep(5 * time.Second)
+		}
+	}()
+	w := newRemoteWriter("tcp", ln.Addr().String())
+	line := []byte(strings.Repeat("x", 8<<10) + "\n")
+	dropped := DroppedLogEntries()
+	start := time.Now()
+	for i := 0; i < 2*ShipperQueueSize; i++ {
+		w.Write(line)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("writes blocked for %v", d)
+	}
+	if DroppedLogEntries() == dropped {
+		t.Error("no entry dropped with the queue full")
+	}
+	if v := expvar.Get("log_dropped_entries"); v == nil || v.String() == "0" {
+		t.Errorf("dropped entries not published, got %v", v)
+	}
+}
+
+func TestRemoteWriterReconnects(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	lines := make(chan string, 10)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			// Read one line per connection, then drop it
+			line, _ := bufio.NewReader(conn).ReadString('\n')
+			lines <- line
+			conn.Close()
+		}
+	}()
+	w := newRemoteWriter("tcp", ln.Addr().String())
+	w.Write([]byte("first\n"))
+	if got := <-lines; got != "first\n" {
+		t.Fatalf("got %q", got)
+	}
+	// Written on the closed connection or retried on a new one
+	deadline := time.After(5 * time.Second)
+	for {
+		w.Write([]byte("again\n"))
+		select {
+		case got := <-lines:
+			if got != "again\n" {
+				t.Fatalf("got %q", got)
+			}
+			return
+		case <-time.After(100 * time.Millisecond):
+		case <-deadline:
+			t.Fatal("not reconnected")
+		}
+	}
+}
+
+func TestSyslogWriter(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	msgs := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		// RFC 6587 octet counting
+		r := bufio.NewReader(conn)
+		var n int
+		if _, err := fmt.Fscanf(r, "%d ", &n); err != nil {
+			return
+		}
+		msg := make([]byte, n)
+		if _, err := io.ReadFull(r, msg); err == nil {
+			msgs <- string(msg)
+		}
+	}()
+
+	w := newSyslogWriter("tcp", ln.Addr().String(), 0, "app")
+	start := time.Now()
+	if err := w.WriteLevel(ErrorLevel, []byte("boom\n")); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d > 100*time.Millisecond {
+		t.Errorf("write blocked for %v", d)
+	}
+	select {
+	case msg := <-msgs:
+		// Facility daemon (3), severity err (3)
+		if !strings.HasPrefix(msg, "<27>") || !strings.Contains(msg, " app ") || !strings.Contains(msg, "boom") {
+			t.Errorf("got message %q", msg)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("message not received")
+	}
+}
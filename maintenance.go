@@ -0,0 +1,104 @@
+package hang
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// MaintenanceRetryAfter is the Retry-After sent while in maintenance mode
+var MaintenanceRetryAfter = 2 * time.Minute
+
+// maintenanceRoutes keep working in maintenance mode
+var maintenanceRoutes = map[string]bool{
+	"livecheck":   true,
+	"readycheck":  true,
+	"health/deep": true,
+	"version":     true,
+	"maintenance": true,
+}
+
+// maintenanceState is the maintenance mode of a Handler
+type maintenanceState struct {
+	mu      sync.RWMutex
+	on      bool
+	message string
+	since   time.Time
+}
+
+// SetMaintenanceMode turns the maintenance mode on or off. While on, all the
+// routes but the health ones respond 503 with message and Retry-After.
+func (h *Handler) SetMaintenanceMode(on bool, message string) {
+	h.maintenance.mu.Lock()
+	h.maintenance.on = on
+	h.maintenance.message = message
+	h.maintenance.since = time.Now()
+	h.maintenance.mu.Unlock()
+	h.Log.WithFields(Fields{"enabled": on, "message": message}).Warnf("%v: maintenance mode changed", h.ProcessName)
+}
+
+// MaintenanceMode returns whether the maintenance mode is on and its message
+func (h *Handler) MaintenanceMode() (bool, string) {
+	h.maintenance.mu.RLock()
+	defer h.maintenance.mu.RUnlock()
+	return h.maintenance.on, h.maintenance.message
+}
+
+// serveMaintenance responds 503 if in maintenance mode and path is not a
+// health route, reporting whether it did
+func (h *Handler) serveMaintenance(resp http.ResponseWriter, req *http.Request, path string) bool {
+	on, message := h.MaintenanceMode()
+	if !on || maintenanceRoutes[path] {
+		return false
+	}
+	if message == "" {
+		message = "service under maintenance"
+	}
+	resp.Header().Set("Retry-After", strconv.Itoa(int(MaintenanceRetryAfter.Seconds())))
+	WriteError(resp, req, http.StatusServiceUnavailable, errors.New(message))
+	return true
+}
+
+// EnableMaintenanceEndpoint registers the maintenance endpoint (on the admin
+// listener, if enabled) protected by token, which can be empty only with the
+// admin listener
+func (h *Handler) EnableMaintenanceEndpoint(token string) error {
+	if err := h.checkControlToken("maintenance", token); err != nil {
+		return err
+	}
+	return h.ops().AddRoute("maintenance", RequireToken(token, DebugTokenHeader, h.MaintenanceEndpoint))
+}
+
+// MaintenanceEndpoint returns the maintenance mode on GET and sets it on PUT
+// from a {"enabled": true, "message": "..."} body
+func (h *Handler) MaintenanceEndpoint(resp http.ResponseWriter, req *http.Request) error {
+	var (
+		data struct {
+			Enabled bool      `json:"enabled"`
+			Message string    `json:"message,omitempty"`
+			Since   time.Time `json:"since,omitempty"`
+		}
+		err error
+	)
+	switch req.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		err = GetReqJSONData(resp, req, &data)
+		if err != nil {
+			return err
+		}
+		h.SetMaintenanceMode(data.Enabled, data.Message)
+	default:
+		resp.Header().Set("Allow", "GET, PUT")
+		err = errors.New("method " + req.Method + " not allowed")
+		WriteError(resp, req, http.StatusMethodNotAllowed, err)
+		return err
+	}
+	h.maintenance.mu.RLock()
+	data.Enabled, data.Message, data.Since = h.maintenance.on, h.maintenance.message, h.maintenance.since
+	h.maintenance.mu.RUnlock()
+	return WriteJSON(resp, http.StatusOK, data)
+}
@@ -0,0 +1,89 @@
+package hang
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// AddMethodRoute registers a handler for requests to route with the given
+// method. HEAD requests are answered by the GET handler, discarding the
+// body, OPTIONS requests with the Allow header listing the methods of the
+// route and the other methods with a 405. Routes registered with AddRoute
+// accept any method instead.
+func (h *Handler) AddMethodRoute(method, route string, handleFunc HandleFunc) error {
+	method = strings.ToUpper(method)
+	handlers, exists := h.methodRoutes[route]
+	if !exists {
+		if err := h.AddRoute(route, h.dispatchMethod(route)); err != nil {
+			return err
+		}
+		if h.methodRoutes == nil {
+			h.methodRoutes = map[string]map[string]HandleFunc{}
+		}
+		handlers = map[string]HandleFunc{}
+		h.methodRoutes[route] = handlers
+	}
+	if _, exists = handlers[method]; exists {
+		return errors.New("Route " + method + " " + route + " already exists.")
+	}
+	handlers[method] = handleFunc
+	return nil
+}
+
+// dispatchMethod returns the handler of route calling the handler of the
+// request method
+func (h *Handler) dispatchMethod(route string) HandleFunc {
+	return func(resp http.ResponseWriter, req *http.Request) error {
+		handlers := h.methodRoutes[route]
+		if fn := handlers[req.Method]; fn != nil {
+			return fn(resp, req)
+		}
+		if fn := handlers[http.MethodGet]; fn != nil && req.Method == http.MethodHead {
+			return fn(&headWriter{ResponseWriter: resp}, req)
+		}
+		resp.Header().Set("Allow", strings.Join(allowedMethods(handlers), ", "))
+		if req.Method == http.MethodOptions {
+			resp.WriteHeader(http.StatusNoContent)
+			return nil
+		}
+		err := errors.New("method " + req.Method + " not allowed")
+		WriteError(resp, req, http.StatusMethodNotAllowed, err)
+		return err
+	}
+}
+
+// allowedMethods returns the methods answered by a route with handlers,
+// sorted
+func allowedMethods(handlers map[string]HandleFunc) []string {
+	methods := make([]string, 0, len(handlers)+2)
+	for m := range handlers {
+		methods = append(methods, m)
+	}
+	if _, ok := handlers[http.MethodGet]; ok {
+		if _, ok = handlers[http.MethodHead]; !ok {
+			methods = append(methods, http.MethodHead)
+		}
+	}
+	if _, ok := handlers[http.MethodOptions]; !ok {
+		methods = append(methods, http.MethodOptions)
+	}
+	sort.Strings(methods)
+	return methods
+}
+
+// headWriter discards the body written by a GET handler answering a HEAD
+type headWriter struct {
+	http.ResponseWriter
+}
+
+func (w *headWriter) Write(b []byte) (int, error) {
+	return len(b), nil
+}
+
+// Unwrap returns the wrapped writer, for http.ResponseController
+func (w *headWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,145 @@
+package hang
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"net/http"
+	"regexp"
+
+	"github.com/pkg/errors"
+)
+
+// Middleware wraps a HandleFunc adding behaviour before and/or after it
+type Middleware func(HandleFunc) HandleFunc
+
+// Use registers middleware applied to every route, including the default
+// one. The first registered middleware is the outermost.
+func (h *Handler) Use(mw ...Middleware) {
+	h.Middleware = append(h.Middleware, mw...)
+}
+
+// UseForRoute registers middleware applied only to route, inside the global ones
+func (h *Handler) UseForRoute(route string, mw ...Middleware) error {
+	if _, exists := h.Routes[route]; !exists {
+		return errors.New("Route " + route + " does not exists.")
+	}
+	if h.RouteMiddleware == nil {
+		h.RouteMiddleware = map[string][]Middleware{}
+	}
+	h.RouteMiddleware[route] = append(h.RouteMiddleware[route], mw...)
+	return nil
+}
+
+// wrap applies the route and global middleware to handler
+func (h *Handler) wrap(route string, handler HandleFunc) HandleFunc {
+	rmw := h.RouteMiddleware[route]
+	for i := len(rmw) - 1; i >= 0; i-- {
+		handler = rmw[i](handler)
+	}
+	for i := len(h.Middleware) - 1; i >= 0; i-- {
+		handler = h.Middleware[i](handler)
+	}
+	return handler
+}
+
+// middlewareNames returns the names of the middleware applied to route
+func (h *Handler) middlewareNames(route string) []string {
+	names := []string{}
+	for _, mw := range h.Middleware {
+		names = append(names, middlewareName(mw))
+	}
+	for _, mw := range h.RouteMiddleware[route] {
+		names = append(names, middlewareName(mw))
+	}
+	return names
+}
+
+var closureSuffix = regexp.MustCompile(`(\.func\d+)+$`)
+
+// middlewareName returns the name of the function building the middleware
+func middlewareName(mw Middleware) string {
+	return closureSuffix.ReplaceAllString(funcName(mw), "")
+}
+
+// withRoute stores the matched route in the request context
+func withRoute(req *http.Request, route string) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), routeKey, route))
+}
+
+// RouteFrom returns the route matched by the Handler for the request
+func RouteFrom(req *http.Request) string {
+	if route, ok := req.Context().Value(routeKey).(string); ok {
+		return route
+	}
+	if info := getRequestInfo(req); info != nil {
+		return info.route
+	}
+	return ""
+}
+
+// ResponseRecorder wraps a ResponseWriter recording status and size of the
+// response, for middleware
+type ResponseRecorder struct {
+	http.ResponseWriter
+	// Status code written, 200 if WriteHeader was not called
+	Status int
+	// Bytes of body written
+	Bytes int64
+	// Whether the header has been written
+	WroteHeader bool
+	// Whether the connection has been hijacked
+	Hijacked bool
+}
+
+// NewResponseRecorder wraps resp, returning it unchanged if already a recorder
+func NewResponseRecorder(resp http.ResponseWriter) *ResponseRecorder {
+	if rr, ok := resp.(*ResponseRecorder); ok {
+		return rr
+	}
+	return &ResponseRecorder{ResponseWriter: resp, Status: http.StatusOK}
+}
+
+// WriteHeader records the status code
+func (rr *ResponseRecorder) WriteHeader(status int) {
+	if rr.WroteHeader {
+		return
+	}
+	rr.Status = status
+	rr.WroteHeader = true
+	rr.ResponseWriter.WriteHeader(status)
+}
+
+// Write records the bytes written
+func (rr *ResponseRecorder) Write(b []byte) (int, error) {
+	rr.WroteHeader = true
+	n, err := rr.ResponseWriter.Write(b)
+	rr.Bytes += int64(n)
+	return n, err
+}
+
+// Flush implements http.Flusher if the wrapped writer does
+func (rr *ResponseRecorder) Flush() {
+	if f, ok := rr.ResponseWriter.(http.Flusher); ok {
+		rr.WroteHeader = true
+		f.Flush()
+	}
+}
+
+// Hijack implements http.Hijacker if the wrapped writer does
+func (rr *ResponseRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hj, ok := rr.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response writer does not support hijacking")
+	}
+	conn, rw, err := hj.Hijack()
+	if err == nil {
+		rr.Hijacked = true
+	}
+	return conn, rw, err
+}
+
+// Unwrap returns the wrapped writer, for http.ResponseController
+func (rr *ResponseRecorder) Unwrap() http.ResponseWriter {
+	return rr.ResponseWriter
+}
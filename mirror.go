@@ -0,0 +1,136 @@
+package hang
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// MirroredHeader marks the requests sent to the shadow target
+const MirroredHeader = "X-Mirrored-Request"
+
+// MirrorOptions configures the traffic mirroring
+type MirrorOptions struct {
+	// Shadow target, e.g. http://new-version:8080
+	Target string
+	// Percentage of the requests mirrored, 100 if zero
+	Percentage float64
+	// Requests with larger bodies are not mirrored, 1MB if zero
+	MaxBodySize int64
+	// Timeout of the shadow requests, 5s if zero
+	Timeout time.Duration
+	// Shadow requests in flight, further ones are dropped; 10 if zero
+	MaxInFlight int
+	// Client sending the shadow requests, http.DefaultClient if nil
+	Client *http.Client
+}
+
+// Mirror returns a middleware sending asynchronously a copy (method, path,
+// query, headers and body) of a percentage of the requests to the shadow
+// target. The shadow responses are discarded and never affect the primary
+// one; failures are logged at debug level.
+func (h *Handler) Mirror(opts MirrorOptions) (Middleware, error) {
+	target, err := url.Parse(opts.Target)
+	if err != nil || target.Scheme == "" || target.Host == "" {
+		return nil, errors.New("invalid mirror target " + opts.Target)
+	}
+	if opts.Percentage <= 0 {
+		opts.Percentage = 100
+	}
+	if opts.MaxBodySize <= 0 {
+		opts.MaxBodySize = 1 << 20
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 5 * time.Second
+	}
+	if opts.MaxInFlight <= 0 {
+		opts.MaxInFlight = 10
+	}
+	if opts.Client == nil {
+		opts.Client = http.DefaultClient
+	}
+	slots := make(chan struct{}, opts.MaxInFlight)
+	return func(next HandleFunc) HandleFunc {
+		return func(resp http.ResponseWriter, req *http.Request) error {
+			if opts.Percentage < 100 && rand.Float64()*100 >= opts.Percentage {
+				return next(resp, req)
+			}
+			// Read the body once for both the requests
+			var body []byte
+			if req.Body != nil && req.Body != http.NoBody {
+				buf, err := ioutil.ReadAll(io.LimitReader(req.Body, opts.MaxBodySize+1))
+				if err != nil {
+					return errors.Wrap(err, "can't read request body")
+				}
+				req.Body = struct {
+					io.Reader
+					io.Closer
+				}{io.MultiReader(bytes.NewReader(buf), req.Body), req.Body}
+				if int64(len(buf)) > opts.MaxBodySize {
+					return next(resp, req)
+				}
+				body = buf
+			}
+			select {
+			case slots <- struct{}{}:
+				shadow := mirrorRequest(req, target, body)
+				go func() {
+					defer func() { <-slots }()
+					h.sendMirror(opts, shadow)
+				}()
+			default:
+				h.Log.WithFields(Fields{"route": RouteFrom(req), "target": target.Host}).Debug("mirror request dropped, too many in flight")
+			}
+			return next(resp, req)
+		}
+	}, nil
+}
+
+// mirrorRequest returns the copy of req for target, detached from its context
+func mirrorRequest(req *http.Request, target *url.URL, body []byte) *http.Request {
+	u := *target
+	u.Path = strings.TrimSuffix(target.Path, "/") + req.URL.Path
+	u.RawPath = ""
+	u.RawQuery = req.URL.RawQuery
+	shadow := &http.Request{
+		Method:        req.Method,
+		URL:           &u,
+		Header:        req.Header.Clone(),
+		Host:          u.Host,
+		ContentLength: int64(len(body)),
+	}
+	if body != nil {
+		shadow.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+	shadow.Header.Set(MirroredHeader, "true")
+	if id := GetRequestID(req); id != "" {
+		shadow.Header.Set(RequestIDHeader, id)
+	}
+	// Carry the route for logging
+	return withRoute(shadow, RouteFrom(req))
+}
+
+// sendMirror sends the shadow request, discarding the response
+func (h *Handler) sendMirror(opts MirrorOptions, shadow *http.Request) {
+	ctx, cancel := context.WithTimeout(shadow.Context(), opts.Timeout)
+	defer cancel()
+	start := time.Now()
+	resp, err := opts.Client.Do(shadow.WithContext(ctx))
+	fields := Fields{"route": RouteFrom(shadow), "method": shadow.Method, "target": shadow.URL.Host, "latency_ms": float64(time.Since(start).Microseconds()) / 1000}
+	if err != nil {
+		h.Log.WithFields(fields).Debug(errors.Wrap(err, "mirror request failed"))
+		return
+	}
+	io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+	fields["status"] = resp.StatusCode
+	h.Log.WithFields(fields).Debug("mirror request sent")
+}
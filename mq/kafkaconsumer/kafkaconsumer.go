@@ -0,0 +1,122 @@
+// Package kafkaconsumer is an mq.Consumer for Kafka consumer groups
+package kafkaconsumer
+
+import (
+	"context"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/brunetto/hang"
+	"github.com/brunetto/hang/mq"
+	"github.com/pkg/errors"
+	"github.com/segmentio/kafka-go"
+)
+
+// Options configures the consumer, zero values meaning the defaults
+type Options struct {
+	Brokers []string
+	Topic   string
+	GroupID string
+	// Time given to the message in progress at shutdown, 30s by default
+	DrainTimeout time.Duration
+	// Attempts per message before skipping it, 3 by default
+	MaxAttempts int
+	// Wait between the attempts, 1s by default
+	RetryDelay time.Duration
+	// Reader settings, the kafka-go defaults are used for the unset ones
+	Reader kafka.ReaderConfig
+}
+
+// Consumer consumes a topic as member of a consumer group, committing the
+// offsets of the processed messages
+type Consumer struct {
+	Log       hang.Logger
+	opts      Options
+	reader    *kafka.Reader
+	connected int32
+}
+
+// New returns a consumer, fetching on Consume
+func New(lg hang.Logger, opts Options) *Consumer {
+	if opts.DrainTimeout <= 0 {
+		opts.DrainTimeout = 30 * time.Second
+	}
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = 3
+	}
+	if opts.RetryDelay <= 0 {
+		opts.RetryDelay = time.Second
+	}
+	cfg := opts.Reader
+	cfg.Brokers = opts.Brokers
+	cfg.Topic = opts.Topic
+	cfg.GroupID = opts.GroupID
+	return &Consumer{Log: lg, opts: opts, reader: kafka.NewReader(cfg)}
+}
+
+// Consume implements mq.Consumer. Messages still failing after MaxAttempts
+// are logged and committed, not to block the partition.
+func (c *Consumer) Consume(ctx context.Context, fn mq.HandlerFunc) error {
+	log := c.Log.WithFields(hang.Fields{"topic": c.opts.Topic, "group": c.opts.GroupID})
+	for {
+		m, err := c.reader.FetchMessage(ctx)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			atomic.StoreInt32(&c.connected, 0)
+			return errors.Wrap(err, "can't fetch message")
+		}
+		atomic.StoreInt32(&c.connected, 1)
+
+		work, cancel := mq.DrainContext(ctx, c.opts.DrainTimeout)
+		err = c.handle(work, fn, m)
+		if err != nil {
+			log.WithFields(hang.Fields{"partition": m.Partition, "offset": m.Offset}).Error(errors.Wrap(err, "message processing failed, skipping"))
+		}
+		if err = c.reader.CommitMessages(work, m); err != nil {
+			log.Error(errors.Wrap(err, "can't commit offset"))
+		}
+		cancel()
+	}
+}
+
+// handle passes m to fn, retrying on failure
+func (c *Consumer) handle(ctx context.Context, fn mq.HandlerFunc, m kafka.Message) error {
+	msg := &mq.Message{
+		ID:        m.Topic + "/" + strconv.Itoa(m.Partition) + "/" + strconv.FormatInt(m.Offset, 10),
+		Key:       m.Key,
+		Body:      m.Value,
+		Headers:   map[string]string{},
+		Source:    m.Topic,
+		Timestamp: m.Time,
+	}
+	for _, h := range m.Headers {
+		msg.Headers[h.Key] = string(h.Value)
+	}
+	var err error
+	for attempt := 1; ; attempt++ {
+		if err = fn(ctx, msg); err == nil || attempt == c.opts.MaxAttempts {
+			return err
+		}
+		select {
+		case <-time.After(c.opts.RetryDelay):
+		case <-ctx.Done():
+			return err
+		}
+	}
+}
+
+// Status implements mq.Consumer, the lag being the one of the last fetch
+func (c *Consumer) Status(ctx context.Context) mq.Status {
+	return mq.Status{
+		Connected: atomic.LoadInt32(&c.connected) == 1,
+		Lag:       c.reader.Lag(),
+	}
+}
+
+// Close implements mq.Consumer
+func (c *Consumer) Close() error {
+	return errors.Wrap(c.reader.Close(), "can't close Kafka reader")
+}
@@ -0,0 +1,103 @@
+// Package mq ties message queue consumers to the hang.Handler lifecycle:
+// consumption starts once the server is listening, stops draining the
+// messages in progress on shutdown and reports connection status and lag to
+// the readiness checks. The adapters live in the amqpconsumer and
+// kafkaconsumer subpackages.
+package mq
+
+import (
+	"context"
+	"time"
+
+	"github.com/brunetto/hang"
+	"github.com/pkg/errors"
+)
+
+// Message is a message received from a queue or topic
+type Message struct {
+	ID      string
+	Key     []byte
+	Body    []byte
+	Headers map[string]string
+	// Queue or topic the message comes from
+	Source    string
+	Timestamp time.Time
+}
+
+// HandlerFunc processes a message, which is acknowledged if it returns nil.
+// ctx outlives the shutdown by the drain timeout of the consumer.
+type HandlerFunc func(ctx context.Context, msg *Message) error
+
+// Status is the state of a consumer
+type Status struct {
+	Connected bool `json:"connected"`
+	// Messages waiting to be consumed, -1 if unknown
+	Lag int64 `json:"lag"`
+}
+
+// Consumer receives messages from a broker
+type Consumer interface {
+	// Consume passes the messages to fn until ctx is done, then waits for
+	// the messages in progress and acknowledges them before returning
+	Consume(ctx context.Context, fn HandlerFunc) error
+	// Status returns the connection state and the lag
+	Status(ctx context.Context) Status
+	// Close releases the connections
+	Close() error
+}
+
+// Runner returns a hang.Runner consuming with c once h is listening, so that
+// messages are not processed by a service not able to serve yet, and closing
+// c when done. Add it to the hang.Lifecycle running h.
+func Runner(h *hang.Handler, c Consumer, fn HandlerFunc) hang.Runner {
+	return hang.RunnerFunc(func(ctx context.Context) error {
+		defer c.Close()
+		select {
+		case <-h.Listening():
+		case <-ctx.Done():
+			return nil
+		}
+		err := c.Consume(ctx, fn)
+		if err != nil && ctx.Err() == nil {
+			return errors.Wrap(err, "consumer stopped")
+		}
+		return nil
+	})
+}
+
+// Check returns a readiness check failing when c is disconnected or, if
+// maxLag is positive, when its lag exceeds maxLag
+func Check(c Consumer, maxLag int64) hang.CheckFunc {
+	return func(ctx context.Context) error {
+		st := c.Status(ctx)
+		if !st.Connected {
+			return errors.New("consumer not connected")
+		}
+		if maxLag > 0 && st.Lag > maxLag {
+			return errors.Errorf("consumer lag %d above %d", st.Lag, maxLag)
+		}
+		return nil
+	}
+}
+
+// DrainContext returns a context canceled timeout after ctx is done, for
+// the processing of the messages in progress at shutdown
+func DrainContext(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	work, cancel := context.WithCancel(context.Background())
+	stop := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			select {
+			case <-time.After(timeout):
+				cancel()
+			case <-stop:
+			}
+		case <-stop:
+		}
+	}()
+	return work, func() {
+		close(stop)
+		cancel()
+	}
+}
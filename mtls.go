@@ -0,0 +1,150 @@
+package hang
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/pkg/errors"
+)
+
+// CertIdentity is the identity of a verified client certificate
+type CertIdentity struct {
+	// Distinguished name of the subject
+	Subject      string   `json:"subject"`
+	CommonName   string   `json:"common_name"`
+	Organization []string `json:"organization,omitempty"`
+	// Subject alternative names
+	DNSNames       []string `json:"dns_names,omitempty"`
+	URIs           []string `json:"uris,omitempty"`
+	EmailAddresses []string `json:"email_addresses,omitempty"`
+	// Serial number, in hex, and SHA-256 fingerprint of the certificate
+	SerialNumber string `json:"serial_number"`
+	Fingerprint  string `json:"fingerprint"`
+}
+
+// Names returns the names the identity can be authorized by: the common
+// name and the DNS, URI (e.g. SPIFFE IDs) and email SANs
+func (id CertIdentity) Names() []string {
+	names := []string{id.CommonName}
+	names = append(names, id.DNSNames...)
+	names = append(names, id.URIs...)
+	return append(names, id.EmailAddresses...)
+}
+
+// MutualTLS returns a copy of base, holding the server certificate,
+// requiring the clients to present a certificate signed by one of the CAs
+// in caPEM
+func MutualTLS(base *tls.Config, caPEM []byte) (*tls.Config, error) {
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caPEM) {
+		return nil, errors.New("no CA certificate found")
+	}
+	cfg := &tls.Config{}
+	if base != nil {
+		cfg = base.Clone()
+	}
+	cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	cfg.ClientCAs = pool
+	return cfg, nil
+}
+
+// LoadMutualTLS returns the TLS configuration of a listener serving the
+// certificate in certFile and keyFile and requiring client certificates
+// signed by the CAs in caFile, all PEM encoded
+func LoadMutualTLS(certFile, keyFile, caFile string) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't load the server certificate")
+	}
+	ca, err := ioutil.ReadFile(caFile)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't read the CA file")
+	}
+	cfg, err := MutualTLS(&tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}, ca)
+	return cfg, errors.Wrap(err, "invalid CA file "+caFile)
+}
+
+// NewCertIdentity returns the identity of cert
+func NewCertIdentity(cert *x509.Certificate) CertIdentity {
+	sum := sha256.Sum256(cert.Raw)
+	id := CertIdentity{
+		Subject:        cert.Subject.String(),
+		CommonName:     cert.Subject.CommonName,
+		Organization:   cert.Subject.Organization,
+		DNSNames:       cert.DNSNames,
+		EmailAddresses: cert.EmailAddresses,
+		SerialNumber:   cert.SerialNumber.Text(16),
+		Fingerprint:    hex.EncodeToString(sum[:]),
+	}
+	for _, u := range cert.URIs {
+		id.URIs = append(id.URIs, u.String())
+	}
+	return id
+}
+
+// ClientCert is a middleware storing in the request context the identity
+// of the verified client certificate, if any, for ClientIdentity
+func ClientCert() Middleware {
+	return func(next HandleFunc) HandleFunc {
+		return func(resp http.ResponseWriter, req *http.Request) error {
+			if id, ok := verifiedIdentity(req); ok {
+				req = req.WithContext(context.WithValue(req.Context(), clientCertKey, id))
+			}
+			return next(resp, req)
+		}
+	}
+}
+
+// ClientIdentity returns the identity of the verified client certificate of
+// the request, false if the client did not present a verified certificate
+func ClientIdentity(req *http.Request) (CertIdentity, bool) {
+	if id, ok := req.Context().Value(clientCertKey).(CertIdentity); ok {
+		return id, true
+	}
+	return verifiedIdentity(req)
+}
+
+// verifiedIdentity returns the identity of the leaf of the verified chain
+func verifiedIdentity(req *http.Request) (CertIdentity, bool) {
+	if req.TLS == nil || len(req.TLS.VerifiedChains) == 0 || len(req.TLS.VerifiedChains[0]) == 0 {
+		return CertIdentity{}, false
+	}
+	return NewCertIdentity(req.TLS.VerifiedChains[0][0]), true
+}
+
+// RequireClientIdentity returns a middleware authorizing the requests whose
+// client certificate has one of the allowed names (see CertIdentity.Names),
+// responding 401 without a verified certificate and 403, logging, otherwise.
+// Register it with UseForRoute to authorize routes by identity.
+func (h *Handler) RequireClientIdentity(allowed ...string) Middleware {
+	set := make(map[string]bool, len(allowed))
+	for _, name := range allowed {
+		set[name] = true
+	}
+	return func(next HandleFunc) HandleFunc {
+		return func(resp http.ResponseWriter, req *http.Request) error {
+			id, ok := ClientIdentity(req)
+			if !ok {
+				err := errors.New("client certificate required")
+				// Respond
+				WriteError(resp, req, http.StatusUnauthorized, err)
+				return errors.Wrap(err, "unauthorized request to "+RouteFrom(req))
+			}
+			for _, name := range id.Names() {
+				if name != "" && set[name] {
+					return next(resp, req)
+				}
+			}
+			h.Log.WithFields(Fields{"route": RouteFrom(req), "origin": RealIP(req), "subject": id.Subject, "fingerprint": id.Fingerprint}).Warn("Request from unauthorized client certificate")
+			// Respond
+			WriteError(resp, req, http.StatusForbidden, errors.New("forbidden"))
+			// Logged above
+			return nil
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package hang
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// testCert returns a self signed certificate with the given names
+func testCert(t *testing.T, cn string, dns []string, uris ...string) *x509.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: cn},
+		DNSNames:     dns,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	for _, s := range uris {
+		u, err := url.Parse(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tmpl.URIs = append(tmpl.URIs, u)
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func TestRequireClientIdentity(t *testing.T) {
+	h := testHandler(t)
+	h.Use(ClientCert())
+	h.AddRoute("billing", func(resp http.ResponseWriter, req *http.Request) error { return nil })
+	h.UseForRoute("billing", h.RequireClientIdentity("billing", "spiffe://example.org/billing"))
+
+	var (
+		billing = testCert(t, "billing", nil)
+		spiffe  = testCert(t, "other", nil, "spiffe://example.org/billing")
+		dns     = testCert(t, "other", []string{"billing"})
+		other   = testCert(t, "other", []string{"other.example.org"})
+		empty   = testCert(t, "", nil)
+	)
+	verified := func(cert *x509.Certificate) *tls.ConnectionState {
+		return &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}, VerifiedChains: [][]*x509.Certificate{{cert}}}
+	}
+	tests := []struct {
+		name   string
+		tls    *tls.ConnectionState
+		status int
+	}{
+		{"plain http", nil, http.StatusUnauthorized},
+		{"no certificate", &tls.ConnectionState{}, http.StatusUnauthorized},
+		{"unverified certificate", &tls.ConnectionState{PeerCertificates: []*x509.Certificate{billing}}, http.StatusUnauthorized},
+		{"common name", verified(billing), http.StatusOK},
+		{"uri san", verified(spiffe), http.StatusOK},
+		{"dns san", verified(dns), http.StatusOK},
+		{"other identity", verified(other), http.StatusForbidden},
+		{"empty common name", verified(empty), http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/billing", nil)
+		req.TLS = tt.tls
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != tt.status {
+			t.Errorf("%s: got status %d, want %d", tt.name, rec.Code, tt.status)
+		}
+	}
+}
+
+func TestMutualTLS(t *testing.T) {
+	if _, err := MutualTLS(nil, []byte("not a certificate")); err == nil {
+		t.Error("invalid CA accepted")
+	}
+
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: testCert(t, "ca", nil).Raw})
+	base := &tls.Config{MinVersion: tls.VersionTLS12}
+	cfg, err := MutualTLS(base, ca)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.ClientAuth != tls.RequireAndVerifyClientCert || cfg.ClientCAs == nil || cfg.MinVersion != tls.VersionTLS12 {
+		t.Errorf("got ClientAuth %v and MinVersion %x, want verified client certificates on top of base", cfg.ClientAuth, cfg.MinVersion)
+	}
+	if base.ClientAuth != tls.NoClientCert {
+		t.Error("base configuration modified")
+	}
+}
@@ -0,0 +1,212 @@
+package hang
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// MultipartOptions sets the limits and the destination of the files parsed
+// by GetReqMultipart, zero values meaning the defaults
+type MultipartOptions struct {
+	// Maximum number of files, 10 by default
+	MaxFiles int
+	// Maximum size of each file, 10MB by default
+	MaxFileSize int64
+	// Maximum size of the whole body, 32MB by default
+	MaxTotalSize int64
+	// Maximum size of each non file field, 1MB by default
+	MaxFieldSize int64
+	// Accepted file extensions (e.g. ".png"), any if empty
+	AllowedExtensions []string
+	// Directory for the uploaded files, the system temp dir if empty
+	TempDir string
+	// Receives the content of each file instead of the temp dir
+	OnFile func(file UploadedFile, content io.Reader) error
+}
+
+// UploadedFile describes a file received with GetReqMultipart
+type UploadedFile struct {
+	Field       string `json:"field"`
+	Filename    string `json:"filename"`
+	ContentType string `json:"content_type"`
+	Size        int64  `json:"size"`
+	// Location of the file, empty if streamed to OnFile
+	Path string `json:"-"`
+}
+
+// MultipartData is the content of a multipart/form-data request
+type MultipartData struct {
+	Fields map[string][]string
+	Files  []UploadedFile
+}
+
+// RemoveAll deletes the files stored in the temp dir
+func (d *MultipartData) RemoveAll() error {
+	var err error
+	for _, f := range d.Files {
+		if f.Path == "" {
+			continue
+		}
+		if e := os.Remove(f.Path); e != nil && !os.IsNotExist(e) && err == nil {
+			err = errors.Wrap(e, "can't remove uploaded file")
+		}
+	}
+	return err
+}
+
+// errPartTooLarge is returned when a file or field exceeds its size limit
+var errPartTooLarge = errors.New("multipart file or field too large")
+
+// GetReqMultipart parses a multipart/form-data request streaming the files to
+// the temp dir or to opts.OnFile, responding with a 4xx error if a limit is
+// exceeded. The caller is responsible for removing the files (RemoveAll).
+func GetReqMultipart(resp http.ResponseWriter, req *http.Request, opts MultipartOptions) (*MultipartData, error) {
+	var (
+		o    = multipartDefaults(opts)
+		data = &MultipartData{Fields: map[string][]string{}}
+	)
+	fail := func(status int, err error) (*MultipartData, error) {
+		data.RemoveAll()
+		// Respond
+		WriteError(resp, req, status, err)
+		// Exit
+		return nil, err
+	}
+
+	req.Body = http.MaxBytesReader(resp, req.Body, o.MaxTotalSize)
+	mr, err := req.MultipartReader()
+	if err != nil {
+		if err == http.ErrNotMultipart {
+			return fail(http.StatusUnsupportedMediaType, errors.Wrap(err, "expected multipart/form-data"))
+		}
+		return fail(http.StatusBadRequest, errors.Wrap(err, "can't read multipart body"))
+	}
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fail(multipartErrorStatus(err), errors.Wrap(err, "can't read multipart body"))
+		}
+		field := part.FormName()
+
+		// Plain field
+		if part.FileName() == "" {
+			v, err := ioutil.ReadAll(&limitedReader{r: part, n: o.MaxFieldSize})
+			part.Close()
+			if err != nil {
+				return fail(multipartErrorStatus(err), errors.Wrap(err, "can't read field "+field))
+			}
+			data.Fields[field] = append(data.Fields[field], string(v))
+			continue
+		}
+
+		// File
+		if len(data.Files) == o.MaxFiles {
+			part.Close()
+			return fail(http.StatusRequestEntityTooLarge, errors.Errorf("too many files, at most %d allowed", o.MaxFiles))
+		}
+		file := UploadedFile{
+			Field:       field,
+			Filename:    filepath.Base(part.FileName()),
+			ContentType: part.Header.Get("Content-Type"),
+		}
+		ext := strings.ToLower(filepath.Ext(file.Filename))
+		if !allowedExtension(ext, o.AllowedExtensions) {
+			part.Close()
+			return fail(http.StatusUnsupportedMediaType, errors.Errorf("file extension %q not allowed", ext))
+		}
+		content := &limitedReader{r: part, n: o.MaxFileSize}
+		if o.OnFile != nil {
+			err = o.OnFile(file, content)
+		} else {
+			file.Path, err = saveUpload(o.TempDir, ext, content)
+		}
+		file.Size = content.read
+		part.Close()
+		if err != nil {
+			if file.Path != "" {
+				os.Remove(file.Path)
+			}
+			return fail(multipartErrorStatus(err), errors.Wrap(err, "can't store file "+file.Filename))
+		}
+		data.Files = append(data.Files, file)
+	}
+	return data, nil
+}
+
+// multipartDefaults fills the unset limits
+func multipartDefaults(o MultipartOptions) MultipartOptions {
+	if o.MaxFiles <= 0 {
+		o.MaxFiles = 10
+	}
+	if o.MaxFileSize <= 0 {
+		o.MaxFileSize = 10 << 20
+	}
+	if o.MaxTotalSize <= 0 {
+		o.MaxTotalSize = 32 << 20
+	}
+	if o.MaxFieldSize <= 0 {
+		o.MaxFieldSize = 1 << 20
+	}
+	return o
+}
+
+// allowedExtension checks ext against the allowed ones, any if none
+func allowedExtension(ext string, allowed []string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+	for _, a := range allowed {
+		if strings.EqualFold(ext, a) {
+			return true
+		}
+	}
+	return false
+}
+
+// saveUpload copies content to a new file in dir
+func saveUpload(dir, ext string, content io.Reader) (string, error) {
+	f, err := ioutil.TempFile(dir, "upload-*"+ext)
+	if err != nil {
+		return "", errors.Wrap(err, "can't create upload file")
+	}
+	_, err = io.Copy(f, content)
+	if e := f.Close(); e != nil && err == nil {
+		err = e
+	}
+	return f.Name(), err
+}
+
+// multipartErrorStatus maps the errors reading the body to a response status
+func multipartErrorStatus(err error) int {
+	var tooLarge *http.MaxBytesError
+	if errors.Is(err, errPartTooLarge) || errors.As(err, &tooLarge) {
+		return http.StatusRequestEntityTooLarge
+	}
+	return http.StatusBadRequest
+}
+
+// limitedReader fails with errPartTooLarge after n bytes, instead of
+// silently truncating like io.LimitReader
+type limitedReader struct {
+	r    io.Reader
+	n    int64
+	read int64
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	n, err := l.r.Read(p)
+	l.read += int64(n)
+	if l.read > l.n {
+		return n, errPartTooLarge
+	}
+	return n, err
+}
@@ -0,0 +1,82 @@
+package hang
+
+import (
+	"net/http"
+	"strings"
+)
+
+// TrailingSlashPolicy tells how the Handler treats the paths ending with /
+type TrailingSlashPolicy int
+
+const (
+	// TrailingSlashAccept serves /users/ as /users (the default)
+	TrailingSlashAccept TrailingSlashPolicy = iota
+	// TrailingSlashRedirect redirects /users/ to /users, with a 301 for
+	// GET and HEAD and a 308 for the other methods to keep method and body
+	TrailingSlashRedirect
+)
+
+// SetTrailingSlashPolicy sets how the paths ending with / are handled
+func (h *Handler) SetTrailingSlashPolicy(p TrailingSlashPolicy) {
+	h.trailingSlash = p
+}
+
+// SetCaseInsensitiveRoutes makes the routes match the paths regardless of
+// their case; exact case matches still take precedence. Regex routes can
+// use the (?i) flag instead.
+func (h *Handler) SetCaseInsensitiveRoutes(on bool) {
+	h.caseInsensitive = on
+}
+
+// redirectTrailingSlash redirects, according to the policy, the requests
+// whose path ends with /, reporting whether it did
+func (h *Handler) redirectTrailingSlash(resp http.ResponseWriter, req *http.Request) bool {
+	p := req.URL.Path
+	if h.trailingSlash != TrailingSlashRedirect || len(p) <= 1 || !strings.HasSuffix(p, "/") {
+		return false
+	}
+	u := *req.URL
+	u.Path = localPath(strings.TrimRight(p, "/"))
+	u.RawPath = ""
+	status := http.StatusMovedPermanently
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		status = http.StatusPermanentRedirect
+	}
+	http.Redirect(resp, req, u.RequestURI(), status)
+	return true
+}
+
+// localPath returns p with the leading slashes and backslashes collapsed
+// into one, so that a redirect to it can't be read as a link to another
+// host (//evil.com)
+func localPath(p string) string {
+	return "/" + strings.TrimLeft(p, `/\`)
+}
+
+// lookupRoute returns the registered route equal to route, ignoring the
+// case if enabled, or ""
+func (h *Handler) lookupRoute(route string) string {
+	if hasParams(route) {
+		return ""
+	}
+	if h.Routes[route] != nil {
+		return route
+	}
+	if !h.caseInsensitive {
+		return ""
+	}
+	for r := range h.Routes {
+		if strings.EqualFold(r, route) && !isRegexRoute(r) && !hasParams(r) {
+			return r
+		}
+	}
+	return ""
+}
+
+// hasPathPrefix tells if p starts with prefix, ignoring the case if enabled
+func (h *Handler) hasPathPrefix(p, prefix string) bool {
+	if h.caseInsensitive {
+		return len(p) >= len(prefix) && strings.EqualFold(p[:len(prefix)], prefix)
+	}
+	return strings.HasPrefix(p, prefix)
+}
@@ -0,0 +1,33 @@
+package hang
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestRedirectTrailingSlash(t *testing.T) {
+	h := testHandler(t)
+	h.SetTrailingSlashPolicy(TrailingSlashRedirect)
+	tests := []struct {
+		method, target string
+		status         int
+		location       string
+	}{
+		{"GET", "/users/", http.StatusMovedPermanently, "/users"},
+		{"GET", "/users/?a=1", http.StatusMovedPermanently, "/users?a=1"},
+		{"POST", "/users/", http.StatusPermanentRedirect, "/users"},
+		{"GET", "//evil.com/", http.StatusMovedPermanently, "/evil.com"},
+		{"GET", "///evil.com//", http.StatusMovedPermanently, "/evil.com"},
+		{"GET", `/\evil.com/`, http.StatusMovedPermanently, "/evil.com"},
+		{"GET", "//", http.StatusMovedPermanently, "/"},
+	}
+	for _, tt := range tests {
+		resp := serve(h, tt.method, tt.target, nil)
+		if resp.Code != tt.status {
+			t.Errorf("%v %v: status %v, want %v", tt.method, tt.target, resp.Code, tt.status)
+		}
+		if got := resp.Header().Get("Location"); got != tt.location {
+			t.Errorf("%v %v: location %q, want %q", tt.method, tt.target, got, tt.location)
+		}
+	}
+}
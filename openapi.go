@@ -0,0 +1,355 @@
+package hang
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// OpenAPI versions accepted by OpenAPISpec
+const (
+	OpenAPI30 = "3.0.3"
+	OpenAPI31 = "3.1.0"
+)
+
+// OpenAPIDoc is a minimal OpenAPI 3 document
+type OpenAPIDoc struct {
+	OpenAPI    string                                 `json:"openapi"`
+	Info       SpecInfo                               `json:"info"`
+	Paths      map[string]map[string]OpenAPIOperation `json:"paths"`
+	Components OpenAPIComponents                      `json:"components,omitempty"`
+}
+
+// OpenAPIComponents holds the reusable schemas
+type OpenAPIComponents struct {
+	Schemas map[string]*Schema `json:"schemas,omitempty"`
+}
+
+// OpenAPIOperation documents a method on a path
+type OpenAPIOperation struct {
+	Summary     string                     `json:"summary,omitempty"`
+	Description string                     `json:"description,omitempty"`
+	OperationID string                     `json:"operationId,omitempty"`
+	Tags        []string                   `json:"tags,omitempty"`
+	Parameters  []OpenAPIParameter         `json:"parameters,omitempty"`
+	RequestBody *OpenAPIRequestBody        `json:"requestBody,omitempty"`
+	Responses   map[string]OpenAPIResponse `json:"responses"`
+}
+
+// OpenAPIParameter documents a path parameter
+type OpenAPIParameter struct {
+	Name     string  `json:"name"`
+	In       string  `json:"in"`
+	Required bool    `json:"required"`
+	Schema   *Schema `json:"schema"`
+}
+
+// OpenAPIRequestBody documents the request body
+type OpenAPIRequestBody struct {
+	Required bool                        `json:"required"`
+	Content  map[string]OpenAPIMediaType `json:"content"`
+}
+
+// OpenAPIResponse documents a response
+type OpenAPIResponse struct {
+	Description string                      `json:"description"`
+	Content     map[string]OpenAPIMediaType `json:"content,omitempty"`
+}
+
+// OpenAPIMediaType is the schema of a content type
+type OpenAPIMediaType struct {
+	Schema *Schema `json:"schema,omitempty"`
+}
+
+// OpenAPISpec generates the OpenAPI document, of version OpenAPI30 or
+// OpenAPI31 (the default), from the documented routes as SwaggerSpec does
+func (h *Handler) OpenAPISpec(version, openapiVersion string) OpenAPIDoc {
+	if openapiVersion == "" {
+		openapiVersion = OpenAPI31
+	}
+	spec := h.SwaggerSpec(version)
+	doc := OpenAPIDoc{
+		OpenAPI:    openapiVersion,
+		Info:       spec.Info,
+		Paths:      map[string]map[string]OpenAPIOperation{},
+		Components: OpenAPIComponents{Schemas: map[string]*Schema{}},
+	}
+	for name, s := range spec.Definitions {
+		doc.Components.Schemas[name] = openAPISchema(s)
+	}
+	for path, ops := range spec.Paths {
+		oops := map[string]OpenAPIOperation{}
+		for method, op := range ops {
+			oop := OpenAPIOperation{
+				Summary:     op.Summary,
+				Description: op.Description,
+				OperationID: op.OperationID,
+				Tags:        op.Tags,
+				Responses:   map[string]OpenAPIResponse{},
+			}
+			consumes, produces := MIMEJSON, MIMEJSON
+			if len(op.Consumes) > 0 {
+				consumes = op.Consumes[0]
+			}
+			if len(op.Produces) > 0 {
+				produces = op.Produces[0]
+			}
+			for _, p := range op.Parameters {
+				if p.In == "body" {
+					oop.RequestBody = &OpenAPIRequestBody{
+						Required: p.Required,
+						Content:  map[string]OpenAPIMediaType{consumes: {Schema: openAPISchema(p.Schema)}},
+					}
+					continue
+				}
+				oop.Parameters = append(oop.Parameters, OpenAPIParameter{Name: p.Name, In: p.In, Required: p.Required, Schema: &Schema{Type: p.Type}})
+			}
+			for code, r := range op.Responses {
+				or := OpenAPIResponse{Description: r.Description}
+				if r.Schema != nil {
+					or.Content = map[string]OpenAPIMediaType{produces: {Schema: openAPISchema(r.Schema)}}
+				}
+				oop.Responses[code] = or
+			}
+			oops[method] = oop
+		}
+		doc.Paths[path] = oops
+	}
+	return doc
+}
+
+// openAPISchema returns a copy of s referring to the components instead
+// of the swagger definitions
+func openAPISchema(s *Schema) *Schema {
+	if s == nil {
+		return nil
+	}
+	c := *s
+	c.Ref = strings.Replace(c.Ref, "#/definitions/", "#/components/schemas/", 1)
+	c.Items = openAPISchema(s.Items)
+	c.AdditionalProperties = openAPISchema(s.AdditionalProperties)
+	if s.Properties != nil {
+		c.Properties = make(map[string]*Schema, len(s.Properties))
+		for name, p := range s.Properties {
+			c.Properties[name] = openAPISchema(p)
+		}
+	}
+	return &c
+}
+
+// YAML returns the document encoded as YAML
+func (doc OpenAPIDoc) YAML() ([]byte, error) {
+	// Through JSON to honour the json tags
+	b, err := json.Marshal(doc)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't encode OpenAPI document")
+	}
+	var v interface{}
+	err = json.Unmarshal(b, &v)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't encode OpenAPI document")
+	}
+	b, err = yaml.Marshal(v)
+	return b, errors.Wrap(err, "can't encode OpenAPI document as YAML")
+}
+
+// EnableOpenAPI registers the openapi.json and openapi.yaml routes serving
+// the OpenAPI document of version openapiVersion (OpenAPI31 if empty)
+func (h *Handler) EnableOpenAPI(version, openapiVersion string) error {
+	err := h.AddRoute("openapi.json", func(resp http.ResponseWriter, req *http.Request) error {
+		return WriteJSON(resp, http.StatusOK, h.OpenAPISpec(version, openapiVersion))
+	})
+	if err != nil {
+		return errors.Wrap(err, "can't enable OpenAPI")
+	}
+	err = h.AddRoute("openapi.yaml", func(resp http.ResponseWriter, req *http.Request) error {
+		b, err := h.OpenAPISpec(version, openapiVersion).YAML()
+		if err != nil {
+			WriteError(resp, req, http.StatusInternalServerError, err)
+			return err
+		}
+		resp.Header().Set("Content-Type", "application/yaml")
+		resp.WriteHeader(http.StatusOK)
+		_, err = resp.Write(b)
+		return err
+	})
+	return errors.Wrap(err, "can't enable OpenAPI")
+}
+
+// requestSchema is the schema of the request body of a route method
+type requestSchema struct {
+	body *Schema
+	defs map[string]*Schema
+}
+
+// ValidateRequests returns a middleware validating the requests against
+// the documentation of their route (see RouteDoc): the path params must not
+// be empty and the JSON body must match the schema of RouteDoc.Request.
+// Invalid requests get a 400 with the list of violations.
+func (h *Handler) ValidateRequests() Middleware {
+	var cache sync.Map
+	return func(next HandleFunc) HandleFunc {
+		return func(resp http.ResponseWriter, req *http.Request) error {
+			var violations ValidationErrors
+			route := RouteFrom(req)
+			for name, value := range Params(req) {
+				if value == "" {
+					violations = append(violations, FieldError{Field: name, Rule: "required", Message: "path parameter " + name + " is required"})
+				}
+			}
+			key := req.Method + " " + route
+			rs, ok := cache.Load(key)
+			if !ok {
+				rs, _ = cache.LoadOrStore(key, h.requestSchema(route, req.Method))
+			}
+			schema := rs.(requestSchema)
+			if schema.body != nil && isJSONRequest(req) {
+				body, err := ioutil.ReadAll(req.Body)
+				if err != nil {
+					WriteError(resp, req, http.StatusBadRequest, errors.New("can't read request body"))
+					return errors.Wrap(err, "can't read request body")
+				}
+				req.Body = ioutil.NopCloser(bytes.NewReader(body))
+				var v interface{}
+				if err = json.Unmarshal(body, &v); err != nil {
+					violations = append(violations, FieldError{Field: "body", Rule: "json", Message: "body is not valid JSON"})
+				} else {
+					violations = append(violations, validateSchema(v, schema.body, schema.defs, "")...)
+				}
+			}
+			if len(violations) > 0 {
+				writeError(resp, req, RequestErrorFormat(req), http.StatusBadRequest, violations, violations)
+				return violations
+			}
+			return next(resp, req)
+		}
+	}
+}
+
+// requestSchema returns the schema of the request body of route for method
+func (h *Handler) requestSchema(route, method string) requestSchema {
+	rs := requestSchema{defs: map[string]*Schema{}}
+	for _, d := range h.Docs[route] {
+		m := strings.ToUpper(d.Method)
+		if m == "" {
+			m = http.MethodGet
+		}
+		if m == method && d.Request != nil {
+			rs.body = SchemaOf(d.Request, rs.defs, "")
+		}
+	}
+	return rs
+}
+
+// isJSONRequest tells if the request body is JSON, or has no content type
+func isJSONRequest(req *http.Request) bool {
+	ct := req.Header.Get("Content-Type")
+	if ct == "" {
+		return true
+	}
+	mt, _, err := mime.ParseMediaType(ct)
+	return err == nil && (mt == MIMEJSON || strings.HasSuffix(mt, "+json"))
+}
+
+// validateSchema returns the violations of schema s by the decoded JSON v
+func validateSchema(v interface{}, s *Schema, defs map[string]*Schema, path string) ValidationErrors {
+	if s == nil {
+		return nil
+	}
+	if s.Ref != "" {
+		return validateSchema(v, defs[strings.TrimPrefix(s.Ref, "#/definitions/")], defs, path)
+	}
+	field := path
+	if field == "" {
+		field = "body"
+	}
+	typeErr := func() ValidationErrors {
+		return ValidationErrors{{Field: field, Rule: "type", Param: s.Type, Message: field + " must be of type " + s.Type}}
+	}
+	if v == nil {
+		// null is accepted for optional values
+		return nil
+	}
+	var out ValidationErrors
+	switch s.Type {
+	case "object":
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return typeErr()
+		}
+		for _, name := range s.Required {
+			if _, ok := obj[name]; !ok {
+				f := joinField(path, name)
+				out = append(out, FieldError{Field: f, Rule: "required", Message: f + " is required"})
+			}
+		}
+		names := make([]string, 0, len(obj))
+		for name := range obj {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if p, ok := s.Properties[name]; ok {
+				out = append(out, validateSchema(obj[name], p, defs, joinField(path, name))...)
+			} else if s.AdditionalProperties != nil {
+				out = append(out, validateSchema(obj[name], s.AdditionalProperties, defs, joinField(path, name))...)
+			}
+		}
+	case "array":
+		arr, ok := v.([]interface{})
+		if !ok {
+			if s.Format == "byte" {
+				if _, ok = v.(string); ok {
+					return nil
+				}
+			}
+			return typeErr()
+		}
+		for i, item := range arr {
+			out = append(out, validateSchema(item, s.Items, defs, path+"["+strconv.Itoa(i)+"]")...)
+		}
+	case "string":
+		if _, ok := v.(string); !ok {
+			return typeErr()
+		}
+	case "boolean":
+		if _, ok := v.(bool); !ok {
+			return typeErr()
+		}
+	case "number":
+		if _, ok := v.(float64); !ok {
+			return typeErr()
+		}
+	case "integer":
+		n, ok := v.(float64)
+		if !ok || n != float64(int64(n)) {
+			return typeErr()
+		}
+	}
+	if len(s.Enum) > 0 {
+		for _, e := range s.Enum {
+			if e == v {
+				return out
+			}
+		}
+		out = append(out, FieldError{Field: field, Rule: "enum", Message: field + " is not one of the allowed values"})
+	}
+	return out
+}
+
+// joinField returns the dotted path of a field
+func joinField(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
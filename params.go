@@ -0,0 +1,247 @@
+package hang
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// hasParams tells if the path of route has :param segments
+func hasParams(route string) bool {
+	_, rpath := splitHostRoute(route)
+	return strings.HasPrefix(rpath, ":") || strings.Contains(rpath, "/:")
+}
+
+// checkRoute returns an error if route is malformed or ambiguous with a
+// registered one, i.e. if both would match the same paths with the same
+// precedence
+func (h *Handler) checkRoute(route string) error {
+	if isRegexRoute(route) {
+		return nil
+	}
+	pattern, rpath := splitHostRoute(route)
+	names := map[string]bool{}
+	for _, seg := range strings.Split(rpath, "/") {
+		if !strings.HasPrefix(seg, ":") {
+			continue
+		}
+		name := seg[1:]
+		switch {
+		case name == "":
+			return errors.New("route " + route + " has a param without name")
+		case names[name]:
+			return errors.New("route " + route + " has the param " + name + " twice")
+		case strings.HasSuffix(rpath, "*"):
+			return errors.New("route " + route + " can't have both params and wildcard")
+		}
+		names[name] = true
+	}
+	for other := range h.Routes {
+		if isRegexRoute(other) {
+			continue
+		}
+		opattern, orpath := splitHostRoute(other)
+		if opattern == pattern && h.sameShape(rpath, orpath) {
+			return errors.New("route " + route + " conflicts with " + other)
+		}
+	}
+	return nil
+}
+
+// sameShape tells if the two route paths have the same static segments
+// and params in the same positions
+func (h *Handler) sameShape(a, b string) bool {
+	as, bs := strings.Split(a, "/"), strings.Split(b, "/")
+	if len(as) != len(bs) {
+		return false
+	}
+	for i := range as {
+		ap, bp := strings.HasPrefix(as[i], ":"), strings.HasPrefix(bs[i], ":")
+		if ap != bp || (!ap && !h.segmentEqual(as[i], bs[i])) {
+			return false
+		}
+	}
+	return true
+}
+
+// segmentEqual compares two path segments, ignoring the case if enabled
+func (h *Handler) segmentEqual(a, b string) bool {
+	if h.caseInsensitive {
+		return strings.EqualFold(a, b)
+	}
+	return a == b
+}
+
+// matchParams returns the route with params matching host and path, the
+// ones bound to host first and then the most specific (static segments
+// before params, left to right), with the values of the params and the
+// subdomain matched by the host pattern
+func (h *Handler) matchParams(host, path string) (string, map[string]string, string) {
+	var (
+		best, bestRank, bestSub string
+		bestParams              map[string]string
+		segs                    = strings.Split(path, "/")
+	)
+	for route := range h.Routes {
+		if isRegexRoute(route) || !hasParams(route) {
+			continue
+		}
+		pattern, rpath := splitHostRoute(route)
+		sub, ok := "", true
+		if pattern != "" {
+			sub, ok = matchHost(pattern, host)
+		}
+		if !ok {
+			continue
+		}
+		rsegs := strings.Split(rpath, "/")
+		if len(rsegs) != len(segs) {
+			continue
+		}
+		// Lower ranks win: host bound first, then static segments first
+		rank := make([]byte, 0, len(rsegs)+1)
+		if pattern == "" {
+			rank = append(rank, '1')
+		} else {
+			rank = append(rank, '0')
+		}
+		params := map[string]string{}
+		for i, rs := range rsegs {
+			if strings.HasPrefix(rs, ":") {
+				params[rs[1:]] = segs[i]
+				rank = append(rank, '1')
+				continue
+			}
+			if !h.segmentEqual(rs, segs[i]) {
+				ok = false
+				break
+			}
+			rank = append(rank, '0')
+		}
+		if !ok || (best != "" && string(rank) >= bestRank) {
+			continue
+		}
+		best, bestRank, bestParams, bestSub = route, string(rank), params, sub
+	}
+	return best, bestParams, bestSub
+}
+
+// withParams stores the values of the route params in the request context
+func withParams(req *http.Request, params map[string]string) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), paramsKey, params))
+}
+
+// Param returns the value of the :name segment of the route matched by the
+// request, e.g. "42" for /users/42 on "users/:id"
+func Param(req *http.Request, name string) string {
+	params, _ := req.Context().Value(paramsKey).(map[string]string)
+	return params[name]
+}
+
+// Params returns the values of all the params of the route matched by the
+// request
+func Params(req *http.Request) map[string]string {
+	params, _ := req.Context().Value(paramsKey).(map[string]string)
+	return params
+}
+
+// routeNode is a path segment of the route tree
+type routeNode struct {
+	route    string
+	children map[string]*routeNode
+}
+
+// DumpRouteTree returns the registered routes as a tree of path segments,
+// by host, annotated with the kind of each route and its handler; regex
+// routes are listed at the end. Among the routes matching a path the
+// Handler picks, routes bound to the request host first: exact, then :param
+// (static segments before params, left to right), then regex (in
+// registration order), then wildcard (longest first).
+func (h *Handler) DumpRouteTree() string {
+	var (
+		b     strings.Builder
+		roots = map[string]*routeNode{}
+	)
+	for route := range h.Routes {
+		if isRegexRoute(route) {
+			continue
+		}
+		pattern, rpath := splitHostRoute(route)
+		n, ok := roots[pattern]
+		if !ok {
+			n = &routeNode{children: map[string]*routeNode{}}
+			roots[pattern] = n
+		}
+		for _, seg := range strings.Split(rpath, "/") {
+			child, ok := n.children[seg]
+			if !ok {
+				child = &routeNode{children: map[string]*routeNode{}}
+				n.children[seg] = child
+			}
+			n = child
+		}
+		n.route = route
+	}
+	hosts := make([]string, 0, len(roots))
+	for host := range roots {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+	for _, host := range hosts {
+		if host == "" {
+			b.WriteString("/\n")
+		} else {
+			b.WriteString(host + "/\n")
+		}
+		h.dumpNode(&b, roots[host], 1)
+	}
+	for _, rr := range h.regexRoutes {
+		if h.Routes[rr.route] != nil {
+			fmt.Fprintf(&b, "%v [regex] %v\n", rr.route, h.handlerName(rr.route))
+		}
+	}
+	return b.String()
+}
+
+// dumpNode writes the children of n, static segments first
+func (h *Handler) dumpNode(b *strings.Builder, n *routeNode, depth int) {
+	segs := make([]string, 0, len(n.children))
+	for seg := range n.children {
+		segs = append(segs, seg)
+	}
+	kind := func(seg string) int {
+		switch {
+		case strings.HasPrefix(seg, ":"):
+			return 1
+		case seg == "*":
+			return 2
+		}
+		return 0
+	}
+	sort.Slice(segs, func(i, j int) bool {
+		if ki, kj := kind(segs[i]), kind(segs[j]); ki != kj {
+			return ki < kj
+		}
+		return segs[i] < segs[j]
+	})
+	for _, seg := range segs {
+		child := n.children[seg]
+		b.WriteString(strings.Repeat("  ", depth) + seg)
+		if child.route != "" {
+			k := "exact"
+			switch {
+			case strings.HasSuffix(child.route, "*"):
+				k = "wildcard"
+			case hasParams(child.route):
+				k = "param"
+			}
+			fmt.Fprintf(b, " [%v] %v", k, h.handlerName(child.route))
+		}
+		b.WriteString("\n")
+		h.dumpNode(b, child, depth+1)
+	}
+}
@@ -0,0 +1,171 @@
+package hang
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+)
+
+// ErrorFormat selects how errors are written in the responses
+type ErrorFormat int
+
+const (
+	// PlainTextErrors writes the bare error message (default)
+	PlainTextErrors ErrorFormat = iota
+	// ProblemJSONErrors writes RFC 7807 application/problem+json documents
+	ProblemJSONErrors
+)
+
+// DefaultErrorFormat is the format used by the helper functions when the
+// request does not come through a Handler
+var DefaultErrorFormat = PlainTextErrors
+
+// ctxKey is the type of the keys of the values stored in the request context
+type ctxKey int
+
+const (
+	requestInfoKey ctxKey = iota
+	routeKey
+	suffixKey
+	requestIDKey
+	csrfTokenKey
+	subdomainKey
+	capturesKey
+	paramsKey
+	clientCertKey
+	auditKey
+)
+
+// requestInfo holds what the Handler attaches to every request, in a single
+// context value not to allocate a context for each of them
+type requestInfo struct {
+	errorFormat   ErrorFormat
+	errorRenderer ErrorRenderer
+	realIP        string
+	// Set once matched
+	route string
+}
+
+// withRequestInfo attaches info to the request
+func withRequestInfo(req *http.Request, info *requestInfo) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), requestInfoKey, info))
+}
+
+// getRequestInfo returns the info attached by the Handler, nil if none
+func getRequestInfo(req *http.Request) *requestInfo {
+	info, _ := req.Context().Value(requestInfoKey).(*requestInfo)
+	return info
+}
+
+// Problem is an RFC 7807 problem details document
+type Problem struct {
+	// URI reference identifying the problem type
+	Type string `json:"type"`
+	// Short summary of the problem type
+	Title string `json:"title"`
+	// HTTP status code
+	Status int `json:"status"`
+	// Explanation specific to this occurrence of the problem
+	Detail string `json:"detail,omitempty"`
+	// URI reference identifying this occurrence of the problem
+	Instance string `json:"instance,omitempty"`
+	// Extension member carrying field level errors, if any
+	Errors interface{} `json:"errors,omitempty"`
+}
+
+// NewProblem creates a problem document for the given status and error
+func NewProblem(req *http.Request, status int, err error) Problem {
+	p := Problem{
+		Type:   "about:blank",
+		Title:  http.StatusText(status),
+		Status: status,
+	}
+	if err != nil {
+		p.Detail = err.Error()
+	}
+	if req != nil && req.URL != nil {
+		p.Instance = req.URL.RequestURI()
+	}
+	return p
+}
+
+// WriteProblem writes p as application/problem+json
+func WriteProblem(resp http.ResponseWriter, p Problem) {
+	b, err := json.Marshal(p)
+	if err != nil {
+		b = []byte(`{"type":"about:blank","title":"Internal Server Error","status":500}`)
+		p.Status = http.StatusInternalServerError
+	}
+	resp.Header().Set("Content-Type", "application/problem+json")
+	resp.WriteHeader(p.Status)
+	resp.Write(b)
+}
+
+// WriteError writes err with the given status using the error format
+// attached to the request by the Handler, or DefaultErrorFormat
+func WriteError(resp http.ResponseWriter, req *http.Request, status int, err error) {
+	writeError(resp, req, RequestErrorFormat(req), status, err, nil)
+}
+
+// RequestErrorFormat returns the error format to be used for the request
+func RequestErrorFormat(req *http.Request) ErrorFormat {
+	if req != nil {
+		if info := getRequestInfo(req); info != nil {
+			return info.errorFormat
+		}
+	}
+	return DefaultErrorFormat
+}
+
+// ErrorRenderer writes an error response with the given status, error and
+// field level details (nil if none). It must not call WriteError, which
+// calls it back; FormatErrorRenderer returns the built-in renderers.
+type ErrorRenderer func(resp http.ResponseWriter, req *http.Request, status int, err error, details interface{})
+
+// FormatErrorRenderer returns the renderer writing the errors in format f,
+// as done when no renderer is set
+func FormatErrorRenderer(f ErrorFormat) ErrorRenderer {
+	return func(resp http.ResponseWriter, req *http.Request, status int, err error, details interface{}) {
+		renderError(resp, req, f, status, err, details)
+	}
+}
+
+func writeError(resp http.ResponseWriter, req *http.Request, f ErrorFormat, status int, err error, details interface{}) {
+	if req != nil {
+		if info := getRequestInfo(req); info != nil && info.errorRenderer != nil {
+			info.errorRenderer(resp, req, status, err, details)
+			return
+		}
+	}
+	renderError(resp, req, f, status, err, details)
+}
+
+// renderError writes the error in format f
+func renderError(resp http.ResponseWriter, req *http.Request, f ErrorFormat, status int, err error, details interface{}) {
+	if f == ProblemJSONErrors {
+		p := NewProblem(req, status, err)
+		p.Errors = details
+		WriteProblem(resp, p)
+		return
+	}
+	if details != nil {
+		b, _ := json.Marshal(map[string]interface{}{"errors": details})
+		resp.Header().Set("Content-Type", "application/json")
+		resp.WriteHeader(status)
+		resp.Write(b)
+		return
+	}
+	resp.WriteHeader(status)
+	if err != nil {
+		resp.Write([]byte(err.Error()))
+	}
+}
+
+// renderUnwritten renders with the error renderer, if set, the error of a
+// route handler which did not write a response
+func (h *Handler) renderUnwritten(rr *ResponseRecorder, req *http.Request, err error) {
+	if h.errorRenderer == nil || rr.WroteHeader || rr.Hijacked {
+		return
+	}
+	h.errorRenderer(rr, req, http.StatusInternalServerError, err, nil)
+}
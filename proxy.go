@@ -0,0 +1,165 @@
+package hang
+
+import (
+	"context"
+	"math/rand"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ProxyOptions configures a proxy route
+type ProxyOptions struct {
+	// Forward only the part matched by the * of a wildcard route
+	StripPrefix bool
+	// Headers set on and removed from the forwarded request
+	SetHeaders    map[string]string
+	RemoveHeaders []string
+	// Headers set on the response to the client
+	SetResponseHeaders map[string]string
+	// Timeout of every attempt until the response headers, none if zero
+	Timeout time.Duration
+	// Retries on connection errors and 502/503/504 for idempotent requests
+	// without body
+	Retries int
+	// Wait before the first retry, doubled at every retry, 100ms if zero
+	RetryBackoff time.Duration
+	// Transport to the target, http.DefaultTransport if nil
+	Transport http.RoundTripper
+}
+
+// AddProxyRoute forwards the requests for route (usually a wildcard route
+// such as "legacy/*") to target, logging every proxied request
+func (h *Handler) AddProxyRoute(route, target string, opts ProxyOptions) error {
+	u, err := url.Parse(target)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return errors.New("invalid proxy target " + target)
+	}
+	transport := opts.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	if opts.RetryBackoff <= 0 {
+		opts.RetryBackoff = 100 * time.Millisecond
+	}
+	rp := &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			if opts.StripPrefix {
+				pr.Out.URL.Path = "/" + RouteSuffix(pr.In)
+				pr.Out.URL.RawPath = ""
+			}
+			pr.SetURL(u)
+			pr.SetXForwarded()
+			pr.Out.Host = u.Host
+			for _, k := range opts.RemoveHeaders {
+				pr.Out.Header.Del(k)
+			}
+			for k, v := range opts.SetHeaders {
+				pr.Out.Header.Set(k, v)
+			}
+			if id := GetRequestID(pr.In); id != "" {
+				pr.Out.Header.Set(RequestIDHeader, id)
+			}
+		},
+		Transport: &proxyTransport{base: transport, timeout: opts.Timeout, retries: opts.Retries, backoff: opts.RetryBackoff},
+		ModifyResponse: func(resp *http.Response) error {
+			for k, v := range opts.SetResponseHeaders {
+				resp.Header.Set(k, v)
+			}
+			return nil
+		},
+		ErrorHandler: func(resp http.ResponseWriter, req *http.Request, err error) {
+			status := http.StatusBadGateway
+			if errors.Is(err, context.DeadlineExceeded) {
+				status = http.StatusGatewayTimeout
+			}
+			WriteError(resp, req, status, errors.New(http.StatusText(status)))
+			h.Log.WithFields(Fields{"route": RouteFrom(req), "target": u.Host, "origin": RealIP(req)}).Error(errors.Wrap(err, "proxy error"))
+		},
+	}
+	return h.AddRoute(route, func(resp http.ResponseWriter, req *http.Request) error {
+		start := time.Now()
+		rr := NewResponseRecorder(resp)
+		rp.ServeHTTP(rr, req)
+		h.Log.WithFields(Fields{
+			"route":      RouteFrom(req),
+			"method":     req.Method,
+			"path":       req.URL.RequestURI(),
+			"target":     u.Host,
+			"status":     rr.Status,
+			"bytes":      rr.Bytes,
+			"latency_ms": float64(time.Since(start).Microseconds()) / 1000,
+			"origin":     RealIP(req),
+		}).Info("proxied request")
+		return nil
+	})
+}
+
+// proxyTransport adds per-attempt timeouts and retries with backoff to the
+// proxy
+type proxyTransport struct {
+	base    http.RoundTripper
+	timeout time.Duration
+	retries int
+	backoff time.Duration
+}
+
+func (t *proxyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	retries := t.retries
+	if !isIdempotent(req) || (req.Body != nil && req.Body != http.NoBody) {
+		retries = 0
+	}
+	for attempt := 0; ; attempt++ {
+		resp, cancel, err := t.attempt(req)
+		retry := err != nil || resp.StatusCode == http.StatusBadGateway ||
+			resp.StatusCode == http.StatusServiceUnavailable || resp.StatusCode == http.StatusGatewayTimeout
+		if !retry || attempt >= retries || req.Context().Err() != nil {
+			if err != nil {
+				cancel()
+				return nil, err
+			}
+			// Release the attempt context when the body is closed
+			resp.Body = &cancelBody{ReadCloser: resp.Body, cancel: cancel}
+			return resp, nil
+		}
+		if resp != nil {
+			resp.Body.Close()
+		}
+		cancel()
+
+		// Between d/2 and d, as the Client does
+		d := t.backoff << uint(attempt)
+		if d <= 0 || d > 5*time.Second {
+			d = 5 * time.Second
+		}
+		select {
+		case <-time.After(d/2 + time.Duration(rand.Int63n(int64(d/2)+1))):
+		case <-req.Context().Done():
+			return nil, errors.Wrap(req.Context().Err(), "request cancelled while waiting to retry")
+		}
+	}
+}
+
+// attempt sends req once, bounding with the timeout the wait for the
+// response headers only: the body can take as long as the client waits. The
+// returned function releases the attempt.
+func (t *proxyTransport) attempt(req *http.Request) (*http.Response, context.CancelFunc, error) {
+	ctx, cancel := context.WithCancel(req.Context())
+	if t.timeout <= 0 {
+		resp, err := t.base.RoundTrip(req.WithContext(ctx))
+		return resp, cancel, err
+	}
+	timer := time.AfterFunc(t.timeout, cancel)
+	resp, err := t.base.RoundTrip(req.WithContext(ctx))
+	if !timer.Stop() {
+		// Timed out, possibly while the headers were arriving
+		if resp != nil {
+			resp.Body.Close()
+		}
+		return nil, cancel, errors.Wrapf(context.DeadlineExceeded, "no response headers within %v", t.timeout)
+	}
+	return resp, cancel, err
+}
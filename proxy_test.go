@@ -0,0 +1,86 @@
+package hang
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestProxyTimeout(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/stream":
+			// Headers in time, body slower than the timeout
+			for i := 0; i < 5; i++ {
+				resp.Write([]byte("chunk\n"))
+				resp.(http.Flusher).Flush()
+				time.Sleep(60 * time.Millisecond)
+			}
+		case "/slow":
+			time.Sleep(300 * time.Millisecond)
+		}
+	}))
+	defer backend.Close()
+	h := testHandler(t)
+	if err := h.AddProxyRoute("*", backend.URL, ProxyOptions{Timeout: 100 * time.Millisecond}); err != nil {
+		t.Fatal(err)
+	}
+	front := httptest.NewServer(h)
+	defer front.Close()
+
+	resp, err := http.Get(front.URL + "/stream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil || resp.StatusCode != http.StatusOK || strings.Count(string(body), "chunk") != 5 {
+		t.Errorf("streamed body: got status %d, %d chunks, error %v, want the whole body", resp.StatusCode, strings.Count(string(body), "chunk"), err)
+	}
+
+	resp, err = http.Get(front.URL + "/slow")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusGatewayTimeout {
+		t.Errorf("slow headers: got status %d, want %d", resp.StatusCode, http.StatusGatewayTimeout)
+	}
+}
+
+func TestProxyRetries(t *testing.T) {
+	var calls int32
+	backend := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			resp.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		resp.Write([]byte("ok"))
+	}))
+	defer backend.Close()
+	h := testHandler(t)
+	if err := h.AddProxyRoute("*", backend.URL, ProxyOptions{Retries: 2, RetryBackoff: 40 * time.Millisecond}); err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	rec := serve(h, http.MethodGet, "/", nil)
+	elapsed := time.Since(start)
+	if rec.Code != http.StatusOK || atomic.LoadInt32(&calls) != 3 {
+		t.Errorf("got status %d after %d attempts, want 200 after 3", rec.Code, calls)
+	}
+	// 20-40ms then 40-80ms
+	if elapsed < 60*time.Millisecond {
+		t.Errorf("retried after %v, want a backoff between the attempts", elapsed)
+	}
+
+	atomic.StoreInt32(&calls, 0)
+	serve(h, http.MethodPost, "/", nil)
+	if atomic.LoadInt32(&calls) != 1 {
+		t.Errorf("POST attempted %d times, want no retry", calls)
+	}
+}
@@ -0,0 +1,197 @@
+package hang
+
+import (
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	timeType     = reflect.TypeOf(time.Time{})
+	durationType = reflect.TypeOf(time.Duration(0))
+)
+
+// BindQuery maps the query parameters of req onto the struct pointed by data.
+// Parameters are matched by the "query" tag (then "json", then the field
+// name), missing ones take the value of the "default" tag. Slices accept both
+// repeated and comma separated values, times are RFC3339 or 2006-01-02.
+// Conversion failures are returned as ValidationErrors.
+func BindQuery(req *http.Request, data interface{}) error {
+	v := reflect.ValueOf(data)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		return errors.New("BindQuery needs a pointer to struct")
+	}
+	var ve ValidationErrors
+	bindQuery(v.Elem(), req.URL.Query(), &ve)
+	if len(ve) > 0 {
+		return ve
+	}
+	return nil
+}
+
+// GetReqQueryData works like BindQuery and then validates the struct,
+// responding 400 with the list of field errors on failure
+func GetReqQueryData(resp http.ResponseWriter, req *http.Request, data interface{}) error {
+	var (
+		err error
+		ve  ValidationErrors
+	)
+	err = BindQuery(req, data)
+	if err == nil {
+		err = Validate(data)
+	}
+	if err == nil {
+		return nil
+	}
+	if !errors.As(err, &ve) {
+		// Respond
+		WriteError(resp, req, http.StatusInternalServerError, err)
+		return err
+	}
+	// Respond with the field errors
+	writeError(resp, req, RequestErrorFormat(req), http.StatusBadRequest, err, ve)
+	return err
+}
+
+// bindQuery sets the fields of v, recursing into embedded structs
+func bindQuery(v reflect.Value, query map[string][]string, ve *ValidationErrors) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.PkgPath != "" {
+			// Unexported
+			continue
+		}
+		if sf.Anonymous && sf.Type.Kind() == reflect.Struct {
+			bindQuery(v.Field(i), query, ve)
+			continue
+		}
+		name := queryName(sf)
+		if name == "" {
+			continue
+		}
+		values, ok := query[name]
+		if !ok {
+			def, hasDefault := sf.Tag.Lookup("default")
+			if !hasDefault {
+				continue
+			}
+			values = []string{def}
+		}
+		if err := setQueryValue(v.Field(i), values); err != nil {
+			*ve = append(*ve, FieldError{
+				Field:   name,
+				Rule:    "type",
+				Param:   sf.Type.String(),
+				Message: name + " is not a valid " + sf.Type.String(),
+			})
+		}
+	}
+}
+
+// queryName returns the parameter name of the field, empty if skipped
+func queryName(sf reflect.StructField) string {
+	for _, key := range []string{"query", "json"} {
+		name := strings.SplitN(sf.Tag.Get(key), ",", 2)[0]
+		if name == "-" {
+			return ""
+		}
+		if name != "" {
+			return name
+		}
+	}
+	return sf.Name
+}
+
+// setQueryValue parses values into v according to its type
+func setQueryValue(v reflect.Value, values []string) error {
+	if v.Kind() == reflect.Ptr {
+		p := reflect.New(v.Type().Elem())
+		if err := setQueryValue(p.Elem(), values); err != nil {
+			return err
+		}
+		v.Set(p)
+		return nil
+	}
+	if v.Kind() == reflect.Slice && v.Type().Elem().Kind() != reflect.Uint8 {
+		var parts []string
+		for _, value := range values {
+			if value == "" {
+				continue
+			}
+			parts = append(parts, strings.Split(value, ",")...)
+		}
+		sl := reflect.MakeSlice(v.Type(), len(parts), len(parts))
+		for i, p := range parts {
+			if err := setQueryString(sl.Index(i), strings.TrimSpace(p)); err != nil {
+				return err
+			}
+		}
+		v.Set(sl)
+		return nil
+	}
+	// The first value wins
+	return setQueryString(v, values[0])
+}
+
+// setQueryString parses s into the scalar v
+func setQueryString(v reflect.Value, s string) error {
+	switch v.Type() {
+	case durationType:
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	case timeType:
+		t, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			t, err = time.Parse("2006-01-02", s)
+		}
+		if err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(t))
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		// A bare flag (?verbose) is true
+		if s == "" {
+			s = "true"
+		}
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(n)
+	default:
+		return errors.New("unsupported type " + v.Type().String())
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package hang
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// SetTrustedProxies sets the addresses (IPs or CIDRs) of the load balancers
+// and proxies in front of the service, whose X-Forwarded-For header is used
+// to find the client address returned by RealIP
+func (h *Handler) SetTrustedProxies(proxies ...string) error {
+	trusted, err := parseCIDRs(proxies)
+	if err != nil {
+		return errors.Wrap(err, "invalid trusted proxies")
+	}
+	h.trustedProxies = trusted
+	return nil
+}
+
+// RealIP returns the address of the client, resolved by the Handler through
+// the trusted proxies, or the peer address for requests not routed by a
+// Handler
+func RealIP(req *http.Request) string {
+	if info := getRequestInfo(req); info != nil {
+		return info.realIP
+	}
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return req.RemoteAddr
+	}
+	return host
+}
+
+// clientIP returns the address of the client resolved through the trusted
+// proxies
+func (h *Handler) clientIP(req *http.Request) string {
+	ip := resolveClientIP(req, h.trustedProxies)
+	if ip == nil {
+		return RealIP(req)
+	}
+	return ip.String()
+}
+
+// resolveClientIP returns the address of the client: the peer address
+// unless it is a trusted proxy, in which case the X-Forwarded-For entries
+// are walked from the closest one, skipping the trusted proxies
+func resolveClientIP(req *http.Request, trusted []*net.IPNet) net.IP {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		host = req.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !containsIP(trusted, ip) {
+		return ip
+	}
+	forwarded := strings.Split(strings.Join(req.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		hop := net.ParseIP(strings.TrimSpace(forwarded[i]))
+		if hop == nil {
+			// Garbage in the header, stop at the last valid hop
+			break
+		}
+		ip = hop
+		if !containsIP(trusted, hop) {
+			break
+		}
+	}
+	return ip
+}
@@ -0,0 +1,96 @@
+package hang
+
+import (
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// captureRef matches the $1 and ${name} references of a redirect target
+var captureRef = regexp.MustCompile(`\$(\d+|\{\w+\})`)
+
+// AddRedirect redirects the requests for from to to with code (301 if
+// zero), keeping the query string. from is any route: exact, with :params,
+// wildcard or regex (~pattern). The :name segments of to are replaced with
+// the params of from, a * segment with the part matched by the wildcard and
+// $1 or ${name} with the capture groups of the regex, e.g.
+// AddRedirect("blog/:year/:slug", "/articles/:slug", 0) or
+// AddRedirect(`~post-(\d+)\.html`, "/posts/$1", http.StatusFound).
+func (h *Handler) AddRedirect(from, to string, code int) error {
+	if code == 0 {
+		code = http.StatusMovedPermanently
+	}
+	if code < 300 || code > 399 {
+		return errors.New("invalid redirect status " + strconv.Itoa(code))
+	}
+	if !strings.Contains(to, "://") && !strings.HasPrefix(to, "/") {
+		to = "/" + to
+	}
+	local := !strings.Contains(to, "://")
+	redirect := func(resp http.ResponseWriter, req *http.Request) error {
+		target := redirectTarget(req, to)
+		// The substituted values must not turn the path into a host
+		if local && (strings.HasPrefix(target, "//") || strings.HasPrefix(target, `/\`)) {
+			WriteError(resp, req, http.StatusBadRequest, errors.New("invalid redirect target"))
+			return nil
+		}
+		http.Redirect(resp, req, target, code)
+		return nil
+	}
+	if isRegexRoute(from) {
+		return h.AddRegexRoute(strings.TrimPrefix(from, RegexPrefix), redirect)
+	}
+	return h.AddRoute(from, redirect)
+}
+
+// redirectTarget returns to with the references to the matched route
+// replaced, escaped, and the query string of req appended
+func redirectTarget(req *http.Request, to string) string {
+	target, query := to, ""
+	if i := strings.Index(to, "?"); i >= 0 {
+		target, query = to[:i], to[i+1:]
+	}
+	segs := strings.Split(target, "/")
+	for i, seg := range segs {
+		switch {
+		case seg == "*":
+			segs[i] = escapeSegments(RouteSuffix(req))
+		case strings.HasPrefix(seg, ":") && len(seg) > 1:
+			segs[i] = url.PathEscape(Param(req, seg[1:]))
+		}
+	}
+	target = strings.Join(segs, "/")
+	target = captureRef.ReplaceAllStringFunc(target, func(ref string) string {
+		ref = strings.Trim(ref[1:], "{}")
+		if n, err := strconv.Atoi(ref); err == nil {
+			if captures := RouteCaptures(req); n < len(captures) {
+				return escapeSegments(captures[n])
+			}
+			return ""
+		}
+		return escapeSegments(RouteCapture(req, ref))
+	})
+	if req.URL.RawQuery != "" {
+		if query != "" {
+			query += "&"
+		}
+		query += req.URL.RawQuery
+	}
+	if query != "" {
+		target += "?" + query
+	}
+	return target
+}
+
+// escapeSegments escapes every segment of the path p
+func escapeSegments(p string) string {
+	segs := strings.Split(p, "/")
+	for i, seg := range segs {
+		segs[i] = url.PathEscape(seg)
+	}
+	return strings.Join(segs, "/")
+}
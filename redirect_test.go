@@ -0,0 +1,45 @@
+package hang
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestAddRedirect(t *testing.T) {
+	h := testHandler(t)
+	for _, r := range []struct{ from, to string }{
+		{"old/*", "/*"},
+		{"blog/:year/:slug", "/articles/:slug"},
+		{`~post-(.+)\.html`, "/posts/$1"},
+		{"ext/*", "https://example.com/*"},
+	} {
+		if err := h.AddRedirect(r.from, r.to, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := []struct {
+		target   string
+		status   int
+		location string
+	}{
+		{"/old/a/b?x=1", http.StatusMovedPermanently, "/a/b?x=1"},
+		{"/blog/2020/hello", http.StatusMovedPermanently, "/articles/hello"},
+		{"/post-42.html", http.StatusMovedPermanently, "/posts/42"},
+		{"/ext/a", http.StatusMovedPermanently, "https://example.com/a"},
+		// Open redirects
+		{"/old//evil.com", http.StatusBadRequest, ""},
+		{`/old/\evil.com`, http.StatusMovedPermanently, "/%5Cevil.com"},
+		{"/blog/2020/a%20b%3F", http.StatusMovedPermanently, "/articles/a%20b%3F"},
+		{`/blog/2020/\evil.com`, http.StatusMovedPermanently, "/articles/%5Cevil.com"},
+		{"/post-/evil.com.html", http.StatusMovedPermanently, "/posts/evil.com"},
+	}
+	for _, tt := range tests {
+		resp := serve(h, "GET", tt.target, nil)
+		if resp.Code != tt.status {
+			t.Errorf("%v: status %v, want %v", tt.target, resp.Code, tt.status)
+		}
+		if got := resp.Header().Get("Location"); got != tt.location {
+			t.Errorf("%v: location %q, want %q", tt.target, got, tt.location)
+		}
+	}
+}
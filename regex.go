@@ -0,0 +1,94 @@
+package hang
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// RegexPrefix marks the regex routes among the registered routes
+const RegexPrefix = "~"
+
+// regexRoute is a compiled regex route
+type regexRoute struct {
+	route string
+	re    *regexp.Regexp
+}
+
+// regexMatch holds the capture groups of the matched regex route
+type regexMatch struct {
+	names  []string
+	values []string
+}
+
+// AddRegexRoute registers a handler for the paths matching pattern, a
+// regular expression matched against the whole path without leading and
+// trailing slashes, e.g. `article-(?P<id>\d+)\.html`. The capture groups are
+// available to the handler through RouteCapture and RouteCaptures. The
+// route is registered as ~pattern; regex routes are tried after the exact
+// ones, in registration order.
+func (h *Handler) AddRegexRoute(pattern string, handleFunc HandleFunc) error {
+	re, err := regexp.Compile("^(?:" + pattern + ")$")
+	if err != nil {
+		return errors.Wrap(err, "invalid route pattern "+pattern)
+	}
+	route := RegexPrefix + pattern
+	err = h.AddRoute(route, handleFunc)
+	if err != nil {
+		return err
+	}
+	h.regexRoutes = append(h.regexRoutes, regexRoute{route: route, re: re})
+	return nil
+}
+
+// deleteRegexRoute removes route from the regex routes
+func (h *Handler) deleteRegexRoute(route string) {
+	for i, rr := range h.regexRoutes {
+		if rr.route == route {
+			h.regexRoutes = append(h.regexRoutes[:i:i], h.regexRoutes[i+1:]...)
+			return
+		}
+	}
+}
+
+// isRegexRoute tells if route was registered with AddRegexRoute
+func isRegexRoute(route string) bool {
+	return strings.HasPrefix(route, RegexPrefix)
+}
+
+// matchRegex returns the first regex route matching path with the request
+// carrying the capture groups
+func (h *Handler) matchRegex(req *http.Request, path string) (string, *http.Request) {
+	for _, rr := range h.regexRoutes {
+		if h.Routes[rr.route] == nil {
+			continue
+		}
+		if m := rr.re.FindStringSubmatch(path); m != nil {
+			ctx := context.WithValue(req.Context(), capturesKey, regexMatch{names: rr.re.SubexpNames(), values: m})
+			return rr.route, req.WithContext(ctx)
+		}
+	}
+	return "", req
+}
+
+// RouteCaptures returns the capture groups of the regex route matched by
+// the request, the whole path first as in regexp.FindStringSubmatch
+func RouteCaptures(req *http.Request) []string {
+	m, _ := req.Context().Value(capturesKey).(regexMatch)
+	return m.values
+}
+
+// RouteCapture returns the named capture group of the regex route matched
+// by the request, "" if missing
+func RouteCapture(req *http.Request, name string) string {
+	m, _ := req.Context().Value(capturesKey).(regexMatch)
+	for i, n := range m.names {
+		if n == name && i < len(m.values) {
+			return m.values[i]
+		}
+	}
+	return ""
+}
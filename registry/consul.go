@@ -0,0 +1,134 @@
+package registry
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Consul registers the services on the local Consul agent with a TTL
+// check and, if the service has a HealthURL, an HTTP check
+type Consul struct {
+	// Agent address and ACL token, from CONSUL_HTTP_ADDR and
+	// CONSUL_HTTP_TOKEN by default
+	Addr  string
+	Token string
+	// Time after which Consul removes a critical service, 1m if zero
+	DeregisterCriticalAfter time.Duration
+	Client                  *http.Client
+}
+
+// NewConsul returns a registry on the Consul agent at addr
+func NewConsul(addr, token string) *Consul {
+	if addr == "" {
+		addr = os.Getenv("CONSUL_HTTP_ADDR")
+	}
+	if addr == "" {
+		addr = "http://127.0.0.1:8500"
+	}
+	if !strings.Contains(addr, "://") {
+		addr = "http://" + addr
+	}
+	if token == "" {
+		token = os.Getenv("CONSUL_HTTP_TOKEN")
+	}
+	return &Consul{
+		Addr:                    strings.TrimSuffix(addr, "/"),
+		Token:                   token,
+		DeregisterCriticalAfter: time.Minute,
+		Client:                  &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// consulCheck is a check of the agent service registration
+type consulCheck struct {
+	CheckID                        string `json:"CheckID,omitempty"`
+	TTL                            string `json:"TTL,omitempty"`
+	HTTP                           string `json:"HTTP,omitempty"`
+	Interval                       string `json:"Interval,omitempty"`
+	DeregisterCriticalServiceAfter string `json:"DeregisterCriticalServiceAfter,omitempty"`
+}
+
+// Register registers the service with its checks
+func (c *Consul) Register(ctx context.Context, svc Service) error {
+	svc = svc.withDefaults()
+	checks := []consulCheck{{
+		CheckID:                        ttlCheckID(svc),
+		TTL:                            svc.TTL.String(),
+		DeregisterCriticalServiceAfter: c.DeregisterCriticalAfter.String(),
+	}}
+	if svc.HealthURL != "" {
+		checks = append(checks, consulCheck{HTTP: svc.HealthURL, Interval: (svc.TTL / 2).String()})
+	}
+	body := map[string]interface{}{
+		"ID":      svc.ID,
+		"Name":    svc.Name,
+		"Address": svc.Address,
+		"Port":    svc.Port,
+		"Tags":    svc.Tags,
+		"Meta":    svc.Meta,
+		"Checks":  checks,
+	}
+	err := doJSON(ctx, c.Client, http.MethodPut, c.Addr+"/v1/agent/service/register", c.header(), body, nil)
+	if err != nil {
+		return err
+	}
+	// Passing from the start
+	return c.Refresh(ctx, svc)
+}
+
+// Refresh passes the TTL check
+func (c *Consul) Refresh(ctx context.Context, svc Service) error {
+	svc = svc.withDefaults()
+	return doJSON(ctx, c.Client, http.MethodPut, c.Addr+"/v1/agent/check/pass/"+url.PathEscape(ttlCheckID(svc)), c.header(), nil, nil)
+}
+
+// Deregister removes the service and its checks
+func (c *Consul) Deregister(ctx context.Context, svc Service) error {
+	svc = svc.withDefaults()
+	return doJSON(ctx, c.Client, http.MethodPut, c.Addr+"/v1/agent/service/deregister/"+url.PathEscape(svc.ID), c.header(), nil, nil)
+}
+
+func (c *Consul) header() http.Header {
+	h := http.Header{}
+	if c.Token != "" {
+		h.Set("X-Consul-Token", c.Token)
+	}
+	return h
+}
+
+func ttlCheckID(svc Service) string {
+	return "service:" + svc.ID + ":ttl"
+}
+
+// Resolve returns the addresses of the passing instances of service, for
+// the hang Client Resolver
+func (c *Consul) Resolve(ctx context.Context, service string) ([]string, error) {
+	var entries []struct {
+		Node struct {
+			Address string
+		}
+		Service struct {
+			Address string
+			Port    int
+		}
+	}
+	err := doJSON(ctx, c.Client, http.MethodGet, c.Addr+"/v1/health/service/"+url.PathEscape(service)+"?passing=true", c.header(), nil, &entries)
+	if err != nil {
+		return nil, err
+	}
+	addrs := make([]string, 0, len(entries))
+	for _, e := range entries {
+		host := e.Service.Address
+		if host == "" {
+			host = e.Node.Address
+		}
+		addrs = append(addrs, net.JoinHostPort(host, strconv.Itoa(e.Service.Port)))
+	}
+	return addrs, nil
+}
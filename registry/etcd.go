@@ -0,0 +1,154 @@
+package registry
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Etcd registers the services in etcd, through its v3 JSON gateway, as
+// keys Prefix/name/id holding the JSON Service and bound to a lease of the
+// service TTL
+type Etcd struct {
+	// Endpoint of the etcd cluster, http://127.0.0.1:2379 if empty
+	Endpoint string
+	// Prefix of the keys, "/services" if empty
+	Prefix string
+	Client *http.Client
+
+	mu     sync.Mutex
+	leases map[string]string
+}
+
+// NewEtcd returns a registry on the etcd cluster at endpoint
+func NewEtcd(endpoint string) *Etcd {
+	if endpoint == "" {
+		endpoint = "http://127.0.0.1:2379"
+	}
+	return &Etcd{
+		Endpoint: strings.TrimSuffix(endpoint, "/"),
+		Prefix:   "/services",
+		Client:   &http.Client{Timeout: 10 * time.Second},
+		leases:   map[string]string{},
+	}
+}
+
+// Key returns the key of the service instance
+func (e *Etcd) Key(svc Service) string {
+	svc = svc.withDefaults()
+	return strings.TrimSuffix(e.Prefix, "/") + "/" + svc.Name + "/" + svc.ID
+}
+
+// Register grants a lease and puts the service key bound to it
+func (e *Etcd) Register(ctx context.Context, svc Service) error {
+	svc = svc.withDefaults()
+	var grant struct {
+		ID string `json:"ID"`
+	}
+	ttl := int64(svc.TTL / time.Second)
+	if ttl < 1 {
+		ttl = 1
+	}
+	err := doJSON(ctx, e.Client, http.MethodPost, e.Endpoint+"/v3/lease/grant", nil, map[string]interface{}{"TTL": ttl}, &grant)
+	if err != nil {
+		return errors.Wrap(err, "can't grant lease")
+	}
+	value, err := json.Marshal(svc)
+	if err != nil {
+		return errors.Wrap(err, "can't encode service")
+	}
+	err = doJSON(ctx, e.Client, http.MethodPost, e.Endpoint+"/v3/kv/put", nil, map[string]interface{}{
+		"key":   b64(e.Key(svc)),
+		"value": base64.StdEncoding.EncodeToString(value),
+		"lease": grant.ID,
+	}, nil)
+	if err != nil {
+		return errors.Wrap(err, "can't put service key")
+	}
+	e.mu.Lock()
+	e.leases[svc.ID] = grant.ID
+	e.mu.Unlock()
+	return nil
+}
+
+// Refresh keeps the lease alive, registering again if it expired
+func (e *Etcd) Refresh(ctx context.Context, svc Service) error {
+	svc = svc.withDefaults()
+	e.mu.Lock()
+	lease, ok := e.leases[svc.ID]
+	e.mu.Unlock()
+	if !ok {
+		return e.Register(ctx, svc)
+	}
+	var ka struct {
+		Result struct {
+			TTL string `json:"TTL"`
+		} `json:"result"`
+	}
+	err := doJSON(ctx, e.Client, http.MethodPost, e.Endpoint+"/v3/lease/keepalive", nil, map[string]interface{}{"ID": lease}, &ka)
+	if err != nil {
+		return errors.Wrap(err, "can't keep lease alive")
+	}
+	if ttl, _ := strconv.ParseInt(ka.Result.TTL, 10, 64); ttl <= 0 {
+		// Expired, the key is gone
+		return e.Register(ctx, svc)
+	}
+	return nil
+}
+
+// Deregister revokes the lease, deleting the key
+func (e *Etcd) Deregister(ctx context.Context, svc Service) error {
+	svc = svc.withDefaults()
+	e.mu.Lock()
+	lease, ok := e.leases[svc.ID]
+	delete(e.leases, svc.ID)
+	e.mu.Unlock()
+	if !ok {
+		return nil
+	}
+	err := doJSON(ctx, e.Client, http.MethodPost, e.Endpoint+"/v3/lease/revoke", nil, map[string]interface{}{"ID": lease}, nil)
+	return errors.Wrap(err, "can't revoke lease")
+}
+
+func b64(s string) string {
+	return base64.StdEncoding.EncodeToString([]byte(s))
+}
+
+// Resolve returns the addresses of the registered instances of service,
+// for the hang Client Resolver
+func (e *Etcd) Resolve(ctx context.Context, service string) ([]string, error) {
+	prefix := strings.TrimSuffix(e.Prefix, "/") + "/" + service + "/"
+	// The range end of a prefix is the prefix with the last byte incremented
+	end := []byte(prefix)
+	end[len(end)-1]++
+	var rng struct {
+		KVs []struct {
+			Value string `json:"value"`
+		} `json:"kvs"`
+	}
+	err := doJSON(ctx, e.Client, http.MethodPost, e.Endpoint+"/v3/kv/range", nil, map[string]interface{}{
+		"key":       b64(prefix),
+		"range_end": base64.StdEncoding.EncodeToString(end),
+	}, &rng)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't list instances of "+service)
+	}
+	addrs := make([]string, 0, len(rng.KVs))
+	for _, kv := range rng.KVs {
+		var svc Service
+		b, err := base64.StdEncoding.DecodeString(kv.Value)
+		if err != nil || json.Unmarshal(b, &svc) != nil {
+			continue
+		}
+		addrs = append(addrs, net.JoinHostPort(svc.Address, strconv.Itoa(svc.Port)))
+	}
+	return addrs, nil
+}
@@ -0,0 +1,146 @@
+// Package registry registers the service in a service registry, Consul or
+// etcd, for the other services to find it: Attach registers it once the
+// handler is listening, keeps the registration alive while the handler is
+// ready and deregisters it in the lifecycle shutdown hooks. The registries
+// also resolve the services for the hang Client (see ClientOptions.Resolver).
+package registry
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/brunetto/hang"
+	"github.com/pkg/errors"
+)
+
+// Service is a registered instance of a service
+type Service struct {
+	// Unique ID of the instance, name-hostname-port if empty
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	// Address and port the instance is reachable at
+	Address string            `json:"address"`
+	Port    int               `json:"port"`
+	Tags    []string          `json:"tags,omitempty"`
+	Meta    map[string]string `json:"meta,omitempty"`
+	// URL polled by the registry, if it can, to check the instance health,
+	// e.g. http://10.0.0.1:8080/readycheck
+	HealthURL string `json:"health_url,omitempty"`
+	// Time the registration survives without being refreshed, 15s if zero
+	TTL time.Duration `json:"-"`
+}
+
+// Registry is a service registry
+type Registry interface {
+	// Register adds the instance to the registry
+	Register(ctx context.Context, svc Service) error
+	// Refresh keeps the registration alive
+	Refresh(ctx context.Context, svc Service) error
+	// Deregister removes the instance from the registry
+	Deregister(ctx context.Context, svc Service) error
+}
+
+// withDefaults fills the ID and the TTL
+func (svc Service) withDefaults() Service {
+	if svc.ID == "" {
+		host, _ := os.Hostname()
+		svc.ID = svc.Name + "-" + host + "-" + strconv.Itoa(svc.Port)
+	}
+	if svc.TTL <= 0 {
+		svc.TTL = 15 * time.Second
+	}
+	return svc
+}
+
+// Attach registers svc on r as part of the lifecycle: once h is listening
+// the service is registered, then refreshed every TTL/2 while h is ready,
+// letting the registration expire otherwise; a shutdown hook deregisters
+// it. h may be nil for services without a Handler.
+func Attach(l *hang.Lifecycle, h *hang.Handler, r Registry, svc Service) {
+	svc = svc.withDefaults()
+	fields := hang.Fields{"service": svc.Name, "id": svc.ID}
+	l.AddFunc("registry "+svc.ID, func(ctx context.Context) error {
+		if h != nil {
+			select {
+			case <-h.Listening():
+			case <-ctx.Done():
+				return nil
+			}
+		}
+		err := r.Register(ctx, svc)
+		if err != nil {
+			return errors.Wrap(err, "can't register "+svc.ID)
+		}
+		l.Log.WithFields(fields).Info("service registered")
+		ticker := time.NewTicker(svc.TTL / 2)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-ticker.C:
+			}
+			if h != nil {
+				if ready, _ := h.Ready(ctx); !ready {
+					l.Log.WithFields(fields).Warn("not ready, registration not refreshed")
+					continue
+				}
+			}
+			if err := r.Refresh(ctx, svc); err != nil {
+				// Retried at the next tick
+				l.Log.WithFields(fields).Warn(errors.Wrap(err, "can't refresh registration"))
+			}
+		}
+	})
+	l.AddShutdownHook(func(ctx context.Context) error {
+		err := r.Deregister(ctx, svc)
+		if err != nil {
+			return errors.Wrap(err, "can't deregister "+svc.ID)
+		}
+		l.Log.WithFields(fields).Info("service deregistered")
+		return nil
+	})
+}
+
+// doJSON calls url sending in, if not nil, and decoding the response
+// into out, if not nil
+func doJSON(ctx context.Context, client *http.Client, method, url string, header http.Header, in, out interface{}) error {
+	var body bytes.Buffer
+	if in != nil {
+		if err := json.NewEncoder(&body).Encode(in); err != nil {
+			return errors.Wrap(err, "can't encode request")
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, &body)
+	if err != nil {
+		return errors.Wrap(err, "can't create request")
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "can't reach registry")
+	}
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return errors.Wrap(err, "can't read registry response")
+	}
+	if resp.StatusCode != http.StatusOK {
+		return errors.Errorf("registry error on %v: %v %s", url, resp.Status, bytes.TrimSpace(b))
+	}
+	if out == nil || len(b) == 0 {
+		return nil
+	}
+	return errors.Wrap(json.Unmarshal(b, out), "can't decode registry response")
+}
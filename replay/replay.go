@@ -0,0 +1,175 @@
+// Package replay sends again against another host the requests recorded by
+// the hang Capture middleware, comparing the responses with the recorded
+// ones, e.g. to regression-test a refactoring on production traffic.
+package replay
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/brunetto/hang"
+	"github.com/pkg/errors"
+)
+
+// ReplayedHeader marks the replayed requests
+const ReplayedHeader = "X-Replayed-Request"
+
+// Options configures a Replayer
+type Options struct {
+	// Client sending the requests, http.DefaultClient if nil
+	Client *http.Client
+	// Timeout of every request, 10s if zero
+	Timeout time.Duration
+	// Headers set on every request, e.g. the credentials redacted at capture
+	Header http.Header
+	// Exchanges replayed, all if nil
+	Filter func(e hang.CapturedExchange) bool
+	// Whether to compare the response bodies too, not only the status
+	CompareBodies bool
+}
+
+// Result is the outcome of a replayed exchange
+type Result struct {
+	Exchange  hang.CapturedExchange
+	Status    int
+	Body      []byte
+	LatencyMs float64
+	// Error sending the request, the response fields are empty
+	Err            error
+	StatusMismatch bool
+	BodyMismatch   bool
+}
+
+// Summary counts the results of a replay
+type Summary struct {
+	Sent             int `json:"sent"`
+	Skipped          int `json:"skipped"`
+	Failed           int `json:"failed"`
+	StatusMismatches int `json:"status_mismatches"`
+	BodyMismatches   int `json:"body_mismatches"`
+}
+
+// Replayer sends the captured requests to a target
+type Replayer struct {
+	Log    hang.Logger
+	target *url.URL
+	opts   Options
+}
+
+// New returns a Replayer sending the requests to target, e.g.
+// http://localhost:8080
+func New(lg hang.Logger, target string, opts Options) (*Replayer, error) {
+	u, err := url.Parse(target)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return nil, errors.New("invalid replay target " + target)
+	}
+	if opts.Client == nil {
+		opts.Client = http.DefaultClient
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 10 * time.Second
+	}
+	return &Replayer{Log: lg, target: u, opts: opts}, nil
+}
+
+// Replay sends, one at a time and in order, the exchanges read as JSON
+// lines from r, calling fn, if not nil, with every result. Exchanges
+// filtered out or whose request body was truncated at capture are skipped.
+// It stops at the first malformed line or when ctx is done.
+func (rp *Replayer) Replay(ctx context.Context, r io.Reader, fn func(Result)) (Summary, error) {
+	var (
+		sum     Summary
+		scanner = bufio.NewScanner(r)
+	)
+	// Lines hold whole bodies
+	scanner.Buffer(make([]byte, 64<<10), 64<<20)
+	for line := 1; scanner.Scan(); line++ {
+		if ctx.Err() != nil {
+			return sum, ctx.Err()
+		}
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var e hang.CapturedExchange
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return sum, errors.Wrapf(err, "can't decode line %d", line)
+		}
+		if e.RequestTruncated || (rp.opts.Filter != nil && !rp.opts.Filter(e)) {
+			sum.Skipped++
+			continue
+		}
+		res := rp.Send(ctx, e)
+		sum.Sent++
+		switch {
+		case res.Err != nil:
+			sum.Failed++
+			rp.Log.WithFields(hang.Fields{"method": e.Method, "url": e.URL}).Warn(res.Err)
+		case res.StatusMismatch:
+			sum.StatusMismatches++
+		case res.BodyMismatch:
+			sum.BodyMismatches++
+		}
+		if fn != nil {
+			fn(res)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return sum, errors.Wrap(err, "can't read captured requests")
+	}
+	return sum, nil
+}
+
+// Send replays a single exchange
+func (rp *Replayer) Send(ctx context.Context, e hang.CapturedExchange) Result {
+	res := Result{Exchange: e}
+	ctx, cancel := context.WithTimeout(ctx, rp.opts.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, e.Method, strings.TrimSuffix(rp.target.String(), "/")+e.URL, bytes.NewReader(e.RequestBody))
+	if err != nil {
+		res.Err = errors.Wrap(err, "can't create request")
+		return res
+	}
+	for k, v := range e.RequestHeader {
+		// The redacted values are useless, Content-Length comes from the body
+		if len(v) == 1 && v[0] == "REDACTED" || k == "Content-Length" {
+			continue
+		}
+		req.Header[k] = v
+	}
+	for k, v := range rp.opts.Header {
+		req.Header[k] = v
+	}
+	req.Header.Set(ReplayedHeader, "true")
+
+	start := time.Now()
+	resp, err := rp.opts.Client.Do(req)
+	if err != nil {
+		res.Err = errors.Wrap(err, "can't replay request")
+		return res
+	}
+	defer resp.Body.Close()
+	res.Body, err = ioutil.ReadAll(resp.Body)
+	res.LatencyMs = float64(time.Since(start).Microseconds()) / 1000
+	if err != nil {
+		res.Err = errors.Wrap(err, "can't read response")
+		return res
+	}
+	res.Status = resp.StatusCode
+	res.StatusMismatch = res.Status != e.Status
+	if rp.opts.CompareBodies {
+		got := res.Body
+		if e.ResponseTruncated && len(got) > len(e.ResponseBody) {
+			got = got[:len(e.ResponseBody)]
+		}
+		res.BodyMismatch = !bytes.Equal(got, e.ResponseBody)
+	}
+	return res
+}
@@ -0,0 +1,103 @@
+package hang
+
+import (
+	"fmt"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/pkg/errors"
+)
+
+// ErrorReporter sends the errors of the route handlers, and their panics,
+// to an error tracking system such as Sentry
+type ErrorReporter interface {
+	// Report is called by Handle with the request and the error it logged.
+	// It must not block: slow reporters have to queue the reports.
+	Report(req *http.Request, report ErrorReport)
+}
+
+// ErrorReporterFunc adapts a function to the ErrorReporter interface
+type ErrorReporterFunc func(req *http.Request, report ErrorReport)
+
+// Report calls f
+func (f ErrorReporterFunc) Report(req *http.Request, report ErrorReport) {
+	f(req, report)
+}
+
+// ErrorReport describes an error of a route handler
+type ErrorReport struct {
+	// Error returned, a *PanicError for the recovered panics
+	Err error
+	// Route and name of the function handling it
+	Route    string
+	Function string
+	// Status of the response, 0 if not written
+	Status    int
+	RequestID string
+	Origin    string
+}
+
+// PanicError is the error of a route handler which panicked
+type PanicError struct {
+	// Value passed to panic
+	Value interface{}
+	// Stack of the goroutine when recovered
+	Stack []byte
+}
+
+// Error implements the error interface
+func (e *PanicError) Error() string {
+	return fmt.Sprint("panic: ", e.Value)
+}
+
+// SetErrorReporter sets the reporter of the errors returned by the route
+// handlers and of their recovered panics, nil to disable the reports
+func (h *Handler) SetErrorReporter(r ErrorReporter) {
+	h.errorReporter = r
+}
+
+// call runs the route handler recovering its panics, which are returned as
+// a *PanicError after a 500 response if none was written. The panics
+// aborting the response on purpose (http.ErrAbortHandler) go through.
+func (h *Handler) call(handler HandleFunc, rr *ResponseRecorder, req *http.Request) (err error) {
+	defer func() {
+		p := recover()
+		if p == nil {
+			return
+		}
+		if p == http.ErrAbortHandler {
+			panic(p)
+		}
+		err = &PanicError{Value: p, Stack: debug.Stack()}
+		if !rr.WroteHeader && !rr.Hijacked {
+			WriteError(rr, req, http.StatusInternalServerError, errors.New(http.StatusText(http.StatusInternalServerError)))
+		}
+	}()
+	return handler(rr, req)
+}
+
+// logHandlerError logs and reports the error of the handler of route
+func (h *Handler) logHandlerError(rr *ResponseRecorder, req *http.Request, route string, err error) {
+	if h.logEnabled(ErrorLevel) {
+		fields := Fields{"route": route, "function": h.handlerName(route), "origin": RealIP(req)}
+		var pe *PanicError
+		if errors.As(err, &pe) {
+			fields["stack"] = string(pe.Stack)
+		}
+		h.Log.WithFields(fields).Error(err)
+	}
+	if h.errorReporter == nil {
+		return
+	}
+	report := ErrorReport{
+		Err:       err,
+		Route:     route,
+		Function:  h.handlerName(route),
+		RequestID: GetRequestID(req),
+		Origin:    RealIP(req),
+	}
+	if rr.WroteHeader {
+		report.Status = rr.Status
+	}
+	h.errorReporter.Report(req, report)
+}
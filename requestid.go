@@ -0,0 +1,50 @@
+package hang
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+)
+
+// RequestIDHeader is the header carrying the request ID
+const RequestIDHeader = "X-Request-ID"
+
+// NewRequestID generates a random request ID
+func NewRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// RequestID is a middleware reusing the X-Request-ID header of the request,
+// or generating a new ID, storing it in the request context and in the
+// response header
+func RequestID() Middleware {
+	return func(next HandleFunc) HandleFunc {
+		return func(resp http.ResponseWriter, req *http.Request) error {
+			id := req.Header.Get(RequestIDHeader)
+			if id == "" {
+				id = NewRequestID()
+			}
+			resp.Header().Set(RequestIDHeader, id)
+			req = req.WithContext(context.WithValue(req.Context(), requestIDKey, id))
+			return next(resp, req)
+		}
+	}
+}
+
+// GetRequestID returns the ID of the request, from the context set by the
+// RequestID middleware or from the X-Request-ID header
+func GetRequestID(req *http.Request) string {
+	if id := RequestIDFromContext(req.Context()); id != "" {
+		return id
+	}
+	return req.Header.Get(RequestIDHeader)
+}
+
+// RequestIDFromContext returns the request ID stored by the RequestID middleware
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
@@ -0,0 +1,113 @@
+package hang
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"google.golang.org/protobuf/proto"
+)
+
+// MIMEText is the media type of plain text responses
+const MIMEText = "text/plain"
+
+// DefaultResponseType is the media type used by Respond when the client
+// accepts anything
+var DefaultResponseType = MIMEJSON
+
+// Respond serializes v as JSON, XML, MessagePack, Protobuf (for proto
+// messages) or plain text according to the Accept header of the request,
+// responding 406 if none of the accepted types is supported
+func Respond(resp http.ResponseWriter, req *http.Request, status int, v interface{}) error {
+	resp.Header().Add("Vary", "Accept")
+	_, isProto := v.(proto.Message)
+	mediaType := negotiateType(req.Header.Get("Accept"), isProto)
+	switch mediaType {
+	case MIMEJSON:
+		return WriteJSON(resp, status, v)
+	case MIMEXML:
+		return WriteXML(resp, status, v)
+	case MIMEMsgpack:
+		return WriteMsgpack(resp, status, v)
+	case MIMEProtobuf:
+		return WriteProto(resp, status, v.(proto.Message))
+	case MIMEText:
+		resp.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		resp.WriteHeader(status)
+		_, err := fmt.Fprint(resp, v)
+		return err
+	}
+	err := errors.New("none of the accepted media types is supported: " + req.Header.Get("Accept"))
+	// Respond
+	WriteError(resp, req, http.StatusNotAcceptable, err)
+	return err
+}
+
+// negotiateType returns the supported media type with the highest weight in
+// the Accept header, DefaultResponseType for wildcards or "" if none matches
+func negotiateType(accept string, withProto bool) string {
+	if strings.TrimSpace(accept) == "" {
+		return DefaultResponseType
+	}
+	supported := []string{MIMEJSON, MIMEXML, MIMEMsgpack, MIMEText}
+	if withProto {
+		supported = append(supported, MIMEProtobuf)
+	}
+	// Aliases of the supported types
+	aliases := map[string]string{
+		"text/xml":              MIMEXML,
+		"application/x-msgpack": MIMEMsgpack,
+		"application/protobuf":  MIMEProtobuf,
+	}
+	var (
+		best  string
+		bestQ float64
+	)
+	for _, part := range strings.Split(accept, ",") {
+		fields := strings.Split(strings.TrimSpace(part), ";")
+		mediaType := strings.ToLower(strings.TrimSpace(fields[0]))
+		q := 1.0
+		for _, p := range fields[1:] {
+			p = strings.TrimSpace(p)
+			if strings.HasPrefix(p, "q=") {
+				if v, err := strconv.ParseFloat(p[2:], 64); err == nil {
+					q = v
+				}
+			}
+		}
+		if q <= bestQ {
+			// The first one wins on equal weight
+			continue
+		}
+		if alias, ok := aliases[mediaType]; ok {
+			mediaType = alias
+		}
+		match := ""
+		switch {
+		case mediaType == "*/*":
+			match = DefaultResponseType
+		case strings.HasSuffix(mediaType, "/*"):
+			// Prefer the default if it matches the range
+			prefix := strings.TrimSuffix(mediaType, "*")
+			for _, s := range append([]string{DefaultResponseType}, supported...) {
+				if strings.HasPrefix(s, prefix) {
+					match = s
+					break
+				}
+			}
+		default:
+			for _, s := range supported {
+				if s == mediaType {
+					match = s
+					break
+				}
+			}
+		}
+		if match != "" {
+			best, bestQ = match, q
+		}
+	}
+	return best
+}
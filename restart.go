@@ -0,0 +1,124 @@
+//go:build !windows
+
+package hang
+
+import (
+	"context"
+	"net"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ListenFDsEnv is the environment variable used to pass the listening
+// sockets to the new process during a graceful restart: a comma separated
+// list of the addresses, in the same order of the file descriptors from 3
+const ListenFDsEnv = "HANG_LISTEN_FDS"
+
+// EnableGracefulRestart makes the handler restart with zero downtime on
+// SIGUSR2: a new process is started inheriting the listening sockets, then
+// the current one stops accepting connections and drains the in-flight
+// requests for up to drainTimeout, after which Serve returns.
+func (h *Handler) EnableGracefulRestart(drainTimeout time.Duration) {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGUSR2)
+	go func() {
+		for range c {
+			err := h.Restart(drainTimeout)
+			if err != nil {
+				h.Log.WithFields(Fields{"signal": "SIGUSR2"}).Error(err)
+				continue
+			}
+			signal.Stop(c)
+			return
+		}
+	}()
+}
+
+// Restart starts a copy of the current process passing it the listening
+// sockets, then gracefully shuts down the current servers
+func (h *Handler) Restart(drainTimeout time.Duration) error {
+	var (
+		addrs []string
+		files []*os.File
+		cmd   *exec.Cmd
+		err   error
+	)
+	h.serversMu.Lock()
+	for addr, ln := range h.listeners {
+		fl, ok := ln.(interface{ File() (*os.File, error) })
+		if !ok {
+			continue
+		}
+		f, err := fl.File()
+		if err != nil {
+			h.serversMu.Unlock()
+			return errors.Wrap(err, "can't get the file of the listener on "+addr)
+		}
+		addrs = append(addrs, addr)
+		files = append(files, f)
+	}
+	h.serversMu.Unlock()
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}()
+	if len(files) == 0 {
+		return errors.New("no listener to pass to the new process")
+	}
+
+	// Start the new process
+	cmd = exec.Command(os.Args[0], os.Args[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	cmd.ExtraFiles = files
+	cmd.Env = append(withoutEnv(os.Environ(), ListenFDsEnv), ListenFDsEnv+"="+strings.Join(addrs, ","))
+	err = cmd.Start()
+	if err != nil {
+		return errors.Wrap(err, "can't start the new process")
+	}
+	h.Log.WithFields(Fields{"pid": cmd.Process.Pid}).Infof("%v: restarted, draining connections", h.ProcessName)
+
+	// Drain
+	ctx, cancel := context.WithTimeout(context.Background(), drainTimeout)
+	defer cancel()
+	return h.Shutdown(ctx)
+}
+
+// inheritedListener returns the listener for addr passed by the parent
+// process, if any
+func inheritedListener(addr string) net.Listener {
+	env := os.Getenv(ListenFDsEnv)
+	if env == "" {
+		return nil
+	}
+	for i, a := range strings.Split(env, ",") {
+		if a != addr {
+			continue
+		}
+		f := os.NewFile(uintptr(3+i), "listener-"+strconv.Itoa(i))
+		ln, err := net.FileListener(f)
+		f.Close()
+		if err != nil {
+			return nil
+		}
+		return ln
+	}
+	return nil
+}
+
+func withoutEnv(env []string, name string) []string {
+	out := make([]string, 0, len(env))
+	for _, e := range env {
+		if !strings.HasPrefix(e, name+"=") {
+			out = append(out, e)
+		}
+	}
+	return out
+}
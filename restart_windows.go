@@ -0,0 +1,24 @@
+//go:build windows
+
+package hang
+
+import (
+	"net"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// EnableGracefulRestart is not supported on windows
+func (h *Handler) EnableGracefulRestart(drainTimeout time.Duration) {
+	h.Log.Warnf("%v: graceful restart is not supported on windows", h.ProcessName)
+}
+
+// Restart is not supported on windows
+func (h *Handler) Restart(drainTimeout time.Duration) error {
+	return errors.New("graceful restart is not supported on windows")
+}
+
+func inheritedListener(addr string) net.Listener {
+	return nil
+}
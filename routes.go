@@ -0,0 +1,205 @@
+package hang
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// RouteInfo describes a registered route
+type RouteInfo struct {
+	// Route as registered with AddRoute
+	Route string `json:"route"`
+	// HTTP methods accepted by the route
+	Methods []string `json:"methods"`
+	// Name of the function handling the route
+	Handler string `json:"handler"`
+	// Middleware applied to the route, outermost first
+	Middleware []string `json:"middleware"`
+}
+
+// ListRoutes returns the registered routes sorted by route
+func (h *Handler) ListRoutes() []RouteInfo {
+	routes := make([]RouteInfo, 0, len(h.Routes))
+	for route := range h.Routes {
+		info := RouteInfo{
+			Route:      route,
+			Methods:    []string{"ANY"},
+			Handler:    h.handlerName(route),
+			Middleware: h.middlewareNames(route),
+		}
+		if handlers, ok := h.methodRoutes[route]; ok {
+			info.Methods = allowedMethods(handlers)
+			names := make([]string, 0, len(handlers))
+			for _, m := range info.Methods {
+				if fn := handlers[m]; fn != nil {
+					names = append(names, m+" "+GetFunctionName(fn))
+				}
+			}
+			info.Handler = strings.Join(names, ", ")
+		}
+		routes = append(routes, info)
+	}
+	sort.Slice(routes, func(i, j int) bool { return routes[i].Route < routes[j].Route })
+	return routes
+}
+
+// EnableRoutesEndpoint registers the routes endpoint (on the admin listener,
+// if enabled) listing the routes of the handler, protected by token if not empty
+func (h *Handler) EnableRoutesEndpoint(token string) error {
+	return h.ops().AddRoute("routes", RequireToken(token, DebugTokenHeader, h.RoutesEndpoint))
+}
+
+// RoutesEndpoint responds with the JSON list of the registered routes
+func (h *Handler) RoutesEndpoint(resp http.ResponseWriter, req *http.Request) error {
+	return WriteJSON(resp, http.StatusOK, h.ListRoutes())
+}
+
+// wildcardSuffix returns the part of path matched by the * of route
+func wildcardSuffix(route, path string) string {
+	prefix := strings.TrimSuffix(strings.TrimSuffix(route, "*"), "/")
+	if len(path) < len(prefix) {
+		return ""
+	}
+	// The route matched the prefix, possibly with a different case
+	return strings.TrimPrefix(path[len(prefix):], "/")
+}
+
+// withSuffix stores the path matched by a wildcard route in the request context
+func withSuffix(req *http.Request, suffix string) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), suffixKey, suffix))
+}
+
+// RouteSuffix returns the part of the path matched by the * of a wildcard
+// route, e.g. "a/b.txt" for /files/a/b.txt on "files/*"
+func RouteSuffix(req *http.Request) string {
+	suffix, _ := req.Context().Value(suffixKey).(string)
+	return suffix
+}
+
+// match returns the route for the request to path, "" if none, and the
+// request carrying what the route handler can read from the context.
+// Routes bound to the request host come before the others, exact routes
+// before param, regex and wildcard ones.
+func (h *Handler) match(req *http.Request, path string) (string, *http.Request) {
+	host := requestHost(req)
+	exact, wildcard, sub := hostPatterns(host)
+	if exact != "" {
+		if route := h.lookupRoute(exact + HostSeparator + path); route != "" {
+			return route, req
+		}
+	}
+	if wildcard != "" {
+		if route := h.lookupRoute(wildcard + HostSeparator + path); route != "" {
+			return route, withSubdomain(req, sub)
+		}
+	}
+	// A path containing the separator must not reach the host routes
+	if !strings.Contains(path, HostSeparator) && !isRegexRoute(path) {
+		if route := h.lookupRoute(path); route != "" {
+			return route, req
+		}
+	}
+	if route, params, sub := h.matchParams(host, path); route != "" {
+		if sub != "" {
+			req = withSubdomain(req, sub)
+		}
+		return route, withParams(req, params)
+	}
+	if route, req := h.matchRegex(req, path); route != "" {
+		return route, req
+	}
+	if route, sub := h.matchPrefix(host, path); route != "" {
+		_, rpath := splitHostRoute(route)
+		if sub != "" {
+			req = withSubdomain(req, sub)
+		}
+		return route, withSuffix(req, wildcardSuffix(rpath, path))
+	}
+	return "", req
+}
+
+// MatchRoute returns the route the request would be routed to, "default"
+// if none, without serving it
+func (h *Handler) MatchRoute(req *http.Request) string {
+	if route, _ := h.match(req, GetRoute(req)); route != "" {
+		return route
+	}
+	return "default"
+}
+
+// matchPrefix returns the longest route ending with /* matching host and
+// path, routes bound to host first, with the subdomain matched by the host
+// pattern
+func (h *Handler) matchPrefix(host, p string) (string, string) {
+	var (
+		best, bestSub string
+		bestHost      bool
+		bestLen       int
+	)
+	for route := range h.Routes {
+		if !strings.HasSuffix(route, "*") || isRegexRoute(route) {
+			continue
+		}
+		pattern, rpath := splitHostRoute(route)
+		sub, ok := "", true
+		if pattern != "" {
+			sub, ok = matchHost(pattern, host)
+		}
+		if !ok {
+			continue
+		}
+		prefix := strings.TrimSuffix(strings.TrimSuffix(rpath, "*"), "/")
+		if prefix != "" && !h.hasPathPrefix(p+"/", prefix+"/") {
+			continue
+		}
+		// Routes bound to the host first, then the longest
+		if best != "" && (bestHost && pattern == "" || bestHost == (pattern != "") && len(rpath) <= bestLen) {
+			continue
+		}
+		best, bestSub, bestHost, bestLen = route, sub, pattern != "", len(rpath)
+	}
+	return best, bestSub
+}
+
+// RouteSpec describes a route for registering it on other routers
+type RouteSpec struct {
+	// Route as registered
+	Route string
+	// Host pattern, "" for any host
+	Host string
+	// Path of the route without host, e.g. "users/:id" or "files/*"
+	Path string
+	// Methods answered by the route, nil for any method
+	Methods []string
+	// Kind of route
+	Params   bool
+	Wildcard bool
+	Regex    bool
+}
+
+// RouteSpecs returns the registered routes, but the default one, sorted by
+// route
+func (h *Handler) RouteSpecs() []RouteSpec {
+	specs := make([]RouteSpec, 0, len(h.Routes))
+	for route := range h.Routes {
+		if route == "default" {
+			continue
+		}
+		spec := RouteSpec{Route: route, Regex: isRegexRoute(route)}
+		if spec.Regex {
+			spec.Path = strings.TrimPrefix(route, RegexPrefix)
+		} else {
+			spec.Host, spec.Path = splitHostRoute(route)
+			spec.Params = hasParams(route)
+			spec.Wildcard = strings.HasSuffix(spec.Path, "*")
+		}
+		if handlers, ok := h.methodRoutes[route]; ok {
+			spec.Methods = allowedMethods(handlers)
+		}
+		specs = append(specs, spec)
+	}
+	sort.Slice(specs, func(i, j int) bool { return specs[i].Route < specs[j].Route })
+	return specs
+}
@@ -0,0 +1,123 @@
+package hang
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+)
+
+// Schema is a JSON schema as used by the swagger and OpenAPI documents
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Enum                 []interface{}      `json:"enum,omitempty"`
+}
+
+var rawMessageType = reflect.TypeOf(json.RawMessage{})
+
+// SchemaOf returns the schema of the JSON encoding of v, adding the named
+// structs to defs (by type name) and referring to them as
+// #/definitions/Name; refPrefix replaces #/definitions/ if not empty.
+// Fields follow the json tags and are required if tagged validate:"required".
+func SchemaOf(v interface{}, defs map[string]*Schema, refPrefix string) *Schema {
+	if v == nil {
+		return nil
+	}
+	if refPrefix == "" {
+		refPrefix = "#/definitions/"
+	}
+	return schemaOf(reflect.TypeOf(v), defs, refPrefix)
+}
+
+func schemaOf(t reflect.Type, defs map[string]*Schema, refPrefix string) *Schema {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch {
+	case t == timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case t == durationType:
+		return &Schema{Type: "integer", Format: "int64", Description: "nanoseconds"}
+	case t == rawMessageType:
+		return &Schema{}
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return &Schema{Type: "integer", Format: "int32"}
+	case reflect.Int, reflect.Int64, reflect.Uint, reflect.Uint64, reflect.Uintptr:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Float32:
+		return &Schema{Type: "number", Format: "float"}
+	case reflect.Float64:
+		return &Schema{Type: "number", Format: "double"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return &Schema{Type: "array", Items: schemaOf(t.Elem(), defs, refPrefix)}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: schemaOf(t.Elem(), defs, refPrefix)}
+	case reflect.Struct:
+		name := t.Name()
+		if name == "" {
+			return structSchema(t, defs, refPrefix)
+		}
+		if _, ok := defs[name]; !ok {
+			// Placeholder for recursive types
+			defs[name] = &Schema{Type: "object"}
+			defs[name] = structSchema(t, defs, refPrefix)
+		}
+		return &Schema{Ref: refPrefix + name}
+	}
+	// Interfaces and anything else: any value
+	return &Schema{}
+}
+
+// structSchema returns the inline schema of a struct type
+func structSchema(t reflect.Type, defs map[string]*Schema, refPrefix string) *Schema {
+	s := &Schema{Type: "object", Properties: map[string]*Schema{}}
+	var walk func(t reflect.Type)
+	walk = func(t reflect.Type) {
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			tag := f.Tag.Get("json")
+			if tag == "-" {
+				continue
+			}
+			name := tag
+			if i := strings.Index(tag, ","); i >= 0 {
+				name = tag[:i]
+			}
+			ft := f.Type
+			for ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if f.Anonymous && name == "" && ft.Kind() == reflect.Struct {
+				walk(ft)
+				continue
+			}
+			if f.PkgPath != "" {
+				continue
+			}
+			if name == "" {
+				name = f.Name
+			}
+			s.Properties[name] = schemaOf(f.Type, defs, refPrefix)
+			if strings.Contains(","+f.Tag.Get("validate")+",", ",required,") {
+				s.Required = append(s.Required, name)
+			}
+		}
+	}
+	walk(t)
+	return s
+}
@@ -0,0 +1,108 @@
+package hang
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// SdNotify sends state to the systemd notification socket. It returns false
+// without error when the process is not run by systemd with Type=notify.
+func SdNotify(state string) (bool, error) {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return false, nil
+	}
+	// Abstract socket
+	if socket[0] == '@' {
+		socket = "\x00" + socket[1:]
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return false, errors.Wrap(err, "can't connect to the systemd notification socket")
+	}
+	defer conn.Close()
+	_, err = conn.Write([]byte(state))
+	if err != nil {
+		return false, errors.Wrap(err, "can't notify systemd")
+	}
+	return true, nil
+}
+
+// SdWatchdogInterval returns the watchdog interval requested by systemd,
+// zero if the watchdog is not enabled for this process
+func SdWatchdogInterval() time.Duration {
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0
+	}
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0
+	}
+	return time.Duration(usec) * time.Microsecond
+}
+
+// EnableSystemdNotify makes Serve notify systemd: READY=1 once the handler
+// is listening, WATCHDOG=1 at half the watchdog interval while serving and
+// STOPPING=1 on Shutdown. It has no effect outside Type=notify units.
+func (h *Handler) EnableSystemdNotify() {
+	h.systemdNotify = true
+}
+
+// sdNotify notifies systemd if enabled, logging failures
+func (h *Handler) sdNotify(state string) {
+	if !h.systemdNotify {
+		return
+	}
+	if _, err := SdNotify(state); err != nil {
+		h.Log.WithFields(Fields{"state": state}).Warn(err)
+	}
+}
+
+// sdReady notifies the readiness and starts the watchdog pings
+func (h *Handler) sdReady() {
+	if !h.systemdNotify {
+		return
+	}
+	h.sdNotify("READY=1\nMAINPID=" + strconv.Itoa(os.Getpid()))
+	interval := SdWatchdogInterval()
+	if interval == 0 {
+		return
+	}
+	h.serversMu.Lock()
+	if h.watchdogStop == nil {
+		h.watchdogStop = make(chan struct{})
+		go h.sdWatchdog(interval/2, h.watchdogStop)
+	}
+	h.serversMu.Unlock()
+}
+
+func (h *Handler) sdWatchdog(every time.Duration, stop chan struct{}) {
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			h.sdNotify("WATCHDOG=1")
+		case <-stop:
+			return
+		}
+	}
+}
+
+// sdStopping notifies the shutdown and stops the watchdog pings
+func (h *Handler) sdStopping() {
+	if !h.systemdNotify {
+		return
+	}
+	h.sdNotify("STOPPING=1")
+	h.serversMu.Lock()
+	if h.watchdogStop != nil {
+		close(h.watchdogStop)
+		h.watchdogStop = nil
+	}
+	h.serversMu.Unlock()
+}
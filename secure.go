@@ -0,0 +1,85 @@
+package hang
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// SecureHeadersOptions lists the security headers to set, empty values
+// omitting the header
+type SecureHeadersOptions struct {
+	// Strict-Transport-Security max-age, sent only on HTTPS requests
+	HSTSMaxAge            time.Duration
+	HSTSIncludeSubdomains bool
+	HSTSPreload           bool
+	// X-Content-Type-Options: nosniff
+	NoSniff bool
+	// X-Frame-Options (DENY, SAMEORIGIN)
+	FrameOptions   string
+	ReferrerPolicy string
+	// Content-Security-Policy
+	ContentSecurityPolicy string
+	// Per route replacements of the options
+	Routes map[string]SecureHeadersOptions
+}
+
+// DefaultSecureHeaders returns the options used by SecureHeaders when none
+// are given, suitable for APIs
+func DefaultSecureHeaders() SecureHeadersOptions {
+	return SecureHeadersOptions{
+		HSTSMaxAge:            365 * 24 * time.Hour,
+		HSTSIncludeSubdomains: true,
+		NoSniff:               true,
+		FrameOptions:          "DENY",
+		ReferrerPolicy:        "no-referrer",
+		ContentSecurityPolicy: "default-src 'none'; frame-ancestors 'none'",
+	}
+}
+
+// SecureHeaders returns a middleware setting the security headers described
+// by opts (DefaultSecureHeaders if not given), replaced by opts.Routes for the
+// matching routes. Handlers can still override them.
+func SecureHeaders(opts ...SecureHeadersOptions) Middleware {
+	o := DefaultSecureHeaders()
+	if len(opts) > 0 {
+		o = opts[0]
+	}
+	return func(next HandleFunc) HandleFunc {
+		return func(resp http.ResponseWriter, req *http.Request) error {
+			ro, ok := o.Routes[RouteFrom(req)]
+			if !ok {
+				ro = o
+			}
+			// Setting HSTS on a spoofed header is harmless
+			ro.set(resp.Header(), req.TLS != nil || req.Header.Get("X-Forwarded-Proto") == "https")
+			return next(resp, req)
+		}
+	}
+}
+
+// set writes the headers
+func (o SecureHeadersOptions) set(header http.Header, tls bool) {
+	if tls && o.HSTSMaxAge > 0 {
+		hsts := "max-age=" + strconv.Itoa(int(o.HSTSMaxAge.Seconds()))
+		if o.HSTSIncludeSubdomains {
+			hsts += "; includeSubDomains"
+		}
+		if o.HSTSPreload {
+			hsts += "; preload"
+		}
+		header.Set("Strict-Transport-Security", hsts)
+	}
+	if o.NoSniff {
+		header.Set("X-Content-Type-Options", "nosniff")
+	}
+	if o.FrameOptions != "" {
+		header.Set("X-Frame-Options", o.FrameOptions)
+	}
+	if o.ReferrerPolicy != "" {
+		header.Set("Referrer-Policy", o.ReferrerPolicy)
+	}
+	if o.ContentSecurityPolicy != "" {
+		header.Set("Content-Security-Policy", o.ContentSecurityPolicy)
+	}
+}
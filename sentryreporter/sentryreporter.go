@@ -0,0 +1,71 @@
+// Package sentryreporter is a hang.ErrorReporter sending the errors and the
+// panics of the route handlers to Sentry, with the request and the route.
+package sentryreporter
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/brunetto/hang"
+	"github.com/getsentry/sentry-go"
+	"github.com/pkg/errors"
+)
+
+// Reporter reports to Sentry
+type Reporter struct {
+	Hub *sentry.Hub
+}
+
+// New returns a Reporter for the Sentry client configured by opts, whose
+// DSN comes from SENTRY_DSN if empty
+func New(opts sentry.ClientOptions) (*Reporter, error) {
+	client, err := sentry.NewClient(opts)
+	if err != nil {
+		return nil, errors.Wrap(err, "can't create Sentry client")
+	}
+	return &Reporter{Hub: sentry.NewHub(client, sentry.NewScope())}, nil
+}
+
+// Report implements hang.ErrorReporter; the events are sent in background
+func (r *Reporter) Report(req *http.Request, report hang.ErrorReport) {
+	hub := r.Hub.Clone()
+	hub.WithScope(func(scope *sentry.Scope) {
+		scope.SetRequest(req)
+		scope.SetTag("route", report.Route)
+		scope.SetTag("function", report.Function)
+		if report.RequestID != "" {
+			scope.SetTag("request_id", report.RequestID)
+		}
+		if report.Status != 0 {
+			scope.SetTag("status", http.StatusText(report.Status))
+		}
+		scope.SetUser(sentry.User{IPAddress: report.Origin})
+		var pe *hang.PanicError
+		if errors.As(report.Err, &pe) {
+			scope.SetLevel(sentry.LevelFatal)
+			scope.SetContext("panic", sentry.Context{"stack": string(pe.Stack)})
+		}
+		hub.CaptureException(report.Err)
+	})
+}
+
+// Flush waits for the pending events to be sent, up to timeout
+func (r *Reporter) Flush(timeout time.Duration) bool {
+	return r.Hub.Flush(timeout)
+}
+
+// ShutdownHook returns a hook flushing the pending events, for
+// hang.Lifecycle.AddShutdownHook
+func (r *Reporter) ShutdownHook() hang.ShutdownHook {
+	return func(ctx context.Context) error {
+		timeout := 5 * time.Second
+		if deadline, ok := ctx.Deadline(); ok {
+			timeout = time.Until(deadline)
+		}
+		if !r.Flush(timeout) {
+			return errors.New("timeout flushing the Sentry events")
+		}
+		return nil
+	}
+}
@@ -0,0 +1,294 @@
+package hang
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ServeHTTP makes the Handler an http.Handler
+func (h *Handler) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	h.Handle(resp, req)
+}
+
+// EnableAdminListener moves the operational endpoints (debug, introspection,
+// ...) to a separate handler served on addr by Serve, so that they are not
+// exposed through the public load balancer. The admin handler is returned to
+// allow registering more operational routes.
+func (h *Handler) EnableAdminListener(addr string) *Handler {
+	if h.Admin == nil {
+		h.Admin = &Handler{
+			Log:         h.Log,
+			ExecName:    h.ExecName,
+			ProcessName: h.ProcessName + " (admin)",
+			ErrorFormat: h.ErrorFormat,
+			Routes:      map[string]HandleFunc{},
+		}
+		h.Admin.AddRoute("default", h.Admin.RouteNotSet)
+		h.Admin.AddRoute("livecheck", h.Admin.LiveCheck)
+		h.Admin.AddRoute("readycheck", h.ReadyCheck)
+	}
+	h.AdminAddr = addr
+	return h.Admin
+}
+
+// ops returns the handler where operational endpoints have to be registered
+func (h *Handler) ops() *Handler {
+	if h.Admin != nil {
+		return h.Admin
+	}
+	return h
+}
+
+// Serve listens on addr serving the handler routes and, if enabled, on the
+// admin address serving the operational routes. It returns when a server
+// fails or, after Shutdown, when all the in-flight requests are drained.
+func (h *Handler) Serve(addr string) error {
+	return h.serve([]ListenerConfig{{Addr: addr}})
+}
+
+// ServeListener is Serve on an already open listener, e.g. one shared with
+// other protocols
+func (h *Handler) ServeListener(ln net.Listener) error {
+	return h.serve([]ListenerConfig{{Addr: ln.Addr().String(), ln: ln}})
+}
+
+// ServeListeners is Serve on several listeners at once, e.g. a TCP port
+// and a Unix socket for a local proxy, each with its own TLS settings
+func (h *Handler) ServeListeners(listeners ...ListenerConfig) error {
+	if len(listeners) == 0 {
+		return errors.New("no listener to serve on")
+	}
+	return h.serve(listeners)
+}
+
+// serve implements Serve on the listeners
+func (h *Handler) serve(listeners []ListenerConfig) error {
+	var (
+		errc    = make(chan error, len(listeners)+1)
+		n       = len(listeners)
+		pending = int32(len(listeners))
+	)
+	h.logStartupSummary(listeners)
+	if h.Admin != nil {
+		n++
+		go func() { errc <- h.listenAndServe(h.Admin, ListenerConfig{Addr: h.AdminAddr}, nil) }()
+	}
+	for _, lc := range listeners {
+		go func(lc ListenerConfig) {
+			errc <- h.listenAndServe(h, lc, func() {
+				// Ready once all the listeners are
+				if atomic.AddInt32(&pending, -1) == 0 {
+					h.closeOnce(&h.listening)
+					h.sdReady()
+				}
+			})
+		}(lc)
+	}
+
+	err := <-errc
+	if err != nil {
+		if n > 1 {
+			// Do not leave the other listeners running alone
+			h.Shutdown(context.Background())
+		}
+		return err
+	}
+	// Stopped by Shutdown: wait for the other servers and for the drain
+	for i := 1; i < n; i++ {
+		if e := <-errc; e != nil && err == nil {
+			err = e
+		}
+	}
+	h.draining.Wait()
+	return err
+}
+
+// Shutdown gracefully stops the servers started by Serve, including those
+// still starting. The handler is marked not ready and stays so: it is not
+// meant to be served again.
+func (h *Handler) Shutdown(ctx context.Context) error {
+	var err error
+	h.draining.Add(1)
+	defer h.draining.Done()
+	h.SetReady(false)
+	h.sdStopping()
+	h.serversMu.Lock()
+	servers := h.servers
+	h.servers = nil
+	h.serversMu.Unlock()
+	h.closeOnce(&h.stopping)
+	for _, srv := range servers {
+		if e := srv.Shutdown(ctx); e != nil && err == nil {
+			err = errors.Wrap(e, "can't shutdown server on "+srv.Addr)
+		}
+	}
+	// Hijacked connections are not tracked by the servers
+	h.websockets.closeAll()
+	return err
+}
+
+// Listening returns a channel closed when Serve is accepting connections,
+// for components starting once the service is up
+func (h *Handler) Listening() <-chan struct{} {
+	return h.lifecycleChan(&h.listening)
+}
+
+// Stopping returns a channel closed when Shutdown is called, for long lived
+// responses to end before the servers stop
+func (h *Handler) Stopping() <-chan struct{} {
+	return h.lifecycleChan(&h.stopping)
+}
+
+// lifecycleChan returns *ch, creating it if needed
+func (h *Handler) lifecycleChan(ch *chan struct{}) chan struct{} {
+	h.serversMu.Lock()
+	defer h.serversMu.Unlock()
+	if *ch == nil {
+		*ch = make(chan struct{})
+	}
+	return *ch
+}
+
+// closeOnce closes *ch, creating it if needed, unless already closed
+func (h *Handler) closeOnce(ch *chan struct{}) {
+	c := h.lifecycleChan(ch)
+	h.serversMu.Lock()
+	defer h.serversMu.Unlock()
+	select {
+	case <-c:
+	default:
+		close(c)
+	}
+}
+
+// newServer returns the server for handler on the listener
+func (h *Handler) newServer(handler http.Handler, lc ListenerConfig) *http.Server {
+	srv := &http.Server{Addr: lc.Addr, Handler: handler}
+	if lc.TLS != nil {
+		srv.TLSConfig = lc.TLS.Clone()
+	}
+	h.configureHTTP2(srv)
+	return srv
+}
+
+// logStartupSummary logs in a single entry the configuration Serve is
+// about to start with, for operators to check the deployment
+func (h *Handler) logStartupSummary(listeners []ListenerConfig) {
+	var (
+		srv       = h.newServer(h, listeners[0])
+		addresses []string
+		tls       bool
+		timeout   = func(d time.Duration) string {
+			if d <= 0 {
+				return "none"
+			}
+			return d.String()
+		}
+	)
+	for _, lc := range listeners {
+		addresses = append(addresses, lc.String())
+		tls = tls || lc.TLS != nil
+	}
+	if h.Admin != nil {
+		addresses = append(addresses, h.AdminAddr+" (admin)")
+	}
+	fields := Fields{
+		"addresses":               addresses,
+		"tls":                     tls,
+		"h2c":                     h.http2 != nil && h.http2.H2C,
+		"routes":                  h.ListRoutes(),
+		"middleware":              h.middlewareNames(""),
+		"read_timeout":            timeout(srv.ReadTimeout),
+		"read_header_timeout":     timeout(srv.ReadHeaderTimeout),
+		"write_timeout":           timeout(srv.WriteTimeout),
+		"idle_timeout":            timeout(srv.IdleTimeout),
+		"readiness_check_timeout": timeout(ReadinessCheckTimeout),
+		"slow_request_threshold":  timeout(h.slowThreshold),
+	}
+	if h.Admin != nil {
+		fields["admin_routes"] = h.Admin.ListRoutes()
+	}
+	h.Log.WithFields(fields).Infof("%v: starting", h.ProcessName)
+}
+
+// listenAndServe serves handler on the listener, calling onListen, if not
+// nil, once listening
+func (h *Handler) listenAndServe(handler http.Handler, lc ListenerConfig, onListen func()) error {
+	var err error
+	srv := h.newServer(handler, lc)
+	h.serversMu.Lock()
+	h.servers = append(h.servers, srv)
+	stopping := h.stopping
+	h.serversMu.Unlock()
+	// Shutdown already took the servers to stop: do not start this one
+	if stopping != nil {
+		select {
+		case <-stopping:
+			if lc.ln != nil {
+				lc.ln.Close()
+			}
+			return nil
+		default:
+		}
+	}
+
+	ln := lc.ln
+	if ln == nil {
+		ln, err = h.listen(lc.network(), lc.Addr)
+		if err != nil {
+			return err
+		}
+		if lc.network() == "unix" {
+			err = prepareUnixListener(ln, lc)
+			if err != nil {
+				ln.Close()
+				return err
+			}
+		}
+	}
+	h.Log.Infof("%v: listening on %v", h.ProcessName, lc)
+	if onListen != nil {
+		onListen()
+	}
+	if lc.TLS != nil {
+		// The certificates come from the TLS configuration
+		err = srv.ServeTLS(ln, "", "")
+	} else {
+		err = srv.Serve(ln)
+	}
+	if err == http.ErrServerClosed {
+		return nil
+	}
+	return errors.Wrap(err, "can't serve on "+lc.String())
+}
+
+// listen returns the listener inherited from the parent process during a
+// graceful restart or a new one on addr
+func (h *Handler) listen(network, addr string) (net.Listener, error) {
+	var (
+		ln  net.Listener
+		err error
+	)
+	ln = inheritedListener(addr)
+	if ln == nil {
+		if network == "unix" {
+			removeStaleSocket(addr)
+		}
+		ln, err = net.Listen(network, addr)
+		if err != nil {
+			return nil, errors.Wrap(err, "can't listen on "+addr)
+		}
+	}
+	h.serversMu.Lock()
+	if h.listeners == nil {
+		h.listeners = map[string]net.Listener{}
+	}
+	h.listeners[addr] = ln
+	h.serversMu.Unlock()
+	return ln, nil
+}
@@ -0,0 +1,29 @@
+package hang
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestShutdownBeforeServe(t *testing.T) {
+	h := testHandler(t)
+	h.EnableAdminListener("127.0.0.1:0")
+	if err := h.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error)
+	go func() { done <- h.Serve("127.0.0.1:0") }()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("got error %v, want nil", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("servers started after Shutdown are left running")
+	}
+	if ready, _ := h.Ready(context.Background()); ready {
+		t.Error("ready after Shutdown")
+	}
+}
@@ -0,0 +1,66 @@
+package hang
+
+import (
+	"os"
+	"os/signal"
+)
+
+// OnSignal registers fn to be called when sig is received, for example
+// SIGHUP to reload the configuration. Callbacks for SIGINT and SIGTERM run
+// before the process exits. On handlers not built by NewHandler, such as the
+// admin one, the callbacks run but the process does not exit.
+func (h *Handler) OnSignal(sig os.Signal, fn func(os.Signal)) {
+	h.signalMu.Lock()
+	if h.signalHooks == nil {
+		h.signalHooks = map[os.Signal][]func(os.Signal){}
+	}
+	h.signalHooks[sig] = append(h.signalHooks[sig], fn)
+	if h.c == nil {
+		// No WaitForShutdown reading the signals
+		h.c = make(chan os.Signal, 1)
+		go func(c chan os.Signal) {
+			for sig := range c {
+				h.runSignalHooks(sig)
+			}
+		}(h.c)
+	}
+	c := h.c
+	h.signalMu.Unlock()
+	signal.Notify(c, sig)
+}
+
+// runSignalHooks calls the callbacks registered for sig, recovering panics
+// so that a failing callback does not prevent the others from running
+func (h *Handler) runSignalHooks(sig os.Signal) {
+	h.signalMu.Lock()
+	hooks := append([]func(os.Signal){}, h.signalHooks[sig]...)
+	h.signalMu.Unlock()
+	if len(hooks) == 0 {
+		return
+	}
+	h.Log.WithFields(Fields{"signal": sig.String()}).Infof("%v: signal received", h.ProcessName)
+	for _, fn := range hooks {
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					h.Log.WithFields(Fields{"signal": sig.String(), "function": funcName(fn)}).Errorf("signal callback panicked: %v", r)
+				}
+			}()
+			fn(sig)
+		}()
+	}
+}
+
+// DisableExitOnSignal prevents the handler from exiting the process on
+// SIGINT and SIGTERM, when the shutdown is managed elsewhere (e.g. by a Lifecycle)
+func (h *Handler) DisableExitOnSignal() {
+	h.signalMu.Lock()
+	h.keepRunningOnSignal = true
+	h.signalMu.Unlock()
+}
+
+func (h *Handler) exitDisabled() bool {
+	h.signalMu.Lock()
+	defer h.signalMu.Unlock()
+	return h.keepRunningOnSignal
+}
@@ -0,0 +1,30 @@
+//go:build !windows
+
+package hang
+
+import (
+	"os"
+	"runtime"
+	"syscall"
+)
+
+// EnableDiagnosticsDump logs the stack of all goroutines and the memory
+// statistics every time SIGUSR1 is received
+func (h *Handler) EnableDiagnosticsDump() {
+	h.OnSignal(syscall.SIGUSR1, func(os.Signal) {
+		var (
+			ms    runtime.MemStats
+			stack = make([]byte, 1<<20)
+		)
+		runtime.ReadMemStats(&ms)
+		n := runtime.Stack(stack, true)
+		h.Log.WithFields(Fields{
+			"goroutines":  runtime.NumGoroutine(),
+			"heap_alloc":  ms.HeapAlloc,
+			"heap_inuse":  ms.HeapInuse,
+			"sys":         ms.Sys,
+			"num_gc":      ms.NumGC,
+			"pause_total": ms.PauseTotalNs,
+		}).Info("diagnostics dump\n" + string(stack[:n]))
+	})
+}
@@ -0,0 +1,29 @@
+//go:build !windows
+
+package hang
+
+import (
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestOnSignalAdminHandler(t *testing.T) {
+	h := testHandler(t)
+	admin := h.EnableAdminListener("localhost:0")
+	got := make(chan os.Signal, 1)
+	admin.OnSignal(syscall.SIGUSR2, func(sig os.Signal) { got <- sig })
+
+	if err := syscall.Kill(os.Getpid(), syscall.SIGUSR2); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case sig := <-got:
+		if sig != syscall.SIGUSR2 {
+			t.Errorf("got signal %v, want SIGUSR2", sig)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("callback not called")
+	}
+}
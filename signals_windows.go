@@ -0,0 +1,8 @@
+//go:build windows
+
+package hang
+
+// EnableDiagnosticsDump is not supported on windows, where SIGUSR1 does not exist
+func (h *Handler) EnableDiagnosticsDump() {
+	h.Log.Warnf("%v: diagnostics dump is not supported on windows", h.ProcessName)
+}
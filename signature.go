@@ -0,0 +1,162 @@
+package hang
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Default headers of the signed requests
+const (
+	SignatureHeader          = "X-Signature"
+	SignatureTimestampHeader = "X-Signature-Timestamp"
+	SignatureKeyIDHeader     = "X-Signature-Key-Id"
+)
+
+// SignatureOptions configures the VerifySignature middleware, zero values
+// meaning the defaults
+type SignatureOptions struct {
+	// Returns the secret of the key ID sent by the client (empty if no key
+	// ID header), required
+	Secret func(keyID string) ([]byte, error)
+	// Hash function, SHA-256 by default
+	Algorithm func() hash.Hash
+	// Headers carrying signature, timestamp and key ID
+	Header          string
+	TimestampHeader string
+	KeyIDHeader     string
+	// Maximum distance of the timestamp from now, 5m by default
+	MaxSkew time.Duration
+	// Maximum size of the signed body, 1MB by default
+	MaxBodySize int64
+}
+
+// Sign returns the hex encoded HMAC of timestamp and body, as checked by
+// VerifySignature. The signed message is "<unix timestamp>.<body>".
+func Sign(alg func() hash.Hash, secret []byte, timestamp time.Time, body []byte) string {
+	if alg == nil {
+		alg = sha256.New
+	}
+	mac := hmac.New(alg, secret)
+	mac.Write([]byte(strconv.FormatInt(timestamp.Unix(), 10) + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifySignature returns a middleware accepting only the requests signed
+// with Sign by a known key, with a timestamp within MaxSkew and a signature
+// not seen before, responding 401 and logging the others. The signature can
+// be prefixed by the algorithm name as in "sha256=<hex>".
+func (h *Handler) VerifySignature(opts SignatureOptions) (Middleware, error) {
+	if opts.Secret == nil {
+		return nil, errors.New("missing secret lookup function")
+	}
+	if opts.Algorithm == nil {
+		opts.Algorithm = sha256.New
+	}
+	if opts.Header == "" {
+		opts.Header = SignatureHeader
+	}
+	if opts.TimestampHeader == "" {
+		opts.TimestampHeader = SignatureTimestampHeader
+	}
+	if opts.KeyIDHeader == "" {
+		opts.KeyIDHeader = SignatureKeyIDHeader
+	}
+	if opts.MaxSkew <= 0 {
+		opts.MaxSkew = 5 * time.Minute
+	}
+	if opts.MaxBodySize <= 0 {
+		opts.MaxBodySize = 1 << 20
+	}
+	seen := &replayCache{seen: map[string]time.Time{}}
+
+	return func(next HandleFunc) HandleFunc {
+		return func(resp http.ResponseWriter, req *http.Request) error {
+			err := checkSignature(req, opts, seen)
+			if err != nil {
+				h.Log.WithFields(Fields{"route": RouteFrom(req), "origin": RealIP(req), "key_id": req.Header.Get(opts.KeyIDHeader)}).Warn(err)
+				// Respond
+				WriteError(resp, req, http.StatusUnauthorized, errors.New("invalid signature"))
+				// Logged above
+				return nil
+			}
+			return next(resp, req)
+		}
+	}, nil
+}
+
+// checkSignature verifies the request, restoring its body
+func checkSignature(req *http.Request, opts SignatureOptions, seen *replayCache) error {
+	sig := req.Header.Get(opts.Header)
+	if i := strings.Index(sig, "="); i >= 0 {
+		sig = sig[i+1:]
+	}
+	if sig == "" {
+		return errors.New("missing signature")
+	}
+	sec, err := strconv.ParseInt(req.Header.Get(opts.TimestampHeader), 10, 64)
+	if err != nil {
+		return errors.New("missing or invalid signature timestamp")
+	}
+	ts := time.Unix(sec, 0)
+	if d := time.Since(ts); d > opts.MaxSkew || d < -opts.MaxSkew {
+		return errors.New("signature timestamp out of the accepted window")
+	}
+	secret, err := opts.Secret(req.Header.Get(opts.KeyIDHeader))
+	if err != nil || len(secret) == 0 {
+		return errors.New("unknown signature key")
+	}
+	var body []byte
+	if req.Body != nil {
+		body, err = ioutil.ReadAll(http.MaxBytesReader(nil, req.Body, opts.MaxBodySize))
+		if err != nil {
+			return errors.Wrap(err, "can't read signed body")
+		}
+		req.Body.Close()
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+	expected := Sign(opts.Algorithm, secret, ts, body)
+	if !hmac.Equal([]byte(strings.ToLower(sig)), []byte(expected)) {
+		return errors.New("signature mismatch")
+	}
+	// The canonical signature, not to accept its other spellings
+	if !seen.add(expected, ts.Add(opts.MaxSkew)) {
+		return errors.New("replayed signature")
+	}
+	return nil
+}
+
+// replayCache remembers the signatures until their timestamp leaves the
+// accepted window
+type replayCache struct {
+	mu   sync.Mutex
+	seen map[string]time.Time
+}
+
+// add records sig, returning false if already seen
+func (rc *replayCache) add(sig string, expires time.Time) bool {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	now := time.Now()
+	for s, exp := range rc.seen {
+		if now.After(exp) {
+			delete(rc.seen, s)
+		}
+	}
+	if _, ok := rc.seen[sig]; ok {
+		return false
+	}
+	rc.seen[sig] = expires
+	return true
+}
@@ -0,0 +1,51 @@
+package hang
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVerifySignature(t *testing.T) {
+	h := testHandler(t)
+	secret := []byte("secret")
+	mw, err := h.VerifySignature(SignatureOptions{Secret: func(string) ([]byte, error) { return secret, nil }})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.AddRoute("hook", mw(func(resp http.ResponseWriter, req *http.Request) error { return nil }))
+
+	var (
+		now   = time.Now()
+		stale = now.Add(-10 * time.Minute)
+		sig   = Sign(nil, secret, now, nil)
+	)
+	signed := func(sig string, ts time.Time) http.Header {
+		return http.Header{
+			SignatureHeader:          {sig},
+			SignatureTimestampHeader: {strconv.FormatInt(ts.Unix(), 10)},
+		}
+	}
+	tests := []struct {
+		name   string
+		header http.Header
+		status int
+	}{
+		{"valid", signed(sig, now), http.StatusOK},
+		{"replayed", signed(sig, now), http.StatusUnauthorized},
+		{"replayed upper case", signed(strings.ToUpper(sig), now), http.StatusUnauthorized},
+		{"replayed mixed case", signed(strings.ToUpper(sig[:10])+sig[10:], now), http.StatusUnauthorized},
+		{"replayed with prefix", signed("sha256="+sig, now), http.StatusUnauthorized},
+		{"prefixed", signed("sha256="+Sign(nil, secret, now.Add(-time.Second), nil), now.Add(-time.Second)), http.StatusOK},
+		{"wrong signature", signed(Sign(nil, []byte("other"), now, nil), now), http.StatusUnauthorized},
+		{"stale", signed(Sign(nil, secret, stale, nil), stale), http.StatusUnauthorized},
+		{"missing", nil, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		if resp := serve(h, "POST", "/hook", tt.header); resp.Code != tt.status {
+			t.Errorf("%v: status %v, want %v", tt.name, resp.Code, tt.status)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package hang
+
+import (
+	"context"
+	"log/slog"
+)
+
+// Levels used for fatal and panic entries written through slog
+const (
+	SlogLevelFatal = slog.LevelError + 4
+	SlogLevelPanic = slog.LevelError + 8
+)
+
+// LoggerBackend selects the library backing the default logger
+type LoggerBackend int
+
+const (
+	// LogrusBackend uses github.com/sirupsen/logrus (default)
+	LogrusBackend LoggerBackend = iota
+	// SlogBackend uses log/slog from the standard library
+	SlogBackend
+)
+
+// NewSlogLogger adapts a log/slog logger to the Logger interface
+func NewSlogLogger(lg *slog.Logger) Logger {
+	return NewFuncLogger(func(level Level, msg string, fields Fields) {
+		sl := SlogLevel(level)
+		if !lg.Enabled(context.Background(), sl) {
+			return
+		}
+		attrs := make([]slog.Attr, 0, len(fields))
+		for _, k := range fields.SortedKeys() {
+			attrs = append(attrs, slog.Any(k, fields[k]))
+		}
+		lg.LogAttrs(context.Background(), sl, msg, attrs...)
+	})
+}
+
+// slogLevelLogger changes, with the level of the logger, the level of the
+// slog handlers it writes to
+type slogLevelLogger struct {
+	Logger
+	level *slog.LevelVar
+}
+
+func (l *slogLevelLogger) GetLevel() Level {
+	return l.Logger.(LevelSetter).GetLevel()
+}
+
+func (l *slogLevelLogger) SetLevel(level Level) {
+	l.Logger.(LevelSetter).SetLevel(level)
+	l.level.Set(SlogLevel(level))
+}
+
+// SlogLevel maps a hang level on the corresponding slog level
+func SlogLevel(level Level) slog.Level {
+	switch level {
+	case DebugLevel:
+		return slog.LevelDebug
+	case InfoLevel:
+		return slog.LevelInfo
+	case WarnLevel:
+		return slog.LevelWarn
+	case ErrorLevel:
+		return slog.LevelError
+	case FatalLevel:
+		return SlogLevelFatal
+	default:
+		return SlogLevelPanic
+	}
+}
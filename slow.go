@@ -0,0 +1,92 @@
+package hang
+
+import (
+	"bytes"
+	"net/http"
+	"reflect"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// MaxSlowStackBytes limits the goroutine snippet logged with slow requests
+var MaxSlowStackBytes = 8 << 10
+
+// SetSlowRequestThreshold makes Handle log a warning for the requests
+// taking longer than threshold (zero disables it). With withStack the stack
+// of the goroutines running the handler when the threshold is crossed is
+// added to the entry.
+func (h *Handler) SetSlowRequestThreshold(threshold time.Duration, withStack bool) {
+	h.slowThreshold = threshold
+	h.slowWithStack = withStack
+}
+
+// slowWatch measures a request for the slow request log
+type slowWatch struct {
+	h       *Handler
+	route   string
+	handler HandleFunc
+	start   time.Time
+	timer   *time.Timer
+	mu      sync.Mutex
+	stack   string
+}
+
+// watchSlow starts measuring a request, nil if the slow log is disabled
+func (h *Handler) watchSlow(route string, handler HandleFunc) *slowWatch {
+	if h.slowThreshold <= 0 {
+		return nil
+	}
+	sw := &slowWatch{h: h, route: route, handler: handler, start: time.Now()}
+	if h.slowWithStack {
+		sw.timer = time.AfterFunc(h.slowThreshold, sw.captureStack)
+	}
+	return sw
+}
+
+// captureStack keeps the stacks of the goroutines running the handler
+func (sw *slowWatch) captureStack() {
+	name := runtime.FuncForPC(reflect.ValueOf(sw.handler).Pointer()).Name()
+	buf := make([]byte, 1<<20)
+	buf = buf[:runtime.Stack(buf, true)]
+	var snippet bytes.Buffer
+	for _, g := range bytes.Split(buf, []byte("\n\n")) {
+		if bytes.Contains(g, []byte(name)) {
+			snippet.Write(g)
+			snippet.WriteString("\n\n")
+		}
+	}
+	s := snippet.String()
+	if len(s) > MaxSlowStackBytes {
+		s = s[:MaxSlowStackBytes] + "..."
+	}
+	sw.mu.Lock()
+	sw.stack = s
+	sw.mu.Unlock()
+}
+
+// done logs the request if slow
+func (sw *slowWatch) done(req *http.Request) {
+	if sw == nil {
+		return
+	}
+	if sw.timer != nil {
+		sw.timer.Stop()
+	}
+	latency := time.Since(sw.start)
+	if latency < sw.h.slowThreshold {
+		return
+	}
+	fields := Fields{
+		"route":      sw.route,
+		"function":   sw.h.handlerName(sw.route),
+		"origin":     RealIP(req),
+		"latency_ms": float64(latency.Microseconds()) / 1000,
+	}
+	sw.mu.Lock()
+	if sw.stack != "" {
+		fields["stack"] = sw.stack
+	}
+	sw.mu.Unlock()
+	sw.h.Log.WithFields(fields).Warn("slow request")
+}
@@ -0,0 +1,140 @@
+package hang
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// SSEEvent is a Server-Sent Event
+type SSEEvent struct {
+	// Event id, sent back by the client as Last-Event-ID on reconnection
+	ID string
+	// Event type, "message" if empty
+	Event string
+	// Payload, split into multiple data lines if it contains newlines
+	Data string
+	// Reconnection delay suggested to the client
+	Retry time.Duration
+}
+
+// SSEWriter writes Server-Sent Events to a response
+type SSEWriter struct {
+	resp   http.ResponseWriter
+	rc     *http.ResponseController
+	mu     sync.Mutex
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// NewSSEWriter prepares resp for a Server-Sent Events stream, sending a
+// keepalive comment every keepAlive (none if zero). The stream is done when
+// the client disconnects, the handler shuts down or Close is called.
+func (h *Handler) NewSSEWriter(resp http.ResponseWriter, req *http.Request, keepAlive time.Duration) (*SSEWriter, error) {
+	w := &SSEWriter{resp: resp, rc: http.NewResponseController(resp)}
+	w.ctx, w.cancel = context.WithCancel(req.Context())
+
+	resp.Header().Set("Content-Type", "text/event-stream")
+	resp.Header().Set("Cache-Control", "no-cache")
+	resp.Header().Set("Connection", "keep-alive")
+	// Disable proxy buffering (nginx)
+	resp.Header().Set("X-Accel-Buffering", "no")
+	resp.WriteHeader(http.StatusOK)
+	if err := w.rc.Flush(); err != nil {
+		w.cancel()
+		return nil, errors.Wrap(err, "can't stream events")
+	}
+	// The server write timeout would cut the stream
+	w.rc.SetWriteDeadline(time.Time{})
+
+	go func() {
+		select {
+		case <-h.Stopping():
+			w.Close()
+		case <-w.ctx.Done():
+		}
+	}()
+	if keepAlive > 0 {
+		go w.keepAlive(keepAlive)
+	}
+	return w, nil
+}
+
+// Send writes ev and flushes it to the client
+func (w *SSEWriter) Send(ev SSEEvent) error {
+	var b strings.Builder
+	if ev.ID != "" {
+		fmt.Fprintf(&b, "id: %s\n", ev.ID)
+	}
+	if ev.Event != "" {
+		fmt.Fprintf(&b, "event: %s\n", ev.Event)
+	}
+	if ev.Retry > 0 {
+		fmt.Fprintf(&b, "retry: %d\n", ev.Retry.Milliseconds())
+	}
+	for _, line := range strings.Split(ev.Data, "\n") {
+		fmt.Fprintf(&b, "data: %s\n", line)
+	}
+	b.WriteString("\n")
+	return w.write(b.String())
+}
+
+// SendJSON sends data encoded as JSON as an event of type event
+func (w *SSEWriter) SendJSON(event string, data interface{}) error {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return errors.Wrap(err, "can't encode event data")
+	}
+	return w.Send(SSEEvent{Event: event, Data: string(b)})
+}
+
+// Done is closed when the stream ends
+func (w *SSEWriter) Done() <-chan struct{} {
+	return w.ctx.Done()
+}
+
+// Close ends the stream, the handler must return to close the response
+func (w *SSEWriter) Close() {
+	w.cancel()
+}
+
+// write sends s unless the stream is done
+func (w *SSEWriter) write(s string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err := w.ctx.Err(); err != nil {
+		return errors.Wrap(err, "event stream closed")
+	}
+	if _, err := w.resp.Write([]byte(s)); err != nil {
+		w.cancel()
+		return errors.Wrap(err, "can't write event")
+	}
+	if err := w.rc.Flush(); err != nil {
+		w.cancel()
+		return errors.Wrap(err, "can't flush event")
+	}
+	return nil
+}
+
+// keepAlive sends a comment every d to keep the connection open through
+// proxies
+func (w *SSEWriter) keepAlive(d time.Duration) {
+	ticker := time.NewTicker(d)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if w.write(": keepalive\n\n") != nil {
+				return
+			}
+		case <-w.ctx.Done():
+			return
+		}
+	}
+}
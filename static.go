@@ -0,0 +1,131 @@
+package hang
+
+import (
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// StaticOptions configures a static route
+type StaticOptions struct {
+	// Serve Index for missing files, for single page applications
+	SPA bool
+	// Index file name, index.html if empty
+	Index string
+	// Cache-Control max-age of the files (Index excluded), no header if zero
+	MaxAge time.Duration
+	// Serve also files and folders starting with a dot
+	AllowHidden bool
+}
+
+// AddStaticRoute serves the files in dir under prefix (e.g. "assets" serves
+// /assets/css/app.css from dir/css/app.css). Requests can not escape dir.
+func (h *Handler) AddStaticRoute(prefix, dir string, opts ...StaticOptions) error {
+	var o StaticOptions
+	if len(opts) > 0 {
+		o = opts[0]
+	}
+	if o.Index == "" {
+		o.Index = "index.html"
+	}
+	fi, err := os.Stat(dir)
+	if err != nil || !fi.IsDir() {
+		return errors.New("static folder " + dir + " not found")
+	}
+	return h.AddRoute(prefixRoute(strings.Trim(prefix, "/")), staticHandler(http.Dir(dir), o))
+}
+
+// prefixRoute returns the route matching prefix and all its sub paths
+func prefixRoute(prefix string) string {
+	if prefix == "" {
+		return "*"
+	}
+	return prefix + "/*"
+}
+
+func staticHandler(fs http.FileSystem, o StaticOptions) HandleFunc {
+	return func(resp http.ResponseWriter, req *http.Request) error {
+		if req.Method != http.MethodGet && req.Method != http.MethodHead {
+			resp.Header().Set("Allow", "GET, HEAD")
+			WriteError(resp, req, http.StatusMethodNotAllowed, errors.New("method "+req.Method+" not allowed"))
+			return nil
+		}
+		name := RouteSuffix(req)
+		// http.Dir cleans the path, so it can not go above the root
+		name = path.Clean("/" + name)
+		if !o.AllowHidden && hiddenPath(name) {
+			WriteError(resp, req, http.StatusNotFound, errors.New("file not found"))
+			return nil
+		}
+		if name == "/" {
+			name = "/" + o.Index
+		}
+		maxAge := o.MaxAge
+		if path.Base(name) == o.Index {
+			maxAge = 0
+		}
+		served, err := serveFile(resp, req, fs, name, o.Index, maxAge)
+		if served || err != nil {
+			return err
+		}
+		if o.SPA && path.Ext(name) == "" {
+			// Let the client side router handle the path
+			resp.Header().Set("Cache-Control", "no-cache")
+			served, err = serveFile(resp, req, fs, "/"+o.Index, o.Index, 0)
+			if served || err != nil {
+				return err
+			}
+		}
+		WriteError(resp, req, http.StatusNotFound, errors.New("file not found"))
+		return nil
+	}
+}
+
+// serveFile serves name, or its index file if it is a folder, from fs,
+// returning false if it does not exist
+func serveFile(resp http.ResponseWriter, req *http.Request, fs http.FileSystem, name, index string, maxAge time.Duration) (bool, error) {
+	f, err := fs.Open(name)
+	if err != nil {
+		return false, nil
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return false, errors.Wrap(err, "can't stat "+name)
+	}
+	if fi.IsDir() {
+		// Folders are served through their index only
+		idx, err := fs.Open(path.Join(name, index))
+		if err != nil {
+			return false, nil
+		}
+		defer idx.Close()
+		if fi, err = idx.Stat(); err != nil || fi.IsDir() {
+			return false, nil
+		}
+		f = idx
+		// Not cached as the index
+		maxAge = 0
+	}
+	if maxAge > 0 {
+		resp.Header().Set("Cache-Control", "public, max-age="+strconv.Itoa(int(maxAge.Seconds())))
+	}
+	// Sets the content type from the extension and handles ranges and
+	// conditional requests
+	http.ServeContent(resp, req, fi.Name(), fi.ModTime(), f)
+	return true, nil
+}
+
+func hiddenPath(name string) bool {
+	for _, part := range strings.Split(name, "/") {
+		if strings.HasPrefix(part, ".") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,61 @@
+package hang
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAddStaticRouteIndex(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"main.htm":         "root",
+		"docs/main.htm":    "docs",
+		"other/index.html": "default index",
+		"app.css":          "css",
+	} {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	h := testHandler(t)
+	if err := h.AddStaticRoute("assets", dir, StaticOptions{Index: "main.htm", MaxAge: time.Hour}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		target string
+		status int
+		body   string
+		cached bool
+	}{
+		{"/assets", http.StatusOK, "root", false},
+		{"/assets/docs", http.StatusOK, "docs", false},
+		{"/assets/docs/", http.StatusOK, "docs", false},
+		{"/assets/other", http.StatusNotFound, "", false},
+		{"/assets/app.css", http.StatusOK, "css", true},
+	}
+	for _, tt := range tests {
+		rec := serve(h, http.MethodGet, tt.target, nil)
+		if rec.Code != tt.status {
+			t.Errorf("%s: got status %d, want %d", tt.target, rec.Code, tt.status)
+			continue
+		}
+		if tt.status != http.StatusOK {
+			continue
+		}
+		if rec.Body.String() != tt.body {
+			t.Errorf("%s: got body %q, want %q", tt.target, rec.Body.String(), tt.body)
+		}
+		if cached := rec.Header().Get("Cache-Control") != ""; cached != tt.cached {
+			t.Errorf("%s: got Cache-Control %q, want cached %v", tt.target, rec.Header().Get("Cache-Control"), tt.cached)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package hang
+
+import (
+	"net/http"
+	"sync"
+	"sync/atomic"
+)
+
+// RouteStats contains the request counters of a route
+type RouteStats struct {
+	// Requests handled
+	Requests uint64 `json:"requests"`
+	// Requests whose handler returned an error
+	Errors uint64 `json:"errors"`
+	// Responses by status class
+	Status1xx uint64 `json:"status_1xx"`
+	Status2xx uint64 `json:"status_2xx"`
+	Status3xx uint64 `json:"status_3xx"`
+	Status4xx uint64 `json:"status_4xx"`
+	Status5xx uint64 `json:"status_5xx"`
+	// Errors over requests
+	ErrorRate float64 `json:"error_rate"`
+}
+
+// routeCounters are updated atomically by Handle
+type routeCounters struct {
+	requests uint64
+	errors   uint64
+	classes  [6]uint64
+}
+
+// statsTable holds the counters by route
+type statsTable struct {
+	mu     sync.RWMutex
+	routes map[string]*routeCounters
+}
+
+func (st *statsTable) counters(route string) *routeCounters {
+	st.mu.RLock()
+	c, ok := st.routes[route]
+	st.mu.RUnlock()
+	if ok {
+		return c
+	}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.routes == nil {
+		st.routes = map[string]*routeCounters{}
+	}
+	if c, ok = st.routes[route]; !ok {
+		c = &routeCounters{}
+		st.routes[route] = c
+	}
+	return c
+}
+
+// record counts a handled request
+func (st *statsTable) record(route string, status int, err error) {
+	c := st.counters(route)
+	atomic.AddUint64(&c.requests, 1)
+	if err != nil {
+		atomic.AddUint64(&c.errors, 1)
+	}
+	if class := status / 100; class >= 1 && class <= 5 {
+		atomic.AddUint64(&c.classes[class], 1)
+	}
+}
+
+// Stats returns the request counters by route since the start of the
+// process (unmatched requests are counted under "default")
+func (h *Handler) Stats() map[string]RouteStats {
+	h.stats.mu.RLock()
+	defer h.stats.mu.RUnlock()
+	out := make(map[string]RouteStats, len(h.stats.routes))
+	for route, c := range h.stats.routes {
+		s := RouteStats{
+			Requests:  atomic.LoadUint64(&c.requests),
+			Errors:    atomic.LoadUint64(&c.errors),
+			Status1xx: atomic.LoadUint64(&c.classes[1]),
+			Status2xx: atomic.LoadUint64(&c.classes[2]),
+			Status3xx: atomic.LoadUint64(&c.classes[3]),
+			Status4xx: atomic.LoadUint64(&c.classes[4]),
+			Status5xx: atomic.LoadUint64(&c.classes[5]),
+		}
+		if s.Requests > 0 {
+			s.ErrorRate = float64(s.Errors) / float64(s.Requests)
+		}
+		out[route] = s
+	}
+	return out
+}
+
+// EnableStatsEndpoint registers the stats endpoint (on the admin listener,
+// if enabled) protected by token if not empty
+func (h *Handler) EnableStatsEndpoint(token string) error {
+	return h.ops().AddRoute("stats", RequireToken(token, DebugTokenHeader, h.StatsEndpoint))
+}
+
+// StatsEndpoint responds with the JSON request counters by route
+func (h *Handler) StatsEndpoint(resp http.ResponseWriter, req *http.Request) error {
+	return WriteJSON(resp, http.StatusOK, h.Stats())
+}
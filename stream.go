@@ -0,0 +1,120 @@
+package hang
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+
+	"github.com/pkg/errors"
+)
+
+// StreamFormat is the encoding of a JSONStream
+type StreamFormat int
+
+const (
+	// JSONArray streams the elements as a single JSON array
+	JSONArray StreamFormat = iota
+	// NDJSON streams one JSON document per line
+	NDJSON
+)
+
+// DefaultStreamFlushEvery is the default number of elements between flushes
+const DefaultStreamFlushEvery = 100
+
+// JSONStream writes a response element by element, without holding the whole
+// result set in memory. Once the first element is written the status can't
+// change anymore: errors after that just truncate the response.
+type JSONStream struct {
+	// Number of elements between flushes to the client
+	FlushEvery int
+
+	resp    http.ResponseWriter
+	rc      *http.ResponseController
+	buf     *bufio.Writer
+	format  StreamFormat
+	status  int
+	n       int
+	started bool
+	closed  bool
+}
+
+// NewJSONStream returns a stream writing to resp with the given status
+func NewJSONStream(resp http.ResponseWriter, status int, format StreamFormat) *JSONStream {
+	return &JSONStream{
+		FlushEvery: DefaultStreamFlushEvery,
+		resp:       resp,
+		rc:         http.NewResponseController(resp),
+		buf:        bufio.NewWriter(resp),
+		format:     format,
+		status:     status,
+	}
+}
+
+// Encode writes v as the next element
+func (s *JSONStream) Encode(v interface{}) error {
+	if s.closed {
+		return errors.New("JSON stream closed")
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return errors.Wrap(err, "can't encode stream element")
+	}
+	s.start()
+	if s.format == NDJSON {
+		b = append(b, '\n')
+	} else if s.n > 0 {
+		s.buf.WriteByte(',')
+	}
+	s.buf.Write(b)
+	s.n++
+	if s.FlushEvery > 0 && s.n%s.FlushEvery == 0 {
+		return s.Flush()
+	}
+	return nil
+}
+
+// Flush sends the buffered elements to the client
+func (s *JSONStream) Flush() error {
+	if err := s.buf.Flush(); err != nil {
+		return errors.Wrap(err, "can't write stream")
+	}
+	// Writers not supporting flushes are fine, data just arrives later
+	if err := s.rc.Flush(); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		return errors.Wrap(err, "can't flush stream")
+	}
+	return nil
+}
+
+// Close terminates the stream, it must be called even if no element was
+// written
+func (s *JSONStream) Close() error {
+	if s.closed {
+		return nil
+	}
+	s.start()
+	s.closed = true
+	if s.format == JSONArray {
+		s.buf.WriteString("]\n")
+	}
+	return s.Flush()
+}
+
+// Count returns the number of elements written
+func (s *JSONStream) Count() int {
+	return s.n
+}
+
+// start writes the header and opens the array on the first call
+func (s *JSONStream) start() {
+	if s.started {
+		return
+	}
+	s.started = true
+	if s.format == NDJSON {
+		s.resp.Header().Set("Content-Type", "application/x-ndjson")
+	} else {
+		s.resp.Header().Set("Content-Type", "application/json")
+		s.buf.WriteByte('[')
+	}
+	s.resp.WriteHeader(s.status)
+}
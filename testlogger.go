@@ -0,0 +1,88 @@
+package hang
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// LoggedEntry is an entry recorded by a TestLogger
+type LoggedEntry struct {
+	Level   Level
+	Message string
+	Fields  Fields
+}
+
+// TestLogger is a Logger recording the entries in memory, for tests to
+// assert on what was logged. Fatal entries exit and Panic entries panic
+// after being recorded, as with NewFuncLogger.
+type TestLogger struct {
+	Logger
+	mu      sync.Mutex
+	entries []LoggedEntry
+}
+
+// NewTestLogger returns a TestLogger recording all the levels
+func NewTestLogger() *TestLogger {
+	tl := &TestLogger{}
+	tl.Logger = NewFuncLogger(func(level Level, msg string, fields Fields) {
+		tl.mu.Lock()
+		defer tl.mu.Unlock()
+		tl.entries = append(tl.entries, LoggedEntry{Level: level, Message: msg, Fields: fields})
+	})
+	return tl
+}
+
+// Entries returns the entries recorded so far
+func (tl *TestLogger) Entries() []LoggedEntry {
+	tl.mu.Lock()
+	defer tl.mu.Unlock()
+	return append([]LoggedEntry(nil), tl.entries...)
+}
+
+// Reset forgets the recorded entries
+func (tl *TestLogger) Reset() {
+	tl.mu.Lock()
+	defer tl.mu.Unlock()
+	tl.entries = nil
+}
+
+// EntriesAt returns the entries at level
+func (tl *TestLogger) EntriesAt(level Level) []LoggedEntry {
+	return tl.filter(func(e LoggedEntry) bool { return e.Level == level })
+}
+
+// EntriesWithField returns the entries with the field key set to value, or
+// set at all if value is nil
+func (tl *TestLogger) EntriesWithField(key string, value interface{}) []LoggedEntry {
+	return tl.filter(func(e LoggedEntry) bool {
+		v, ok := e.Fields[key]
+		return ok && (value == nil || reflect.DeepEqual(v, value))
+	})
+}
+
+// Contains reports whether an entry at level containing msg was recorded
+func (tl *TestLogger) Contains(level Level, msg string) bool {
+	return len(tl.filter(func(e LoggedEntry) bool {
+		return e.Level == level && strings.Contains(e.Message, msg)
+	})) > 0
+}
+
+// ContainsError reports whether an entry at error level or more severe
+// containing msg was recorded
+func (tl *TestLogger) ContainsError(msg string) bool {
+	return len(tl.filter(func(e LoggedEntry) bool {
+		return e.Level <= ErrorLevel && strings.Contains(e.Message, msg)
+	})) > 0
+}
+
+// filter returns the entries for which keep is true
+func (tl *TestLogger) filter(keep func(LoggedEntry) bool) []LoggedEntry {
+	var entries []LoggedEntry
+	for _, e := range tl.Entries() {
+		if keep(e) {
+			entries = append(entries, e)
+		}
+	}
+	return entries
+}
@@ -0,0 +1,106 @@
+package hang
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Timeout returns a middleware running the handler with a context having
+// deadline d. If the handler does not return in time the client gets a 504
+// and the error, reporting the latency, is logged by Handle with the route.
+// Requests canceled by the client get no response. The response is buffered
+// until the handler returns.
+func Timeout(d time.Duration) Middleware {
+	return func(next HandleFunc) HandleFunc {
+		return func(resp http.ResponseWriter, req *http.Request) error {
+			var (
+				start  = time.Now()
+				done   = make(chan error, 1)
+				panicc = make(chan interface{}, 1)
+				tw     = &timeoutWriter{header: http.Header{}, status: http.StatusOK}
+			)
+			ctx, cancel := context.WithTimeout(req.Context(), d)
+			defer cancel()
+
+			go func() {
+				defer func() {
+					if p := recover(); p != nil {
+						panicc <- p
+					}
+				}()
+				done <- next(tw, req.WithContext(ctx))
+			}()
+
+			select {
+			case p := <-panicc:
+				panic(p)
+			case err := <-done:
+				tw.mu.Lock()
+				defer tw.mu.Unlock()
+				if !tw.wroteHeader {
+					// Nothing written by the handler, leave the error
+					// response to Handle
+					return err
+				}
+				dst := resp.Header()
+				for k, v := range tw.header {
+					dst[k] = v
+				}
+				resp.WriteHeader(tw.status)
+				resp.Write(tw.buf.Bytes())
+				return err
+			case <-ctx.Done():
+				tw.mu.Lock()
+				defer tw.mu.Unlock()
+				tw.abandoned = true
+				if ctx.Err() != context.DeadlineExceeded {
+					// Nobody left to respond to
+					return errors.Wrapf(ctx.Err(), "request canceled after %v", time.Since(start))
+				}
+				err := errors.Errorf("request timed out after %v (budget %v)", time.Since(start), d)
+				WriteError(resp, req, http.StatusGatewayTimeout, errors.New("request timed out"))
+				return err
+			}
+		}
+	}
+}
+
+// timeoutWriter buffers the response of a handler run by Timeout
+type timeoutWriter struct {
+	mu          sync.Mutex
+	header      http.Header
+	buf         bytes.Buffer
+	status      int
+	wroteHeader bool
+	// Set when Timeout returned before the handler
+	abandoned bool
+}
+
+func (tw *timeoutWriter) Header() http.Header {
+	return tw.header
+}
+
+func (tw *timeoutWriter) Write(b []byte) (int, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.abandoned {
+		return 0, http.ErrHandlerTimeout
+	}
+	tw.wroteHeader = true
+	return tw.buf.Write(b)
+}
+
+func (tw *timeoutWriter) WriteHeader(status int) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.abandoned || tw.wroteHeader {
+		return
+	}
+	tw.wroteHeader = true
+	tw.status = status
+}
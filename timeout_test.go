@@ -0,0 +1,53 @@
+package hang
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func TestTimeout(t *testing.T) {
+	h := testHandler(t)
+	h.Use(Timeout(50 * time.Millisecond))
+	h.AddRoute("slow", func(resp http.ResponseWriter, req *http.Request) error {
+		<-req.Context().Done()
+		return nil
+	})
+
+	if rec := serve(h, http.MethodGet, "/slow", nil); rec.Code != http.StatusGatewayTimeout {
+		t.Errorf("deadline: got status %d, want %d", rec.Code, http.StatusGatewayTimeout)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req := httptest.NewRequest(http.MethodGet, "/slow", nil).WithContext(ctx)
+	rec := httptest.NewRecorder()
+	time.AfterFunc(10*time.Millisecond, cancel)
+	h.ServeHTTP(rec, req)
+	if rec.Code == http.StatusGatewayTimeout || rec.Body.Len() != 0 {
+		t.Errorf("canceled: got status %d and body %q, want no response", rec.Code, rec.Body.String())
+	}
+}
+
+func TestTimeoutHandlerError(t *testing.T) {
+	h := testHandler(t)
+	h.SetErrorRenderer(FormatErrorRenderer(ProblemJSONErrors))
+	h.Use(Timeout(time.Second))
+	h.AddRoute("fail", func(resp http.ResponseWriter, req *http.Request) error {
+		return errors.New("db down")
+	})
+	h.AddRoute("ok", func(resp http.ResponseWriter, req *http.Request) error {
+		resp.Header().Set("X-Done", "yes")
+		return WriteJSON(resp, http.StatusCreated, "done")
+	})
+
+	if rec := serve(h, http.MethodGet, "/fail", nil); rec.Code != http.StatusInternalServerError || rec.Body.Len() == 0 {
+		t.Errorf("handler error: got status %d and body %q, want the rendered 500", rec.Code, rec.Body.String())
+	}
+	if rec := serve(h, http.MethodGet, "/ok", nil); rec.Code != http.StatusCreated || rec.Header().Get("X-Done") != "yes" {
+		t.Errorf("handler response: got status %d and headers %v, want the buffered 201", rec.Code, rec.Header())
+	}
+}
@@ -0,0 +1,111 @@
+package hang
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TracerName is the instrumentation name of the spans created by hang
+const TracerName = "github.com/brunetto/hang"
+
+// TracingOptions configures the tracing middleware
+type TracingOptions struct {
+	// Provider of the tracer, the global one if nil
+	TracerProvider trace.TracerProvider
+	// Propagator extracting the parent span, W3C trace context if nil
+	Propagator propagation.TextMapPropagator
+}
+
+func (o TracingOptions) tracer() trace.Tracer {
+	tp := o.TracerProvider
+	if tp == nil {
+		tp = otel.GetTracerProvider()
+	}
+	return tp.Tracer(TracerName)
+}
+
+func (o TracingOptions) propagator() propagation.TextMapPropagator {
+	if o.Propagator == nil {
+		return propagation.TraceContext{}
+	}
+	return o.Propagator
+}
+
+// Tracing returns a middleware starting a server span per request, named
+// after the matched route and child of the traceparent header span, if any.
+// The span is available to the handler through the request context.
+func Tracing(opts TracingOptions) Middleware {
+	tracer := opts.tracer()
+	prop := opts.propagator()
+	return func(next HandleFunc) HandleFunc {
+		return func(resp http.ResponseWriter, req *http.Request) error {
+			route := RouteFrom(req)
+			ctx := prop.Extract(req.Context(), propagation.HeaderCarrier(req.Header))
+			ctx, span := tracer.Start(ctx, route,
+				trace.WithSpanKind(trace.SpanKindServer),
+				trace.WithAttributes(requestAttributes(req, route)...),
+			)
+			defer span.End()
+
+			rr := NewResponseRecorder(resp)
+			err := next(rr, req.WithContext(ctx))
+			endSpan(span, rr.Status, err)
+			return err
+		}
+	}
+}
+
+// GinTracing is the Tracing middleware for gin engines, such as the one
+// returned by GinOnTheRocks
+func GinTracing(opts TracingOptions) gin.HandlerFunc {
+	tracer := opts.tracer()
+	prop := opts.propagator()
+	return func(c *gin.Context) {
+		route := c.FullPath()
+		if route == "" {
+			route = "default"
+		}
+		ctx := prop.Extract(c.Request.Context(), propagation.HeaderCarrier(c.Request.Header))
+		ctx, span := tracer.Start(ctx, route,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(requestAttributes(c.Request, route)...),
+		)
+		defer span.End()
+
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+		var err error
+		if e := c.Errors.Last(); e != nil {
+			err = e
+		}
+		endSpan(span, c.Writer.Status(), err)
+	}
+}
+
+func requestAttributes(req *http.Request, route string) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.String("http.request.method", req.Method),
+		attribute.String("http.route", route),
+		attribute.String("url.path", req.URL.Path),
+		attribute.String("client.address", RealIP(req)),
+		attribute.String("user_agent.original", req.UserAgent()),
+	}
+}
+
+func endSpan(span trace.Span, status int, err error) {
+	span.SetAttributes(attribute.Int("http.response.status_code", status))
+	if err != nil {
+		span.RecordError(err)
+	}
+	if status >= 500 {
+		span.SetStatus(codes.Error, http.StatusText(status))
+	} else if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+	}
+}
@@ -0,0 +1,149 @@
+package hang
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/pkg/errors"
+)
+
+// Validator is the struct-tag validator used by GetReqJSONDataValidated,
+// exported so custom validations can be registered on it
+var Validator = newValidator()
+
+// FieldError describes a single field failing validation
+type FieldError struct {
+	// JSON name of the field (dotted path for nested structs)
+	Field string `json:"field"`
+	// Validation rule that failed (required, min, max, email, ...)
+	Rule string `json:"rule"`
+	// Rule parameter, if any (e.g. 3 for min=3)
+	Param string `json:"param,omitempty"`
+	// Human readable description of the failure
+	Message string `json:"message"`
+}
+
+// ValidationErrors is the list of field errors returned when validation fails
+type ValidationErrors []FieldError
+
+// Error implements the error interface
+func (ve ValidationErrors) Error() string {
+	msgs := make([]string, len(ve))
+	for i, fe := range ve {
+		msgs[i] = fe.Message
+	}
+	return "validation failed: " + strings.Join(msgs, "; ")
+}
+
+func newValidator() *validator.Validate {
+	v := validator.New()
+	// Report JSON names instead of Go field names
+	v.RegisterTagNameFunc(func(f reflect.StructField) string {
+		name := strings.SplitN(f.Tag.Get("json"), ",", 2)[0]
+		if name == "-" {
+			return ""
+		}
+		if name == "" {
+			return f.Name
+		}
+		return name
+	})
+	return v
+}
+
+// Validate runs the struct-tag ("validate") validation on data, a struct or
+// a slice, array or map of structs, and returns ValidationErrors if any field
+// is not valid. Other values have nothing to validate.
+func Validate(data interface{}) error {
+	var (
+		err  error
+		verr validator.ValidationErrors
+		ve   ValidationErrors
+	)
+	v := reflect.ValueOf(data)
+	for v.Kind() == reflect.Ptr && !v.IsNil() {
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.Struct:
+		err = Validator.Struct(v.Interface())
+	case reflect.Slice, reflect.Array, reflect.Map:
+		err = Validator.Var(v.Interface(), "dive")
+	default:
+		return nil
+	}
+	if err == nil {
+		return nil
+	}
+	if !errors.As(err, &verr) {
+		return errors.Wrap(err, "can't validate input data")
+	}
+	for _, fe := range verr {
+		ve = append(ve, FieldError{
+			Field:   fieldPath(fe.Namespace()),
+			Rule:    fe.Tag(),
+			Param:   fe.Param(),
+			Message: fieldMessage(fe),
+		})
+	}
+	return ve
+}
+
+// GetReqJSONDataValidated works like GetReqJSONData and then validates the
+// decoded struct, responding 422 with the list of field errors on failure
+func GetReqJSONDataValidated(resp http.ResponseWriter, req *http.Request, data interface{}) error {
+	var (
+		err error
+		ve  ValidationErrors
+	)
+	err = GetReqJSONData(resp, req, data)
+	if err != nil {
+		return err
+	}
+	err = Validate(data)
+	if err == nil {
+		return nil
+	}
+	if !errors.As(err, &ve) {
+		// Respond
+		WriteError(resp, req, http.StatusInternalServerError, err)
+		return err
+	}
+	// Respond with the field errors
+	writeError(resp, req, RequestErrorFormat(req), http.StatusUnprocessableEntity, err, ve)
+	return err
+}
+
+// fieldPath removes the top level struct name from the validator namespace
+func fieldPath(namespace string) string {
+	if strings.HasPrefix(namespace, "[") {
+		// Element of a validated slice or map, e.g. [1].name
+		return namespace
+	}
+	if i := strings.Index(namespace, "."); i >= 0 {
+		return namespace[i+1:]
+	}
+	return namespace
+}
+
+func fieldMessage(fe validator.FieldError) string {
+	field := fieldPath(fe.Namespace())
+	switch fe.Tag() {
+	case "required":
+		return field + " is required"
+	case "min":
+		return field + " must be at least " + fe.Param()
+	case "max":
+		return field + " must be at most " + fe.Param()
+	case "len":
+		return field + " must have length " + fe.Param()
+	case "oneof":
+		return field + " must be one of: " + fe.Param()
+	}
+	if fe.Param() != "" {
+		return field + " does not satisfy " + fe.Tag() + "=" + fe.Param()
+	}
+	return field + " is not a valid " + fe.Tag()
+}
@@ -0,0 +1,48 @@
+package hang
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestGetReqJSONDataValidated(t *testing.T) {
+	type item struct {
+		Name string `json:"name" validate:"required"`
+		Qty  int    `json:"qty" validate:"min=1"`
+	}
+	tests := []struct {
+		name   string
+		data   func() interface{}
+		body   string
+		status int
+		fields []string
+	}{
+		{"valid struct", func() interface{} { return &item{} }, `{"name": "a", "qty": 1}`, http.StatusOK, nil},
+		{"invalid struct", func() interface{} { return &item{} }, `{"qty": 0}`, http.StatusUnprocessableEntity, []string{"name", "qty"}},
+		{"valid slice", func() interface{} { return &[]item{} }, `[{"name": "a", "qty": 1}]`, http.StatusOK, nil},
+		{"invalid slice", func() interface{} { return &[]item{} }, `[{"name": "a", "qty": 1}, {"qty": 1}]`, http.StatusUnprocessableEntity, []string{"[1].name"}},
+		{"empty slice", func() interface{} { return &[]item{} }, `[]`, http.StatusOK, nil},
+		{"map", func() interface{} { return &map[string]item{} }, `{"a": {"name": "a"}}`, http.StatusUnprocessableEntity, []string{"[a].qty"}},
+		{"slice of scalars", func() interface{} { return &[]int{} }, `[1, 2]`, http.StatusOK, nil},
+		{"scalar", func() interface{} { return new(string) }, `"a"`, http.StatusOK, nil},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tt.body))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		err := GetReqJSONDataValidated(rec, req, tt.data())
+		if err == nil {
+			rec.WriteHeader(http.StatusOK)
+		}
+		if rec.Code != tt.status {
+			t.Errorf("%s: got status %d (%v), want %d", tt.name, rec.Code, err, tt.status)
+		}
+		for _, field := range tt.fields {
+			if !strings.Contains(rec.Body.String(), `"`+field) {
+				t.Errorf("%s: field %s not reported in %s", tt.name, field, rec.Body.String())
+			}
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package hang
+
+import (
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// BuildInfo describes the running binary
+type BuildInfo struct {
+	Version   string    `json:"version"`
+	Commit    string    `json:"commit"`
+	BuildDate string    `json:"build_date"`
+	GoVersion string    `json:"go_version"`
+	StartTime time.Time `json:"start_time"`
+	Uptime    string    `json:"uptime"`
+}
+
+var (
+	buildMu   sync.RWMutex
+	buildInfo = readBuildInfo()
+	startTime = time.Now()
+)
+
+// SetBuildInfo sets the version of the service, usually injected at build
+// time with -ldflags "-X main.version=...". Empty values keep the ones read
+// from the module build info. Call it before NewHandler for the version to
+// be in the startup log line.
+func SetBuildInfo(version, commit, buildDate string) {
+	buildMu.Lock()
+	defer buildMu.Unlock()
+	if version != "" {
+		buildInfo.Version = version
+	}
+	if commit != "" {
+		buildInfo.Commit = commit
+	}
+	if buildDate != "" {
+		buildInfo.BuildDate = buildDate
+	}
+}
+
+// GetBuildInfo returns the build info of the service with its uptime
+func GetBuildInfo() BuildInfo {
+	buildMu.RLock()
+	bi := buildInfo
+	buildMu.RUnlock()
+	bi.StartTime = startTime
+	bi.Uptime = time.Since(startTime).Round(time.Second).String()
+	return bi
+}
+
+// readBuildInfo gets version and VCS data embedded by the Go toolchain
+func readBuildInfo() BuildInfo {
+	bi := BuildInfo{Version: "unknown", GoVersion: runtime.Version()}
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return bi
+	}
+	if v := info.Main.Version; v != "" && v != "(devel)" {
+		bi.Version = v
+	}
+	for _, s := range info.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			bi.Commit = s.Value
+		case "vcs.time":
+			bi.BuildDate = s.Value
+		}
+	}
+	return bi
+}
+
+// Version responds with the JSON build info
+func (h *Handler) Version(resp http.ResponseWriter, req *http.Request) error {
+	return WriteJSON(resp, http.StatusOK, GetBuildInfo())
+}
@@ -0,0 +1,58 @@
+package webhook
+
+import (
+	"context"
+	"sort"
+	"sync"
+)
+
+// Store keeps the undelivered deliveries, implementations must be safe for
+// concurrent use
+type Store interface {
+	// Save adds or replaces the delivery of an event to a target
+	Save(ctx context.Context, dl Delivery) error
+	// Delete removes the delivery of an event to a target
+	Delete(ctx context.Context, eventID, targetID string) error
+	// List returns the stored deliveries, oldest first
+	List(ctx context.Context) ([]Delivery, error)
+}
+
+// MemoryStore is a Store losing its content on restart, for tests and
+// services that can afford it
+type MemoryStore struct {
+	mu         sync.Mutex
+	deliveries map[string]Delivery
+}
+
+// NewMemoryStore returns an empty MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{deliveries: map[string]Delivery{}}
+}
+
+// Save implements Store
+func (s *MemoryStore) Save(_ context.Context, dl Delivery) error {
+	s.mu.Lock()
+	s.deliveries[dl.Event.ID+"/"+dl.TargetID] = dl
+	s.mu.Unlock()
+	return nil
+}
+
+// Delete implements Store
+func (s *MemoryStore) Delete(_ context.Context, eventID, targetID string) error {
+	s.mu.Lock()
+	delete(s.deliveries, eventID+"/"+targetID)
+	s.mu.Unlock()
+	return nil
+}
+
+// List implements Store
+func (s *MemoryStore) List(_ context.Context) ([]Delivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := make([]Delivery, 0, len(s.deliveries))
+	for _, dl := range s.deliveries {
+		list = append(list, dl)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Event.CreatedAt.Before(list[j].Event.CreatedAt) })
+	return list, nil
+}
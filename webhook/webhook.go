@@ -0,0 +1,339 @@
+// Package webhook delivers events to the registered HTTP targets, signing the
+// payloads as checked by hang's VerifySignature middleware and retrying with
+// exponential backoff. Deliveries still failing after the last attempt, or
+// pending at shutdown, are saved in a Store to be redelivered later.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/brunetto/hang"
+	"github.com/pkg/errors"
+)
+
+// Headers sent with every delivery, besides the signature ones
+const (
+	EventIDHeader   = "X-Webhook-Id"
+	EventTypeHeader = "X-Webhook-Event"
+)
+
+// Target is a receiver of events
+type Target struct {
+	ID  string
+	URL string
+	// Signing secret and its ID, sent in hang.SignatureKeyIDHeader
+	Secret []byte
+	KeyID  string
+	// Event types delivered, all if empty
+	Events []string
+}
+
+// accepts reports whether the target subscribed to eventType
+func (t Target) accepts(eventType string) bool {
+	if len(t.Events) == 0 {
+		return true
+	}
+	for _, e := range t.Events {
+		if e == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// Event is a notification to deliver
+type Event struct {
+	ID        string          `json:"id"`
+	Type      string          `json:"type"`
+	Payload   json.RawMessage `json:"payload"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// Delivery is an event addressed to a target
+type Delivery struct {
+	Event     Event     `json:"event"`
+	TargetID  string    `json:"target_id"`
+	Attempts  int       `json:"attempts"`
+	LastError string    `json:"last_error,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Metrics are the delivery counters of a Dispatcher
+type Metrics struct {
+	Published int64 `json:"published"`
+	Delivered int64 `json:"delivered"`
+	Retries   int64 `json:"retries"`
+	Failed    int64 `json:"failed"`
+	// Deliveries queued or being attempted
+	InFlight int64 `json:"in_flight"`
+}
+
+// Options configures a Dispatcher, zero values meaning the defaults
+type Options struct {
+	// Client sending the requests, one with a 10s timeout by default
+	Client *http.Client
+	// Attempts per delivery, 5 by default
+	MaxAttempts int
+	// Backoff before the retries, doubling from BaseBackoff (1s) up to
+	// MaxBackoff (5m)
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+	// Concurrent deliveries, 4 by default
+	Workers int
+	// Deliveries waiting for a worker before being stored, 1000 by default
+	QueueSize int
+	// Storage of the undelivered events, an in-memory one by default
+	Store Store
+}
+
+// Dispatcher delivers the published events to the registered targets
+type Dispatcher struct {
+	Log     hang.Logger
+	opts    Options
+	mu      sync.RWMutex
+	targets map[string]Target
+	queue   chan Delivery
+	metrics Metrics
+}
+
+// New returns a Dispatcher, deliveries start with Run
+func New(lg hang.Logger, opts Options) *Dispatcher {
+	if opts.Client == nil {
+		opts.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = 5
+	}
+	if opts.BaseBackoff <= 0 {
+		opts.BaseBackoff = time.Second
+	}
+	if opts.MaxBackoff <= 0 {
+		opts.MaxBackoff = 5 * time.Minute
+	}
+	if opts.Workers <= 0 {
+		opts.Workers = 4
+	}
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = 1000
+	}
+	if opts.Store == nil {
+		opts.Store = NewMemoryStore()
+	}
+	return &Dispatcher{
+		Log:     lg,
+		opts:    opts,
+		targets: map[string]Target{},
+		queue:   make(chan Delivery, opts.QueueSize),
+	}
+}
+
+// AddTarget registers or replaces a target
+func (d *Dispatcher) AddTarget(t Target) error {
+	if t.ID == "" || t.URL == "" {
+		return errors.New("webhook target needs ID and URL")
+	}
+	d.mu.Lock()
+	d.targets[t.ID] = t
+	d.mu.Unlock()
+	return nil
+}
+
+// RemoveTarget unregisters a target, its queued deliveries are dropped
+func (d *Dispatcher) RemoveTarget(id string) {
+	d.mu.Lock()
+	delete(d.targets, id)
+	d.mu.Unlock()
+}
+
+// Publish queues the delivery of payload, encoded as JSON, to the targets
+// subscribed to eventType
+func (d *Dispatcher) Publish(ctx context.Context, eventType string, payload interface{}) (Event, error) {
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return Event{}, errors.Wrap(err, "can't encode webhook payload")
+	}
+	ev := Event{ID: hang.NewRequestID(), Type: eventType, Payload: b, CreatedAt: time.Now()}
+	atomic.AddInt64(&d.metrics.Published, 1)
+
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	for _, t := range d.targets {
+		if t.accepts(eventType) {
+			if err := d.enqueue(ctx, Delivery{Event: ev, TargetID: t.ID, UpdatedAt: ev.CreatedAt}); err != nil {
+				return ev, err
+			}
+		}
+	}
+	return ev, nil
+}
+
+// enqueue hands dl to the workers, storing it if the queue is full
+func (d *Dispatcher) enqueue(ctx context.Context, dl Delivery) error {
+	select {
+	case d.queue <- dl:
+		atomic.AddInt64(&d.metrics.InFlight, 1)
+		return nil
+	default:
+		return errors.Wrap(d.opts.Store.Save(ctx, dl), "webhook queue full, can't store delivery")
+	}
+}
+
+// Redeliver queues again the deliveries saved in the store
+func (d *Dispatcher) Redeliver(ctx context.Context) error {
+	pending, err := d.opts.Store.List(ctx)
+	if err != nil {
+		return errors.Wrap(err, "can't list stored deliveries")
+	}
+	for _, dl := range pending {
+		if err := d.opts.Store.Delete(ctx, dl.Event.ID, dl.TargetID); err != nil {
+			return errors.Wrap(err, "can't remove stored delivery")
+		}
+		// A new round of attempts
+		dl.Attempts = 0
+		if err := d.enqueue(ctx, dl); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Metrics returns a snapshot of the delivery counters
+func (d *Dispatcher) Metrics() Metrics {
+	return Metrics{
+		Published: atomic.LoadInt64(&d.metrics.Published),
+		Delivered: atomic.LoadInt64(&d.metrics.Delivered),
+		Retries:   atomic.LoadInt64(&d.metrics.Retries),
+		Failed:    atomic.LoadInt64(&d.metrics.Failed),
+		InFlight:  atomic.LoadInt64(&d.metrics.InFlight),
+	}
+}
+
+// Run delivers the queued events until ctx is done, then saves the pending
+// deliveries in the store. It implements hang.Runner.
+func (d *Dispatcher) Run(ctx context.Context) error {
+	var wg sync.WaitGroup
+	for i := 0; i < d.opts.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case dl := <-d.queue:
+					d.deliver(ctx, dl)
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Keep what is still queued for the next run
+	for {
+		select {
+		case dl := <-d.queue:
+			atomic.AddInt64(&d.metrics.InFlight, -1)
+			if err := d.opts.Store.Save(context.Background(), dl); err != nil {
+				d.Log.WithFields(hang.Fields{"event_id": dl.Event.ID, "target": dl.TargetID}).Error(errors.Wrap(err, "can't store pending delivery"))
+			}
+		default:
+			return nil
+		}
+	}
+}
+
+// deliver attempts dl until success, a permanent failure, the last attempt
+// or ctx done, storing it in the last two cases
+func (d *Dispatcher) deliver(ctx context.Context, dl Delivery) {
+	defer atomic.AddInt64(&d.metrics.InFlight, -1)
+	d.mu.RLock()
+	t, ok := d.targets[dl.TargetID]
+	d.mu.RUnlock()
+	if !ok {
+		// Target removed
+		return
+	}
+	log := d.Log.WithFields(hang.Fields{"event_id": dl.Event.ID, "event": dl.Event.Type, "target": t.ID})
+	for {
+		dl.Attempts++
+		dl.UpdatedAt = time.Now()
+		retry, err := d.send(ctx, t, dl.Event)
+		if err == nil {
+			atomic.AddInt64(&d.metrics.Delivered, 1)
+			log.WithFields(hang.Fields{"attempts": dl.Attempts}).Debug("webhook delivered")
+			return
+		}
+		dl.LastError = err.Error()
+		if !retry || dl.Attempts >= d.opts.MaxAttempts {
+			atomic.AddInt64(&d.metrics.Failed, 1)
+			log.WithFields(hang.Fields{"attempts": dl.Attempts}).Error(errors.Wrap(err, "webhook delivery failed"))
+			d.store(dl, log)
+			return
+		}
+		atomic.AddInt64(&d.metrics.Retries, 1)
+		select {
+		case <-time.After(d.backoff(dl.Attempts)):
+		case <-ctx.Done():
+			d.store(dl, log)
+			return
+		}
+	}
+}
+
+// store saves an undelivered delivery
+func (d *Dispatcher) store(dl Delivery, log hang.Entry) {
+	if err := d.opts.Store.Save(context.Background(), dl); err != nil {
+		log.Error(errors.Wrap(err, "can't store undelivered webhook"))
+	}
+}
+
+// send posts ev to t, reporting whether a failure can be retried
+func (d *Dispatcher) send(ctx context.Context, t Target, ev Event) (bool, error) {
+	body, err := json.Marshal(ev)
+	if err != nil {
+		return false, errors.Wrap(err, "can't encode webhook event")
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, errors.Wrap(err, "can't create webhook request")
+	}
+	now := time.Now()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventIDHeader, ev.ID)
+	req.Header.Set(EventTypeHeader, ev.Type)
+	req.Header.Set(hang.SignatureTimestampHeader, strconv.FormatInt(now.Unix(), 10))
+	req.Header.Set(hang.SignatureHeader, "sha256="+hang.Sign(nil, t.Secret, now, body))
+	if t.KeyID != "" {
+		req.Header.Set(hang.SignatureKeyIDHeader, t.KeyID)
+	}
+	resp, err := d.opts.Client.Do(req)
+	if err != nil {
+		return true, errors.Wrap(err, "can't send webhook")
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 300 {
+		return true, nil
+	}
+	err = errors.Errorf("webhook target responded %d", resp.StatusCode)
+	// Client errors are permanent, except timeouts and throttling
+	retry := resp.StatusCode >= 500 || resp.StatusCode == http.StatusRequestTimeout || resp.StatusCode == http.StatusTooManyRequests
+	return retry, err
+}
+
+// backoff returns the wait after attempt, with jitter
+func (d *Dispatcher) backoff(attempt int) time.Duration {
+	b := d.opts.BaseBackoff << uint(attempt-1)
+	if b <= 0 || b > d.opts.MaxBackoff {
+		b = d.opts.MaxBackoff
+	}
+	// Between b/2 and b
+	return b/2 + time.Duration(rand.Int63n(int64(b/2)+1))
+}
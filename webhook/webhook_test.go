@@ -0,0 +1,124 @@
+package webhook
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/brunetto/hang"
+)
+
+// waitFor polls cond until true or a timeout
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); !cond(); time.Sleep(5 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for " + what)
+		}
+	}
+}
+
+// receiver returns a target answering with the statuses in order, then 200,
+// and checking the signature of every request
+func receiver(t *testing.T, secret []byte, statuses ...int) (*httptest.Server, *int32) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		n := atomic.AddInt32(&calls, 1)
+		body, _ := ioutil.ReadAll(req.Body)
+		ts, _ := strconv.ParseInt(req.Header.Get(hang.SignatureTimestampHeader), 10, 64)
+		if got, want := req.Header.Get(hang.SignatureHeader), "sha256="+hang.Sign(nil, secret, time.Unix(ts, 0), body); got != want {
+			t.Errorf("got signature %q, want %q", got, want)
+		}
+		if int(n) <= len(statuses) {
+			resp.WriteHeader(statuses[n-1])
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &calls
+}
+
+func TestDeliveryRetries(t *testing.T) {
+	secret := []byte("secret")
+	tests := []struct {
+		name      string
+		statuses  []int
+		calls     int32
+		delivered bool
+	}{
+		{"first attempt", nil, 1, true},
+		{"retried until success", []int{http.StatusServiceUnavailable, http.StatusTooManyRequests}, 3, true},
+		{"attempts exhausted", []int{500, 500, 500}, 3, false},
+		{"permanent failure", []int{http.StatusBadRequest}, 1, false},
+	}
+	for _, tt := range tests {
+		srv, calls := receiver(t, secret, tt.statuses...)
+		store := NewMemoryStore()
+		d := New(hang.NewTestLogger(), Options{MaxAttempts: 3, BaseBackoff: time.Millisecond, Store: store})
+		d.AddTarget(Target{ID: "t", URL: srv.URL, Secret: secret})
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			d.Run(ctx)
+			close(done)
+		}()
+
+		ev, err := d.Publish(ctx, "order.created", map[string]int{"id": 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		waitFor(t, tt.name, func() bool { return d.Metrics().InFlight == 0 })
+		cancel()
+		<-done
+
+		if n := atomic.LoadInt32(calls); n != tt.calls {
+			t.Errorf("%s: got %d attempts, want %d", tt.name, n, tt.calls)
+		}
+		m := d.Metrics()
+		stored, _ := store.List(context.Background())
+		if tt.delivered {
+			if m.Delivered != 1 || m.Retries != int64(tt.calls-1) || len(stored) != 0 {
+				t.Errorf("%s: got metrics %+v and %d stored, want delivered after %d retries", tt.name, m, len(stored), tt.calls-1)
+			}
+			continue
+		}
+		if m.Failed != 1 || len(stored) != 1 || stored[0].Event.ID != ev.ID || stored[0].Attempts != int(tt.calls) || stored[0].LastError == "" {
+			t.Errorf("%s: got metrics %+v and stored %+v, want the failed delivery stored", tt.name, m, stored)
+		}
+	}
+}
+
+func TestRedeliver(t *testing.T) {
+	srv, calls := receiver(t, nil)
+	store := NewMemoryStore()
+	d := New(hang.NewTestLogger(), Options{BaseBackoff: time.Millisecond, Store: store})
+	d.AddTarget(Target{ID: "orders", URL: srv.URL, Events: []string{"order.created"}})
+	d.AddTarget(Target{ID: "all", URL: srv.URL})
+
+	// Published while not running: saved when Run stops
+	ctx := context.Background()
+	d.Publish(ctx, "order.created", nil)
+	d.Publish(ctx, "user.created", nil)
+	stopped, cancel := context.WithCancel(ctx)
+	cancel()
+	d.Run(stopped)
+	stored, _ := store.List(ctx)
+	if len(stored) != 3 || atomic.LoadInt32(calls) != 0 {
+		t.Fatalf("got %d stored after %d calls, want 3 deliveries stored without calls", len(stored), atomic.LoadInt32(calls))
+	}
+
+	runCtx, stop := context.WithCancel(ctx)
+	defer stop()
+	go d.Run(runCtx)
+	if err := d.Redeliver(ctx); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the redeliveries", func() bool { return d.Metrics().Delivered == 3 })
+	if stored, _ := store.List(ctx); len(stored) != 0 {
+		t.Errorf("got %d deliveries still stored, want none", len(stored))
+	}
+}
@@ -0,0 +1,141 @@
+package hang
+
+import (
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/pkg/errors"
+)
+
+// WebSocketOptions configures a websocket route
+type WebSocketOptions struct {
+	// Interval between pings, 30s if zero
+	PingInterval time.Duration
+	// Maximum wait for a pong (or any message) before the connection is
+	// considered dead, 60s if zero
+	PongWait time.Duration
+	// Maximum size of a received message, no limit if zero
+	ReadLimit int64
+	// Origin check, same origin only if nil
+	CheckOrigin func(req *http.Request) bool
+}
+
+// Conn is a websocket connection handled by a websocket route. The
+// keepalive pongs are processed while reading, so handlers must keep
+// reading from the connection.
+type Conn struct {
+	*websocket.Conn
+	// Logger with the connection fields (route, origin, request ID)
+	Log Entry
+	// Request upgraded to websocket
+	Request *http.Request
+}
+
+// WebSocketFunc handles a websocket connection, which is closed when it returns
+type WebSocketFunc func(conn *Conn) error
+
+// AddWebSocketRoute registers a route upgrading the connection to websocket
+// and passing it to fn, sending pings to keep it alive. Open connections are
+// closed with a going away message on Shutdown.
+func (h *Handler) AddWebSocketRoute(route string, fn WebSocketFunc, opts ...WebSocketOptions) error {
+	var o WebSocketOptions
+	if len(opts) > 0 {
+		o = opts[0]
+	}
+	if o.PingInterval <= 0 {
+		o.PingInterval = 30 * time.Second
+	}
+	if o.PongWait <= 0 {
+		o.PongWait = 60 * time.Second
+	}
+	upgrader := websocket.Upgrader{CheckOrigin: o.CheckOrigin}
+
+	return h.AddRoute(route, func(resp http.ResponseWriter, req *http.Request) error {
+		ws, err := upgrader.Upgrade(resp, req, nil)
+		if err != nil {
+			// The upgrader already responded
+			return errors.Wrap(err, "can't upgrade to websocket")
+		}
+		conn := &Conn{
+			Conn:    ws,
+			Request: req,
+			Log:     h.Log.WithFields(Fields{"route": RouteFrom(req), "origin": RealIP(req), "request_id": GetRequestID(req)}),
+		}
+		h.websockets.add(conn)
+		defer h.websockets.remove(conn)
+		defer ws.Close()
+
+		if o.ReadLimit > 0 {
+			ws.SetReadLimit(o.ReadLimit)
+		}
+		ws.SetReadDeadline(time.Now().Add(o.PongWait))
+		ws.SetPongHandler(func(string) error {
+			return ws.SetReadDeadline(time.Now().Add(o.PongWait))
+		})
+		stop := make(chan struct{})
+		defer close(stop)
+		go keepAlive(ws, o.PingInterval, stop)
+
+		conn.Log.Debug("websocket connected")
+		start := time.Now()
+		err = fn(conn)
+		conn.Log.WithFields(Fields{"duration": time.Since(start).String()}).Debug("websocket disconnected")
+		// Connections closed by Shutdown end with a net.ErrClosed
+		if err != nil && !websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) && !errors.Is(err, net.ErrClosed) {
+			return err
+		}
+		return nil
+	})
+}
+
+// keepAlive pings the peer until stop is closed
+func keepAlive(ws *websocket.Conn, every time.Duration, stop chan struct{}) {
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			// WriteControl is safe to call concurrently with the other methods
+			if err := ws.WriteControl(websocket.PingMessage, nil, time.Now().Add(every)); err != nil {
+				return
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+// wsRegistry tracks the open websocket connections
+type wsRegistry struct {
+	mu    sync.Mutex
+	conns map[*Conn]struct{}
+}
+
+func (r *wsRegistry) add(c *Conn) {
+	r.mu.Lock()
+	if r.conns == nil {
+		r.conns = map[*Conn]struct{}{}
+	}
+	r.conns[c] = struct{}{}
+	r.mu.Unlock()
+}
+
+func (r *wsRegistry) remove(c *Conn) {
+	r.mu.Lock()
+	delete(r.conns, c)
+	r.mu.Unlock()
+}
+
+// closeAll sends a going away close message to all the connections and closes them
+func (r *wsRegistry) closeAll() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	msg := websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down")
+	for c := range r.conns {
+		c.WriteControl(websocket.CloseMessage, msg, time.Now().Add(time.Second))
+		c.Close()
+	}
+}
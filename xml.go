@@ -0,0 +1,77 @@
+package hang
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/net/html/charset"
+)
+
+// GetReqXMLData reads the request body and decodes it as XML into data,
+// converting non UTF-8 bodies according to the Content-Type charset or the
+// XML declaration. Like GetReqJSONData it responds on failure.
+func GetReqXMLData(resp http.ResponseWriter, req *http.Request, data interface{}) error {
+	var (
+		body []byte
+		err  error
+		r    io.Reader
+	)
+	body, err = GetReqData(resp, req)
+	if err != nil {
+		return err
+	}
+	r = bytes.NewReader(body)
+	charsetReader := charset.NewReaderLabel
+	if cs := contentCharset(req.Header.Get("Content-Type")); cs != "" && !strings.EqualFold(cs, "utf-8") {
+		r, err = charset.NewReaderLabel(cs, r)
+		if err != nil {
+			err = errors.Wrap(err, "unsupported charset "+cs)
+			// Respond
+			WriteError(resp, req, http.StatusUnsupportedMediaType, err)
+			return err
+		}
+		// Already converted, ignore the encoding in the declaration
+		charsetReader = func(_ string, in io.Reader) (io.Reader, error) { return in, nil }
+	}
+	dec := xml.NewDecoder(r)
+	dec.CharsetReader = charsetReader
+	err = dec.Decode(data)
+	if err != nil {
+		err = errors.Wrap(err, "can't decode input XML")
+		// Respond
+		if resp != nil {
+			WriteError(resp, req, http.StatusBadRequest, err)
+		}
+		return err
+	}
+	return nil
+}
+
+// WriteXML serializes data as XML, with the XML declaration, and writes it
+// with the given status
+func WriteXML(resp http.ResponseWriter, status int, data interface{}) error {
+	b, err := xml.Marshal(data)
+	if err != nil {
+		err = errors.Wrap(err, "can't encode output XML")
+		resp.WriteHeader(http.StatusInternalServerError)
+		return err
+	}
+	resp.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	resp.WriteHeader(status)
+	_, err = resp.Write(append([]byte(xml.Header), b...))
+	return err
+}
+
+// contentCharset returns the charset parameter of a Content-Type
+func contentCharset(contentType string) string {
+	_, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return ""
+	}
+	return params["charset"]
+}